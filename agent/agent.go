@@ -126,6 +126,10 @@ func (agent *Agent) Join() error {
 
 	// joined
 	once.Do(func() {
+		if n := agent.config.AdbSimulator; n > 0 {
+			log.Warnf("agent serving on in-memory adb simulator with %d virtual devices", n)
+			extensions.SetupAdbSimulator(id, n)
+		}
 	})
 
 	// call GC() once
@@ -6,13 +6,17 @@ import (
 	"net/http"
 	"os/exec"
 	"strconv"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
 	"github.com/kr/pty"
 
 	"github.com/bbklab/adbot/agent/extensions"
+	"github.com/bbklab/adbot/pkg/adbot"
 	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/pkg/utils"
 	"github.com/bbklab/adbot/types"
 	"github.com/bbklab/adbot/version"
 )
@@ -226,9 +230,10 @@ func (agent *Agent) listAdbDevices(ctx *httpmux.Context) {
 	ctx.JSON(200, devices)
 }
 
-func (agent *Agent) checkAdbAlipayOrder(ctx *httpmux.Context) {
+func (agent *Agent) checkAdbPayOrder(ctx *httpmux.Context) {
 	var (
 		dvcID   = ctx.Query["device_id"]
+		app     = ctx.Query["app"]
 		orderID = ctx.Query["order_id"]
 	)
 
@@ -236,12 +241,16 @@ func (agent *Agent) checkAdbAlipayOrder(ctx *httpmux.Context) {
 		ctx.BadRequest("device id required")
 		return
 	}
+	if app == "" {
+		ctx.BadRequest("payment app required")
+		return
+	}
 	if orderID == "" {
 		ctx.BadRequest("order id required")
 		return
 	}
 
-	order, err := extensions.CheckAdbAlipayOrder(dvcID, orderID)
+	order, err := extensions.CheckAdbPayOrder(dvcID, app, orderID)
 	if err != nil {
 		ctx.AutoError(err)
 		return
@@ -250,6 +259,121 @@ func (agent *Agent) checkAdbAlipayOrder(ctx *httpmux.Context) {
 	ctx.JSON(200, order)
 }
 
+func (agent *Agent) listAdbPayBills(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		app   = ctx.Query["app"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if app == "" {
+		ctx.BadRequest("payment app required")
+		return
+	}
+
+	var (
+		bills []*adbot.PayOrder
+		err   error
+	)
+	if date := ctx.Query["date"]; date != "" { // all of the bills of the day
+		day, perr := time.ParseInLocation("2006-01-02", date, time.Local)
+		if perr != nil {
+			ctx.BadRequest("date: " + perr.Error())
+			return
+		}
+		bills, err = extensions.ListAdbPayDayBills(dvcID, app, day)
+	} else {
+		bills, err = extensions.ListAdbPayBills(dvcID, app)
+	}
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, bills)
+}
+
+func (agent *Agent) genAdbPayQrCode(ctx *httpmux.Context) {
+	var (
+		dvcID   = ctx.Query["device_id"]
+		app     = ctx.Query["app"]
+		fee, _  = strconv.Atoi(ctx.Query["fee"])
+		comment = ctx.Query["comment"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if app == "" {
+		ctx.BadRequest("payment app required")
+		return
+	}
+	if fee <= 0 {
+		ctx.BadRequest("bad parameter: fee")
+		return
+	}
+	if comment == "" {
+		ctx.BadRequest("comment required")
+		return
+	}
+
+	qrpng, err := extensions.AdbDevicePayQrCode(dvcID, app, fee, comment)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Res.Header().Set("Content-Type", "image/png")
+	ctx.Res.WriteHeader(200)
+	ctx.Res.Write(qrpng)
+}
+
+func (agent *Agent) adbDeviceOpQueue(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+
+	stats, err := extensions.AdbDeviceOpQueue(dvcID)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, stats)
+}
+
+func (agent *Agent) cancelAdbDeviceOp(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		opID  = ctx.Query["op_id"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if opID == "" {
+		ctx.BadRequest("op id required")
+		return
+	}
+
+	if err := extensions.CancelAdbDeviceOp(dvcID, opID); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
 func (agent *Agent) screenCapAdbDevice(ctx *httpmux.Context) {
 	var (
 		dvcID = ctx.Query["device_id"]
@@ -272,15 +396,22 @@ func (agent *Agent) screenCapAdbDevice(ctx *httpmux.Context) {
 
 func (agent *Agent) dumpAdbDeviceUINodes(ctx *httpmux.Context) {
 	var (
-		dvcID = ctx.Query["device_id"]
+		dvcID    = ctx.Query["device_id"]
+		selector = ctx.Query["selector"]
 	)
 
 	if dvcID == "" {
 		ctx.BadRequest("device id required")
 		return
 	}
+	if selector != "" {
+		if _, err := adbot.ParseUISelector(selector); err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+	}
 
-	uinodes, err := extensions.AdbDeviceDumpUINodes(dvcID)
+	uinodes, err := extensions.AdbDeviceDumpUINodes(dvcID, selector)
 	if err != nil {
 		ctx.AutoError(err)
 		return
@@ -289,6 +420,305 @@ func (agent *Agent) dumpAdbDeviceUINodes(ctx *httpmux.Context) {
 	ctx.JSON(200, uinodes)
 }
 
+func (agent *Agent) tailAdbDeviceSysLogs(ctx *httpmux.Context) {
+	var (
+		dvcID  = ctx.Query["device_id"]
+		filter = &adbot.SysLogFilter{
+			Buffers:  utils.SplitNonEmpty(ctx.Query["buffers"], ","),
+			Tags:     utils.SplitNonEmpty(ctx.Query["tags"], ","),
+			Priority: ctx.Query["priority"],
+		}
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if err := filter.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	notifier, ok := ctx.Res.(http.CloseNotifier)
+	if !ok {
+		ctx.InternalServerError("not a http close notifier")
+		return
+	}
+
+	flusher, ok := ctx.Res.(http.Flusher)
+	if !ok {
+		ctx.InternalServerError("not a http flusher")
+		return
+	}
+
+	ch, stopch, err := extensions.TailAdbDeviceSysLogs(dvcID, filter)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	// must: stop the tailer befor page exit
+	go func() {
+		<-notifier.CloseNotify()
+		close(stopch)
+	}()
+
+	// write response header firstly
+	ctx.Res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	ctx.Res.Header().Set("Cache-Control", "no-cache")
+	ctx.Res.WriteHeader(200)
+	flusher.Flush()
+
+	for line := range ch {
+		ctx.Res.Write([]byte(line + "\n"))
+		flusher.Flush()
+	}
+}
+
+// live screen mirror over websocket:
+//  - server -> client: binary message for each jpeg frame, text message for json MirrorEvent (info, error)
+//  - client -> server: text message for json MirrorEvent (tap, swipe, key, text, options)
+func (agent *Agent) mirrorAdbDevice(ctx *httpmux.Context) {
+	var (
+		dvcID       = ctx.Query["device_id"]
+		fps, _      = strconv.ParseFloat(ctx.Query["fps"], 64)
+		quality, _  = strconv.Atoi(ctx.Query["quality"])
+		maxWidth, _ = strconv.Atoi(ctx.Query["max_width"])
+		opts        = &adbot.MirrorOptions{FPS: fps, Quality: quality, MaxWidth: maxWidth}
+		upgrader    = websocket.Upgrader{}
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+
+	if err := opts.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	mirror, err := extensions.AdbDeviceScreenMirror(dvcID, opts)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+	defer mirror.Stop()
+
+	conn, err := upgrader.Upgrade(ctx.Res, ctx.Req, nil)
+	if err != nil {
+		log.Errorln("adb device screen mirror upgrade websocket error:", err)
+		return
+	}
+	defer conn.Close() // must
+
+	log.Infof("adb device %s screen mirror start", dvcID)
+	defer log.Infof("adb device %s screen mirror end", dvcID)
+
+	// note: websocket conn doesn't support concurrent writers
+	var wmux sync.Mutex
+	writeMessage := func(typ int, data []byte) error {
+		wmux.Lock()
+		defer wmux.Unlock()
+		return conn.WriteMessage(typ, data)
+	}
+	writeEvent := func(ev *adbot.MirrorEvent) error {
+		bs, _ := json.Marshal(ev)
+		return writeMessage(websocket.TextMessage, bs)
+	}
+
+	// copying frames to the client
+	go func() {
+		var sent bool
+		for frame := range mirror.Frames() {
+			if err := writeMessage(websocket.BinaryMessage, frame); err != nil {
+				conn.Close() // so the following reading quit
+				return
+			}
+			if !sent { // tell the screen size after the first frame captured
+				writeEvent(mirror.Info())
+				sent = true
+			}
+		}
+	}()
+
+	// reading events from the client
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var ev = new(adbot.MirrorEvent)
+		if err := json.Unmarshal(msg, ev); err != nil {
+			writeEvent(&adbot.MirrorEvent{Type: adbot.MirrorEventError, Message: "invalid event: " + err.Error()})
+			continue
+		}
+
+		if err := mirror.Handle(ev); err != nil {
+			writeEvent(&adbot.MirrorEvent{Type: adbot.MirrorEventError, Message: err.Error()})
+			continue
+		}
+		if ev.Type == adbot.MirrorEventOptions {
+			writeEvent(mirror.Info())
+		}
+	}
+}
+
+// pull the device file, the response body is the raw file content
+func (agent *Agent) pullAdbDeviceFile(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		path  = ctx.Query["path"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if err := adbot.ValidDevicePath(path); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	info, err := extensions.AdbDeviceStatFile(dvcID, path)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	stream, err := extensions.AdbDevicePullFile(dvcID, path)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+	defer stream.Close()
+
+	ctx.Res.Header().Set("Content-Type", "application/octet-stream")
+	ctx.Res.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	ctx.Res.WriteHeader(200)
+	io.Copy(ctx.Res, stream)
+}
+
+// push the device file, the request body is the raw file content
+func (agent *Agent) pushAdbDeviceFile(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		path  = ctx.Query["path"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if err := adbot.ValidDevicePath(path); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	mode, err := adbot.ParseFileMode(ctx.Query["mode"])
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	err = extensions.AdbDevicePushFile(dvcID, path, mode, ctx.Req.Body)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (agent *Agent) listAdbDevicePackages(ctx *httpmux.Context) {
+	var (
+		dvcID         = ctx.Query["device_id"]
+		thirdParty, _ = strconv.ParseBool(ctx.Query["third_party"])
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+
+	pkgs, err := extensions.AdbDeviceListPackages(dvcID, thirdParty)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, pkgs)
+}
+
+func (agent *Agent) getAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		name  = ctx.Query["name"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if err := adbot.ValidPackageName(name); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	pkg, err := extensions.AdbDevicePackageInfo(dvcID, name)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, pkg)
+}
+
+// install the apk, the request body is the raw apk content
+func (agent *Agent) installAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+
+	err := extensions.AdbDeviceInstallPackage(dvcID, ctx.Req.Body)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (agent *Agent) uninstallAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		name  = ctx.Query["name"]
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+	if err := adbot.ValidPackageName(name); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	err := extensions.AdbDeviceUninstallPackage(dvcID, name)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
 func (agent *Agent) clickAdbDevice(ctx *httpmux.Context) {
 	var (
 		dvcID = ctx.Query["device_id"]
@@ -395,3 +825,38 @@ func (agent *Agent) runAdbDeviceCmd(ctx *httpmux.Context) {
 
 	ctx.Text(200, string(bs))
 }
+
+func (agent *Agent) runAdbDeviceFlow(ctx *httpmux.Context) {
+	var (
+		dvcID = ctx.Query["device_id"]
+		req   = new(types.AdbDeviceFlowReq)
+	)
+
+	if dvcID == "" {
+		ctx.BadRequest("device id required")
+		return
+	}
+
+	if err := ctx.Bind(req); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if req.Flow == nil {
+		ctx.BadRequest("flow required")
+		return
+	}
+
+	if err := req.Flow.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	result, err := extensions.RunAdbDeviceFlow(dvcID, req.Flow, req.Vars)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, result)
+}
@@ -1,8 +1,10 @@
 package extensions
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -16,8 +18,38 @@ import (
 var (
 	am   *adbMgr // runtime adb managers
 	amux sync.Mutex
+
+	sim *adbot.Simulator // non-nil if the adb manager serving on the in-memory adb simulator
+
+	defaultPaymentApp = adbot.PaymentAppAlipay // the payment app kept on the top activity while the device idle
+
+	// the device op deadlines by priority
+	adbOpTimeouts = map[adbot.OpPriority]time.Duration{
+		adbot.OpPriorityOrder:     time.Minute * 2,
+		adbot.OpPriorityKeepAlive: time.Second * 30,
+		adbot.OpPriorityDebug:     time.Minute,
+	}
+
+	adbDayBillsTimeout = time.Minute * 10 // scrolling back the bill list of a whole day takes a long time
+	adbInstallTimeout  = time.Minute * 6  // pushing the apk & pm install (bounded by 5m)
 )
 
+// SetupAdbSimulator make the adb manager serving on an in-memory adb simulator
+// with given number of virtual devices instead of the real adb host
+// note: must be called before the adb manager setup
+func SetupAdbSimulator(prefix string, n int) *adbot.Simulator {
+	amux.Lock()
+	defer amux.Unlock()
+
+	if sim == nil {
+		sim = adbot.NewSimulator()
+		for i := 1; i <= n; i++ {
+			sim.AddDevice(fmt.Sprintf("%s-sim-%02d", prefix, i))
+		}
+	}
+	return sim
+}
+
 func setupAdbotMgr() error {
 	amux.Lock()
 	defer amux.Unlock()
@@ -26,7 +58,15 @@ func setupAdbotMgr() error {
 		return nil
 	}
 
-	ah, err := adbot.NewAdb()
+	var (
+		ah  adbot.AdbHandler
+		err error
+	)
+	if sim != nil {
+		ah = sim
+	} else {
+		ah, err = adbot.NewAdb()
+	}
 	if err != nil {
 		return err
 	}
@@ -37,7 +77,7 @@ func setupAdbotMgr() error {
 		reg: routine.NewRegistry(),
 	}
 	go am.watchAllDeviceEvents()
-	go am.watchAllDeviceAlipayActivity()
+	go am.watchAllDevicePayAppActivity()
 
 	return nil
 }
@@ -68,8 +108,8 @@ func (mgr *adbMgr) getDevice(id string) (adbot.AdbDeviceHandler, error) {
 	mgr.dhs[id] = newdh
 
 	// launch new device alipay watcher
-	if !mgr.reg.ExistsRoutine("adb_device_alipay_watcher", id) {
-		go mgr.watchDeviceAlipay(id)
+	if !mgr.reg.ExistsRoutine("adb_device_payorder_watcher", id) {
+		go mgr.watchDevicePayOrders(id)
 	}
 
 	return newdh, nil
@@ -81,7 +121,7 @@ func (mgr *adbMgr) rmDevice(id string) {
 	mgr.Unlock()
 }
 
-func (mgr *adbMgr) watchDeviceAlipay(id string) {
+func (mgr *adbMgr) watchDevicePayOrders(id string) {
 	dvc, err := mgr.getDevice(id)
 	if err != nil {
 		log.Errorln("get adb device handler error", id, err)
@@ -90,16 +130,16 @@ func (mgr *adbMgr) watchDeviceAlipay(id string) {
 	defer mgr.rmDevice(id)
 
 	var (
-		loopName = fmt.Sprintf("device %s alipay order watcher loop", id)
+		loopName = fmt.Sprintf("device %s pay order watcher loop", id)
 	)
 
 	log.Printf("starting %s ...", loopName)
 	defer log.Warnf("stopped %s", loopName)
 
-	mgr.reg.AddRoutine("adb_device_alipay_watcher", id)
-	defer mgr.reg.DelRoutine("adb_device_alipay_watcher", id)
+	mgr.reg.AddRoutine("adb_device_payorder_watcher", id)
+	defer mgr.reg.DelRoutine("adb_device_payorder_watcher", id)
 
-	noopTicker := time.NewTicker(time.Second * 20) // timer to report noop alipay order event
+	noopTicker := time.NewTicker(time.Second * 20) // timer to report noop pay order event
 	defer noopTicker.Stop()
 
 	existTicker := time.NewTicker(time.Second * 5) // timer to check device exists
@@ -116,24 +156,27 @@ func (mgr *adbMgr) watchDeviceAlipay(id string) {
 
 		select {
 		case sysNotify := <-ch:
-			if sysNotify.Source != "com.eg.android.AlipayGphone" {
+			notice := parsePayNotify(dvc, sysNotify)
+			if notice == nil {
 				continue // skip
 			}
 
-			msg = sysNotify.Message
+			msg = notice.Message
 			ev := &adbot.AdbEvent{
 				Serial:  id,
-				Type:    adbot.AdbEventAlipayOrder,
+				Type:    adbot.AdbEventPayOrder,
+				App:     notice.App,
+				Notice:  notice,
 				Message: msg,
 				Time:    time.Now(),
 			}
 			err = reportAdbEvent(ev)
 
 		case <-noopTicker.C:
-			msg = "NOOP ALIPAY EVENT IN CASE OF MISSING SYSNOTIFY"
+			msg = "NOOP PAY ORDER EVENT IN CASE OF MISSING SYSNOTIFY"
 			ev := &adbot.AdbEvent{
 				Serial:  id,
-				Type:    adbot.AdbEventAlipayOrder,
+				Type:    adbot.AdbEventPayOrder,
 				Message: msg,
 				Time:    time.Now(),
 			}
@@ -149,9 +192,9 @@ func (mgr *adbMgr) watchDeviceAlipay(id string) {
 		}
 
 		if err != nil {
-			log.Warnf("%s report alipay order event to master error: %v - [%s]", loopName, err, msg)
+			log.Warnf("%s report pay order event to master error: %v - [%s]", loopName, err, msg)
 		} else {
-			log.Infof("%s report alipay order event to master succeed - [%s]", loopName, msg)
+			log.Infof("%s report pay order event to master succeed - [%s]", loopName, msg)
 		}
 	}
 }
@@ -178,25 +221,25 @@ func (mgr *adbMgr) watchAllDeviceEvents() {
 			log.Infof("report adb device %s event to master succeed - [%s]", ev.Serial, ev.Message)
 		}
 
-		if ev.Type == adbot.AdbEventDeviceAlive { // ensure device alipay watcher running
-			if !mgr.reg.ExistsRoutine("adb_device_alipay_watcher", ev.Serial) {
-				go mgr.watchDeviceAlipay(ev.Serial)
+		if ev.Type == adbot.AdbEventDeviceAlive { // ensure device pay order watcher running
+			if !mgr.reg.ExistsRoutine("adb_device_payorder_watcher", ev.Serial) {
+				go mgr.watchDevicePayOrders(ev.Serial)
 			}
 		}
 	}
 }
 
-// ensure all device's alipay is the top activity
-func (mgr *adbMgr) watchAllDeviceAlipayActivity() {
+// ensure all device's payment app is the top activity
+func (mgr *adbMgr) watchAllDevicePayAppActivity() {
 	var (
-		loopName = fmt.Sprintf("all devices alipay activity watcher loop")
+		loopName = fmt.Sprintf("all devices payment app activity watcher loop")
 	)
 
 	log.Printf("starting %s ...", loopName)
 	defer log.Warnf("stopped %s", loopName)
 
-	mgr.reg.AddRoutine("adb_alipay_activity_watcher", "system")
-	defer mgr.reg.DelRoutine("adb_alipay_activity_watcher", "system")
+	mgr.reg.AddRoutine("adb_payapp_activity_watcher", "system")
+	defer mgr.reg.DelRoutine("adb_payapp_activity_watcher", "system")
 
 	ticker := time.NewTicker(time.Second * 30)
 	defer ticker.Stop()
@@ -216,12 +259,27 @@ func (mgr *adbMgr) watchAllDeviceAlipayActivity() {
 					return
 				}
 
-				if !dvc.IsAwake() {
-					dvc.AwakenScreen()
-				}
-
-				if activity, _ := dvc.CurrentTopActivity(); !strings.Contains(activity, "com.eg.android.AlipayGphone") {
-					dvc.StartAliPay()
+				// queued behind the order ops, give up if the device keeps busy until the deadline
+				err = doAdbDeviceOp(dvc, adbot.OpPriorityKeepAlive, "keepalive", func(ctx context.Context) error {
+					if err := awakenAdbDevice(dvc); err != nil {
+						return err
+					}
+
+					// leave it alone if any payment app is on the top
+					for _, name := range adbot.PaymentApps() {
+						if app, err := dvc.PaymentApp(name); err == nil && app.IsForeground(ctx) {
+							return nil
+						}
+					}
+
+					app, err := dvc.PaymentApp(defaultPaymentApp)
+					if err != nil {
+						return err
+					}
+					return app.Start(ctx)
+				})
+				if err != nil {
+					log.Warnf("%s keep payment app alive on %s error: %v", loopName, id, err)
 				}
 			}(id)
 		}
@@ -229,6 +287,20 @@ func (mgr *adbMgr) watchAllDeviceAlipayActivity() {
 	}
 }
 
+// parse the payment notice from the sys notify by all of registered payment apps
+func parsePayNotify(dvc adbot.AdbDeviceHandler, notify *adbot.AndroidSysNotify) *adbot.PayNotice {
+	for _, name := range adbot.PaymentApps() {
+		app, err := dvc.PaymentApp(name)
+		if err != nil {
+			continue
+		}
+		if notice := app.ParseNotify(notify); notice != nil {
+			return notice
+		}
+	}
+	return nil
+}
+
 func reportAdbEvent(ev *adbot.AdbEvent) error {
 	var (
 		client = GetMasterAPIClient()
@@ -287,8 +359,139 @@ func ListAdbDevices() (map[string]*adbot.AndroidSysInfo, error) {
 	return ret, nil
 }
 
-// CheckAdbAlipayOrder check one alipay order on given adb device
-func CheckAdbAlipayOrder(dvcID, orderID string) (*adbot.AlipayOrder, error) {
+// CheckAdbPayOrder check one order by the payment app on given adb device
+func CheckAdbPayOrder(dvcID, appName, orderID string) (*adbot.PayOrder, error) {
+	dvc, app, err := adbDevicePaymentApp(dvcID, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var order *adbot.PayOrder
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityOrder, appName+".search_order", func(ctx context.Context) (err error) {
+		if err = awakenAdbDevice(dvc); err != nil {
+			return
+		}
+		order, err = app.SearchOrder(ctx, orderID)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ListAdbPayBills list the recent bills of the payment app on given adb device
+func ListAdbPayBills(dvcID, appName string) ([]*adbot.PayOrder, error) {
+	dvc, app, err := adbDevicePaymentApp(dvcID, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var bills []*adbot.PayOrder
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityOrder, appName+".list_bills", func(ctx context.Context) (err error) {
+		if err = awakenAdbDevice(dvc); err != nil {
+			return
+		}
+		bills, err = app.ListBills(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bills, nil
+}
+
+// ListAdbPayDayBills list all of the bills of the given day by the payment app on given adb device
+// note: queued behind the order ops, but once started it holds the device until the scan finished,
+// the scan checks the deadline on every page, so the queued order ops wait at most adbDayBillsTimeout
+func ListAdbPayDayBills(dvcID, appName string, day time.Time) ([]*adbot.PayOrder, error) {
+	dvc, app, err := adbDevicePaymentApp(dvcID, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adbDayBillsTimeout)
+	defer cancel()
+
+	var bills []*adbot.PayOrder
+	err = dvc.DoOp(ctx, adbot.OpPriorityKeepAlive, appName+".list_day_bills", func(ctx context.Context) (err error) {
+		if err = awakenAdbDevice(dvc); err != nil {
+			return
+		}
+		bills, err = adbot.ListDayBills(ctx, app, day)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bills, nil
+}
+
+// AdbDevicePayQrCode generate collect qrcode with given fee & order comment by the payment app on given adb device
+func AdbDevicePayQrCode(dvcID, appName string, fee int, comment string) ([]byte, error) {
+	dvc, app, err := adbDevicePaymentApp(dvcID, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	qrcoder, ok := app.(adbot.PaymentQrCoder)
+	if !ok {
+		return nil, fmt.Errorf("payment app %s doesn't support generating qrcode on device", appName)
+	}
+
+	var qrpng []byte
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityOrder, appName+".gen_qrcode", func(ctx context.Context) (err error) {
+		if err = awakenAdbDevice(dvc); err != nil {
+			return
+		}
+		qrpng, err = qrcoder.GenQrCode(ctx, fee, comment)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return qrpng, nil
+}
+
+func adbDevicePaymentApp(dvcID, appName string) (adbot.AdbDeviceHandler, adbot.PaymentApp, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	app, err := dvc.PaymentApp(appName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dvc, app, nil
+}
+
+func awakenAdbDevice(dvc adbot.AdbDeviceHandler) error {
+	if dvc.IsAwake() {
+		return nil
+	}
+	return dvc.AwakenScreen()
+}
+
+// run the op exclusively on the device op queue with the deadline of the priority
+//
+// note: the op results must be only read while the returned error is nil, the op body
+// should pass the ctx to the device commands, so it gives up once the deadline exceeded
+// or cancelled, the device is still occupied until the op body returned
+func doAdbDeviceOp(dvc adbot.AdbDeviceHandler, prio adbot.OpPriority, name string, fn adbot.OpFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), adbOpTimeouts[prio])
+	defer cancel()
+
+	return dvc.DoOp(ctx, prio, name, fn)
+}
+
+// AdbDeviceOpQueue query the op queue stats of given adb device
+func AdbDeviceOpQueue(dvcID string) (*adbot.OpQueueStats, error) {
 	if err := setupAdbotMgr(); err != nil {
 		return nil, err
 	}
@@ -297,15 +500,20 @@ func CheckAdbAlipayOrder(dvcID, orderID string) (*adbot.AlipayOrder, error) {
 	if err != nil {
 		return nil, err
 	}
+	return dvc.OpQueueStats(), nil
+}
 
-	if !dvc.IsAwake() {
-		err := dvc.AwakenScreen()
-		if err != nil {
-			return nil, err
-		}
+// CancelAdbDeviceOp cancel the pending or running op on given adb device
+func CancelAdbDeviceOp(dvcID, opID string) error {
+	if err := setupAdbotMgr(); err != nil {
+		return err
 	}
 
-	return dvc.AlipaySearchOrder(orderID)
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return err
+	}
+	return dvc.CancelOp(opID)
 }
 
 // AdbDeviceScreenCap take screen cap on given adb device
@@ -318,11 +526,49 @@ func AdbDeviceScreenCap(dvcID string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return dvc.ScreenCap()
+
+	var bs []byte
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "screencap", func(ctx context.Context) (err error) {
+		bs, err = dvc.ScreenCapContext(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// TailAdbDeviceSysLogs follow the system logs of given adb device
+func TailAdbDeviceSysLogs(dvcID string, filter *adbot.SysLogFilter) (<-chan string, chan struct{}, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, stopch := dvc.TailSysLogs(filter)
+	return ch, stopch, nil
+}
+
+// AdbDeviceScreenMirror create a live screen mirror on given adb device
+func AdbDeviceScreenMirror(dvcID string, opts *adbot.MirrorOptions) (*adbot.ScreenMirror, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+
+	return adbot.NewScreenMirror(dvc, opts)
 }
 
-// AdbDeviceDumpUINodes dump current android ui nodes
-func AdbDeviceDumpUINodes(dvcID string) ([]*adbot.AndroidUINode, error) {
+// AdbDeviceDumpUINodes dump current android ui nodes, filtered by the UISelector if given
+func AdbDeviceDumpUINodes(dvcID, selector string) ([]*adbot.AndroidUINode, error) {
 	if err := setupAdbotMgr(); err != nil {
 		return nil, err
 	}
@@ -331,7 +577,24 @@ func AdbDeviceDumpUINodes(dvcID string) ([]*adbot.AndroidUINode, error) {
 	if err != nil {
 		return nil, err
 	}
-	return dvc.DumpCurrentUI()
+
+	var nodes []*adbot.AndroidUINode
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "dump_ui", func(ctx context.Context) (err error) {
+		var sel *adbot.UISelector
+		if selector != "" {
+			if sel, err = adbot.ParseUISelector(selector); err != nil {
+				return
+			}
+		}
+		if nodes, err = dvc.DumpCurrentUIContext(ctx); err == nil && sel != nil {
+			nodes = sel.Find(nodes)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
 }
 
 // AdbDeviceClick click device on give X,Y
@@ -344,7 +607,9 @@ func AdbDeviceClick(dvcID string, x, y int) error {
 	if err != nil {
 		return err
 	}
-	return dvc.Click(x, y)
+	return doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "click", func(context.Context) error {
+		return dvc.Click(x, y)
+	})
 }
 
 // AdbDeviceGoback tap device back key
@@ -357,7 +622,9 @@ func AdbDeviceGoback(dvcID string) error {
 	if err != nil {
 		return err
 	}
-	return dvc.GoBack()
+	return doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "goback", func(context.Context) error {
+		return dvc.GoBack()
+	})
 }
 
 // AdbDeviceGotoHome tap device home key
@@ -370,7 +637,9 @@ func AdbDeviceGotoHome(dvcID string) error {
 	if err != nil {
 		return err
 	}
-	return dvc.GotoHome()
+	return doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "gotohome", func(context.Context) error {
+		return dvc.GotoHome()
+	})
 }
 
 // AdbDeviceReboot reboot given adb device
@@ -385,7 +654,9 @@ func AdbDeviceReboot(dvcID string) error {
 	}
 
 	// reboot
-	err = dvc.Reboot()
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "reboot", func(context.Context) error {
+		return dvc.Reboot()
+	})
 	if err != nil {
 		return err
 	}
@@ -401,6 +672,128 @@ func AdbDeviceReboot(dvcID string) error {
 	return nil
 }
 
+// AdbDeviceStatFile query the file info on given adb device
+func AdbDeviceStatFile(dvcID, path string) (*adbot.AndroidFile, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+	return dvc.StatFile(path)
+}
+
+// AdbDevicePullFile open the file reader on given adb device
+func AdbDevicePullFile(dvcID, path string) (io.ReadCloser, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+	return dvc.PullFile(path)
+}
+
+// AdbDevicePushFile write the file onto given adb device
+func AdbDevicePushFile(dvcID, path string, perm os.FileMode, src io.Reader) error {
+	if err := setupAdbotMgr(); err != nil {
+		return err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return err
+	}
+	return dvc.PushFile(src, path, perm)
+}
+
+// AdbDeviceListPackages list the installed packages on given adb device
+func AdbDeviceListPackages(dvcID string, thirdParty bool) ([]*adbot.AndroidPackage, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+	return dvc.ListPackages(thirdParty)
+}
+
+// AdbDevicePackageInfo query the installed package on given adb device
+func AdbDevicePackageInfo(dvcID, name string) (*adbot.AndroidPackage, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+	return dvc.PackageInfo(name)
+}
+
+// AdbDeviceInstallPackage install or upgrade the apk on given adb device
+func AdbDeviceInstallPackage(dvcID string, apk io.Reader) error {
+	if err := setupAdbotMgr(); err != nil {
+		return err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return err
+	}
+
+	// pushing the large apk & pm install take longer than the other debug ops
+	ctx, cancel := context.WithTimeout(context.Background(), adbInstallTimeout)
+	defer cancel()
+
+	return dvc.DoOp(ctx, adbot.OpPriorityDebug, "install_package", func(ctx context.Context) error {
+		return dvc.InstallPackageContext(ctx, apk)
+	})
+}
+
+// AdbDeviceUninstallPackage uninstall the package on given adb device
+func AdbDeviceUninstallPackage(dvcID, name string) error {
+	if err := setupAdbotMgr(); err != nil {
+		return err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return err
+	}
+	return doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "uninstall_package", func(context.Context) error {
+		return dvc.UninstallPackage(name)
+	})
+}
+
+// RunAdbDeviceFlow run the automation flow on given adb device
+func RunAdbDeviceFlow(dvcID string, flow *adbot.Flow, vars map[string]string) (*adbot.FlowResult, error) {
+	if err := setupAdbotMgr(); err != nil {
+		return nil, err
+	}
+
+	dvc, err := am.getDevice(dvcID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *adbot.FlowResult
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "flow", func(ctx context.Context) error {
+		result = adbot.RunFlow(ctx, dvc, flow, vars)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // RunAdbDeviceCmd run command on device adb device
 func RunAdbDeviceCmd(dvcID, cmd string) ([]byte, error) {
 	if err := setupAdbotMgr(); err != nil {
@@ -420,6 +813,13 @@ func RunAdbDeviceCmd(dvcID, cmd string) ([]byte, error) {
 		return nil, fmt.Errorf("bad command: null")
 	}
 
-	out, err := dvc.Run(command[0], command[1:]...)
-	return []byte(out), err
+	var out string
+	err = doAdbDeviceOp(dvc, adbot.OpPriorityDebug, "exec", func(ctx context.Context) (err error) {
+		out, err = dvc.RunContext(ctx, command[0], command[1:]...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
 }
@@ -27,12 +27,25 @@ func (agent *Agent) setupRoutes(mux *httpmux.Mux) {
 
 	// adb bot
 	mux.GET("/adbot/devices", agent.listAdbDevices)
-	mux.GET("/adbot/alipay_order", agent.checkAdbAlipayOrder)
+	mux.GET("/adbot/pay_order", agent.checkAdbPayOrder)
+	mux.GET("/adbot/pay_bills", agent.listAdbPayBills)
+	mux.GET("/adbot/pay_qrcode", agent.genAdbPayQrCode)
+	mux.GET("/adbot/device/ops", agent.adbDeviceOpQueue)
+	mux.DELETE("/adbot/device/ops", agent.cancelAdbDeviceOp)
 	mux.GET("/adbot/device/screencap", agent.screenCapAdbDevice)
 	mux.GET("/adbot/device/uinodes", agent.dumpAdbDeviceUINodes)
+	mux.GET("/adbot/device/syslogs", agent.tailAdbDeviceSysLogs)
+	mux.GET("/adbot/device/mirror", agent.mirrorAdbDevice) // websocket
 	mux.PATCH("/adbot/device/click", agent.clickAdbDevice)
 	mux.PATCH("/adbot/device/goback", agent.gobackAdbDevice)
 	mux.PATCH("/adbot/device/gotohome", agent.gotoHomeAdbDevice)
 	mux.PATCH("/adbot/device/reboot", agent.rebootAdbDevice)
 	mux.POST("/adbot/device/exec", agent.runAdbDeviceCmd)
+	mux.POST("/adbot/device/flow", agent.runAdbDeviceFlow)
+	mux.GET("/adbot/device/file", agent.pullAdbDeviceFile)
+	mux.PUT("/adbot/device/file", agent.pushAdbDeviceFile)
+	mux.GET("/adbot/device/packages", agent.listAdbDevicePackages)
+	mux.GET("/adbot/device/package", agent.getAdbDevicePackage)
+	mux.POST("/adbot/device/package", agent.installAdbDevicePackage)
+	mux.DELETE("/adbot/device/package", agent.uninstallAdbDevicePackage)
 }
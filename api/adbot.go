@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
@@ -9,8 +11,11 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bbklab/adbot/pkg/adbot"
@@ -215,23 +220,188 @@ func (s *Server) screenCapAdbDevice(ctx *httpmux.Context) {
 	ctx.Res.Write(imgbs)
 }
 
+func (s *Server) tailAdbDeviceSysLogs(ctx *httpmux.Context) {
+	var (
+		dvcid  = ctx.Path["device_id"]
+		filter = &adbot.SysLogFilter{
+			Buffers:  utils.SplitNonEmpty(ctx.Query["buffers"], ","),
+			Tags:     utils.SplitNonEmpty(ctx.Query["tags"], ","),
+			Priority: ctx.Query["priority"],
+		}
+	)
+
+	if err := filter.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	notifier, ok := ctx.Res.(http.CloseNotifier)
+	if !ok {
+		ctx.InternalServerError("not a http close notifier")
+		return
+	}
+
+	flusher, ok := ctx.Res.(http.Flusher)
+	if !ok {
+		ctx.InternalServerError("not a http flusher")
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	// obtain a node adb device live stream system logs
+	stream, err := scheduler.DoNodeTailAdbDeviceSysLogs(dvc.NodeID, dvc.ID, filter)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+	defer stream.Close()
+
+	// must: close the stream befor page exit
+	// to prevent fd & goroutine leaks
+	go func() {
+		<-notifier.CloseNotify()
+		stream.Close()
+	}()
+
+	// write response header firstly, note: the headers must be set before the status code
+	ctx.Res.Header().Set("Content-Type", "text/event-stream")
+	ctx.Res.Header().Set("Cache-Control", "no-cache")
+	ctx.Res.WriteHeader(200)
+	ctx.Res.Write(nil)
+	flusher.Flush()
+
+	// write each system log line to the client with sse format
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		ctx.Res.Write([]byte(fmt.Sprintf("event: syslog\ndata: %s\n\n", scanner.Text())))
+		flusher.Flush()
+	}
+}
+
+// live screen mirror over websocket, proxy between the client and the node
+// note: the input events will be rejected while the device is not idle
+func (s *Server) mirrorAdbDevice(ctx *httpmux.Context) {
+	var (
+		dvcid       = ctx.Path["device_id"]
+		fps, _      = strconv.ParseFloat(ctx.Query["fps"], 64)
+		quality, _  = strconv.Atoi(ctx.Query["quality"])
+		maxWidth, _ = strconv.Atoi(ctx.Query["max_width"])
+		opts        = &adbot.MirrorOptions{FPS: fps, Quality: quality, MaxWidth: maxWidth}
+		upgrader    = websocket.Upgrader{}
+	)
+
+	if err := opts.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	// obtain the node adb device screen mirror ws connection
+	nodeConn, err := scheduler.DialNodeAdbDeviceMirror(dvc.NodeID, dvc.ID, opts)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+	defer nodeConn.Close() // must
+
+	// obtain ws connection of client
+	wsConn, err := upgrader.Upgrade(ctx.Res, ctx.Req, nil)
+	if err != nil {
+		log.Errorln("adb device screen mirror upgrade websocket error:", err)
+		return
+	}
+	defer wsConn.Close() // must
+
+	// note: websocket conn doesn't support concurrent writers
+	var wmux sync.Mutex
+	writeClient := func(typ int, data []byte) error {
+		wmux.Lock()
+		defer wmux.Unlock()
+		return wsConn.WriteMessage(typ, data)
+	}
+
+	// copying frames & events from the node to the client
+	go func() {
+		defer wsConn.Close() // so the following reading quit
+		for {
+			typ, msg, err := nodeConn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := writeClient(typ, msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	// copying events from the client to the node
+	for {
+		typ, msg, err := wsConn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var ev = new(adbot.MirrorEvent)
+		if err := json.Unmarshal(msg, ev); err == nil && ev.IsInput() {
+			// ensure device idle, the device status may changed during the mirror session
+			current, err := store.DB().GetAdbDevice(dvc.ID)
+			if err == nil {
+				err = scheduler.EnsureAdbDeviceIdle(current)
+			}
+			if err != nil {
+				bs, _ := json.Marshal(&adbot.MirrorEvent{Type: adbot.MirrorEventError, Message: "device busy: " + err.Error()})
+				writeClient(websocket.TextMessage, bs)
+				continue
+			}
+		}
+
+		if err := nodeConn.WriteMessage(typ, msg); err != nil {
+			return
+		}
+	}
+}
+
 func (s *Server) dumpAdbDeviceUINodes(ctx *httpmux.Context) {
 	var (
-		dvcid = ctx.Path["device_id"]
+		dvcid    = ctx.Path["device_id"]
+		selector = ctx.Query["selector"]
 	)
 
+	if selector != "" {
+		if _, err := adbot.ParseUISelector(selector); err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+	}
+
 	dvc, err := store.DB().GetAdbDevice(dvcid)
 	if err != nil {
 		ctx.AutoError(err)
 		return
 	}
 
-	uinodes, err := scheduler.DoNodeDumpUIAdbDevice(dvc.NodeID, dvc.ID)
+	uinodes, err := scheduler.DoNodeDumpUIAdbDevice(dvc.NodeID, dvc.ID, selector)
 	if err != nil {
 		ctx.AutoError(err)
 		return
 	}
 
+	// return all of the matched nodes if the selector given
+	if selector != "" {
+		ctx.JSON(200, uinodes)
+		return
+	}
+
 	var idx int
 	for _, node := range uinodes {
 		if node.Text != "" || node.ContentDesc != "" {
@@ -244,6 +414,45 @@ func (s *Server) dumpAdbDeviceUINodes(ctx *httpmux.Context) {
 	ctx.JSON(200, uinodes)
 }
 
+func (s *Server) adbDeviceOpQueue(ctx *httpmux.Context) {
+	dvcid := ctx.Path["device_id"]
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	stats, err := scheduler.DoNodeAdbDeviceOpQueue(dvc.NodeID, dvc.ID)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, stats)
+}
+
+func (s *Server) cancelAdbDeviceOp(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		opid  = ctx.Path["op_id"]
+	)
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	err = scheduler.DoNodeCancelAdbDeviceOp(dvc.NodeID, dvc.ID, opid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
 func (s *Server) clickAdbDevice(ctx *httpmux.Context) {
 	var (
 		dvcid = ctx.Path["device_id"]
@@ -560,6 +769,85 @@ func (s *Server) revokeAdbDeviceAlipay(ctx *httpmux.Context) {
 	ctx.Status(200)
 }
 
+func (s *Server) bindAdbDeviceWxpay(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		wxpay = new(types.WxpayAccount)
+	)
+
+	// obtain new wxpay account
+	if err := ctx.Bind(wxpay); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if err := wxpay.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if wxpay := dvc.Wxpay; wxpay != nil {
+		ctx.Conflict(fmt.Errorf("device already bind wxpay account %s", wxpay.Username))
+		return
+	}
+
+	// ensure this wxpay account not binded to other device
+	devices, _ := store.DB().ListAdbDevices(nil, nil)
+	for _, device := range devices {
+		if device.Wxpay != nil && device.Wxpay.WxID == wxpay.WxID {
+			ctx.Conflict(fmt.Errorf("this wxpay account already binded to device %s", device.ID))
+			return
+		}
+	}
+
+	err = scheduler.MemoAdbDeviceWxpay(dvc.ID, wxpay)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) revokeAdbDeviceWxpay(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+	)
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if wxpay := dvc.Wxpay; wxpay == nil {
+		ctx.Status(204)
+		return
+	}
+
+	// ensure device idle
+	err = scheduler.EnsureAdbDeviceIdle(dvc)
+	if err != nil {
+		ctx.Locked(err)
+		return
+	}
+
+	// revoke set nil
+	err = scheduler.MemoAdbDeviceWxpay(dvc.ID, nil)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
 func (s *Server) verifyAdbDevice(ctx *httpmux.Context) {
 	var (
 		dvcid  = ctx.Path["device_id"]
@@ -639,7 +927,9 @@ func (s *Server) rmAdbDevice(ctx *httpmux.Context) {
 // adb orders
 //
 
-func (s *Server) listAdbOrders(ctx *httpmux.Context) {
+// build the adb orders db query by the request query parameters,
+// shared by the orders listing, export & settlement reports
+func adbOrdersQuery(ctx *httpmux.Context) (bson.M, time.Time, time.Time, error) {
 	var (
 		search     = ctx.Query["search"] // search id or out_order_id
 		orderID    = ctx.Query["order_id"]
@@ -647,6 +937,7 @@ func (s *Server) listAdbOrders(ctx *httpmux.Context) {
 		status     = ctx.Query["status"]
 		cbstatus   = ctx.Query["cbstatus"]
 		device     = ctx.Query["device_id"]
+		merchant   = ctx.Query["merchant_id"]
 		startAt    = ctx.Query["start_at"]
 		endAt      = ctx.Query["end_at"]
 		query      = bson.M{}
@@ -671,6 +962,9 @@ func (s *Server) listAdbOrders(ctx *httpmux.Context) {
 	if device != "" {
 		query["device_id"] = device
 	}
+	if merchant != "" {
+		query["merchant_id"] = scheduler.MerchantAdbOrdersFilter(merchant)
+	}
 
 	var (
 		startTime time.Time
@@ -680,15 +974,13 @@ func (s *Server) listAdbOrders(ctx *httpmux.Context) {
 	if startAt != "" {
 		startTime, err = time.Parse(time.RFC3339, startAt)
 		if err != nil {
-			ctx.BadRequest(err)
-			return
+			return nil, time.Time{}, time.Time{}, err
 		}
 	}
 	if endAt != "" {
 		endTime, err = time.Parse(time.RFC3339, endAt)
 		if err != nil {
-			ctx.BadRequest(err)
-			return
+			return nil, time.Time{}, time.Time{}, err
 		}
 	}
 	if !startTime.IsZero() && !endTime.IsZero() {
@@ -706,6 +998,16 @@ func (s *Server) listAdbOrders(ctx *httpmux.Context) {
 		query["created_at"] = bson.M{"$lt": endTime}
 	}
 
+	return query, startTime, endTime, nil
+}
+
+func (s *Server) listAdbOrders(ctx *httpmux.Context) {
+	query, _, _, err := adbOrdersQuery(ctx)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
 	// db query
 	orders, err := store.DB().ListAdbOrders(getPager(ctx), query)
 	if err != nil {
@@ -715,6 +1017,7 @@ func (s *Server) listAdbOrders(ctx *httpmux.Context) {
 
 	wraps := make([]*types.AdbOrderWrapper, len(orders))
 	for idx, order := range orders {
+		order.Events = nil // only shown by the single order inspection
 		wrap := s.wrapAdbOrder(order)
 		wraps[idx] = wrap
 	}
@@ -756,22 +1059,123 @@ func (s *Server) reCallbackAdbOrder(ctx *httpmux.Context) {
 	}
 
 	if order.CallbackStatus == types.AdbOrderCallbackStatusOngoing {
-		ctx.Conflict("another order callback ongoing")
+		ctx.Conflict("another order callback ongoing in the delivery queue")
 		return
 	}
 
-	scheduler.MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusOngoing)
-	err = scheduler.SendAdbOrderCallback(order.ID, nil) // send once, no retry
+	if order.Status != types.AdbOrderStatusPaid {
+		ctx.Conflict("can't re-callback the un-paid adb order, current status: " + order.Status)
+		return
+	}
+
+	err = scheduler.ReCallbackAdbOrder(order) // send once, no retry
 	if err != nil {
 		ctx.AutoError(err)
-		scheduler.MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusError) // see callback history
 		return
 	}
 
-	scheduler.MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusSucceed)
 	ctx.Status(200)
 }
 
+func (s *Server) overrideAdbOrder(ctx *httpmux.Context) {
+	var (
+		id     = ctx.Path["order_id"]
+		userID = ctx.GetKey("USER_ID").(string)
+		req    = new(types.AdbOrderOverrideReq)
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	user, err := store.DB().GetUser(userID)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	override, err := scheduler.OverrideAdbOrder(id, req, user.ID, user.Name)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, override)
+}
+
+func (s *Server) listAdbOrderOverrides(ctx *httpmux.Context) {
+	query := bson.M{}
+	if merchant := ctx.Query["merchant_id"]; merchant != "" {
+		query["merchant_id"] = scheduler.MerchantAdbOrdersFilter(merchant)
+	}
+	if dvc := ctx.Query["device_id"]; dvc != "" {
+		query["device_id"] = dvc
+	}
+
+	overrides, err := scheduler.ListAdbOrderOverrides(query, ctx.Query["operator"], ctx.Query["action"])
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Res.Header().Set("Total-Records", strconv.Itoa(len(overrides)))
+	ctx.JSON(200, overrides)
+}
+
+func (s *Server) listDeadAdbOrderCallbacks(ctx *httpmux.Context) {
+	query := bson.M{"callback_status": bson.M{"$in": types.AdbOrderCallbackDeadStatuses}}
+	if merchant := ctx.Query["merchant_id"]; merchant != "" {
+		query["merchant_id"] = scheduler.MerchantAdbOrdersFilter(merchant)
+	}
+
+	orders, err := store.DB().ListAdbOrders(getPager(ctx), query)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	wraps := make([]*types.AdbOrderWrapper, len(orders))
+	for idx, order := range orders {
+		order.Events = nil // only shown by the single order inspection
+		wraps[idx] = s.wrapAdbOrder(order)
+	}
+
+	n, _ := store.DB().CountAdbOrders(query)
+	ctx.Res.Header().Set("Total-Records", strconv.Itoa(n))
+	ctx.JSON(200, wraps)
+}
+
+func (s *Server) replayAdbOrderCallbacks(ctx *httpmux.Context) {
+	var (
+		all, _ = strconv.ParseBool(ctx.Query["all"])
+		ids    []string
+	)
+	if !all {
+		if err := ctx.Bind(&ids); err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+		if len(ids) == 0 {
+			ctx.BadRequest("at least one order id required")
+			return
+		}
+	}
+
+	replayed, err := scheduler.ReplayAdbOrderCallbacks(all, ids)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, replayed)
+}
+
 //
 // public api docs
 //
@@ -901,14 +1305,9 @@ func (s *Server) wrapAdbDevice(dvc *types.AdbDevice) *types.AdbDeviceWrapper {
 	monthStartAt, _ := utils.CurrMonth()
 	wrap.RecentAdbOrders.Month = scheduler.CountAdbOrdersByStatus(bson.M{"device_id": dvc.ID, "created_at": bson.M{"$gt": monthStartAt}})
 
-	// today paid rate %
-	today := wrap.RecentAdbOrders.Today
-	paid, pending, timeout := today.Paid, today.Pending, today.Timeout
-	total := paid + pending + timeout
-	if total == 0 {
-		wrap.TodayPaidRate = float64(0)
-	} else {
-		wrap.TodayPaidRate = math.Round(float64(paid*100) / float64(total))
+	// today paid rate %, by the daily rollup of the device
+	if stat := scheduler.AdbDeviceTodayStats(dvc.ID); stat != nil {
+		wrap.TodayPaidRate = math.Round(stat.PaidRate * 100)
 	}
 
 	return wrap
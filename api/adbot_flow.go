@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb flows
+//
+
+var (
+	maxAdbFlowSize int64 = 1024 * 1024
+)
+
+func (s *Server) listAdbFlows(ctx *httpmux.Context) {
+	var (
+		search = ctx.Query["search"] // name regex search
+		query  = bson.M{}
+	)
+
+	if search != "" {
+		query["name"] = bson.M{"$regex": bson.RegEx{Pattern: search}}
+	}
+
+	flows, err := store.DB().ListAdbFlows(getPager(ctx), query)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	n := store.DB().CountAdbFlows(query)
+	ctx.Res.Header().Set("Total-Records", strconv.Itoa(n))
+	ctx.JSON(200, flows)
+}
+
+func (s *Server) getAdbFlow(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["flow_id"]
+	)
+
+	flow, err := store.DB().GetAdbFlow(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, flow)
+}
+
+// the request body is the yaml or json flow document
+func (s *Server) addAdbFlow(ctx *httpmux.Context) {
+	content, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, maxAdbFlowSize+1))
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dbflow, err := types.NewAdbFlow(content)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if _, err := store.DB().GetAdbFlow(dbflow.Name); err == nil {
+		ctx.Conflict(errors.New("flow name already exists"))
+		return
+	}
+
+	dbflow.ID = utils.RandomString(16)
+	dbflow.CreatedAt = time.Now()
+	dbflow.UpdatedAt = time.Now()
+
+	if err := store.DB().AddAdbFlow(dbflow); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(201, dbflow)
+}
+
+// the request body is the yaml or json flow document
+func (s *Server) updateAdbFlow(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["flow_id"]
+	)
+
+	current, err := store.DB().GetAdbFlow(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, maxAdbFlowSize+1))
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dbflow, err := types.NewAdbFlow(content)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if dbflow.Name != current.Name {
+		if _, err := store.DB().GetAdbFlow(dbflow.Name); err == nil {
+			ctx.Conflict(errors.New("flow name already exists"))
+			return
+		}
+	}
+
+	setUpdator := bson.M{
+		"name":       dbflow.Name,
+		"desc":       dbflow.Desc,
+		"content":    dbflow.Content,
+		"num_steps":  dbflow.NumSteps,
+		"updated_at": time.Now(),
+	}
+	if err := store.DB().UpdateAdbFlow(current.ID, bson.M{"$set": setUpdator}); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	updated, _ := store.DB().GetAdbFlow(current.ID)
+	ctx.JSON(200, updated)
+}
+
+func (s *Server) rmAdbFlow(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["flow_id"]
+	)
+
+	flow, err := store.DB().GetAdbFlow(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if err := store.DB().RemoveAdbFlow(flow.ID); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) runAdbFlow(ctx *httpmux.Context) {
+	var (
+		id  = ctx.Path["flow_id"]
+		req = new(types.AdbFlowRunReq)
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dbflow, err := store.DB().GetAdbFlow(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	flow, err := dbflow.Flow()
+	if err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
+
+	results, err := scheduler.RunAdbFlow(flow, req)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, results)
+}
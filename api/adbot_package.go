@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb device files & packages
+//
+
+var (
+	maxAdbPackageSize int64 = 512 * 1024 * 1024
+)
+
+func (s *Server) pullAdbDeviceFile(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		file  = ctx.Query["path"]
+	)
+
+	if err := adbot.ValidDevicePath(file); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	stream, size, err := scheduler.DoNodePullAdbDeviceFile(dvc.NodeID, dvc.ID, file)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+	defer stream.Close()
+
+	ctx.Res.Header().Set("Content-Type", "application/octet-stream")
+	ctx.Res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(file)))
+	if size >= 0 {
+		ctx.Res.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	ctx.Res.WriteHeader(200)
+	io.Copy(ctx.Res, stream)
+}
+
+// the request body is the raw file content
+func (s *Server) pushAdbDeviceFile(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		file  = ctx.Query["path"]
+	)
+
+	if err := adbot.ValidDevicePath(file); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	mode, err := adbot.ParseFileMode(ctx.Query["mode"])
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	err = scheduler.DoNodePushAdbDeviceFile(dvc.NodeID, dvc.ID, file, mode, ctx.Req.Body)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) listAdbDevicePackages(ctx *httpmux.Context) {
+	var (
+		dvcid         = ctx.Path["device_id"]
+		thirdParty, _ = strconv.ParseBool(ctx.Query["third_party"])
+	)
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	pkgs, err := scheduler.DoNodeListAdbDevicePackages(dvc.NodeID, dvc.ID, thirdParty)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, pkgs)
+}
+
+func (s *Server) getAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		name  = ctx.Path["package"]
+	)
+
+	if err := adbot.ValidPackageName(name); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	pkg, err := scheduler.DoNodeAdbDevicePackageInfo(dvc.NodeID, dvc.ID, name)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, pkg)
+}
+
+// the request body is the raw apk content
+func (s *Server) installAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+	)
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	// ensure device idle
+	err = scheduler.EnsureAdbDeviceIdle(dvc)
+	if err != nil {
+		ctx.Locked(err)
+		return
+	}
+
+	err = scheduler.DoNodeInstallAdbDevicePackage(dvc.NodeID, dvc.ID, io.LimitReader(ctx.Req.Body, maxAdbPackageSize))
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) uninstallAdbDevicePackage(ctx *httpmux.Context) {
+	var (
+		dvcid = ctx.Path["device_id"]
+		name  = ctx.Path["package"]
+	)
+
+	if err := adbot.ValidPackageName(name); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	dvc, err := store.DB().GetAdbDevice(dvcid)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	// ensure device idle
+	err = scheduler.EnsureAdbDeviceIdle(dvc)
+	if err != nil {
+		ctx.Locked(err)
+		return
+	}
+
+	err = scheduler.DoNodeUninstallAdbDevicePackage(dvc.NodeID, dvc.ID, name)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+// install the apk onto all of online adb devices of the label-selected nodes,
+// the request body is the raw apk content, the response is the progress of
+// each device with SSE format
+func (s *Server) rolloutAdbPackage(ctx *httpmux.Context) {
+	var (
+		labels         = ctx.Query["labels"] // key1=val1,key2=val2,key3=val3...
+		concurrency, _ = strconv.Atoi(ctx.Query["concurrency"])
+		req            = &types.AdbPackageRolloutReq{
+			Labels:      make(map[string]string),
+			Package:     ctx.Query["package"],
+			Concurrency: concurrency,
+		}
+	)
+
+	for _, pair := range strings.Split(labels, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			req.Labels[kv[0]] = kv[1]
+		}
+	}
+
+	if err := req.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	flusher, ok := ctx.Res.(http.Flusher)
+	if !ok {
+		ctx.InternalServerError("not a http flusher")
+		return
+	}
+
+	// save the apk into the temp file, so it could be read by each device
+	tmpfile, err := ioutil.TempFile("", "adbot-apk-")
+	if err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
+	defer os.Remove(tmpfile.Name())
+
+	n, err := io.Copy(tmpfile, io.LimitReader(ctx.Req.Body, maxAdbPackageSize+1))
+	tmpfile.Close()
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+	if n == 0 {
+		ctx.BadRequest("apk content required")
+		return
+	}
+	if n > maxAdbPackageSize {
+		ctx.BadRequest(fmt.Sprintf("apk size must less than %d bytes", maxAdbPackageSize))
+		return
+	}
+
+	var started bool
+	err = scheduler.RolloutAdbPackage(tmpfile.Name(), req, func(p *types.AdbPackageRolloutProgress) {
+		if !started { // write response header firstly
+			ctx.Res.Header().Set("Content-Type", "text/event-stream")
+			ctx.Res.Header().Set("Cache-Control", "no-cache")
+			ctx.Res.WriteHeader(200)
+			started = true
+		}
+		bs, _ := json.Marshal(p)
+		ctx.Res.Write([]byte(fmt.Sprintf("event: progress\ndata: %s\n\n", bs)))
+		flusher.Flush()
+	})
+	if err != nil { // failed before any progress
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Res.Write([]byte("event: done\ndata: \n\n"))
+	flusher.Flush()
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// hosted cashier page
+//  - public, the per-order page & status stream are protected by the order cashier token
+//  - the page shows the qrcode, payable amount and countdown, driven by the status stream,
+//    and redirects to the merchant return url after the order done
+//
+
+var (
+	cashierPollInterval = time.Second * 5 // re-check the order status in case of the missing events, eg: changed on another master
+	cashierRedirectWait = time.Second * 3 // show the final status for a while before redirecting
+)
+
+// the hosted cashier page of the adb order
+func (s *Server) cashierPage(ctx *httpmux.Context) {
+	order, err := cashierOrder(ctx)
+	if err != nil {
+		ctx.NotFound(err)
+		return
+	}
+
+	ctx.Res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Res.Header().Set("Cache-Control", "no-store")
+	ctx.Res.WriteHeader(200)
+	renderCashierPage(ctx.Res, cashierLang(ctx), order)
+}
+
+// the status stream of the adb order with sse format, the current status is sent at once,
+// and the stream ends after the order done
+func (s *Server) cashierEvents(ctx *httpmux.Context) {
+	order, err := cashierOrder(ctx)
+	if err != nil {
+		ctx.NotFound(err)
+		return
+	}
+
+	notifier, ok := ctx.Res.(http.CloseNotifier)
+	if !ok {
+		ctx.InternalServerError("not a http close notifier")
+		return
+	}
+
+	flusher, ok := ctx.Res.(http.Flusher)
+	if !ok {
+		ctx.InternalServerError("not a http flusher")
+		return
+	}
+
+	// subscribe before sending the current status, so no status changes are missed
+	sub := scheduler.SubscribeAdbOrderStatusEvents(order.ID)
+	defer scheduler.EvictAdbOrderStatusEvents(sub)
+
+	ctx.Res.Header().Set("Content-Type", "text/event-stream")
+	ctx.Res.Header().Set("Cache-Control", "no-cache")
+	ctx.Res.WriteHeader(200)
+
+	ticker := time.NewTicker(cashierPollInterval)
+	defer ticker.Stop()
+
+	var (
+		closed = notifier.CloseNotify()
+		status string
+	)
+	for {
+		if order.Status != status {
+			status = order.Status
+			ctx.Res.Write(cashierStatusEvent(order).Format())
+			flusher.Flush()
+		}
+		if status != types.AdbOrderStatusPending {
+			return // order done
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-sub:
+		case <-ticker.C:
+		}
+
+		if order, err = store.DB().GetAdbOrder(order.ID); err != nil {
+			return
+		}
+	}
+}
+
+// lookup the adb order of the cashier request and verify the cashier token,
+// all of the failures are the same not found to avoid probing the order ids
+func cashierOrder(ctx *httpmux.Context) (*types.AdbOrder, error) {
+	errNotFound := errors.New("adb order not found")
+
+	order, err := store.DB().GetAdbOrder(ctx.Path["order_id"])
+	if err != nil {
+		return nil, errNotFound
+	}
+	if order.CashierToken == "" || subtle.ConstantTimeCompare([]byte(order.CashierToken), []byte(ctx.Query["token"])) != 1 {
+		return nil, errNotFound
+	}
+	return order, nil
+}
+
+// genCashierURL return the hosted cashier page url of the adb order, under the base url if
+// configured, otherwise under the paygate request host
+func genCashierURL(req *http.Request, base string, order *types.AdbOrder) string {
+	if base == "" {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" { // behind the reverse proxy
+			scheme = proto
+		}
+		base = scheme + "://" + req.Host
+	}
+	return fmt.Sprintf("%s%s/cashier/%s?token=%s", strings.TrimSuffix(base, "/"), APIPREFIX, order.ID, order.CashierToken)
+}
+
+// the configured cashier base url, empty means by the paygate request host
+func cashierBaseURL() string {
+	settings, err := store.DB().GetSettings()
+	if err != nil {
+		return ""
+	}
+	return settings.CashierBaseURL
+}
+
+// the merchant return url of the done adb order with the order id, out order id & status appended,
+// empty if the order is still pending or the return url not provided
+//
+// note: the appended parameters are not signed, the merchant should query the order status
+func cashierReturnURL(order *types.AdbOrder) string {
+	if order.ReturnURL == "" || order.Status == types.AdbOrderStatusPending {
+		return ""
+	}
+
+	u, err := url.Parse(order.ReturnURL)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	query.Set("order_id", order.ID)
+	query.Set("out_order_id", order.OutOrderID)
+	query.Set("status", order.Status)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// the current status event of the adb order
+func cashierStatusEvent(order *types.AdbOrder) *types.AdbOrderStatusEvent {
+	return &types.AdbOrderStatusEvent{
+		OrderID:   order.ID,
+		Status:    order.Status,
+		ExpireAt:  order.Deadline(),
+		ReturnURL: cashierReturnURL(order),
+		Time:      time.Now(),
+	}
+}
+
+// the cashier page language by the `lang` query parameter, or by the Accept-Language header
+func cashierLang(ctx *httpmux.Context) language.Tag {
+	switch lang := strings.ToLower(ctx.Query["lang"]); {
+	case strings.HasPrefix(lang, "zh"):
+		return language.Chinese
+	case strings.HasPrefix(lang, "en"):
+		return language.English
+	}
+	return getLang(ctx)
+}
+
+// the cashier page texts of one language
+type cashierText struct {
+	Title       string
+	ScanAlipay  string
+	ScanWxpay   string
+	Amount      string
+	ExactAmount string
+	OrderID     string
+	Remaining   string
+	Redirecting string
+	Statuses    map[string]string // by the order status
+}
+
+var cashierTexts = map[language.Tag]*cashierText{
+	language.English: {
+		Title:       "Cashier",
+		ScanAlipay:  "Scan the QR code with Alipay to pay",
+		ScanWxpay:   "Scan the QR code with WeChat to pay",
+		Amount:      "Amount",
+		ExactAmount: "Please pay the exact amount, otherwise the payment can't be confirmed",
+		OrderID:     "Order",
+		Remaining:   "Time remaining",
+		Redirecting: "Returning to the merchant ...",
+		Statuses: map[string]string{
+			types.AdbOrderStatusPending:          "Waiting for payment",
+			types.AdbOrderStatusPaid:             "Payment succeeded",
+			types.AdbOrderStatusTimeout:          "Order expired",
+			types.AdbOrderStatusClosed:           "Order closed",
+			types.AdbOrderStatusPaidAfterTimeout: "Paid after the order expired, please contact the merchant",
+		},
+	},
+	language.Chinese: {
+		Title:       "收银台",
+		ScanAlipay:  "请使用支付宝扫码支付",
+		ScanWxpay:   "请使用微信扫码支付",
+		Amount:      "支付金额",
+		ExactAmount: "请按显示金额准确付款，否则无法确认到账",
+		OrderID:     "订单号",
+		Remaining:   "剩余时间",
+		Redirecting: "正在返回商户 ...",
+		Statuses: map[string]string{
+			types.AdbOrderStatusPending:          "等待支付",
+			types.AdbOrderStatusPaid:             "支付成功",
+			types.AdbOrderStatusTimeout:          "订单已超时",
+			types.AdbOrderStatusClosed:           "订单已关闭",
+			types.AdbOrderStatusPaidAfterTimeout: "订单超时后到账，请联系商户处理",
+		},
+	},
+}
+
+// the cashier page template data
+type cashierPageData struct {
+	Lang       string
+	Text       *cashierText
+	Scan       string
+	Order      *types.AdbOrder
+	QRImage    template.URL // data uri of the qrcode png
+	PayFeeYuan string
+	Status     string // the current status text
+	ExpireAt   int64  // unix milliseconds
+	EventsURL  string
+	RedirectMS int64
+}
+
+// render the cashier page of the adb order by the language
+func renderCashierPage(w io.Writer, lang language.Tag, order *types.AdbOrder) error {
+	text, ok := cashierTexts[lang]
+	if !ok {
+		lang, text = language.English, cashierTexts[language.English]
+	}
+
+	data := &cashierPageData{
+		Lang:       lang.String(),
+		Text:       text,
+		Scan:       text.ScanAlipay,
+		Order:      order,
+		PayFeeYuan: fmt.Sprintf("%0.2f", float64(order.Payable())/float64(100)),
+		Status:     text.Statuses[order.Status],
+		ExpireAt:   order.Deadline().UnixNano() / int64(time.Millisecond),
+		EventsURL:  fmt.Sprintf("%s/cashier/%s/events?token=%s", APIPREFIX, order.ID, order.CashierToken),
+		RedirectMS: int64(cashierRedirectWait / time.Millisecond),
+	}
+	if order.QRType == types.QRCodeTypeWxpay {
+		data.Scan = text.ScanWxpay
+	}
+	if len(order.QRCode) > 0 {
+		data.QRImage = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(order.QRCode))
+	}
+
+	return cashierTemplate.Execute(w, data)
+}
+
+var cashierTemplate = template.Must(template.New("cashier").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Text.Title}}</title>
+<style>
+body { margin: 0; background: #f5f5f5; font-family: -apple-system, "Helvetica Neue", Arial, "PingFang SC", "Microsoft YaHei", sans-serif; color: #333; }
+.box { max-width: 360px; margin: 24px auto; padding: 24px; background: #fff; border-radius: 8px; text-align: center; }
+.amount { font-size: 36px; font-weight: bold; margin: 8px 0; }
+.tips { font-size: 13px; color: #e4393c; }
+.qr img { width: 240px; height: 240px; margin: 16px 0; }
+.qr.done img { opacity: 0.1; }
+.status { font-size: 18px; margin: 8px 0; }
+.muted { font-size: 13px; color: #999; }
+</style>
+</head>
+<body>
+<div class="box">
+  <div class="muted">{{.Text.Amount}}</div>
+  <div class="amount">&yen;{{.PayFeeYuan}}</div>
+  <div class="tips">{{.Text.ExactAmount}}</div>
+  <div class="qr" id="qr">{{if .QRImage}}<img src="{{.QRImage}}" alt="QR">{{end}}</div>
+  <div>{{.Scan}}</div>
+  <div class="status" id="status">{{.Status}}</div>
+  <div class="muted" id="countdown">{{.Text.Remaining}} <span id="remaining"></span></div>
+  <div class="muted">{{.Text.OrderID}}: {{.Order.OutOrderID}}</div>
+</div>
+<script>
+(function() {
+  var statuses = {{.Text.Statuses}}, redirecting = {{.Text.Redirecting}};
+  var expireAt = {{.ExpireAt}}, done = false, timer;
+
+  function tick() {
+    var left = Math.max(0, Math.floor((expireAt - Date.now()) / 1000));
+    var min = Math.floor(left / 60), sec = left % 60;
+    document.getElementById("remaining").textContent = min + ":" + (sec < 10 ? "0" : "") + sec;
+  }
+
+  function finish(ev) {
+    done = true;
+    clearInterval(timer);
+    document.getElementById("qr").className = "qr done";
+    document.getElementById("countdown").style.display = "none";
+    if (ev.return_url) {
+      document.getElementById("status").textContent = statuses[ev.status] + ", " + redirecting;
+      setTimeout(function() { window.location.href = ev.return_url; }, {{.RedirectMS}});
+    }
+  }
+
+  tick();
+  timer = setInterval(tick, 1000);
+
+  var es = new EventSource({{.EventsURL}});
+  es.addEventListener("status", function(e) {
+    var ev = JSON.parse(e.data);
+    expireAt = Date.parse(ev.expire_at) || expireAt;
+    document.getElementById("status").textContent = statuses[ev.status] || ev.status;
+    if (ev.status !== "pending") {
+      es.close();
+      finish(ev);
+    }
+  });
+  es.onerror = function() {
+    if (done) { es.close(); }
+  };
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/types"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(new(cashierSuite))
+
+type cashierSuite struct{}
+
+func (s *cashierSuite) order(status string) *types.AdbOrder {
+	return &types.AdbOrder{
+		ID:           "2019620183258-BA01",
+		Status:       status,
+		PayFee:       1998,
+		QRCode:       []byte("png"),
+		CashierToken: "d41d8cd98f00b204e9800998ecf8427e",
+		CreatedAt:    time.Date(2019, 6, 20, 18, 32, 58, 0, time.UTC),
+		NewAdbOrderReq: types.NewAdbOrderReq{
+			OutOrderID: "000082",
+			QRType:     types.QRCodeTypeAlipay,
+			Fee:        2000,
+			ReturnURL:  "https://shop.example.com/return?from=adbot",
+		},
+	}
+}
+
+func (s *cashierSuite) TestGenCashierURL(c *check.C) {
+	var (
+		order  = s.order(types.AdbOrderStatusPending)
+		suffix = "/api/cashier/2019620183258-BA01?token=d41d8cd98f00b204e9800998ecf8427e"
+	)
+
+	req, _ := http.NewRequest("POST", "http://192.168.1.1:8008/api/adb_paygate/new", nil)
+	c.Assert(genCashierURL(req, "", order), check.Equals, "http://192.168.1.1:8008"+suffix)
+
+	req.TLS = &tls.ConnectionState{}
+	c.Assert(genCashierURL(req, "", order), check.Equals, "https://192.168.1.1:8008"+suffix)
+
+	req.TLS = nil
+	req.Header.Set("X-Forwarded-Proto", "https")
+	c.Assert(genCashierURL(req, "", order), check.Equals, "https://192.168.1.1:8008"+suffix)
+
+	req.Header.Set("X-Forwarded-Proto", "javascript")
+	c.Assert(genCashierURL(req, "", order), check.Equals, "http://192.168.1.1:8008"+suffix)
+
+	c.Assert(genCashierURL(req, "https://pay.example.com/", order), check.Equals, "https://pay.example.com"+suffix)
+}
+
+func (s *cashierSuite) TestCashierReturnURL(c *check.C) {
+	order := s.order(types.AdbOrderStatusPending)
+	c.Assert(cashierReturnURL(order), check.Equals, "")
+
+	order.Status = types.AdbOrderStatusPaid
+	c.Assert(cashierReturnURL(order), check.Equals,
+		"https://shop.example.com/return?from=adbot&order_id=2019620183258-BA01&out_order_id=000082&status=paid")
+
+	order.Status = types.AdbOrderStatusTimeout
+	ev := cashierStatusEvent(order)
+	c.Assert(ev.Status, check.Equals, types.AdbOrderStatusTimeout)
+	c.Assert(ev.ExpireAt.Equal(order.CreatedAt.Add(types.AdbOrderTimeout)), check.Equals, true)
+	c.Assert(strings.HasSuffix(ev.ReturnURL, "&status=timeout"), check.Equals, true)
+
+	order.ExpireAt = order.CreatedAt.Add(time.Minute * 10) // by the order ttl
+	c.Assert(cashierStatusEvent(order).ExpireAt.Equal(order.ExpireAt), check.Equals, true)
+
+	formatted := string(ev.Format())
+	c.Assert(strings.HasPrefix(formatted, "event: status\ndata: {"), check.Equals, true)
+	c.Assert(strings.HasSuffix(formatted, "}\n\n"), check.Equals, true)
+
+	order.ReturnURL = ""
+	c.Assert(cashierReturnURL(order), check.Equals, "")
+}
+
+func (s *cashierSuite) TestCashierLang(c *check.C) {
+	newCtx := func(query, acceptLang string) *httpmux.Context {
+		req, _ := http.NewRequest("GET", "http://192.168.1.1:8008/api/cashier/x", nil)
+		req.Header.Set("Accept-Language", acceptLang)
+		return &httpmux.Context{Req: req, Query: httpmux.Params{"lang": query}}
+	}
+
+	c.Assert(cashierLang(newCtx("", "zh-CN,zh;q=0.9,en;q=0.8")), check.Equals, language.Chinese)
+	c.Assert(cashierLang(newCtx("", "en-US,en;q=0.9")), check.Equals, language.English)
+	c.Assert(cashierLang(newCtx("", "")), check.Equals, language.English)
+	c.Assert(cashierLang(newCtx("en", "zh-CN")), check.Equals, language.English)
+	c.Assert(cashierLang(newCtx("zh-TW", "en-US")), check.Equals, language.Chinese)
+}
+
+func (s *cashierSuite) TestRenderCashierPage(c *check.C) {
+	order := s.order(types.AdbOrderStatusPending)
+
+	var buf bytes.Buffer
+	c.Assert(renderCashierPage(&buf, language.Chinese, order), check.IsNil)
+	page := buf.String()
+	c.Assert(strings.Contains(page, `<html lang="zh">`), check.Equals, true)
+	c.Assert(strings.Contains(page, "收银台"), check.Equals, true)
+	c.Assert(strings.Contains(page, "请使用支付宝扫码支付"), check.Equals, true)
+	c.Assert(strings.Contains(page, "&yen;19.98"), check.Equals, true) // the payable amount
+	c.Assert(strings.Contains(page, `src="data:image/png;base64,cG5n"`), check.Equals, true)
+	c.Assert(strings.Contains(page, "等待支付"), check.Equals, true)
+	c.Assert(strings.Contains(page, "/api/cashier/2019620183258-BA01/events?token=d41d8cd98f00b204e9800998ecf8427e"), check.Equals, true)
+	c.Assert(strings.Contains(page, "1561055878000"), check.Equals, true) // expire at by unix milliseconds
+
+	buf.Reset()
+	order.QRType = types.QRCodeTypeWxpay
+	order.OutOrderID = "<script>alert(1)</script>"
+	c.Assert(renderCashierPage(&buf, language.French, order), check.IsNil) // fall back to english
+	page = buf.String()
+	c.Assert(strings.Contains(page, `<html lang="en">`), check.Equals, true)
+	c.Assert(strings.Contains(page, "Scan the QR code with WeChat to pay"), check.Equals, true)
+	c.Assert(strings.Contains(page, "<script>alert(1)</script>"), check.Equals, false)
+}
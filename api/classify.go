@@ -19,15 +19,19 @@ func (s *Server) classify() {
 	s.classifyOnce.Do(func() {
 		s.classified = map[string][]httpmux.HandleFunc{
 			catePublic: {
-				s.ping,               // ping pong (for node join)
-				s.queryLeader,        // query current leader (for node join)
-				s.checkNodeJoin,      // node join chec  (for node join)k
-				s.version,            // query version
-				s.anyUser,            // query if any user
-				s.addUser,            // add first admin user
-				s.userAuthLogin,      // user login
-				s.payGateNewAdbOrder, // adb paygate: new ordek (protected by secret header)
-				s.receiveAdbEvents,   // used by adb nodes to report adb device events
+				s.ping,                 // ping pong (for node join)
+				s.queryLeader,          // query current leader (for node join)
+				s.checkNodeJoin,        // node join chec  (for node join)k
+				s.version,              // query version
+				s.anyUser,              // query if any user
+				s.addUser,              // add first admin user
+				s.userAuthLogin,        // user login
+				s.payGateNewAdbOrder,   // adb paygate: new ordek (protected by secret header)
+				s.payGateQueryAdbOrder, // adb paygate: query order (protected by signature)
+				s.payGateCloseAdbOrder, // adb paygate: close order (protected by signature)
+				s.cashierPage,          // adb paygate: hosted cashier page (protected by cashier token)
+				s.cashierEvents,        // adb paygate: hosted cashier status stream (protected by cashier token)
+				s.receiveAdbEvents,     // used by adb nodes to report adb device events
 			},
 			cateNonForward: {
 				s.ping,          // ping pong (for node join)
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// paygate merchants
+//
+
+func (s *Server) listMerchants(ctx *httpmux.Context) {
+	var (
+		search = ctx.Query["search"] // id or name regex search
+		query  = bson.M{}
+	)
+
+	if search != "" {
+		regex := bson.M{"$regex": bson.RegEx{Pattern: search}}
+		query["$or"] = []bson.M{{"id": regex}, {"name": regex}}
+	}
+
+	merchants, err := store.DB().ListMerchants(getPager(ctx), query)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	wraps := make([]*types.MerchantWrapper, len(merchants))
+	for idx, merchant := range merchants {
+		wraps[idx] = s.wrapMerchant(merchant)
+	}
+
+	n := store.DB().CountMerchants(query)
+	ctx.Res.Header().Set("Total-Records", strconv.Itoa(n))
+	ctx.JSON(200, wraps)
+}
+
+func (s *Server) getMerchant(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["merchant_id"]
+	)
+
+	merchant, err := store.DB().GetMerchant(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, s.wrapMerchant(merchant))
+}
+
+func (s *Server) addMerchant(ctx *httpmux.Context) {
+	var merchant = new(types.Merchant)
+	if err := ctx.Bind(merchant); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if merchant.ID == "" {
+		merchant.ID = utils.RandomString(16)
+	}
+	if merchant.Secret == "" {
+		merchant.Secret = newMerchantSecret()
+	}
+	if merchant.QRTypes == nil {
+		merchant.QRTypes = []string{}
+	}
+	if merchant.Devices == nil {
+		merchant.Devices = []string{}
+	}
+	merchant.CreatedAt = time.Now()
+	merchant.UpdatedAt = time.Now()
+
+	if err := merchant.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if err := s.checkMerchantDevices(merchant); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if _, err := store.DB().GetMerchant(merchant.ID); err == nil {
+		ctx.Conflict(errors.New("merchant id already exists"))
+		return
+	}
+	if _, err := store.DB().GetMerchant(merchant.Name); err == nil {
+		ctx.Conflict(errors.New("merchant name already exists"))
+		return
+	}
+
+	if err := store.DB().AddMerchant(merchant); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(201, merchant) // note: always show the secret to the creator
+}
+
+func (s *Server) updateMerchant(ctx *httpmux.Context) {
+	var (
+		id  = ctx.Path["merchant_id"]
+		req = new(types.UpdateMerchantReq)
+	)
+
+	current, err := store.DB().GetMerchant(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if err := ctx.Bind(req); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	var (
+		prevName = current.Name
+	)
+
+	req.Apply(current)
+	if err := current.Valid(); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	if err := s.checkMerchantDevices(current); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if current.Name != prevName {
+		if _, err := store.DB().GetMerchant(current.Name); err == nil {
+			ctx.Conflict(errors.New("merchant name already exists"))
+			return
+		}
+	}
+
+	setUpdator := bson.M{
+		"name":             current.Name,
+		"notify_url":       current.NotifyURL,
+		"qrtypes":          current.QRTypes,
+		"min_fee":          current.MinFee,
+		"max_fee":          current.MaxFee,
+		"devices":          current.Devices,
+		"pickup_strategy":  current.PickupStrategy,
+		"sign_legacy":      current.SignLegacy,
+		"sign_legacy_v2":   current.SignLegacyV2,
+		"callback_backoff": current.CallbackBackoff,
+		"order_ttl":        current.OrderTTL,
+		"device_hold":      current.DeviceHold,
+		"disabled":         current.Disabled,
+		"desc":             current.Desc,
+		"updated_at":       time.Now(),
+	}
+	if err := store.DB().UpdateMerchant(current.ID, bson.M{"$set": setUpdator}); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	updated, _ := store.DB().GetMerchant(current.ID)
+	ctx.JSON(200, s.wrapMerchant(updated))
+}
+
+// rotate the merchant secret, the previous one is invalid at once
+func (s *Server) resetMerchantSecret(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["merchant_id"]
+	)
+
+	merchant, err := store.DB().GetMerchant(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	secret := newMerchantSecret()
+	setUpdator := bson.M{
+		"secret":     secret,
+		"updated_at": time.Now(),
+	}
+	if err := store.DB().UpdateMerchant(merchant.ID, bson.M{"$set": setUpdator}); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	updated, _ := store.DB().GetMerchant(merchant.ID)
+	ctx.JSON(200, updated) // note: always show the new secret to the rotator
+}
+
+func (s *Server) rmMerchant(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["merchant_id"]
+	)
+
+	merchant, err := store.DB().GetMerchant(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if merchant.ID == types.DefaultMerchantID {
+		ctx.BadRequest("the default merchant can't be removed, disable it instead")
+		return
+	}
+
+	query := bson.M{"merchant_id": merchant.ID, "status": types.AdbOrderStatusPending}
+	if n, _ := store.DB().CountAdbOrders(query); n > 0 {
+		ctx.Conflict(errors.New("merchant still have pending adb orders"))
+		return
+	}
+
+	if err := store.DB().RemoveMerchant(merchant.ID); err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.Status(200)
+}
+
+// ensure all of the dedicated devices exist and not dedicated to another merchant
+func (s *Server) checkMerchantDevices(merchant *types.Merchant) error {
+	if len(merchant.Devices) == 0 {
+		return nil
+	}
+
+	for _, id := range merchant.Devices {
+		if _, err := store.DB().GetAdbDevice(id); err != nil {
+			if store.DB().ErrNotFound(err) {
+				return fmt.Errorf("adb device %s not found", id)
+			}
+			return err
+		}
+	}
+
+	query := bson.M{"id": bson.M{"$ne": merchant.ID}, "devices": bson.M{"$in": merchant.Devices}}
+	if n := store.DB().CountMerchants(query); n > 0 {
+		return errors.New("conflict: some of the adb devices already dedicated to another merchant")
+	}
+	return nil
+}
+
+func (s *Server) wrapMerchant(merchant *types.Merchant) *types.MerchantWrapper {
+	if !unmaskSensitive {
+		merchant.Hidden()
+	}
+
+	wrap := &types.MerchantWrapper{
+		Merchant:        merchant,
+		RecentAdbOrders: types.RecentAdbOrders{},
+	}
+
+	filter := scheduler.MerchantAdbOrdersFilter(merchant.ID)
+
+	// today
+	todayStartAt, _ := utils.Today()
+	wrap.RecentAdbOrders.Today = scheduler.CountAdbOrdersByStatus(bson.M{"merchant_id": filter, "created_at": bson.M{"$gt": todayStartAt}})
+
+	// month
+	monthStartAt, _ := utils.CurrMonth()
+	wrap.RecentAdbOrders.Month = scheduler.CountAdbOrdersByStatus(bson.M{"merchant_id": filter, "created_at": bson.M{"$gt": monthStartAt}})
+
+	return wrap
+}
+
+func newMerchantSecret() string {
+	return "0" + utils.RandomString(30) + "x"
+}
@@ -2,13 +2,14 @@ package api
 
 import (
 	"encoding/base64"
-	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/pkg/utils"
 	"github.com/bbklab/adbot/scheduler"
 	"github.com/bbklab/adbot/store"
 	"github.com/bbklab/adbot/types"
@@ -16,17 +17,19 @@ import (
 
 // adb paygate
 //  - public apis, visit by out side pay system
-//  - protected by signature verify (with payGateSecret)
+//  - protected by signature verify (with the merchant secret, legacy MD5 or HMAC-SHA256)
 //
 func (s *Server) payGateNewAdbOrder(ctx *httpmux.Context) {
 	var (
-		req     = new(types.NewAdbOrderReq)
-		resp    = new(types.NewAdbOrderResp)
-		dvc     *types.AdbDevice
-		qrpng   []byte
-		orderID string
-		query   bson.M
-		err     error
+		req      = new(types.NewAdbOrderReq)
+		resp     = new(types.NewAdbOrderResp)
+		merchant *types.Merchant
+		order    *types.AdbOrder
+		qrpng    []byte
+		orderID  string
+		created  bool
+		status   = 200
+		err      error
 	)
 
 	if err = ctx.Bind(req); err != nil {
@@ -36,78 +39,263 @@ func (s *Server) payGateNewAdbOrder(ctx *httpmux.Context) {
 		goto END
 	}
 
-	// verify signature
-	err = scheduler.VerifySignature(payGateSecret, req)
+	// lookup the merchant by app id
+	merchant, err = scheduler.PaygateMerchant(req.AppID)
 	if err != nil {
 		goto END
 	}
 
-	// ensure we have corresponding adb device avaliable through
-	// once smart pickup
-	dvc, err = scheduler.SmartPickupAdbDevice(req)
+	// verify signature
+	err = scheduler.VerifySignature(merchant, req)
 	if err != nil {
-		err = fmt.Errorf("pick up adb device error: %s", err.Error())
 		goto END
 	}
 
-	// check duplication on out order id
-	query = bson.M{"out_order_id": req.OutOrderID}
-	if orders, _ := store.DB().ListAdbOrders(nil, query); len(orders) > 0 {
-		err = errors.New("duplicated out order id")
+	// verify the merchant limits
+	err = merchant.Allow(req)
+	if err != nil {
 		goto END
 	}
+	if req.NotifyURL == "" {
+		req.NotifyURL = merchant.NotifyURL
+	}
+	req.TTL = int(merchant.TTL(req).Seconds())
 
-	// save db adb order
-	orderID = s.newOrderID()
-	if err = store.DB().AddAdbOrder(&types.AdbOrder{
-		ID:              orderID,
-		Status:          types.AdbOrderStatusPending, // init status: pending
-		NodeID:          dvc.NodeID,
-		DeviceID:        dvc.ID,
-		NewAdbOrderReq:  *req, // never be nil
-		Response:        nil,
-		Callback:        nil,
-		CallbackHistory: []string{},
-		CallbackStatus:  types.AdbOrderCallbackStatusNone, // init status: none
-		CreatedAt:       time.Now(),
-		PaidAt:          time.Time{},
-	}); err != nil {
+	// the retried request of the same out order id gets the existing adb order
+	order, err = lookupPaygateAdbOrder(merchant, req)
+	if err != nil {
 		goto END
 	}
 
-	// ask generate qrcode and return response
-	qrpng, _, err = scheduler.GenAdbpayQrCode(dvc.ID, req.QRType, req.Fee, orderID)
+	// otherwise pick up the adb device and save db adb order
+	if order == nil {
+		order, created, err = s.savePaygateAdbOrder(merchant, req)
+		if err != nil {
+			goto END
+		}
+	}
+	orderID = order.ID
+
+	// the existing adb order is returned only while it's still payable
+	if !created {
+		err = payableAdbOrder(order)
+		scheduler.AppendAdbOrderEvents(orderID, newPaygateRetriedEvent(req, err))
+		if err != nil {
+			goto END
+		}
+	}
+
+	// ask generate qrcode by the payable amount and return response
+	qrpng, _, err = scheduler.GenAdbpayQrCode(order.DeviceID, req.QRType, order.PayFee, orderID)
 	if err != nil {
 		// note: after db order created, if we met error while generating qrcode,
 		// we should remove the newly db order and tell outside to retry.
 		err = fmt.Errorf("generate adbpay qrcode error: [%v], pls try again later", err)
-		store.DB().RemoveAdbOrder(orderID) // note: remove the newly db adb order
+		if created {
+			store.DB().RemoveAdbOrder(orderID) // note: remove the newly db adb order
+		}
 		goto END
 	}
+	scheduler.MemoAdbOrderQRCode(orderID, qrpng) // shown on the hosted cashier page
+	scheduler.AppendAdbOrderEvents(orderID, types.NewAdbOrderEvent(types.AdbOrderEventQRIssued, "payment qrcode generated",
+		"device_id", order.DeviceID, "qrtype", req.QRType, "pay_fee", strconv.Itoa(order.PayFee)))
 
 END:
 	// fill the response
 	if err != nil {
 		resp.Code = 0
 		resp.Message = err.Error()
+		if _, ok := err.(*types.AdbOrderConflictError); ok {
+			status = 409
+		}
 	} else {
 		resp.Code = 1
 		resp.QRImage = fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(qrpng))
+		resp.CashierURL = genCashierURL(ctx.Req, cashierBaseURL(), order)
 	}
 	resp.OrderID = orderID
 	resp.OutOrderID = req.OutOrderID
 	resp.Fee = req.Fee
 	resp.FeeYuan = float64(req.Fee) / float64(100)
+	if order != nil {
+		resp.PayFee = order.PayFee
+		resp.PayFeeYuan = float64(order.PayFee) / float64(100)
+		resp.TTL = order.TTL
+		resp.ExpireAt = order.ExpireAt
+	}
 	resp.Time = time.Now() // add time at to track order timeline
 
 	// if db order created, save adb order response
-	if orderID != "" {
+	if created && orderID != "" {
 		scheduler.MemoAdbOrderResponse(orderID, resp)
 
 		// subscribe wait the adb order's callback and return our callback to merchant
 		go scheduler.SubscribeAdbOrderAndSendCallback(orderID)
 	}
 
+	// always 200, except the conflicted retries
+	ctx.JSON(status, resp)
+}
+
+// lookupPaygateAdbOrder return the existing adb order of the request out order id, nil if not exists,
+// the conflict error is returned if the existing order was created with the different parameters
+func lookupPaygateAdbOrder(merchant *types.Merchant, req *types.NewAdbOrderReq) (*types.AdbOrder, error) {
+	query := bson.M{"merchant_id": scheduler.MerchantAdbOrdersFilter(merchant.ID), "out_order_id": req.OutOrderID}
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	order := orders[0]
+	if err := order.Conflict(req); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// the lifecycle event of the retried request which got the existing adb order
+func newPaygateRetriedEvent(req *types.NewAdbOrderReq, err error) *types.AdbOrderEvent {
+	message := "existing order returned"
+	if err != nil {
+		message = err.Error()
+	}
+	return types.NewAdbOrderEvent(types.AdbOrderEventRetried, message, "nonce", req.Nonce)
+}
+
+// payableAdbOrder verify the existing adb order of the retried request is still payable
+func payableAdbOrder(order *types.AdbOrder) error {
+	if order.Status != types.AdbOrderStatusPending {
+		return fmt.Errorf("adb order %s already %s", order.ID, order.Status)
+	}
+	if time.Now().After(order.Deadline()) {
+		return fmt.Errorf("adb order %s already expired", order.ID)
+	}
+	return nil
+}
+
+// ensure we have corresponding adb device avaliable through once smart pickup within
+// the merchant's device pool, and save the pending db adb order with the payable amount
+//
+// note: serialized by the pickup lock, so the payable amount keeps uniq on the device
+//
+// note: the out order id is uniq within the merchant by the db index, if the concurrent
+// retry (maybe on another master) saved first, its adb order is returned with created=false
+func (s *Server) savePaygateAdbOrder(merchant *types.Merchant, req *types.NewAdbOrderReq) (*types.AdbOrder, bool, error) {
+	unlock := scheduler.LockAdbOrderPickup()
+	defer unlock()
+
+	dvc, pickup, err := scheduler.SmartPickupAdbDevice(merchant, req)
+	if err != nil {
+		return nil, false, fmt.Errorf("pick up adb device error: %s", err.Error())
+	}
+
+	var (
+		now         = time.Now()
+		expireAt    = now.Add(time.Duration(req.TTL) * time.Second)
+		payeeAlipay *types.AlipayAccount // kept for the settlement even if the device rebinds later
+	)
+	if req.QRType == types.QRCodeTypeAlipay {
+		payeeAlipay = dvc.Alipay
+	}
+
+	order := &types.AdbOrder{
+		ID:              s.newOrderID(),
+		Status:          types.AdbOrderStatusPending, // init status: pending
+		MerchantID:      merchant.ID,
+		NodeID:          dvc.NodeID,
+		DeviceID:        dvc.ID,
+		PayFee:          pickup.PayFee,
+		Pickup:          pickup,
+		Alipay:          payeeAlipay,
+		NewAdbOrderReq:  *req, // never be nil
+		Response:        nil,
+		Callback:        nil,
+		CallbackHistory: []string{},
+		CallbackStatus:  types.AdbOrderCallbackStatusNone, // init status: none
+		CashierToken:    utils.RandomString(32),
+		ExpireAt:        expireAt,
+		DeviceHold:      merchant.DeviceHold,
+		HoldUntil:       expireAt.Add(time.Duration(merchant.DeviceHold) * time.Second),
+		CreatedAt:       now,
+		PaidAt:          time.Time{},
+	}
+	if err := scheduler.SaveAdbOrder(order); err != nil {
+		if store.DB().ErrDuplicated(err) {
+			if existing, lerr := lookupPaygateAdbOrder(merchant, req); existing != nil || lerr != nil {
+				return existing, false, lerr
+			}
+		}
+		return nil, false, err
+	}
+	return order, true, nil
+}
+
+// query the merchant's adb order by order id or out order id,
+// protected by the HMAC-SHA256 signature verify
+func (s *Server) payGateQueryAdbOrder(ctx *httpmux.Context) {
+	s.payGateOnAdbOrder(ctx, nil)
+}
+
+// close the merchant's pending adb order before paid,
+// protected by the HMAC-SHA256 signature verify
+func (s *Server) payGateCloseAdbOrder(ctx *httpmux.Context) {
+	s.payGateOnAdbOrder(ctx, scheduler.CloseAdbOrder)
+}
+
+// verify the signed paygate order request, lookup the merchant's adb order
+// and run the optional action on it, respond the signed current adb order
+func (s *Server) payGateOnAdbOrder(ctx *httpmux.Context, action func(*types.AdbOrder) error) {
+	var (
+		req      = new(types.PaygateOrderReq)
+		merchant *types.Merchant
+		order    *types.AdbOrder
+		err      error
+	)
+
+	if err = ctx.Bind(req); err != nil {
+		goto END
+	}
+	if err = req.Valid(); err != nil {
+		goto END
+	}
+
+	// lookup the merchant by app id
+	merchant, err = scheduler.PaygateMerchant(req.AppID)
+	if err != nil {
+		goto END
+	}
+
+	// verify signature
+	err = scheduler.VerifySignature(merchant, req)
+	if err != nil {
+		goto END
+	}
+
+	order, err = scheduler.PaygateAdbOrder(merchant, req.OrderID, req.OutOrderID)
+	if err != nil {
+		goto END
+	}
+
+	if action != nil {
+		if err = action(order); err != nil {
+			goto END
+		}
+		order, err = store.DB().GetAdbOrder(order.ID) // reload the changed adb order
+	}
+
+END:
 	// always 200
-	ctx.JSON(200, resp)
+	if err != nil {
+		ctx.JSON(200, &types.PaygateOrderResp{
+			Code:       0,
+			Message:    err.Error(),
+			OrderID:    req.OrderID,
+			OutOrderID: req.OutOrderID,
+		})
+		return
+	}
+	ctx.JSON(200, scheduler.GenPaygateOrderResp(merchant, order))
 }
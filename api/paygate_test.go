@@ -0,0 +1,32 @@
+package api
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(paygateSuite))
+
+type paygateSuite struct{}
+
+func (s *paygateSuite) TestPayableAdbOrder(c *check.C) {
+	order := &types.AdbOrder{
+		ID:        "2019620183258-BA01",
+		Status:    types.AdbOrderStatusPending,
+		ExpireAt:  time.Now().Add(time.Minute),
+		CreatedAt: time.Now(),
+	}
+	c.Assert(payableAdbOrder(order), check.IsNil) // the retry gets the pending order
+
+	order.ExpireAt = time.Now().Add(-time.Second)
+	c.Assert(payableAdbOrder(order), check.ErrorMatches, "adb order 2019620183258-BA01 already expired")
+
+	order.Status = types.AdbOrderStatusPaid
+	c.Assert(payableAdbOrder(order), check.ErrorMatches, "adb order 2019620183258-BA01 already paid")
+
+	order.Status = types.AdbOrderStatusClosed
+	c.Assert(payableAdbOrder(order), check.ErrorMatches, "adb order 2019620183258-BA01 already closed")
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb daily reconciliation
+//
+
+func (s *Server) listAdbReconciles(ctx *httpmux.Context) {
+	var (
+		status = ctx.Query["status"] // running, done
+		query  = bson.M{}
+	)
+
+	if status != "" {
+		query["status"] = status
+	}
+
+	reconciles, err := store.DB().ListAdbReconciles(getPager(ctx), query)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	n := store.DB().CountAdbReconciles(query)
+	ctx.Res.Header().Set("Total-Records", strconv.Itoa(n))
+	ctx.JSON(200, reconciles)
+}
+
+func (s *Server) getAdbReconcile(ctx *httpmux.Context) {
+	var (
+		id = ctx.Path["date"]
+	)
+
+	reconcile, err := store.DB().GetAdbReconcile(id)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, reconcile)
+}
+
+// run the reconciliation of the day in background, default yesterday
+func (s *Server) runAdbReconcile(ctx *httpmux.Context) {
+	var (
+		date = ctx.Query["date"]
+		day  = time.Now().AddDate(0, 0, -1)
+	)
+
+	if date != "" {
+		var err error
+		if day, err = scheduler.ParseReconcileDate(date); err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+	}
+
+	if err := scheduler.StartAdbReconcile(day); err != nil {
+		ctx.Conflict(err)
+		return
+	}
+
+	ctx.JSON(202, map[string]string{"id": day.Format("2006-01-02"), "status": types.AdbReconcileStatusRunning})
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/pkg/xlsx"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb order reports
+//
+
+var (
+	adbOrderExportHeader = []interface{}{
+		"id", "out_order_id", "merchant_id", "qrtype", "node_id", "device_id", "fee_yuan", "pay_fee_yuan",
+		"status", "callback_status", "created_at", "paid_at", "pay_seconds",
+	}
+
+	adbOrderSettlementHeader = []interface{}{
+		"key", "name", "orders", "paid", "paid_after_timeout", "pending", "timeout", "closed",
+		"fee_yuan", "paid_fee_yuan", "success_rate", "avg_pay_seconds",
+	}
+)
+
+// export the adb orders one by one by the same query parameters as the orders listing
+func (s *Server) exportAdbOrders(ctx *httpmux.Context) {
+	var (
+		format = ctx.Query["format"] // csv, xlsx
+	)
+
+	if format == "" {
+		format = "csv"
+	}
+
+	query, _, _, err := adbOrdersQuery(ctx)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	w, err := newTableWriter(ctx, format, "adb_orders")
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+	defer w.Close()
+
+	// note: the status code and headers have been sent,
+	// the db errors could only be logged while streaming
+	w.Write(adbOrderExportHeader)
+	err = store.DB().IterAdbOrders(query, func(order *types.AdbOrder) error {
+		return w.Write(adbOrderExportRow(order))
+	})
+	if err != nil {
+		log.Errorf("export adb orders error: %v", err)
+	}
+}
+
+// the export row of the adb order, same columns as the adbOrderExportHeader,
+// the legacy orders are exported under the default merchant as the settlement
+func adbOrderExportRow(order *types.AdbOrder) []interface{} {
+	var (
+		paidAt     interface{}
+		paySeconds interface{}
+	)
+	if !order.PaidAt.IsZero() {
+		paidAt = order.PaidAt.In(time.Local)
+		paySeconds = order.PaidAt.Sub(order.CreatedAt).Seconds()
+	}
+	return []interface{}{
+		order.ID, order.OutOrderID, order.MerchantOrDefault(), order.QRType, order.NodeID, order.DeviceID,
+		yuan(order.Fee), yuan(order.Payable()), order.Status, order.CallbackStatus,
+		order.CreatedAt.In(time.Local), paidAt, paySeconds,
+	}
+}
+
+// the adb orders settlement report grouped by day, device, alipay account or merchant
+func (s *Server) adbOrderSettlement(ctx *httpmux.Context) {
+	var (
+		format  = ctx.Query["format"]   // json, csv, xlsx
+		groupBy = ctx.Query["group_by"] // day, device, alipay, merchant
+	)
+
+	if groupBy == "" {
+		groupBy = types.AdbOrderReportByDay
+	}
+	if err := types.ValidAdbOrderReportGroupBy(groupBy); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	query, startTime, endTime, err := adbOrdersQuery(ctx)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	report, err := scheduler.AdbOrderSettlement(query, groupBy, startTime, endTime)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	if format == "" || format == "json" {
+		ctx.JSON(200, report)
+		return
+	}
+
+	w, err := newTableWriter(ctx, format, "adb_settlement_by_"+groupBy)
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+	defer w.Close()
+
+	w.Write(adbOrderSettlementHeader)
+	for _, row := range append(report.Rows, report.Total) {
+		w.Write([]interface{}{
+			row.Key, row.Name, row.Orders, row.Paid, row.PaidAfterTimeout, row.Pending, row.Timeout, row.Closed,
+			yuan(row.Fee), yuan(row.PaidFee), row.SuccessRate, row.AvgPaySeconds,
+		})
+	}
+}
+
+// the fee in CNY cent to yuan
+func yuan(fee int) float64 {
+	return float64(fee) / float64(100)
+}
+
+// tableWriter write the report rows in the csv or xlsx format
+type tableWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// new table writer on the response by the format, the response headers are sent
+func newTableWriter(ctx *httpmux.Context, format, name string) (tableWriter, error) {
+	var (
+		filename = fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102150405"), format)
+		header   = ctx.Res.Header()
+	)
+
+	switch format {
+	case "csv":
+		header.Set("Content-Type", "text/csv; charset=utf-8")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Res.WriteHeader(200)
+		io.WriteString(ctx.Res, "\xEF\xBB\xBF") // utf-8 bom, make the excel happy
+		return &csvTableWriter{csv.NewWriter(ctx.Res)}, nil
+
+	case "xlsx":
+		header.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Res.WriteHeader(200)
+		w, err := xlsx.NewWriter(ctx.Res, name)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+
+	return nil, fmt.Errorf("report format %s unrecoginized", format)
+}
+
+type csvTableWriter struct {
+	w *csv.Writer
+}
+
+func (t *csvTableWriter) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for idx, val := range row {
+		switch v := val.(type) {
+		case nil:
+		case string:
+			record[idx] = v
+		case int:
+			record[idx] = strconv.Itoa(v)
+		case float64:
+			record[idx] = strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Time:
+			record[idx] = v.Format("2006-01-02 15:04:05")
+		default:
+			record[idx] = fmt.Sprint(v)
+		}
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(reportSuite))
+
+type reportSuite struct{}
+
+func (s *reportSuite) TestExportRow(c *check.C) {
+	var (
+		created = time.Date(2019, 6, 17, 11, 9, 14, 0, time.Local)
+		order   = &types.AdbOrder{
+			ID:             "201961711914-cc4b76",
+			Status:         types.AdbOrderStatusPaid,
+			NodeID:         "2cb7fbbcc4b0e1a1",
+			DeviceID:       "546052d21f384",
+			PayFee:         9999,
+			NewAdbOrderReq: types.NewAdbOrderReq{OutOrderID: "NO20190617001", QRType: types.QRCodeTypeAlipay, Fee: 10000},
+			CallbackStatus: types.AdbOrderCallbackStatusSucceed,
+			CreatedAt:      created.UTC(),
+			PaidAt:         created.Add(time.Millisecond * 48200),
+		}
+	)
+
+	// the legacy order is exported under the default merchant
+	row := adbOrderExportRow(order)
+	c.Assert(row, check.HasLen, len(adbOrderExportHeader))
+	c.Assert(row[:10], check.DeepEquals, []interface{}{
+		"201961711914-cc4b76", "NO20190617001", types.DefaultMerchantID, types.QRCodeTypeAlipay, "2cb7fbbcc4b0e1a1", "546052d21f384",
+		float64(100), 99.99, types.AdbOrderStatusPaid, types.AdbOrderCallbackStatusSucceed,
+	})
+	c.Assert(row[10].(time.Time).Location(), check.Equals, time.Local)
+	c.Assert(row[11].(time.Time).Equal(order.PaidAt), check.Equals, true)
+	c.Assert(row[12], check.Equals, 48.2)
+
+	// not paid yet
+	order.MerchantID, order.Status, order.PaidAt = "shop01", types.AdbOrderStatusPending, time.Time{}
+	row = adbOrderExportRow(order)
+	c.Assert(row[2], check.Equals, "shop01")
+	c.Assert(row[11], check.IsNil)
+	c.Assert(row[12], check.IsNil)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http/pprof"
 
 	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/types"
 )
 
 func (s *Server) setupRoutes(mux *httpmux.Mux) {
@@ -82,6 +83,10 @@ func (s *Server) setupRoutes(mux *httpmux.Mux) {
 	mux.PATCH("/adb_devices/:device_id", s.updateAdbDevice)
 	mux.GET("/adb_devices/:device_id/screencap", s.screenCapAdbDevice)
 	mux.GET("/adb_devices/:device_id/uinodes", s.dumpAdbDeviceUINodes)
+	mux.GET("/adb_devices/:device_id/syslogs", s.tailAdbDeviceSysLogs)
+	mux.GET("/adb_devices/:device_id/mirror", s.mirrorAdbDevice) // websocket
+	mux.GET("/adb_devices/:device_id/ops", s.adbDeviceOpQueue)
+	mux.DELETE("/adb_devices/:device_id/ops/:op_id", s.cancelAdbDeviceOp)
 	mux.PATCH("/adb_devices/:device_id/click", s.clickAdbDevice)
 	mux.PATCH("/adb_devices/:device_id/goback", s.gobackAdbDevice)
 	mux.PATCH("/adb_devices/:device_id/gotohome", s.gotoHomeAdbDevice)
@@ -92,12 +97,45 @@ func (s *Server) setupRoutes(mux *httpmux.Mux) {
 	mux.PUT("/adb_devices/:device_id/weight", s.setAdbDeviceWeight)
 	mux.PUT("/adb_devices/:device_id/alipay", s.bindAdbDeviceAlipay)
 	mux.DELETE("/adb_devices/:device_id/alipay", s.revokeAdbDeviceAlipay)
+	mux.PUT("/adb_devices/:device_id/wxpay", s.bindAdbDeviceWxpay)
+	mux.DELETE("/adb_devices/:device_id/wxpay", s.revokeAdbDeviceWxpay)
 	mux.GET("/adb_devices/:device_id/verify", s.verifyAdbDevice) // verify the adb device binded alipay account and test payment charging
+	mux.GET("/adb_devices/:device_id/files", s.pullAdbDeviceFile)
+	mux.PUT("/adb_devices/:device_id/files", s.pushAdbDeviceFile)
+	mux.GET("/adb_devices/:device_id/packages", s.listAdbDevicePackages)
+	mux.GET("/adb_devices/:device_id/packages/:package", s.getAdbDevicePackage)
+	mux.POST("/adb_devices/:device_id/packages", s.installAdbDevicePackage)
+	mux.DELETE("/adb_devices/:device_id/packages/:package", s.uninstallAdbDevicePackage)
 	mux.DELETE("/adb_devices/:device_id", s.rmAdbDevice)
+	// adb packages
+	mux.POST("/adb_packages/rollout", s.rolloutAdbPackage) // install the apk on label-selected node devices
 	// adb orders
 	mux.GET("/adb_orders", s.listAdbOrders)
 	mux.GET("/adb_orders/:order_id", s.getAdbOrder)
 	mux.PUT("/adb_orders/:order_id/recallback", s.reCallbackAdbOrder)
+	mux.PUT("/adb_orders/:order_id/override", s.overrideAdbOrder) // manual mark paid, timeout, void or refund note
+	mux.GET("/adb_order_overrides", s.listAdbOrderOverrides)
+	mux.GET("/adb_order_reports/export", s.exportAdbOrders)        // stream the orders in csv or xlsx
+	mux.GET("/adb_order_reports/settlement", s.adbOrderSettlement) // grouped by day, device, alipay or merchant
+	mux.GET("/adb_order_callbacks/dead", s.listDeadAdbOrderCallbacks)
+	mux.PUT("/adb_order_callbacks/replay", s.replayAdbOrderCallbacks)
+	// adb flows
+	mux.GET("/adb_flows", s.listAdbFlows)
+	mux.POST("/adb_flows", s.addAdbFlow)
+	mux.GET("/adb_flows/:flow_id", s.getAdbFlow)
+	mux.PUT("/adb_flows/:flow_id", s.updateAdbFlow)
+	mux.DELETE("/adb_flows/:flow_id", s.rmAdbFlow)
+	mux.POST("/adb_flows/:flow_id/run", s.runAdbFlow) // run on one device or label-selected node devices
+	// adb order time-series stats
+	mux.GET("/stats/orders", s.listAdbOrderStats(types.StatsDimensionAll, ""))
+	mux.GET("/stats/devices", s.listAdbOrderStats(types.StatsDimensionDevice, "device_id"))
+	mux.GET("/stats/nodes", s.listAdbOrderStats(types.StatsDimensionNode, "node_id"))
+	mux.GET("/stats/merchants", s.listAdbOrderStats(types.StatsDimensionMerchant, "merchant_id"))
+	mux.POST("/stats/rollup", s.rollupAdbOrderStats) // re-aggregate the rollups of the time range
+	// adb daily reconciliation
+	mux.GET("/adb_reconciles", s.listAdbReconciles)
+	mux.POST("/adb_reconciles", s.runAdbReconcile) // run in background, default yesterday
+	mux.GET("/adb_reconciles/:date", s.getAdbReconcile)
 	// adb public api
 	mux.GET("/adb_public_api", s.getAdbPublicAPIDocs)
 	// adb events
@@ -106,6 +144,18 @@ func (s *Server) setupRoutes(mux *httpmux.Mux) {
 	// adb paygate
 	//  - called by out side pay system, only autheticated by secret header
 	mux.POST("/adb_paygate/new", s.payGateNewAdbOrder)
+	mux.POST("/adb_paygate/query", s.payGateQueryAdbOrder)
+	mux.POST("/adb_paygate/close", s.payGateCloseAdbOrder)
+	// hosted cashier
+	mux.GET("/cashier/:order_id", s.cashierPage)          // public, protected by the cashier token
+	mux.GET("/cashier/:order_id/events", s.cashierEvents) // public, protected by the cashier token
+	// paygate merchants
+	mux.GET("/merchants", s.listMerchants)
+	mux.POST("/merchants", s.addMerchant)
+	mux.GET("/merchants/:merchant_id", s.getMerchant)
+	mux.PATCH("/merchants/:merchant_id", s.updateMerchant)
+	mux.PUT("/merchants/:merchant_id/secret", s.resetMerchantSecret) // rotate the merchant secret
+	mux.DELETE("/merchants/:merchant_id", s.rmMerchant)
 
 	// settings
 	mux.GET("/settings", s.getSettings)
@@ -14,8 +14,7 @@ import (
 )
 
 var (
-	unmaskSensitive bool   // unmask the sensitive fields when api response
-	payGateSecret   string // paygate secret
+	unmaskSensitive bool // unmask the sensitive fields when api response
 )
 
 func (s *Server) getSettings(ctx *httpmux.Context) {
@@ -144,7 +143,6 @@ func (s *Server) applyRuntimeSettings() error {
 	s.mux.SetDebug(current.EnableHTTPMuxDebug)
 
 	unmaskSensitive = current.UnmarkSensitive
-	payGateSecret = current.GlobalAttrs.Get(types.GlobalAttrPaygateSecretKey)
 
 	scheduler.RenewTGBot(current.TGBotToken)
 
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/httpmux"
+	"github.com/bbklab/adbot/scheduler"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb order time-series stats
+//
+
+// list the rollups of the dimension, filtered by the key query parameter if provided
+func (s *Server) listAdbOrderStats(dimension, keyParam string) httpmux.HandleFunc {
+	return func(ctx *httpmux.Context) {
+		var (
+			granularity = ctx.Query["granularity"] // minute, hour, day
+		)
+
+		if granularity == "" {
+			granularity = types.StatsGranularityHour
+		}
+		if err := types.ValidStatsGranularity(granularity); err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+
+		// default the recent 60 buckets
+		startTime, endTime, err := statsTimeRange(ctx, time.Now().Add(-types.StatsGranularities[granularity].Bucket*60))
+		if err != nil {
+			ctx.BadRequest(err)
+			return
+		}
+
+		query := bson.M{
+			"granularity": granularity,
+			"dimension":   dimension,
+			"time":        bson.M{"$gte": types.StatsBucketOf(granularity, startTime), "$lt": endTime},
+		}
+		if keyParam != "" {
+			if key := ctx.Query[keyParam]; key != "" {
+				query["key"] = key
+			}
+		}
+
+		stats, err := store.DB().ListAdbOrderStats(&pageParam{types.MaxStatsBuckets, 0}, query)
+		if err != nil {
+			ctx.AutoError(err)
+			return
+		}
+
+		ctx.JSON(200, stats)
+	}
+}
+
+// re-aggregate the rollups of the time range, eg: backfill the history orders after upgrading
+func (s *Server) rollupAdbOrderStats(ctx *httpmux.Context) {
+	var (
+		granularity = ctx.Query["granularity"] // minute, hour, day
+	)
+
+	if err := types.ValidStatsGranularity(granularity); err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+
+	startTime, endTime, err := statsTimeRange(ctx, time.Time{})
+	if err != nil {
+		ctx.BadRequest(err)
+		return
+	}
+	if startTime.IsZero() {
+		ctx.BadRequest("start_at required")
+		return
+	}
+	if retention := types.StatsGranularities[granularity].Retention; retention > 0 && time.Since(startTime) > retention {
+		ctx.BadRequest(fmt.Sprintf("the %s rollups are only kept for %s", granularity, retention))
+		return
+	}
+
+	num, err := scheduler.RollupAdbOrderStats(granularity, startTime, endTime)
+	if err != nil {
+		ctx.AutoError(err)
+		return
+	}
+
+	ctx.JSON(200, map[string]int{"rollups": num})
+}
+
+// parse the RFC3339 start_at & end_at query parameters, default [defaultStart, now)
+func statsTimeRange(ctx *httpmux.Context, defaultStart time.Time) (time.Time, time.Time, error) {
+	var (
+		startTime = defaultStart
+		endTime   = time.Now()
+		err       error
+	)
+
+	if startAt := ctx.Query["start_at"]; startAt != "" {
+		if startTime, err = time.Parse(time.RFC3339, startAt); err != nil {
+			return startTime, endTime, err
+		}
+	}
+	if endAt := ctx.Query["end_at"]; endAt != "" {
+		if endTime, err = time.Parse(time.RFC3339, endAt); err != nil {
+			return startTime, endTime, err
+		}
+	}
+	if !startTime.IsZero() && !startTime.Before(endTime) {
+		return startTime, endTime, errors.New("start_at must be earlier than end_at")
+	}
+
+	return startTime, endTime, nil
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -44,8 +45,8 @@ var (
 	AdbDeviceTableLine    = "{{.ID}}\t{{.SysInfo.DeviceName}}\t{{.NodeID}}\t" + AdbDeviceTableStatus + "\t{{.Weight}}\t{{.RecentAdbOrders.Today.Paid}}/{{.MaxBill}}\t{{.RecentAdbOrders.Today.PaidBill}}/{{.MaxAmountYuan}}\t{{.TodayPaidRate}}%\t{{.SysInfo.Manufacturer}} - {{.SysInfo.ProductModel}}\t{{.SysInfo.ReleaseVersion}} - SDK{{.SysInfo.SDKVersion}}\t" + AdbDeviceTableBattery + "\t{{tformat .SysInfo.BootTimeAt}}\t\n"
 
 	// adb device ui nodes
-	AdbDeviceUINodeTableHeader = "PACKAGE\tRESOURCE ID\tTEXT\tCONTENT DESC\tBOUNDS\tXY\t\n"
-	AdbDeviceUINodeTableLine   = "{{.Package}}\t{{.ResourceID}}\t{{.Text}}\t{{.ContentDesc}}\t{{.Bounds}}\t{{.XY}}\t\n"
+	AdbDeviceUINodeTableHeader = "PATH\tCLASS\tPACKAGE\tRESOURCE ID\tTEXT\tCONTENT DESC\tBOUNDS\tXY\t\n"
+	AdbDeviceUINodeTableLine   = "{{.Path}}\t{{.Class}}\t{{.Package}}\t{{.ResourceID}}\t{{.Text}}\t{{.ContentDesc}}\t{{.Bounds}}\t{{.XY}}\t\n"
 )
 
 var (
@@ -67,6 +68,28 @@ var (
 		},
 	}
 
+	dumpUIAdbDeviceFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "selector",
+			Usage: "only ui nodes matched the css-like selector, eg: 'ListView > TextView[text*=\"账单\"][clickable]'",
+		},
+	}
+
+	sysLogsAdbDeviceFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "buffers",
+			Usage: "logcat buffers, eg: main,system,radio,events,crash,all",
+		},
+		cli.StringFlag{
+			Name:  "tags",
+			Usage: "only logs with given tags, eg: ActivityManager,NotificationService",
+		},
+		cli.StringFlag{
+			Name:  "priority",
+			Usage: "minimal log priority, one of: V,D,I,W,E,F",
+		},
+	}
+
 	execAdbDeviceFlags = []cli.Flag{
 		cli.StringFlag{
 			Name:  "cmd",
@@ -111,6 +134,21 @@ var (
 		},
 	}
 
+	bindAdbDeviceWxpayFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "wxid",
+			Usage: "wechat id",
+		},
+		cli.StringFlag{
+			Name:  "username",
+			Usage: "wxpay username",
+		},
+		cli.StringFlag{
+			Name:  "nickname",
+			Usage: "wxpay nickname",
+		},
+	}
+
 	listAdbDeviceFlags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "quiet,q",
@@ -159,16 +197,26 @@ func AdbDeviceCommand() cli.Command {
 			adbDeviceInspectCommand(),      // inspect
 			adbDeviceScreenCapCommand(),    // screencap
 			adbDeviceDumpUICommand(),       // dumpui
+			adbDeviceSysLogsCommand(),      // syslogs
+			adbDeviceOpsCommand(),          // ops
+			adbDeviceCancelOpCommand(),     // cancel-op
 			adbDeviceClickCommand(),        // click
 			adbDeviceGobackCommand(),       // goback
 			adbDeviceGotoHomeCommand(),     // gotohome
 			adbDeviceRebootCommand(),       // reboot
 			adbDeviceExecCommand(),         // exec
+			adbDevicePullCommand(),         // pull
+			adbDevicePushCommand(),         // push
+			adbDevicePackagesCommand(),     // packages
+			adbDeviceInstallCommand(),      // install
+			adbDeviceUninstallCommand(),    // uninstall
 			adbDeviceSetBillCommand(),      // set-bill
 			adbDeviceSetAmountCommand(),    // set-amount
 			adbDeviceSetWeightCommand(),    // set-weight
 			adbDeviceBindAlipayCommand(),   // bind-alipay
 			adbDeviceRevokeAlipayCommand(), // revoke-alipay
+			adbDeviceBindWxpayCommand(),    // bind-wxpay
+			adbDeviceRevokeWxpayCommand(),  // revoke-wxpay
 			adbDeviceRemoveCommand(),       // rm
 		},
 	}
@@ -214,10 +262,39 @@ func adbDeviceDumpUICommand() cli.Command {
 		Name:      "dumpui",
 		Usage:     "dump ui nodes on an adb device",
 		ArgsUsage: "DEVICE",
+		Flags:     dumpUIAdbDeviceFlags,
 		Action:    dumpUIAdbDevice,
 	}
 }
 
+func adbDeviceSysLogsCommand() cli.Command {
+	return cli.Command{
+		Name:      "syslogs",
+		Usage:     "follow system logs on an adb device",
+		ArgsUsage: "DEVICE",
+		Flags:     sysLogsAdbDeviceFlags,
+		Action:    sysLogsAdbDevice,
+	}
+}
+
+func adbDeviceOpsCommand() cli.Command {
+	return cli.Command{
+		Name:      "ops",
+		Usage:     "show the op queue of an adb device",
+		ArgsUsage: "DEVICE",
+		Action:    opsAdbDevice,
+	}
+}
+
+func adbDeviceCancelOpCommand() cli.Command {
+	return cli.Command{
+		Name:      "cancel-op",
+		Usage:     "cancel a pending or running op on an adb device",
+		ArgsUsage: "DEVICE OP",
+		Action:    cancelOpAdbDevice,
+	}
+}
+
 func adbDeviceClickCommand() cli.Command {
 	return cli.Command{
 		Name:      "click",
@@ -314,6 +391,25 @@ func adbDeviceRevokeAlipayCommand() cli.Command {
 	}
 }
 
+func adbDeviceBindWxpayCommand() cli.Command {
+	return cli.Command{
+		Name:      "bind-wxpay",
+		Usage:     "bind abb device with wxpay account",
+		ArgsUsage: "DEVICE",
+		Flags:     bindAdbDeviceWxpayFlags,
+		Action:    bindAdbDeviceWxpay,
+	}
+}
+
+func adbDeviceRevokeWxpayCommand() cli.Command {
+	return cli.Command{
+		Name:      "revoke-wxpay",
+		Usage:     "revoke abb device wxpay account",
+		ArgsUsage: "DEVICE",
+		Action:    revokeAdbDeviceWxpay,
+	}
+}
+
 func adbDeviceRemoveCommand() cli.Command {
 	return cli.Command{
 		Name:      "rm",
@@ -549,7 +645,7 @@ func dumpUIAdbDevice(c *cli.Context) error {
 		return cli.ShowSubcommandHelp(c)
 	}
 
-	uinodes, err := client.DumpAdbDeviceUINodes(dvcID)
+	uinodes, err := client.DumpAdbDeviceUINodes(dvcID, c.String("selector"))
 	if err != nil {
 		return err
 	}
@@ -568,6 +664,47 @@ func dumpUIAdbDevice(c *cli.Context) error {
 	return nil
 }
 
+func sysLogsAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+	)
+
+	if dvcID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	filter := &adbot.SysLogFilter{
+		Buffers:  utils.SplitNonEmpty(c.String("buffers"), ","),
+		Tags:     utils.SplitNonEmpty(c.String("tags"), ","),
+		Priority: c.String("priority"),
+	}
+	if err := filter.Valid(); err != nil {
+		return err
+	}
+
+	stream, err := client.TailAdbDeviceSysLogs(dvcID, filter)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// only print sse `data ` prefixed line
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "data: ") {
+			fmt.Fprintln(os.Stdout, strings.TrimPrefix(line, "data: "))
+		}
+	}
+
+	return scanner.Err()
+}
+
 func clickAdbDevice(c *cli.Context) error {
 	client, err := helpers.NewClient()
 	if err != nil {
@@ -597,6 +734,52 @@ func clickAdbDevice(c *cli.Context) error {
 	return nil
 }
 
+func opsAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+	)
+
+	if dvcID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	stats, err := client.AdbDeviceOpQueue(dvcID)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, stats)
+}
+
+func cancelOpAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		opID  = c.Args().Get(1)
+	)
+
+	if dvcID == "" || opID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.CancelAdbDeviceOp(dvcID, opID)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte("+OK"), '\r', '\n'))
+	return nil
+}
+
 func gobackAdbDevice(c *cli.Context) error {
 	client, err := helpers.NewClient()
 	if err != nil {
@@ -820,6 +1003,57 @@ func revokeAdbDeviceAlipay(c *cli.Context) error {
 	return nil
 }
 
+func bindAdbDeviceWxpay(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		wxpay = &types.WxpayAccount{
+			WxID:     c.String("wxid"),
+			Username: c.String("username"),
+			Nickname: c.String("nickname"),
+		}
+	)
+
+	if dvcID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.BindAdbDeviceWxpay(dvcID, wxpay)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte("OK"), '\r', '\n'))
+	return nil
+}
+
+func revokeAdbDeviceWxpay(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+	)
+
+	if dvcID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.RevokeAdbDeviceWxpay(dvcID)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte("OK"), '\r', '\n'))
+	return nil
+}
+
 func removeAdbDevice(c *cli.Context) error {
 	client, err := helpers.NewClient()
 	if err != nil {
@@ -0,0 +1,367 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/bbklab/adbot/cli/helpers"
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/pkg/color"
+	"github.com/bbklab/adbot/pkg/label"
+	"github.com/bbklab/adbot/pkg/template"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/types"
+)
+
+// nolint
+var (
+	AdbFlowTableHeader = "FLOW ID\tNAME\tSTEPS\tDESC\tUPDATED AT\t\n"
+	AdbFlowTableLine   = "{{.ID}}\t{{.Name}}\t{{.NumSteps}}\t{{.Desc}}\t{{tformat .UpdatedAt}}\t\n"
+
+	AdbFlowRunTableHeader = "DEVICE ID\tSTEP\tACTION\t" + color.Yellow("STATUS") + "\tATTEMPTS\tCOST\tOUTPUT\tERROR\t\n"
+)
+
+var (
+	listAdbFlowFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet,q",
+			Usage: "only display numeric flow IDs",
+		},
+	}
+
+	addAdbFlowFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "file,f",
+			Usage: "the yaml or json flow document file",
+		},
+	}
+
+	runAdbFlowFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "device",
+			Usage: "run the flow on the adb device",
+		},
+		cli.StringFlag{
+			Name:  "labels",
+			Usage: "run the flow on all of online adb devices of the label-selected nodes, eg: 'key1=val1 key2=val2'",
+		},
+		cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "override the flow variable, eg: --var keyword=123456 --var amount=0.01",
+		},
+		cli.StringFlag{
+			Name:  "screenshot-dir",
+			Usage: "save the screenshots of failed steps into the directory",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the full json trace",
+		},
+	}
+)
+
+// AdbFlowCommand is exported
+func AdbFlowCommand() cli.Command {
+	return cli.Command{
+		Name:  "adb-flow",
+		Usage: "adb device automation flow management",
+		Subcommands: []cli.Command{
+			adbFlowListCommand(),    // ls
+			adbFlowInspectCommand(), // inspect
+			adbFlowAddCommand(),     // create
+			adbFlowUpdateCommand(),  // update
+			adbFlowRemoveCommand(),  // rm
+			adbFlowRunCommand(),     // run
+		},
+	}
+}
+
+func adbFlowListCommand() cli.Command {
+	return cli.Command{
+		Name:   "ls",
+		Usage:  "list adb flows",
+		Flags:  listAdbFlowFlags,
+		Action: listAdbFlows,
+	}
+}
+
+func adbFlowInspectCommand() cli.Command {
+	return cli.Command{
+		Name:      "inspect",
+		Usage:     "inspect details of an adb flow",
+		ArgsUsage: "FLOW",
+		Action:    inspectAdbFlow,
+	}
+}
+
+func adbFlowAddCommand() cli.Command {
+	return cli.Command{
+		Name:   "create",
+		Usage:  "create an adb flow by yaml or json document",
+		Flags:  addAdbFlowFlags,
+		Action: addAdbFlow,
+	}
+}
+
+func adbFlowUpdateCommand() cli.Command {
+	return cli.Command{
+		Name:      "update",
+		Usage:     "update an adb flow by yaml or json document",
+		ArgsUsage: "FLOW",
+		Flags:     addAdbFlowFlags,
+		Action:    updateAdbFlow,
+	}
+}
+
+func adbFlowRemoveCommand() cli.Command {
+	return cli.Command{
+		Name:      "rm",
+		Usage:     "remove an adb flow",
+		ArgsUsage: "FLOW",
+		Action:    rmAdbFlow,
+	}
+}
+
+func adbFlowRunCommand() cli.Command {
+	return cli.Command{
+		Name:      "run",
+		Usage:     "run an adb flow on one adb device or label-selected node devices",
+		ArgsUsage: "FLOW",
+		Flags:     runAdbFlowFlags,
+		Action:    runAdbFlow,
+	}
+}
+
+func listAdbFlows(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	flows, err := client.ListAdbFlows()
+	if err != nil {
+		return err
+	}
+
+	// only print ids
+	if c.Bool("quiet") {
+		for _, flow := range flows {
+			fmt.Fprintln(os.Stdout, flow.ID)
+		}
+		return nil
+	}
+
+	var (
+		w         = tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+		parser, _ = template.NewParser(AdbFlowTableLine)
+	)
+
+	fmt.Fprint(w, AdbFlowTableHeader)
+	for _, flow := range flows {
+		parser.Execute(w, flow)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func inspectAdbFlow(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		flowID = c.Args().First()
+	)
+
+	if flowID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	flow, err := client.InspectAdbFlow(flowID)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, flow)
+}
+
+func addAdbFlow(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		file = c.String("file")
+	)
+
+	if file == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	flow, err := client.AddAdbFlow(content)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(flow.ID), '\r', '\n'))
+	return nil
+}
+
+func updateAdbFlow(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		flowID = c.Args().First()
+		file   = c.String("file")
+	)
+
+	if flowID == "" || file == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	flow, err := client.UpdateAdbFlow(flowID, content)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, flow)
+}
+
+func rmAdbFlow(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		flowID = c.Args().First()
+	)
+
+	if flowID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.RemoveAdbFlow(flowID)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(flowID), '\r', '\n'))
+	return nil
+}
+
+func runAdbFlow(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		flowID = c.Args().First()
+		req    = &types.AdbFlowRunReq{
+			DeviceID: c.String("device"),
+			Vars:     make(map[string]string),
+		}
+		screenshotDir = c.String("screenshot-dir")
+	)
+
+	if flowID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	lbs, err := label.Parse(c.String("labels"))
+	if err != nil {
+		return err
+	}
+	req.Labels = map[string]string(lbs)
+
+	for _, pair := range c.StringSlice("var") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("[%s] is not valid var kv format", pair)
+		}
+		req.Vars[kv[0]] = kv[1]
+	}
+
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	results, err := client.RunAdbFlow(flowID, req)
+	if err != nil {
+		return err
+	}
+
+	// save the screenshots of failed steps
+	if screenshotDir != "" {
+		for _, r := range results {
+			if r.Result == nil {
+				continue
+			}
+			for _, step := range r.Result.Steps {
+				if len(step.Screenshot) == 0 {
+					continue
+				}
+				name := filepath.Join(screenshotDir, fmt.Sprintf("%s-%s-%d.png", r.Result.Flow, r.DeviceID, step.Index))
+				if err := ioutil.WriteFile(name, step.Screenshot, 0644); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if c.Bool("json") {
+		return utils.PrettyJSON(nil, results)
+	}
+
+	var (
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	)
+
+	fmt.Fprint(w, AdbFlowRunTableHeader)
+	for _, r := range results {
+		if r.Result == nil {
+			fmt.Fprintf(w, "%s\t-\t-\t%s\t-\t-\t-\t%s\t\n", r.DeviceID, color.Red(adbot.FlowStatusFailed), r.Errmsg)
+			continue
+		}
+		for _, step := range r.Result.Steps {
+			status := step.Status
+			switch status {
+			case adbot.FlowStatusSucceed:
+				status = color.Green(status)
+			case adbot.FlowStatusFailed:
+				status = color.Red(status)
+			}
+			name := step.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", step.Index)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t\n", r.DeviceID, name, step.Action, status, step.Attempts, step.Cost, utils.Truncate(step.Output, 40), step.Errmsg)
+		}
+	}
+	w.Flush()
+
+	return nil
+}
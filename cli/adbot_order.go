@@ -0,0 +1,472 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/bbklab/adbot/cli/helpers"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/types"
+)
+
+// nolint
+var (
+	AdbOrderCallbackTableHeader   = "ORDER ID\tOUT ORDER ID\tQRTYPE\tFEE\tTRIES\tNOTIFY URL\tLAST CALLBACK\t\n"
+	AdbOrderOverrideTableHeader   = "ORDER ID\tOUT ORDER ID\tMERCHANT\tPAY FEE\tACTION\tFROM\tTO\tSTATUS\tCALLBACK\tOPERATOR\tREASON\tTIME\t\n"
+	AdbOrderEventTableHeader      = "TIME\tEVENT\tMESSAGE\tATTRS\t\n"
+	AdbOrderSettlementTableHeader = "KEY\tNAME\tORDERS\tPAID\tLATE PAID\tPENDING\tTIMEOUT\tCLOSED\tFEE\tPAID FEE\tSUCCESS RATE\tAVG PAY TIME\t\n"
+)
+
+var (
+	listDeadAdbOrderCallbacksFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet,q",
+			Usage: "only display order IDs",
+		},
+	}
+
+	inspectAdbOrderFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "timeline",
+			Usage: "only display the lifecycle events of the order",
+		},
+	}
+
+	replayAdbOrderCallbacksFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "replay all of dead letter callbacks",
+		},
+	}
+
+	overrideAdbOrderFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "reason",
+			Usage: "the mandatory reason of the manual override, [4-256]",
+		},
+		cli.BoolFlag{
+			Name:  "callback",
+			Usage: "queue the merchant callback after marked as paid",
+		},
+	}
+
+	listAdbOrderOverridesFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "merchant",
+			Usage: "only the overrides of the merchant orders",
+		},
+		cli.StringFlag{
+			Name:  "operator",
+			Usage: "only the overrides by the operator",
+		},
+		cli.StringFlag{
+			Name:  "action",
+			Usage: "only the overrides of the action, eg: paid|timeout|void|refund",
+		},
+	}
+
+	// shared by export & settlement
+	adbOrderReportFilterFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "start-at",
+			Usage: "orders created since, eg: 2019-06-01 or 2019-06-01T08:00:00+08:00",
+		},
+		cli.StringFlag{
+			Name:  "end-at",
+			Usage: "orders created before, eg: 2019-07-01 or 2019-07-01T08:00:00+08:00",
+		},
+		cli.StringFlag{
+			Name:  "merchant",
+			Usage: "only the orders of the merchant",
+		},
+		cli.StringFlag{
+			Name:  "device",
+			Usage: "only the orders on the adb device",
+		},
+		cli.StringFlag{
+			Name:  "status",
+			Usage: "only the orders of the status, eg: pending|paid|timeout|closed|paid_after_timeout|void",
+		},
+	}
+
+	exportAdbOrdersFlags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Value: "csv",
+			Usage: "export file format, csv|xlsx",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "FILE  Write output to <file> instead of stdout",
+		},
+	}, adbOrderReportFilterFlags...)
+
+	adbOrderSettlementFlags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "group-by",
+			Value: "day",
+			Usage: "group the orders by, day|device|alipay|merchant",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "output format, table|json|csv|xlsx",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "FILE  Write output to <file> instead of stdout",
+		},
+	}, adbOrderReportFilterFlags...)
+)
+
+// AdbOrderCommand is exported
+func AdbOrderCommand() cli.Command {
+	return cli.Command{
+		Name:  "adb-order",
+		Usage: "adb order management",
+		Subcommands: []cli.Command{
+			adbOrderInspectCommand(),         // inspect
+			adbOrderDeadCallbacksCommand(),   // dead-callbacks
+			adbOrderReplayCallbacksCommand(), // replay-callbacks
+			adbOrderMarkCommand(),            // mark
+			adbOrderOverridesCommand(),       // overrides
+			adbOrderExportCommand(),          // export
+			adbOrderSettlementCommand(),      // settlement
+		},
+	}
+}
+
+func adbOrderInspectCommand() cli.Command {
+	return cli.Command{
+		Name:      "inspect",
+		Usage:     "inspect an adb order with its lifecycle events",
+		ArgsUsage: "ORDER",
+		Flags:     inspectAdbOrderFlags,
+		Action:    inspectAdbOrder,
+	}
+}
+
+func adbOrderDeadCallbacksCommand() cli.Command {
+	return cli.Command{
+		Name:   "dead-callbacks",
+		Usage:  "list adb orders with dead letter callbacks",
+		Flags:  listDeadAdbOrderCallbacksFlags,
+		Action: listDeadAdbOrderCallbacks,
+	}
+}
+
+func adbOrderReplayCallbacksCommand() cli.Command {
+	return cli.Command{
+		Name:      "replay-callbacks",
+		Usage:     "re-queue the dead letter callbacks of adb orders",
+		ArgsUsage: "ORDER [ORDER...]",
+		Flags:     replayAdbOrderCallbacksFlags,
+		Action:    replayAdbOrderCallbacks,
+	}
+}
+
+func adbOrderMarkCommand() cli.Command {
+	return cli.Command{
+		Name:      "mark",
+		Usage:     "manually mark an adb order as paid, timeout or void, or leave a refund note",
+		ArgsUsage: "ORDER paid|timeout|void|refund",
+		Flags:     overrideAdbOrderFlags,
+		Action:    overrideAdbOrder,
+	}
+}
+
+func adbOrderOverridesCommand() cli.Command {
+	return cli.Command{
+		Name:   "overrides",
+		Usage:  "list the manual overrides of adb orders for the review",
+		Flags:  listAdbOrderOverridesFlags,
+		Action: listAdbOrderOverrides,
+	}
+}
+
+func adbOrderExportCommand() cli.Command {
+	return cli.Command{
+		Name:   "export",
+		Usage:  "export adb orders to the csv or xlsx file",
+		Flags:  exportAdbOrdersFlags,
+		Action: exportAdbOrders,
+	}
+}
+
+func adbOrderSettlementCommand() cli.Command {
+	return cli.Command{
+		Name:   "settlement",
+		Usage:  "settlement report of adb orders grouped by day, device, alipay account or merchant",
+		Flags:  adbOrderSettlementFlags,
+		Action: adbOrderSettlement,
+	}
+}
+
+func inspectAdbOrder(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() != 1 {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	order, err := client.InspectAdbOrder(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("timeline") {
+		return utils.PrettyJSON(nil, order)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, AdbOrderEventTableHeader)
+	for _, ev := range order.Events {
+		attrs := make([]string, 0, len(ev.Attrs))
+		for key, val := range ev.Attrs {
+			attrs = append(attrs, key+"="+val)
+		}
+		sort.Strings(attrs)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n",
+			ev.Time.Format(time.RFC3339), ev.Type, utils.Truncate(ev.Message, 60), strings.Join(attrs, " "))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func listDeadAdbOrderCallbacks(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	orders, err := client.ListDeadAdbOrderCallbacks()
+	if err != nil {
+		return err
+	}
+
+	// only print ids
+	if c.Bool("quiet") {
+		for _, order := range orders {
+			fmt.Fprintln(os.Stdout, order.ID)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, AdbOrderCallbackTableHeader)
+	for _, order := range orders {
+		var last string
+		if n := len(order.CallbackHistory); n > 0 {
+			last = order.CallbackHistory[n-1]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%0.2f\t%d\t%s\t%s\t\n", order.ID, order.OutOrderID, order.QRType, order.FeeYuan, order.CallbackTries, order.NotifyURL, utils.Truncate(last, 60))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func replayAdbOrderCallbacks(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		all = c.Bool("all")
+		ids = []string(c.Args())
+	)
+
+	if !all && len(ids) == 0 {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	replayed, err := client.ReplayAdbOrderCallbacks(all, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range replayed {
+		fmt.Fprintln(os.Stdout, id)
+	}
+	return nil
+}
+
+func overrideAdbOrder(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() != 2 {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	req := &types.AdbOrderOverrideReq{
+		Action:   c.Args().Get(1),
+		Reason:   c.String("reason"),
+		Callback: c.Bool("callback"),
+	}
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	override, err := client.OverrideAdbOrder(c.Args().First(), req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: %s -> %s\r\n", c.Args().First(), override.From, override.To)
+	return nil
+}
+
+func listAdbOrderOverrides(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	overrides, err := client.ListAdbOrderOverrides(c.String("merchant"), c.String("operator"), c.String("action"))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, AdbOrderOverrideTableHeader)
+	for _, o := range overrides {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%0.2f\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\t\n",
+			o.OrderID, o.OutOrderID, o.MerchantID, float64(o.PayFee)/100, o.Action, o.From, o.To, o.Status,
+			o.Callback, o.Operator, utils.Truncate(o.Reason, 40), o.Time.Format(time.RFC3339))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func exportAdbOrders(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	filter, err := newAdbOrderReportFilter(c)
+	if err != nil {
+		return err
+	}
+
+	stream, err := client.ExportAdbOrders(filter, c.String("format"))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	return writeOutput(c.String("output"), stream)
+}
+
+func adbOrderSettlement(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		groupBy = c.String("group-by")
+		format  = c.String("format")
+	)
+
+	filter, err := newAdbOrderReportFilter(c)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv", "xlsx":
+		stream, err := client.ExportAdbOrderSettlement(filter, groupBy, format)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		return writeOutput(c.String("output"), stream)
+	}
+
+	report, err := client.AdbOrderSettlement(filter, groupBy)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		return utils.PrettyJSON(nil, report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, AdbOrderSettlementTableHeader)
+	for _, row := range append(report.Rows, report.Total) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%0.2f\t%0.2f\t%0.2f%%\t%s\t\n",
+			row.Key, utils.Truncate(row.Name, 20), row.Orders, row.Paid, row.PaidAfterTimeout, row.Pending, row.Timeout, row.Closed,
+			float64(row.Fee)/100, float64(row.PaidFee)/100, row.SuccessRate*100, time.Duration(row.AvgPaySeconds)*time.Second)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func newAdbOrderReportFilter(c *cli.Context) (*types.AdbOrderReportFilter, error) {
+	filter := &types.AdbOrderReportFilter{
+		MerchantID: c.String("merchant"),
+		DeviceID:   c.String("device"),
+		Status:     c.String("status"),
+	}
+
+	var err error
+	if v := c.String("start-at"); v != "" {
+		if filter.StartAt, err = parseReportTime(v); err != nil {
+			return nil, fmt.Errorf("start-at: %v", err)
+		}
+	}
+	if v := c.String("end-at"); v != "" {
+		if filter.EndAt, err = parseReportTime(v); err != nil {
+			return nil, fmt.Errorf("end-at: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+// parse the local date or the RFC3339 time
+func parseReportTime(v string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// write the stream to the file, or stdout if no file given
+func writeOutput(output string, stream io.Reader) error {
+	if output == "" {
+		_, err := io.Copy(os.Stdout, stream)
+		return err
+	}
+
+	fd, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if _, err := io.Copy(fd, stream); err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(output), '\r', '\n'))
+	return nil
+}
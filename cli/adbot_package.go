@@ -0,0 +1,409 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/bbklab/adbot/cli/helpers"
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/pkg/color"
+	"github.com/bbklab/adbot/pkg/label"
+	"github.com/bbklab/adbot/pkg/template"
+	"github.com/bbklab/adbot/types"
+)
+
+// nolint
+var (
+	AdbPackageTableHeader = "PACKAGE\tVERSION NAME\tVERSION CODE\tLAST UPDATE\tCODE PATH\t\n"
+	AdbPackageTableLine   = "{{.Name}}\t{{.VersionName}}\t{{.VersionCode}}\t{{.LastUpdateTime}}\t{{.CodePath}}\t\n"
+)
+
+var (
+	pullAdbDeviceFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "the absolute file path on the adb device",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "the local file path, default the base name of the device file path",
+		},
+	}
+
+	pushAdbDeviceFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "file,f",
+			Usage: "the local file to be pushed",
+		},
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "the absolute file path on the adb device",
+		},
+		cli.StringFlag{
+			Name:  "mode",
+			Usage: "the octal file permission bits on the adb device",
+			Value: "0644",
+		},
+	}
+
+	packagesAdbDeviceFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "third-party",
+			Usage: "only display the third party packages",
+		},
+	}
+
+	installAdbDeviceFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "file,f",
+			Usage: "the local apk file",
+		},
+	}
+
+	rolloutAdbPackageFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "file,f",
+			Usage: "the local apk file",
+		},
+		cli.StringFlag{
+			Name:  "labels",
+			Usage: "install onto all of online adb devices of the label-selected nodes, eg: 'key1=val1 key2=val2'",
+		},
+		cli.StringFlag{
+			Name:  "package",
+			Usage: "the package name of the apk, to query the installed version after each installation",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "max concurrent installations, must between [1-50]",
+			Value: 5,
+		},
+	}
+)
+
+// AdbPackageCommand is exported
+func AdbPackageCommand() cli.Command {
+	return cli.Command{
+		Name:  "adb-package",
+		Usage: "adb device packages bulk management",
+		Subcommands: []cli.Command{
+			adbPackageRolloutCommand(), // rollout
+		},
+	}
+}
+
+func adbDevicePullCommand() cli.Command {
+	return cli.Command{
+		Name:      "pull",
+		Usage:     "pull a file from an adb device",
+		ArgsUsage: "DEVICE",
+		Flags:     pullAdbDeviceFlags,
+		Action:    pullAdbDevice,
+	}
+}
+
+func adbDevicePushCommand() cli.Command {
+	return cli.Command{
+		Name:      "push",
+		Usage:     "push a file onto an adb device",
+		ArgsUsage: "DEVICE",
+		Flags:     pushAdbDeviceFlags,
+		Action:    pushAdbDevice,
+	}
+}
+
+func adbDevicePackagesCommand() cli.Command {
+	return cli.Command{
+		Name:      "packages",
+		Usage:     "list installed packages on an adb device, or query the given package version",
+		ArgsUsage: "DEVICE [PACKAGE]",
+		Flags:     packagesAdbDeviceFlags,
+		Action:    packagesAdbDevice,
+	}
+}
+
+func adbDeviceInstallCommand() cli.Command {
+	return cli.Command{
+		Name:      "install",
+		Usage:     "install or upgrade an apk on an adb device",
+		ArgsUsage: "DEVICE",
+		Flags:     installAdbDeviceFlags,
+		Action:    installAdbDevice,
+	}
+}
+
+func adbDeviceUninstallCommand() cli.Command {
+	return cli.Command{
+		Name:      "uninstall",
+		Usage:     "uninstall a package on an adb device",
+		ArgsUsage: "DEVICE PACKAGE",
+		Action:    uninstallAdbDevice,
+	}
+}
+
+func adbPackageRolloutCommand() cli.Command {
+	return cli.Command{
+		Name:   "rollout",
+		Usage:  "install an apk onto all of online adb devices of the label-selected nodes",
+		Flags:  rolloutAdbPackageFlags,
+		Action: rolloutAdbPackage,
+	}
+}
+
+func pullAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID  = c.Args().First()
+		src    = c.String("path")
+		output = c.String("output")
+	)
+
+	if dvcID == "" || src == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+	if output == "" {
+		output = path.Base(src)
+	}
+
+	stream, err := client.PullAdbDeviceFile(dvcID, src)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	fd, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if _, err := io.Copy(fd, stream); err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(output), '\r', '\n'))
+	return nil
+}
+
+func pushAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		file  = c.String("file")
+		dst   = c.String("path")
+	)
+
+	if dvcID == "" || file == "" || dst == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	if err := adbot.ValidDevicePath(dst); err != nil {
+		return err
+	}
+	mode, err := adbot.ParseFileMode(c.String("mode"))
+	if err != nil {
+		return err
+	}
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	err = client.PushAdbDeviceFile(dvcID, dst, mode, fd)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(dst), '\r', '\n'))
+	return nil
+}
+
+func packagesAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		name  = c.Args().Get(1)
+		pkgs  []*adbot.AndroidPackage
+	)
+
+	if dvcID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	if name != "" {
+		pkg, err := client.InspectAdbDevicePackage(dvcID, name)
+		if err != nil {
+			return err
+		}
+		pkgs = []*adbot.AndroidPackage{pkg}
+	} else {
+		pkgs, err = client.ListAdbDevicePackages(dvcID, c.Bool("third-party"))
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		w         = tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+		parser, _ = template.NewParser(AdbPackageTableLine)
+	)
+
+	fmt.Fprint(w, AdbPackageTableHeader)
+	for _, pkg := range pkgs {
+		parser.Execute(w, pkg)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func installAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		file  = c.String("file")
+	)
+
+	if dvcID == "" || file == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	err = client.InstallAdbDevicePackage(dvcID, fd)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte("+OK"), '\r', '\n'))
+	return nil
+}
+
+func uninstallAdbDevice(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dvcID = c.Args().First()
+		name  = c.Args().Get(1)
+	)
+
+	if dvcID == "" || name == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.UninstallAdbDevicePackage(dvcID, name)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(name), '\r', '\n'))
+	return nil
+}
+
+func rolloutAdbPackage(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		file = c.String("file")
+		req  = &types.AdbPackageRolloutReq{
+			Package:     c.String("package"),
+			Concurrency: c.Int("concurrency"),
+		}
+	)
+
+	if file == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	lbs, err := label.Parse(c.String("labels"))
+	if err != nil {
+		return err
+	}
+	req.Labels = map[string]string(lbs)
+
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	stream, err := client.RolloutAdbPackage(req, fd)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// only print sse `data ` prefixed line of progress event
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+
+		var p *types.AdbPackageRolloutProgress
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &p); err != nil {
+			return err
+		}
+
+		status := p.Status
+		switch status {
+		case types.AdbPackageRolloutSucceed:
+			status = color.Green(status)
+		case types.AdbPackageRolloutFailed:
+			status = color.Red(status)
+		case types.AdbPackageRolloutSkipped:
+			status = color.Magenta(status)
+		}
+		line = fmt.Sprintf("[%d/%d] %s@%s %s", p.Done, p.Total, p.DeviceID, p.NodeID, status)
+		if p.Package != nil {
+			line += fmt.Sprintf(" %s %s(%d)", p.Package.Name, p.Package.VersionName, p.Package.VersionCode)
+		}
+		if p.Errmsg != "" {
+			line += " " + p.Errmsg
+		}
+		fmt.Fprintln(os.Stdout, line)
+	}
+
+	return scanner.Err()
+}
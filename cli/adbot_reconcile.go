@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/bbklab/adbot/cli/helpers"
+	"github.com/bbklab/adbot/pkg/utils"
+)
+
+// nolint
+var (
+	AdbReconcileTableHeader = "DATE\tSTATUS\tDEVICES\tBILLS\tORDERS\tISSUES\tERRORS\tFINISHED AT\t\n"
+)
+
+var (
+	listAdbReconcileFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet,q",
+			Usage: "only display reconciliation dates",
+		},
+	}
+
+	runAdbReconcileFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "date",
+			Usage: "the day to reconcile, eg: 2019-06-10, default yesterday",
+		},
+	}
+)
+
+// AdbReconcileCommand is exported
+func AdbReconcileCommand() cli.Command {
+	return cli.Command{
+		Name:  "adb-reconcile",
+		Usage: "adb daily reconciliation of the device bills against the orders",
+		Subcommands: []cli.Command{
+			adbReconcileListCommand(),    // ls
+			adbReconcileInspectCommand(), // inspect
+			adbReconcileRunCommand(),     // run
+		},
+	}
+}
+
+func adbReconcileListCommand() cli.Command {
+	return cli.Command{
+		Name:   "ls",
+		Usage:  "list adb daily reconciliation reports",
+		Flags:  listAdbReconcileFlags,
+		Action: listAdbReconciles,
+	}
+}
+
+func adbReconcileInspectCommand() cli.Command {
+	return cli.Command{
+		Name:      "inspect",
+		Usage:     "inspect details of an adb daily reconciliation report",
+		ArgsUsage: "DATE",
+		Action:    inspectAdbReconcile,
+	}
+}
+
+func adbReconcileRunCommand() cli.Command {
+	return cli.Command{
+		Name:   "run",
+		Usage:  "run the adb daily reconciliation in background",
+		Flags:  runAdbReconcileFlags,
+		Action: runAdbReconcile,
+	}
+}
+
+func listAdbReconciles(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	reconciles, err := client.ListAdbReconciles()
+	if err != nil {
+		return err
+	}
+
+	// only print ids
+	if c.Bool("quiet") {
+		for _, reconcile := range reconciles {
+			fmt.Fprintln(os.Stdout, reconcile.ID)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, AdbReconcileTableHeader)
+	for _, reconcile := range reconciles {
+		var finishedAt = "-"
+		if !reconcile.FinishedAt.IsZero() {
+			finishedAt = reconcile.FinishedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			reconcile.ID, reconcile.Status, len(reconcile.Devices), reconcile.NumBills, reconcile.NumOrders,
+			reconcile.NumIssues, reconcile.NumErrors, finishedAt)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func inspectAdbReconcile(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		date = c.Args().First()
+	)
+
+	if date == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	reconcile, err := client.InspectAdbReconcile(date)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, reconcile)
+}
+
+func runAdbReconcile(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.RunAdbReconcile(c.String("date")); err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte("OK"), '\r', '\n'))
+	return nil
+}
@@ -16,6 +16,11 @@ var (
 			Usage:  "The address of masters to join, eg: 127.0.0.1:88,127.0.0.1:89",
 			EnvVar: "JOIN_ADDRS",
 		},
+		cli.IntFlag{
+			Name:   "adb-simulator",
+			Usage:  "Serving on in-memory adb simulator with given number of virtual devices instead of the real adb host, for tests and demos",
+			EnvVar: "ADB_SIMULATOR",
+		},
 	}
 )
 
@@ -44,7 +49,8 @@ func runAgentAndJoin(c *cli.Context) error {
 
 func newAgentConfig(c *cli.Context) (*types.AgentConfig, error) {
 	var (
-		addrArgs = c.String("addrs")
+		addrArgs     = c.String("addrs")
+		adbSimulator = c.Int("adb-simulator")
 	)
 
 	var addrs = []string{}
@@ -53,7 +59,8 @@ func newAgentConfig(c *cli.Context) (*types.AgentConfig, error) {
 	}
 
 	cfg := &types.AgentConfig{
-		JoinAddrs: addrs,
+		JoinAddrs:    addrs,
+		AdbSimulator: adbSimulator,
 	}
 
 	if err := cfg.Valid(); err != nil {
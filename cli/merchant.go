@@ -0,0 +1,430 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/bbklab/adbot/cli/helpers"
+	"github.com/bbklab/adbot/pkg/ptype"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/types"
+)
+
+// nolint
+var (
+	MerchantTableHeader = "MERCHANT ID\tNAME\tSTATUS\tQRTYPES\tFEE LIMIT\tDEVICES\tTODAY PAID\tDESC\t\n"
+)
+
+var (
+	listMerchantFlags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet,q",
+			Usage: "only display merchant IDs",
+		},
+	}
+
+	// shared by create & update
+	merchantFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "merchant name",
+		},
+		cli.StringFlag{
+			Name:  "notify-url",
+			Usage: "default callback notify url if the order request not provided",
+		},
+		cli.StringFlag{
+			Name:  "qrtypes",
+			Usage: "allowed qrcode types, eg: alipay,wxpay, empty means all",
+		},
+		cli.StringFlag{
+			Name:  "min-fee",
+			Usage: "min order fee by CNY cent, 0 means unlimit",
+		},
+		cli.StringFlag{
+			Name:  "max-fee",
+			Usage: "max order fee by CNY cent, 0 means unlimit",
+		},
+		cli.StringFlag{
+			Name:  "devices",
+			Usage: "dedicated adb device ids, eg: dvc1,dvc2, empty means the shared device pool",
+		},
+		cli.StringFlag{
+			Name:  "sign-legacy",
+			Usage: "accept the legacy MD5 signature or not",
+		},
+		cli.StringFlag{
+			Name:  "sign-legacy-v2",
+			Usage: "the legacy MD5 callback signature covers the order status or not",
+		},
+		cli.StringFlag{
+			Name:  "callback-backoff",
+			Usage: "callback failure retry backoff, eg: 10s,30s,2m, empty means default",
+		},
+		cli.StringFlag{
+			Name:  "pickup-strategy",
+			Usage: "adb device pickup strategy, eg weight|round-robin|least-pending|quota-headroom|success-rate|sticky-payer, empty means follow the settings",
+		},
+		cli.StringFlag{
+			Name:  "order-ttl",
+			Usage: "default order ttl in seconds if the order request not provided, [120-900], 0 means default 300",
+		},
+		cli.StringFlag{
+			Name:  "device-hold",
+			Usage: "seconds the timeout order keeps holding its payable amount on the device, [0-1800], 0 means never",
+		},
+		cli.StringFlag{
+			Name:  "disabled",
+			Usage: "disable the merchant creating new orders or not",
+		},
+		cli.StringFlag{
+			Name:  "desc",
+			Usage: "merchant description",
+		},
+	}
+
+	addMerchantFlags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "merchant id, as the app id of the paygate requests, default random generated",
+		},
+		cli.StringFlag{
+			Name:  "secret",
+			Usage: "merchant secret key, default random generated",
+		},
+	}, merchantFlags...)
+)
+
+// MerchantCommand is exported
+func MerchantCommand() cli.Command {
+	return cli.Command{
+		Name:  "merchant",
+		Usage: "paygate merchant management",
+		Subcommands: []cli.Command{
+			merchantListCommand(),        // ls
+			merchantInspectCommand(),     // inspect
+			merchantAddCommand(),         // create
+			merchantUpdateCommand(),      // update
+			merchantResetSecretCommand(), // reset-secret
+			merchantRemoveCommand(),      // rm
+		},
+	}
+}
+
+func merchantListCommand() cli.Command {
+	return cli.Command{
+		Name:   "ls",
+		Usage:  "list paygate merchants",
+		Flags:  listMerchantFlags,
+		Action: listMerchants,
+	}
+}
+
+func merchantInspectCommand() cli.Command {
+	return cli.Command{
+		Name:      "inspect",
+		Usage:     "inspect details of a paygate merchant",
+		ArgsUsage: "MERCHANT",
+		Action:    inspectMerchant,
+	}
+}
+
+func merchantAddCommand() cli.Command {
+	return cli.Command{
+		Name:   "create",
+		Usage:  "create a paygate merchant",
+		Flags:  addMerchantFlags,
+		Action: addMerchant,
+	}
+}
+
+func merchantUpdateCommand() cli.Command {
+	return cli.Command{
+		Name:      "update",
+		Usage:     "update a paygate merchant",
+		ArgsUsage: "MERCHANT",
+		Flags:     merchantFlags,
+		Action:    updateMerchant,
+	}
+}
+
+func merchantResetSecretCommand() cli.Command {
+	return cli.Command{
+		Name:      "reset-secret",
+		Usage:     "rotate the secret key of a paygate merchant",
+		ArgsUsage: "MERCHANT",
+		Action:    resetMerchantSecret,
+	}
+}
+
+func merchantRemoveCommand() cli.Command {
+	return cli.Command{
+		Name:      "rm",
+		Usage:     "remove a paygate merchant",
+		ArgsUsage: "MERCHANT",
+		Action:    rmMerchant,
+	}
+}
+
+func listMerchants(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	merchants, err := client.ListMerchants()
+	if err != nil {
+		return err
+	}
+
+	// only print ids
+	if c.Bool("quiet") {
+		for _, merchant := range merchants {
+			fmt.Fprintln(os.Stdout, merchant.ID)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', 0)
+	fmt.Fprint(w, MerchantTableHeader)
+	for _, merchant := range merchants {
+		var (
+			status   = "enabled"
+			qrtypes  = "all"
+			devices  = "shared"
+			feelimit = fmt.Sprintf("%d-%d", merchant.MinFee, merchant.MaxFee)
+			today    = merchant.RecentAdbOrders.Today
+		)
+		if merchant.Disabled {
+			status = "disabled"
+		}
+		if len(merchant.QRTypes) > 0 {
+			qrtypes = strings.Join(merchant.QRTypes, ",")
+		}
+		if n := len(merchant.Devices); n > 0 {
+			devices = strconv.Itoa(n)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d/%0.2f\t%s\t\n", merchant.ID, merchant.Name, status, qrtypes, feelimit, devices, today.Paid, today.PaidBill, utils.Truncate(merchant.Desc, 40))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func inspectMerchant(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		merchantID = c.Args().First()
+	)
+
+	if merchantID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	merchant, err := client.InspectMerchant(merchantID)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, merchant)
+}
+
+func addMerchant(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if c.String("name") == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	req, err := newUpdateMerchantReq(c)
+	if err != nil {
+		return err
+	}
+
+	merchant := &types.Merchant{
+		ID:     c.String("id"),
+		Secret: c.String("secret"),
+	}
+	req.Apply(merchant)
+
+	created, err := client.AddMerchant(merchant)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, created) // note: the secret is only shown once
+}
+
+func updateMerchant(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		merchantID = c.Args().First()
+	)
+
+	if merchantID == "" || c.NumFlags() == 0 {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	req, err := newUpdateMerchantReq(c)
+	if err != nil {
+		return err
+	}
+
+	merchant, err := client.UpdateMerchant(merchantID, req)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrettyJSON(nil, merchant)
+}
+
+func resetMerchantSecret(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		merchantID = c.Args().First()
+	)
+
+	if merchantID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	merchant, err := client.ResetMerchantSecret(merchantID)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(merchant.Secret), '\r', '\n'))
+	return nil
+}
+
+func rmMerchant(c *cli.Context) error {
+	client, err := helpers.NewClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		merchantID = c.Args().First()
+	)
+
+	if merchantID == "" {
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	err = client.RemoveMerchant(merchantID)
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(append([]byte(merchantID), '\r', '\n'))
+	return nil
+}
+
+// build the merchant update request by the given flags
+func newUpdateMerchantReq(c *cli.Context) (*types.UpdateMerchantReq, error) {
+	var req = new(types.UpdateMerchantReq)
+
+	if c.IsSet("name") {
+		req.Name = ptype.String(c.String("name"))
+	}
+	if c.IsSet("notify-url") {
+		req.NotifyURL = ptype.String(c.String("notify-url"))
+	}
+	if c.IsSet("qrtypes") {
+		req.QRTypes = splitCommaList(c.String("qrtypes"))
+	}
+	if c.IsSet("min-fee") {
+		v, err := strconv.Atoi(c.String("min-fee"))
+		if err != nil {
+			return nil, fmt.Errorf("min-fee: %v", err)
+		}
+		req.MinFee = ptype.Int(v)
+	}
+	if c.IsSet("max-fee") {
+		v, err := strconv.Atoi(c.String("max-fee"))
+		if err != nil {
+			return nil, fmt.Errorf("max-fee: %v", err)
+		}
+		req.MaxFee = ptype.Int(v)
+	}
+	if c.IsSet("devices") {
+		req.Devices = splitCommaList(c.String("devices"))
+	}
+	if c.IsSet("sign-legacy") {
+		v, err := strconv.ParseBool(c.String("sign-legacy"))
+		if err != nil {
+			return nil, fmt.Errorf("sign-legacy: %v", err)
+		}
+		req.SignLegacy = ptype.Bool(v)
+	}
+	if c.IsSet("sign-legacy-v2") {
+		v, err := strconv.ParseBool(c.String("sign-legacy-v2"))
+		if err != nil {
+			return nil, fmt.Errorf("sign-legacy-v2: %v", err)
+		}
+		req.SignLegacyV2 = ptype.Bool(v)
+	}
+	if c.IsSet("callback-backoff") {
+		req.CallbackBackoff = ptype.String(c.String("callback-backoff"))
+	}
+	if c.IsSet("pickup-strategy") {
+		req.PickupStrategy = ptype.String(c.String("pickup-strategy"))
+	}
+	if c.IsSet("order-ttl") {
+		v, err := strconv.Atoi(c.String("order-ttl"))
+		if err != nil {
+			return nil, fmt.Errorf("order-ttl: %v", err)
+		}
+		req.OrderTTL = ptype.Int(v)
+	}
+	if c.IsSet("device-hold") {
+		v, err := strconv.Atoi(c.String("device-hold"))
+		if err != nil {
+			return nil, fmt.Errorf("device-hold: %v", err)
+		}
+		req.DeviceHold = ptype.Int(v)
+	}
+	if c.IsSet("disabled") {
+		v, err := strconv.ParseBool(c.String("disabled"))
+		if err != nil {
+			return nil, fmt.Errorf("disabled: %v", err)
+		}
+		req.Disabled = ptype.Bool(v)
+	}
+	if c.IsSet("desc") {
+		req.Desc = ptype.String(c.String("desc"))
+	}
+
+	return req, nil
+}
+
+// split the comma separated list, the empty string means an empty list
+func splitCommaList(s string) *[]string {
+	ret := []string{}
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			ret = append(ret, field)
+		}
+	}
+	return &ret
+}
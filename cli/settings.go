@@ -33,6 +33,22 @@ var (
 			Name:  "telegram-bot-token",
 			Usage: "telegram bot token",
 		},
+		cli.StringFlag{
+			Name:  "telegram-chat-id",
+			Usage: "telegram chat id to push the reports, send `chatid` to the bot to get it, 0 means never",
+		},
+		cli.StringFlag{
+			Name:  "pickup-strategy",
+			Usage: "default adb device pickup strategy, eg weight|round-robin|least-pending|quota-headroom|success-rate|sticky-payer",
+		},
+		cli.StringFlag{
+			Name:  "pay-fee-offset",
+			Usage: "max cents to reduce the payable amount to keep it uniq on the device, 0 means never",
+		},
+		cli.StringFlag{
+			Name:  "cashier-base-url",
+			Usage: "external base url of the hosted cashier pages, eg https://pay.example.com, empty means by the paygate request host",
+		},
 	}
 
 	removeGlobalAttrFlags = []cli.Flag{
@@ -149,6 +165,26 @@ func updateSettings(c *cli.Context) error {
 	if v := c.String("telegram-bot-token"); v != "" {
 		req.TGBotToken = ptype.String(v)
 	}
+	if v := c.String("telegram-chat-id"); v != "" {
+		vv, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("telegram-chat-id: %v", err)
+		}
+		req.TGChatID = ptype.Int64(vv)
+	}
+	if c.IsSet("pickup-strategy") { // empty means default
+		req.PickupStrategy = ptype.String(c.String("pickup-strategy"))
+	}
+	if v := c.String("pay-fee-offset"); v != "" {
+		vv, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("pay-fee-offset: %v", err)
+		}
+		req.PayFeeOffset = ptype.Int(vv)
+	}
+	if c.IsSet("cashier-base-url") { // empty means by the request host
+		req.CashierBaseURL = ptype.String(c.String("cashier-base-url"))
+	}
 
 	if _, err := client.UpdateSettings(req); err != nil {
 		return err
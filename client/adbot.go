@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"strings"
 
 	"github.com/bbklab/adbot/pkg/adbot"
 	"github.com/bbklab/adbot/types"
@@ -106,8 +108,11 @@ func (c *AdbotClient) ScreenCapAdbDevice(id string) ([]byte, error) {
 }
 
 // DumpAdbDeviceUINodes implement Client interface
-func (c *AdbotClient) DumpAdbDeviceUINodes(id string) ([]*adbot.AndroidUINode, error) {
-	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/uinodes", id), nil, 0, "", "")
+func (c *AdbotClient) DumpAdbDeviceUINodes(id, selector string) ([]*adbot.AndroidUINode, error) {
+	query := url.Values{}
+	query.Set("selector", selector)
+
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/uinodes?%s", id, query.Encode()), nil, 0, "", "")
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +128,61 @@ func (c *AdbotClient) DumpAdbDeviceUINodes(id string) ([]*adbot.AndroidUINode, e
 	return ret, err
 }
 
+// TailAdbDeviceSysLogs implement Client interface
+func (c *AdbotClient) TailAdbDeviceSysLogs(id string, filter *adbot.SysLogFilter) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("buffers", strings.Join(filter.Buffers, ","))
+	query.Set("tags", strings.Join(filter.Tags, ","))
+	query.Set("priority", filter.Priority)
+
+	resp, err := c.sendRequest("GET", "/api/adb_devices/"+id+"/syslogs?"+query.Encode(), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{code, string(bs)}
+	}
+
+	return resp.Body, nil
+}
+
+// AdbDeviceOpQueue implement Client interface
+func (c *AdbotClient) AdbDeviceOpQueue(id string) (*adbot.OpQueueStats, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/ops", id), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *adbot.OpQueueStats
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// CancelAdbDeviceOp implement Client interface
+func (c *AdbotClient) CancelAdbDeviceOp(id, opID string) error {
+	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/adb_devices/%s/ops/%s", id, opID), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
 // ClickAdbDevice implement Client interface
 func (c *AdbotClient) ClickAdbDevice(id string, x, y int) error {
 	resp, err := c.sendRequest("PATCH", fmt.Sprintf("/api/adb_devices/%s/click?x=%d&y=%d", id, x, y), nil, 0, "", "")
@@ -284,6 +344,38 @@ func (c *AdbotClient) RevokeAdbDeviceAlipay(id string) error {
 	return nil
 }
 
+// BindAdbDeviceWxpay implement Client interface
+func (c *AdbotClient) BindAdbDeviceWxpay(id string, wxpay *types.WxpayAccount) error {
+	resp, err := c.sendRequest("PUT", fmt.Sprintf("/api/adb_devices/%s/wxpay", id), wxpay, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
+// RevokeAdbDeviceWxpay implement Client interface
+func (c *AdbotClient) RevokeAdbDeviceWxpay(id string) error {
+	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/adb_devices/%s/wxpay", id), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 && code != 204 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
 // RemoveAdbDevice implement Client interface
 func (c *AdbotClient) RemoveAdbDevice(id string) error {
 	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/adb_devices/%s", id), nil, 0, "", "")
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb flows
+//
+
+// ListAdbFlows implement Client interface
+func (c *AdbotClient) ListAdbFlows() ([]*types.AdbFlow, error) {
+	resp, err := c.sendRequest("GET", "/api/adb_flows", nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.AdbFlow
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// InspectAdbFlow implement Client interface
+func (c *AdbotClient) InspectAdbFlow(id string) (*types.AdbFlow, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_flows/%s", id), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbFlow
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// AddAdbFlow implement Client interface
+func (c *AdbotClient) AddAdbFlow(content []byte) (*types.AdbFlow, error) {
+	resp, err := c.sendRequest("POST", "/api/adb_flows", content, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 201 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbFlow
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// UpdateAdbFlow implement Client interface
+func (c *AdbotClient) UpdateAdbFlow(id string, content []byte) (*types.AdbFlow, error) {
+	resp, err := c.sendRequest("PUT", fmt.Sprintf("/api/adb_flows/%s", id), content, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbFlow
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// RemoveAdbFlow implement Client interface
+func (c *AdbotClient) RemoveAdbFlow(id string) error {
+	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/adb_flows/%s", id), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
+// RunAdbFlow implement Client interface
+func (c *AdbotClient) RunAdbFlow(id string, req *types.AdbFlowRunReq) ([]*types.AdbFlowRunResult, error) {
+	resp, err := c.sendRequest("POST", fmt.Sprintf("/api/adb_flows/%s/run", id), req, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.AdbFlowRunResult
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
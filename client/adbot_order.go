@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb orders
+//
+
+// InspectAdbOrder implement Client interface
+func (c *AdbotClient) InspectAdbOrder(id string) (*types.AdbOrderWrapper, error) {
+	resp, err := c.sendRequest("GET", "/api/adb_orders/"+id, nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbOrderWrapper
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ListDeadAdbOrderCallbacks implement Client interface
+func (c *AdbotClient) ListDeadAdbOrderCallbacks() ([]*types.AdbOrderWrapper, error) {
+	resp, err := c.sendRequest("GET", "/api/adb_order_callbacks/dead", nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.AdbOrderWrapper
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ReplayAdbOrderCallbacks implement Client interface
+func (c *AdbotClient) ReplayAdbOrderCallbacks(all bool, ids []string) ([]string, error) {
+	resp, err := c.sendRequest("PUT", fmt.Sprintf("/api/adb_order_callbacks/replay?all=%t", all), ids, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []string
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// OverrideAdbOrder implement Client interface
+func (c *AdbotClient) OverrideAdbOrder(id string, req *types.AdbOrderOverrideReq) (*types.AdbOrderOverride, error) {
+	resp, err := c.sendRequest("PUT", "/api/adb_orders/"+id+"/override", req, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbOrderOverride
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ListAdbOrderOverrides implement Client interface
+func (c *AdbotClient) ListAdbOrderOverrides(merchant, operator, action string) ([]*types.AdbOrderOverrideRecord, error) {
+	query := url.Values{}
+	query.Set("merchant_id", merchant)
+	query.Set("operator", operator)
+	query.Set("action", action)
+
+	resp, err := c.sendRequest("GET", "/api/adb_order_overrides?"+query.Encode(), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.AdbOrderOverrideRecord
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ExportAdbOrders implement Client interface
+func (c *AdbotClient) ExportAdbOrders(filter *types.AdbOrderReportFilter, format string) (io.ReadCloser, error) {
+	query := adbOrderReportQuery(filter)
+	query.Set("format", format)
+
+	resp, err := c.sendRequest("GET", "/api/adb_order_reports/export?"+query.Encode(), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{code, string(bs)}
+	}
+
+	return resp.Body, nil
+}
+
+// AdbOrderSettlement implement Client interface
+func (c *AdbotClient) AdbOrderSettlement(filter *types.AdbOrderReportFilter, groupBy string) (*types.AdbOrderReport, error) {
+	query := adbOrderReportQuery(filter)
+	query.Set("group_by", groupBy)
+
+	resp, err := c.sendRequest("GET", "/api/adb_order_reports/settlement?"+query.Encode(), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbOrderReport
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ExportAdbOrderSettlement implement Client interface
+func (c *AdbotClient) ExportAdbOrderSettlement(filter *types.AdbOrderReportFilter, groupBy, format string) (io.ReadCloser, error) {
+	query := adbOrderReportQuery(filter)
+	query.Set("group_by", groupBy)
+	query.Set("format", format)
+
+	resp, err := c.sendRequest("GET", "/api/adb_order_reports/settlement?"+query.Encode(), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{code, string(bs)}
+	}
+
+	return resp.Body, nil
+}
+
+func adbOrderReportQuery(filter *types.AdbOrderReportFilter) url.Values {
+	query := url.Values{}
+	if filter == nil {
+		return query
+	}
+	if !filter.StartAt.IsZero() {
+		query.Set("start_at", filter.StartAt.Format(time.RFC3339))
+	}
+	if !filter.EndAt.IsZero() {
+		query.Set("end_at", filter.EndAt.Format(time.RFC3339))
+	}
+	if filter.MerchantID != "" {
+		query.Set("merchant_id", filter.MerchantID)
+	}
+	if filter.DeviceID != "" {
+		query.Set("device_id", filter.DeviceID)
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	return query
+}
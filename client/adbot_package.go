@@ -0,0 +1,151 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb device files & packages
+//
+
+// PullAdbDeviceFile implement Client interface
+func (c *AdbotClient) PullAdbDeviceFile(id, path string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("path", path)
+
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/files?%s", id, query.Encode()), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{code, string(bs)}
+	}
+
+	return resp.Body, nil
+}
+
+// PushAdbDeviceFile implement Client interface
+func (c *AdbotClient) PushAdbDeviceFile(id, path string, mode os.FileMode, src io.Reader) error {
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("mode", fmt.Sprintf("%o", mode))
+
+	resp, err := c.sendRequest("PUT", fmt.Sprintf("/api/adb_devices/%s/files?%s", id, query.Encode()), src, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
+// ListAdbDevicePackages implement Client interface
+func (c *AdbotClient) ListAdbDevicePackages(id string, thirdParty bool) ([]*adbot.AndroidPackage, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/packages?third_party=%v", id, thirdParty), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*adbot.AndroidPackage
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// InspectAdbDevicePackage implement Client interface
+func (c *AdbotClient) InspectAdbDevicePackage(id, name string) (*adbot.AndroidPackage, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_devices/%s/packages/%s", id, name), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *adbot.AndroidPackage
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// InstallAdbDevicePackage implement Client interface
+func (c *AdbotClient) InstallAdbDevicePackage(id string, apk io.Reader) error {
+	resp, err := c.sendRequest("POST", fmt.Sprintf("/api/adb_devices/%s/packages", id), apk, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
+// UninstallAdbDevicePackage implement Client interface
+func (c *AdbotClient) UninstallAdbDevicePackage(id, name string) error {
+	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/adb_devices/%s/packages/%s", id, name), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
+
+// RolloutAdbPackage implement Client interface
+// the returned stream is the SSE progress of each device
+func (c *AdbotClient) RolloutAdbPackage(req *types.AdbPackageRolloutReq, apk io.Reader) (io.ReadCloser, error) {
+	var labels []string
+	for key, val := range req.Labels {
+		labels = append(labels, key+"="+val)
+	}
+
+	query := url.Values{}
+	query.Set("labels", strings.Join(labels, ","))
+	query.Set("package", req.Package)
+	query.Set("concurrency", fmt.Sprintf("%d", req.Concurrency))
+
+	resp, err := c.sendRequest("POST", "/api/adb_packages/rollout?"+query.Encode(), apk, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &APIError{code, string(bs)}
+	}
+
+	return resp.Body, nil
+}
@@ -175,8 +175,10 @@ func (c *AdbotClient) bind(r io.Reader, val interface{}) error {
 func (c *AdbotClient) sendRequest(method, path string, data interface{}, timeout time.Duration, user, password string) (*http.Response, error) {
 	var (
 		buf   = bytes.NewBuffer(nil) // request Body holder
+		body  io.Reader              // request Body
 		ctype string                 // request Content-Type
 	)
+	body = buf
 
 	// fill up the body buffer
 	switch v := data.(type) {
@@ -189,6 +191,10 @@ func (c *AdbotClient) sendRequest(method, path string, data interface{}, timeout
 		}
 		ctype = "application/octet-stream"
 
+	case io.Reader: // streaming request body
+		body = v
+		ctype = "application/octet-stream"
+
 	default:
 		if err := json.NewEncoder(buf).Encode(v); err != nil {
 			return nil, err
@@ -207,7 +213,7 @@ func (c *AdbotClient) sendRequest(method, path string, data interface{}, timeout
 	}
 
 	path = "http://" + host + path
-	req, err := http.NewRequest(method, path, buf)
+	req, err := http.NewRequest(method, path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"io"
+	"os"
 	"time"
 
 	maxminddb "github.com/oschwald/maxminddb-golang"
@@ -55,7 +56,10 @@ type Client interface {
 	ListAdbDevices() ([]*types.AdbDeviceWrapper, error)
 	InspectAdbDevice(id string) (*types.AdbDeviceWrapper, error)
 	ScreenCapAdbDevice(id string) ([]byte, error)
-	DumpAdbDeviceUINodes(id string) ([]*adbot.AndroidUINode, error)
+	DumpAdbDeviceUINodes(id, selector string) ([]*adbot.AndroidUINode, error)
+	TailAdbDeviceSysLogs(id string, filter *adbot.SysLogFilter) (io.ReadCloser, error)
+	AdbDeviceOpQueue(id string) (*adbot.OpQueueStats, error)
+	CancelAdbDeviceOp(id, opID string) error
 	ClickAdbDevice(id string, x, y int) error
 	GobackAdbDevice(id string) error
 	GotoHomeAdbDevice(id string) error
@@ -66,7 +70,43 @@ type Client interface {
 	SetAdbDeviceWeight(id string, val int) error
 	BindAdbDeviceAlipay(id string, alipay *types.AlipayAccount) error
 	RevokeAdbDeviceAlipay(id string) error
+	BindAdbDeviceWxpay(id string, wxpay *types.WxpayAccount) error
+	RevokeAdbDeviceWxpay(id string) error
 	RemoveAdbDevice(id string) error
+	PullAdbDeviceFile(id, path string) (io.ReadCloser, error)
+	PushAdbDeviceFile(id, path string, mode os.FileMode, src io.Reader) error
+	ListAdbDevicePackages(id string, thirdParty bool) ([]*adbot.AndroidPackage, error)
+	InspectAdbDevicePackage(id, name string) (*adbot.AndroidPackage, error)
+	InstallAdbDevicePackage(id string, apk io.Reader) error
+	UninstallAdbDevicePackage(id, name string) error
+	RolloutAdbPackage(req *types.AdbPackageRolloutReq, apk io.Reader) (io.ReadCloser, error)
+
+	InspectAdbOrder(id string) (*types.AdbOrderWrapper, error)
+	ListDeadAdbOrderCallbacks() ([]*types.AdbOrderWrapper, error)
+	ReplayAdbOrderCallbacks(all bool, ids []string) ([]string, error)
+	OverrideAdbOrder(id string, req *types.AdbOrderOverrideReq) (*types.AdbOrderOverride, error)
+	ListAdbOrderOverrides(merchant, operator, action string) ([]*types.AdbOrderOverrideRecord, error)
+	ExportAdbOrders(filter *types.AdbOrderReportFilter, format string) (io.ReadCloser, error)
+	AdbOrderSettlement(filter *types.AdbOrderReportFilter, groupBy string) (*types.AdbOrderReport, error)
+	ExportAdbOrderSettlement(filter *types.AdbOrderReportFilter, groupBy, format string) (io.ReadCloser, error)
+
+	ListAdbFlows() ([]*types.AdbFlow, error)
+	InspectAdbFlow(id string) (*types.AdbFlow, error)
+	AddAdbFlow(content []byte) (*types.AdbFlow, error)
+	UpdateAdbFlow(id string, content []byte) (*types.AdbFlow, error)
+	RemoveAdbFlow(id string) error
+	RunAdbFlow(id string, req *types.AdbFlowRunReq) ([]*types.AdbFlowRunResult, error)
+
+	ListMerchants() ([]*types.MerchantWrapper, error)
+	InspectMerchant(id string) (*types.MerchantWrapper, error)
+	AddMerchant(merchant *types.Merchant) (*types.Merchant, error)
+	UpdateMerchant(id string, req *types.UpdateMerchantReq) (*types.MerchantWrapper, error)
+	ResetMerchantSecret(id string) (*types.Merchant, error)
+	RemoveMerchant(id string) error
+
+	ListAdbReconciles() ([]*types.AdbReconcile, error)
+	InspectAdbReconcile(date string) (*types.AdbReconcile, error)
+	RunAdbReconcile(date string) error // run in background, empty date means yesterday
 
 	ReportAdbEvent(ev *adbot.AdbEvent) error // public, used by adb node to report adb events
 	WatchAdbEvents() (io.ReadCloser, error)
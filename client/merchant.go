@@ -0,0 +1,118 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// paygate merchants
+//
+
+// ListMerchants implement Client interface
+func (c *AdbotClient) ListMerchants() ([]*types.MerchantWrapper, error) {
+	resp, err := c.sendRequest("GET", "/api/merchants", nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.MerchantWrapper
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// InspectMerchant implement Client interface
+func (c *AdbotClient) InspectMerchant(id string) (*types.MerchantWrapper, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/merchants/%s", id), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.MerchantWrapper
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// AddMerchant implement Client interface
+func (c *AdbotClient) AddMerchant(merchant *types.Merchant) (*types.Merchant, error) {
+	resp, err := c.sendRequest("POST", "/api/merchants", merchant, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 201 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.Merchant
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// UpdateMerchant implement Client interface
+func (c *AdbotClient) UpdateMerchant(id string, req *types.UpdateMerchantReq) (*types.MerchantWrapper, error) {
+	resp, err := c.sendRequest("PATCH", fmt.Sprintf("/api/merchants/%s", id), req, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.MerchantWrapper
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// ResetMerchantSecret implement Client interface
+func (c *AdbotClient) ResetMerchantSecret(id string) (*types.Merchant, error) {
+	resp, err := c.sendRequest("PUT", fmt.Sprintf("/api/merchants/%s/secret", id), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.Merchant
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// RemoveMerchant implement Client interface
+func (c *AdbotClient) RemoveMerchant(id string) error {
+	resp, err := c.sendRequest("DELETE", fmt.Sprintf("/api/merchants/%s", id), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// adb daily reconciliation
+//
+
+// ListAdbReconciles implement Client interface
+func (c *AdbotClient) ListAdbReconciles() ([]*types.AdbReconcile, error) {
+	resp, err := c.sendRequest("GET", "/api/adb_reconciles", nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret []*types.AdbReconcile
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// InspectAdbReconcile implement Client interface
+func (c *AdbotClient) InspectAdbReconcile(date string) (*types.AdbReconcile, error) {
+	resp, err := c.sendRequest("GET", fmt.Sprintf("/api/adb_reconciles/%s", date), nil, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, &APIError{code, string(bs)}
+	}
+
+	var ret *types.AdbReconcile
+	err = c.bind(resp.Body, &ret)
+	return ret, err
+}
+
+// RunAdbReconcile implement Client interface
+func (c *AdbotClient) RunAdbReconcile(date string) error {
+	resp, err := c.sendRequest("POST", fmt.Sprintf("/api/adb_reconciles?date=%s", date), nil, 0, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 202 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return &APIError{code, string(bs)}
+	}
+
+	return nil
+}
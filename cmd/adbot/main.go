@@ -99,6 +99,11 @@ func main() {
 		icli.LicenseCommand(),
 		icli.AdbNodeCommand(),
 		icli.AdbDeviceCommand(),
+		icli.AdbOrderCommand(),
+		icli.AdbFlowCommand(),
+		icli.MerchantCommand(),
+		icli.AdbReconcileCommand(),
+		icli.AdbPackageCommand(),
 	}
 
 	app.RunAndExitOnError()
@@ -105,6 +105,7 @@ func New(cfg *types.MasterConfig) *Master {
 func (m *Master) Run() {
 
 	m.initDBGlobalSettings()
+	m.initDBDefaultMerchant()
 
 	go m.exitTrap()
 
@@ -175,7 +176,7 @@ ELECT:
 				m.initDBNodesStatus()            // mark all db nodes as `offline` except the `deleting` ones
 				m.initDBAdbDevicesStatus()       // mark all db adb devices as `offline`
 				m.initDBAdbOrderStatus()         // mark all of (created_at <= now - 5m) + (status = pending) adb order as `timeout`
-				m.initDBAdbOrderCallbackStatus() // mark all of ongoing adb order callback as `aborted`
+				m.initDBAdbOrderCallbackStatus() // move all of legacy ongoing & aborted adb order callbacks into the delivery queue
 				m.apiserver.SetLeader(true)      // then Api -> 200, agents will join on me
 				scheduler.SetLeader(true)        // then scheduler knows the current role, it's background loops(guarders) will be enabled
 
@@ -183,6 +184,7 @@ ELECT:
 				m.launchUserSessionsCleaner()
 				m.launchAdbDeviceGuarder()
 				m.launchAdbEventWatcher()
+				m.launchAdbOrderCallbackQueue()
 				log.Printf("master in serving now.")
 			}
 		}
@@ -209,6 +211,14 @@ func (m *Master) initDBGlobalSettings() {
 	}
 }
 
+// create the default paygate merchant from the paygate global settings attrs if not exists
+func (m *Master) initDBDefaultMerchant() {
+	err := scheduler.EnsureDefaultMerchant()
+	if err != nil && !store.DB().ErrDuplicated(err) { // maybe created by another master at the same time
+		log.Fatalln("setup db default paygate merchant error:", err)
+	}
+}
+
 // initDBNodesStatus mark all of db nodes as `offline` except deleting nodes
 func (m *Master) initDBNodesStatus() {
 	nodes, err := store.DB().ListNodes(nil, nil)
@@ -233,34 +243,34 @@ func (m *Master) initDBAdbDevicesStatus() {
 	}
 }
 
-// initDBAdbOrderStatus mark all of (created_at <= now - 5m) + (status = pending) adb order status as `timeout`
+// initDBAdbOrderStatus mark all of the expired (expire_at <= now) pending adb orders as `timeout`,
+// the unexpired ones are swept by the leader after expired, as their waitting were lost
 func (m *Master) initDBAdbOrderStatus() {
-	query := bson.M{"status": types.AdbOrderStatusPending, "created_at": bson.M{"$lt": time.Now().Add(-types.AdbOrderTimeout)}}
-	orders, err := store.DB().ListAdbOrders(nil, query)
-	if err != nil {
-		log.Fatalln("db ListAdbOrders() timeout error:", err)
-	}
-
-	for _, order := range orders {
-		scheduler.MemoAdbOrderStatus(order.ID, types.AdbOrderStatusTimeout)
-	}
+	scheduler.SweepExpiredAdbOrders(0)
 }
 
-// initDBAdbOrderCallbackStatus mark all of ongoing adb order callback as `aborted`
-// and re-sending order callback on those adb orders
+// initDBAdbOrderCallbackStatus move all of legacy ongoing & aborted adb order callbacks
+// (sent by the in-memory retries before the delivery queue) and the aborted manual
+// re-callbacks into the delivery queue
 func (m *Master) initDBAdbOrderCallbackStatus() {
-	query := bson.M{"callback_status": types.AdbOrderCallbackStatusOngoing}
+	query := bson.M{"$or": []bson.M{
+		{
+			"callback_status":  bson.M{"$in": []string{types.AdbOrderCallbackStatusOngoing, types.AdbOrderCallbackStatusAborted}},
+			"callback_next_at": bson.M{"$exists": false},
+		},
+		{
+			"callback_status": types.AdbOrderCallbackStatusManual,
+		},
+	}}
 	orders, err := store.DB().ListAdbOrders(nil, query)
 	if err != nil {
-		log.Fatalln("db ListAdbOrders() ongoing error:", err)
+		log.Fatalln("db ListAdbOrders() legacy ongoing error:", err)
 	}
 
 	for _, order := range orders {
-		scheduler.AppendAdbOrderCallbackHistory(order.ID, "callback aborted while restart")
-		scheduler.MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusAborted)
+		scheduler.AppendAdbOrderCallbackHistory(order.ID, "callback aborted while restart, re-queued")
+		scheduler.RequeueAdbOrderCallback(order.ID)
 	}
-
-	go scheduler.BootupReCallbackAbortedAdbOrders(orders)
 }
 
 // launch user sessions cleaner
@@ -284,6 +294,13 @@ func (m *Master) launchAdbEventWatcher() {
 	}
 }
 
+// launch adb order callback delivery queue
+func (m *Master) launchAdbOrderCallbackQueue() {
+	if !scheduler.IsRegisteredGoRoutine("adb_order_callback_queue", "system") {
+		go scheduler.RunAdbOrderCallbackQueueLoop()
+	}
+}
+
 func (m *Master) exitTrap() {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
@@ -1,5 +1,12 @@
 package adbot
 
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
 // AdbHandler represents the adb host (127.0.0.1:5037) handler
 type AdbHandler interface {
 	ListAdbDevices() ([]string, error)
@@ -13,26 +20,47 @@ type AdbDeviceHandler interface {
 	Exists() bool
 	Online() bool
 	Reboot() error
-	Run(cmd string, args ...string) (string, error) // similar as: adb -s {id} shell
+	Run(cmd string, args ...string) (string, error)                             // similar as: adb -s {id} shell, bounded by DefaultRunTimeout
+	RunContext(ctx context.Context, cmd string, args ...string) (string, error) // similar as above, aborted once the ctx done
 	SysInfo() (*AndroidSysInfo, error)
 	BatteryInfo() (*AndroidBatteryInfo, error)
 	IsAwake() bool // is screen awake
 	AwakenScreen() error
 	ScreenCap() ([]byte, error)
+	ScreenCapContext(ctx context.Context) ([]byte, error) // similar as above, aborted once the ctx done
 	GotoHome() error
 	GoBack() error
 	Click(x, y int) error
 	Swipe(x1, y1, x2, y2 int) error
 	CurrentTopActivity() (string, error)
+	CurrentTopActivityContext(ctx context.Context) (string, error) // similar as above, aborted once the ctx done
 	DumpCurrentUI() ([]*AndroidUINode, error)
+	DumpCurrentUIContext(ctx context.Context) ([]*AndroidUINode, error) // similar as above, aborted once the ctx done
 	FindUINodeAndClick(resourceid, resourcetext string) (int, int, error)
-	TailSysLogs() (<-chan string, chan struct{})                     // tail -f syslogs (logcat -d; logcat -c)
-	WatchSysEvents(keywords []string) (<-chan string, chan struct{}) // watch keywords in syslogs via TailSysLogs
-	ListSysNotifies() []*AndroidSysNotify                            // dumpsys notification -> find `tickerTex`
-	ClearSysNotifies() error                                         // pull down, find and tap `clear_all` button
-	WatchSysNotifies() (<-chan *AndroidSysNotify, chan struct{})     // watch notification
+	FindUINodes(selector string) ([]*AndroidUINode, error)                        // find current ui nodes by UISelector
+	WaitForUINode(selector string, timeout time.Duration) (*AndroidUINode, error) // wait until the first ui node matched UISelector shown up
+	ClickSelector(selector string) (int, int, error)                              // find the first ui node matched UISelector and click it
+	TailSysLogs(filter *SysLogFilter) (<-chan string, chan struct{})              // tail -f syslogs (logcat -v time -T ...), nil filter means all logs
+	WatchSysEvents(keywords []string) (<-chan string, chan struct{})              // watch keywords in syslogs via TailSysLogs
+	ListSysNotifies() []*AndroidSysNotify                                         // dumpsys notification -> find `tickerTex`
+	ClearSysNotifies() error                                                      // pull down, find and tap `clear_all` button
+	WatchSysNotifies() (<-chan *AndroidSysNotify, chan struct{})                  // watch notification
+
+	// Files & Packages
+	StatFile(path string) (*AndroidFile, error)                     // adb sync STAT
+	PushFile(src io.Reader, dst string, perm os.FileMode) error     // similar as: adb -s {id} push
+	PullFile(src string) (io.ReadCloser, error)                     // similar as: adb -s {id} pull
+	ListPackages(thirdParty bool) ([]*AndroidPackage, error)        // pm list packages [-3]
+	PackageInfo(name string) (*AndroidPackage, error)               // dumpsys package {name}
+	InstallPackage(apk io.Reader) error                             // similar as: adb -s {id} install -r
+	InstallPackageContext(ctx context.Context, apk io.Reader) error // similar as above, aborted once the ctx done
+	UninstallPackage(name string) error                             // pm uninstall {name}
+
+	// Operation Queue
+	DoOp(ctx context.Context, prio OpPriority, name string, fn OpFunc) error // queue the op and run it exclusively by priority
+	CancelOp(id string) error                                                // cancel the pending or running op
+	OpQueueStats() *OpQueueStats                                             // the op queue depth & wait time
 
-	// Alipay App
-	StartAliPay() error
-	AlipaySearchOrder(orderID string) (*AlipayOrder, error) // 分页: 我的 -> 账单 -> 搜索
+	// Payment Apps
+	PaymentApp(name string) (PaymentApp, error) // the registered payment app driver on this device, eg: alipay, wxpay
 }
@@ -0,0 +1,412 @@
+package adbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// nolint
+var (
+	PaymentAppAlipay = "alipay"
+
+	AlipayPackage            = "com.eg.android.AlipayGphone"
+	AlipayLoginActivity      = "com.eg.android.AlipayGphone/.AlipayLogin"
+	AlipayBillListActivity   = "com.eg.android.AlipayGphone/com.alipay.mobile.bill.list.ui.BillMainListActivity"    // 我的->账单
+	AlipayBillSearchActivity = "com.eg.android.AlipayGphone/com.alipay.mobile.bill.list.ui.BillWordSearchActivity_" // 我的->账单->搜索
+)
+
+var (
+	alipayNotifyAmountrx   = regexp.MustCompile(`(?:成功收款|向你付款)\s*([0-9]+(?:\.[0-9]{1,2})?)\s*元`) // 你已成功收款0.01元, bbk通过扫码向你付款0.01元
+	alipayNotifyPayerrx    = regexp.MustCompile(`([^\s:：,，]+?)(?:已)?通过扫码向你付款`)                   // bbk通过扫码向你付款0.01元
+	alipayNotifyOutgoingrx = regexp.MustCompile(`对方|退款|转账给|转出`)                                  // 对方已成功收款0.01元, 退款0.01元已到账
+)
+
+func init() {
+	RegisterPaymentApp(PaymentAppAlipay, newAlipay)
+}
+
+// alipay is the PaymentApp driver of Alipay App
+type alipay struct {
+	dvc        AdbDeviceHandler
+	sync.Mutex // synchronized the combined ops on the app
+
+	// alipay button XY
+	billListSearchButton [2]int // 我的->账单->搜索
+	billSearchEmitButton [2]int // 我的->账单->搜索->搜索
+}
+
+func newAlipay(dvc AdbDeviceHandler) PaymentApp {
+	return &alipay{dvc: dvc}
+}
+
+// Name implement PaymentApp
+func (app *alipay) Name() string {
+	return PaymentAppAlipay
+}
+
+// Package implement PaymentApp
+func (app *alipay) Package() string {
+	return AlipayPackage
+}
+
+// Start implement PaymentApp
+func (app *alipay) Start(ctx context.Context) error {
+	var err error
+	for i := 1; i <= 5; i++ {
+		if app.IsForeground(ctx) {
+			return nil
+		}
+		_, err = app.dvc.RunContext(ctx, "am", "start", AlipayLoginActivity)
+		if err != nil {
+			log.Warnf("alipay.Start() %d am.start error: %v", i, err)
+		}
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return fmt.Errorf("alipay.Start() %v", err)
+		}
+	}
+	return err
+}
+
+// IsForeground implement PaymentApp
+func (app *alipay) IsForeground(ctx context.Context) bool {
+	activity, _ := app.dvc.CurrentTopActivityContext(ctx)
+	return strings.Contains(activity, AlipayPackage)
+}
+
+// ParseNotify implement PaymentApp
+//
+//	你已成功收款0.01元
+//	成功收款0.01元。享免费提现等更多专属服务，点击查看
+//	bbk通过扫码向你付款0.01元
+func (app *alipay) ParseNotify(notify *AndroidSysNotify) *PayNotice {
+	if notify == nil || notify.Source != AlipayPackage {
+		return nil
+	}
+
+	// note: only the incoming payments have the amount, never the outgoing payments,
+	// refunds or transfers out, otherwise a pending order of the same amount is confirmed
+	var amount, payer string
+	if matched := alipayNotifyAmountrx.FindStringSubmatch(notify.Message); len(matched) == 2 && !alipayNotifyOutgoingrx.MatchString(notify.Message) {
+		amount = matched[1]
+	}
+	if matched := alipayNotifyPayerrx.FindStringSubmatch(notify.Message); len(matched) == 2 {
+		payer = matched[1]
+	}
+	return newPayNotice(PaymentAppAlipay, notify.Message, amount, payer)
+}
+
+// SearchOrder implement PaymentApp
+// 我的 -> 账单 -> 搜索 -> 搜索
+func (app *alipay) SearchOrder(ctx context.Context, orderID string) (*PayOrder, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	if orderID == "" {
+		return nil, errors.New("alipay.SearchOrder() order id required")
+	}
+
+	// clear any previous alipay notifies
+	if n := app.countNotifies(); n > 3 {
+		app.dvc.ClearSysNotifies()
+	}
+
+	// ensure current top activity is alipay bill list page
+	if !app.isBillListActive(ctx) {
+		err := app.gotoBillList(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		resourceid   string
+		resourcetext string
+		newX, newY   int
+		err          error
+	)
+
+	// 点击账单列表页的'搜索'
+	// if we know the button XY, directly click it
+	if currX, currY := app.billListSearchButton[0], app.billListSearchButton[1]; currX > 0 && currY > 0 {
+		app.dvc.Click(currX, currY)
+		// ensure we got the right activity, otherwise re-caculate the button XY and click it
+		err = waitTopActivity(ctx, app.dvc, AlipayBillSearchActivity, 5, time.Second)
+		if err != nil {
+			log.Warnln("alipay.SearchOrder().DirectClick() on `Bill-List-Search-Button` maybe outdated, need fix the button XY")
+		} else {
+			goto EMITSEARCH
+		}
+	}
+
+	// caculate the button XY and click it
+	resourceid = "com.alipay.mobile.bill.list:id/search_btn"
+	resourcetext = "搜索"
+	newX, newY, err = findUINodeAndClick(ctx, app.dvc, resourceid, resourcetext)
+	if err != nil {
+		log.Errorln("alipay.SearchOrder().findUINodeAndClick() on `Bill-List-Search-Button` error:", err)
+		return nil, err
+	}
+	// ensure we got the right activity
+	err = waitTopActivity(ctx, app.dvc, AlipayBillSearchActivity, 5, time.Second)
+	if err != nil {
+		log.Errorln("alipay.SearchOrder().waitBillSearchActive() error:", err)
+		return nil, err
+	}
+	// now we got the right activity
+	if newX > 0 && newY > 0 {
+		app.billListSearchButton = [2]int{newX, newY} // renew the new button XY
+		newX, newY = 0, 0                             // clear the value
+	}
+
+EMITSEARCH:
+
+	// goback once afterwards to the alipay order list page
+	defer func() {
+		app.dvc.GoBack()
+		waitTopActivity(ctx, app.dvc, AlipayBillListActivity, 5, time.Second)
+	}()
+
+	// 输入订单号
+	if _, err := app.dvc.RunContext(ctx, "input", "text", orderID); err != nil {
+		return nil, fmt.Errorf("alipay.SearchOrder() input text orderID error: %v", err)
+	}
+
+	// 点击账单搜索页的'搜索' 进行提交
+	// if we know the button XY, directly click it
+	if currX, currY := app.billSearchEmitButton[0], app.billSearchEmitButton[1]; currX > 0 && currY > 0 {
+		app.dvc.Click(currX, currY)
+	} else { // caculate the button XY and click it
+		resourceid = ""
+		resourcetext = "搜索"
+		newX, newY, err = findUINodeAndClick(ctx, app.dvc, resourceid, resourcetext)
+		if err != nil {
+			log.Errorln("alipay.SearchOrder().findUINodeAndClick() on `Bill-Search-Emit-Button` error:", err)
+			return nil, err
+		}
+		if newX > 0 && newY > 0 {
+			app.billSearchEmitButton = [2]int{newX, newY} // renew the new button XY
+			newX, newY = 0, 0                             // clear the value
+		}
+	}
+
+	// parse the search result page
+	nodes, err := app.loadedUI(ctx)
+	if err != nil {
+		log.Errorln("alipay.SearchOrder().dumpCurrentUI() on search result page error:", err)
+		return nil, err
+	}
+
+	// we assume alipay loaded the search result
+	resourceid = "com.alipay.mobile.antui:id/tips"
+	resourcetext = "没有找到"
+	tipNode := findUINode(nodes, resourceid, resourcetext)
+	if tipNode != nil { // not found this order
+		return nil, errors.New("no such order")
+	}
+
+	bills := parseAlipayBills(nodes)
+	if len(bills) == 0 {
+		return nil, errors.New("unexpected search result page: the `billName` & `billAmount` UI nodes not found")
+	}
+	if bills[0].Comment == "" {
+		return nil, errors.New("unexpected search result page: the `billName` UI node missing order comment text")
+	}
+	return bills[0], nil
+}
+
+// ListBills implement PaymentApp
+// 我的 -> 账单
+func (app *alipay) ListBills(ctx context.Context) ([]*PayOrder, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	if !app.isBillListActive(ctx) {
+		err := app.gotoBillList(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nodes, err := app.loadedUI(ctx)
+	if err != nil {
+		log.Errorln("alipay.ListBills().dumpCurrentUI() on bill list page error:", err)
+		return nil, err
+	}
+
+	return parseAlipayBills(nodes), nil
+}
+
+// ListDayBills implement PaymentDayBiller
+// 我的 -> 账单, the latest bill at the top, scroll up to load the older ones
+func (app *alipay) ListDayBills(ctx context.Context, day time.Time) ([]*PayOrder, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	if err := app.gotoBillList(ctx); err != nil { // always from the top of the bill list
+		return nil, err
+	}
+
+	load := func() ([]*PayOrder, error) {
+		nodes, err := app.loadedUI(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return parseAlipayBills(nodes), nil
+	}
+	scroll := func() error {
+		return swipeScrollable(ctx, app.dvc, true)
+	}
+	return collectDayBills(ctx, day, load, scroll)
+}
+
+// dump the current ui, retry max 10 times if loading
+func (app *alipay) loadedUI(ctx context.Context) ([]*AndroidUINode, error) {
+	nodes, err := app.dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= 10; i++ {
+		loadingNode := findUINode(nodes, "android:id/progress", "") // 加载中
+		if loadingNode != nil {
+			if err := sleepContext(ctx, time.Second); err != nil {
+				return nil, err
+			}
+			nodes, _ = app.dvc.DumpCurrentUIContext(ctx)
+			continue
+		}
+		break
+	}
+	return nodes, nil
+}
+
+func (app *alipay) countNotifies() int {
+	notifies := app.dvc.ListSysNotifies()
+	var n int
+	for _, notify := range notifies {
+		if notify.Source == AlipayPackage {
+			n++
+		}
+	}
+	return n
+}
+
+func (app *alipay) gotoBillList(ctx context.Context) error {
+	if err := app.gotoTabProfile(ctx); err != nil {
+		return err
+	}
+
+	// find the UI node and click it
+	var (
+		resourceid   = "com.alipay.mobile.antui:id/item_left_text"
+		resourcetext = "账单"
+	)
+	_, _, err := findUINodeAndClick(ctx, app.dvc, resourceid, resourcetext)
+	if err != nil {
+		log.Errorln("alipay.gotoBillList().findUINodeAndClick() error:", err)
+		return err
+	}
+
+	// now we expect the bill list activity at top
+	return waitTopActivity(ctx, app.dvc, AlipayBillListActivity, 10, time.Second)
+}
+
+func (app *alipay) gotoTabProfile(ctx context.Context) error {
+	if err := app.Start(ctx); err != nil {
+		return err
+	}
+
+	if err := sleepContext(ctx, time.Millisecond*300); err != nil {
+		return err
+	}
+
+	var (
+		resourceid   = "com.alipay.android.phone.wealth.home:id/tab_description"
+		resourcetext = "我的"
+		maxRetry     = 10
+		retryN       int
+		err          error
+	)
+
+RETRY:
+	retryN++
+	if retryN > maxRetry {
+		return fmt.Errorf("alipay.gotoTabProfile() failed after %d retries, error: %v", retryN, err)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("alipay.gotoTabProfile() aborted: %v", ctxErr)
+	}
+
+	app.Start(ctx) // ensure every time alipay at top
+	_, _, err = findUINodeAndClick(ctx, app.dvc, resourceid, resourcetext)
+	if err != nil {
+		if err == errUINodeNotFound {
+			log.Warnln("alipay.gotoTabProfile() goback one step and retry to find the '我的' button ...")
+		} else {
+			log.Warnln("alipay.gotoTabProfile().findUINodeAndClick error:", err)
+		}
+		app.dvc.GoBack() // go back one step and retry
+		goto RETRY
+	}
+
+	return nil
+}
+
+func (app *alipay) isBillListActive(ctx context.Context) bool {
+	activity, _ := app.dvc.CurrentTopActivityContext(ctx)
+	return activity == AlipayBillListActivity
+}
+
+// parse the bill list items, each item looks like:
+//
+//	billName:   111111111-bbk-bbk (comment-user-username)
+//	billAmount: +0.01
+//	timeInfo1:  昨天
+//	timeInfo2:  11:42
+func parseAlipayBills(nodes []*AndroidUINode) []*PayOrder {
+	var ret []*PayOrder
+	for _, nameNode := range nodes {
+		if nameNode.ResourceID != "com.alipay.mobile.bill.list:id/billName" {
+			continue
+		}
+
+		// the nearest ancestor contains the bill amount
+		var item *AndroidUINode
+		for p := nameNode.Parent(); p != nil; p = p.Parent() {
+			if findUINodeUnder(p, "com.alipay.mobile.bill.list:id/billAmount") != nil {
+				item = p
+				break
+			}
+		}
+		if item == nil {
+			continue
+		}
+
+		var (
+			fields = strings.SplitN(nameNode.Text, "-", 2)
+			order  = &PayOrder{Comment: fields[0]}
+		)
+		if len(fields) == 2 {
+			order.Account = fields[1]
+		}
+		order.Amount = strings.TrimPrefix(findUINodeUnder(item, "com.alipay.mobile.bill.list:id/billAmount").Text, "+")
+
+		var time1, time2 string
+		if node := findUINodeUnder(item, "com.alipay.mobile.bill.list:id/timeInfo1"); node != nil {
+			time1 = node.Text
+		}
+		if node := findUINodeUnder(item, "com.alipay.mobile.bill.list:id/timeInfo2"); node != nil {
+			time2 = node.Text
+		}
+		order.Time = time1 + "-" + time2
+
+		ret = append(ret, order)
+	}
+	return ret
+}
@@ -0,0 +1,255 @@
+package adbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//
+//  Payment App Day Bills
+//
+//  the reconciliation lists all of the bills of one day by scrolling back the bill list
+//  page by page, until the bills older than the day shown up or no more new bills loaded.
+//  the scan checks the ctx on every page, so it gives up once the op deadline exceeded.
+//
+//  the bill time texts are various by the payment apps, eg:
+//    alipay:    今天-11:42, 昨天-11:42, 周一-11:42, 06-10-11:42, 2018-06-10-11:42
+//    wxpay:     2019-06-10 11:42:01
+//
+
+// PaymentDayBiller is an optional interface of PaymentApp,
+// for the wallets which bill list could be scrolled back to the bills of a whole day
+type PaymentDayBiller interface {
+	ListDayBills(ctx context.Context, day time.Time) ([]*PayOrder, error)
+}
+
+// nolint
+var (
+	MaxDayBillPages = 100 // max scrolled bill list pages while listing the day bills
+)
+
+// Fee return the bill amount by CNY cent, 0 if not recognized
+func (o *PayOrder) Fee() int {
+	fee, _ := parseYuanFee(strings.TrimPrefix(o.Amount, "+"))
+	return fee
+}
+
+// ListDayBills list all of the bills of the given day (local time) by the payment app,
+// scroll back the bill list if the app supports, otherwise filter the recent bills
+func ListDayBills(ctx context.Context, app PaymentApp, day time.Time) ([]*PayOrder, error) {
+	if biller, ok := app.(PaymentDayBiller); ok {
+		return biller.ListDayBills(ctx, day)
+	}
+
+	bills, err := app.ListBills(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return collectDayBills(ctx, day, func() ([]*PayOrder, error) { return bills, nil }, nil)
+}
+
+// collect the bills of the given day by loading the current page and scrolling to the
+// older one repeatly, nil scroll means only one page, abort once the ctx done
+func collectDayBills(ctx context.Context, day time.Time, load func() ([]*PayOrder, error), scroll func() error) ([]*PayOrder, error) {
+	var (
+		now        = time.Now()
+		start, end = dayRange(day)
+		prev       []*PayOrder // the bills of the previous page
+		ret        = []*PayOrder{}
+	)
+
+	for page := 1; page <= MaxDayBillPages; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("list day bills aborted on page %d: %v", page, err)
+		}
+
+		bills, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		// only skip the bills overlapped with the previous page, note the identical bills
+		// within one page are different payments, eg: the same amount within the same minute
+		var (
+			overlap      = pageOverlap(prev, bills)
+			fresh, older int
+		)
+		prev = bills
+		for _, bill := range bills[overlap:] {
+			fresh++
+
+			at, err := ParseBillTime(bill.Time, now)
+			if err != nil {
+				log.Warnf("skip the bill %s with unrecognized time: %v", bill.Comment, err)
+				continue
+			}
+			switch {
+			case at.Before(start):
+				older++
+			case at.Before(end):
+				ret = append(ret, bill)
+			}
+		}
+
+		if older > 0 || fresh == 0 || scroll == nil {
+			break
+		}
+		if err := scroll(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// the nb of the leading bills of the current page which are the trailing bills of the
+// previous page, as the scrolled page still shows some of the previous items, the largest
+// overlap is taken, so the whole page overlapped means no more bills loaded
+func pageOverlap(prev, curr []*PayOrder) int {
+	n := len(prev)
+	if len(curr) < n {
+		n = len(curr)
+	}
+	for ; n > 0; n-- {
+		if samePayOrders(prev[len(prev)-n:], curr[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func samePayOrders(a, b []*PayOrder) bool {
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// swipe the biggest scrollable ui node by the given direction,
+// up to load the following items, down to load the previous items
+func swipeScrollable(ctx context.Context, dvc AdbDeviceHandler, up bool) error {
+	nodes, err := dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		node *AndroidUINode
+		area int
+	)
+	for _, n := range nodes {
+		if !n.Scrollable {
+			continue
+		}
+		rect, err := n.Rect()
+		if err != nil {
+			continue
+		}
+		if a := rect.Dx() * rect.Dy(); a > area {
+			node, area = n, a
+		}
+	}
+	if node == nil {
+		return errors.New("no scrollable ui node found")
+	}
+
+	rect, _ := node.Rect()
+	var (
+		x      = rect.Min.X + rect.Dx()/2
+		top    = rect.Min.Y + rect.Dy()/5
+		bottom = rect.Max.Y - rect.Dy()/5
+	)
+	if up {
+		err = dvc.Swipe(x, bottom, x, top)
+	} else {
+		err = dvc.Swipe(x, top, x, bottom)
+	}
+	if err != nil {
+		return err
+	}
+	return sleepContext(ctx, time.Second) // wait for the items loaded
+}
+
+// ParseBillTime parse the bill time text of the payment apps by the local time
+func ParseBillTime(text string, now time.Time) (time.Time, error) {
+	text = strings.TrimSpace(text)
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	// {date}-{clock}
+	idx := strings.LastIndex(text, "-")
+	if idx <= 0 {
+		return time.Time{}, fmt.Errorf("unrecognized bill time %q", text)
+	}
+	clock, err := time.ParseInLocation("15:04", text[idx+1:], time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized bill time %q: %v", text, err)
+	}
+
+	date, err := parseBillDate(text[:idx], now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute), nil
+}
+
+var billWeekdays = map[string]time.Weekday{
+	"周日": time.Sunday, "周一": time.Monday, "周二": time.Tuesday, "周三": time.Wednesday,
+	"周四": time.Thursday, "周五": time.Friday, "周六": time.Saturday,
+}
+
+// parse the date part of the bill time to the day start
+func parseBillDate(text string, now time.Time) (time.Time, error) {
+	today, _ := dayRange(now)
+
+	switch text {
+	case "今天":
+		return today, nil
+	case "昨天":
+		return today.AddDate(0, 0, -1), nil
+	case "前天":
+		return today.AddDate(0, 0, -2), nil
+	}
+
+	// the recent days within one week
+	if wd, ok := billWeekdays[text]; ok {
+		for i := 1; i <= 7; i++ {
+			if day := today.AddDate(0, 0, -i); day.Weekday() == wd {
+				return day, nil
+			}
+		}
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", text, time.Local); err == nil {
+		return t, nil
+	}
+
+	// the month-day of this year, or the last year if it's later than today
+	if t, err := time.ParseInLocation("01-02", text, time.Local); err == nil {
+		t = time.Date(today.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		if t.After(today) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized bill date %q", text)
+}
+
+// the local day start & end of the given time
+func dayRange(t time.Time) (time.Time, time.Time) {
+	t = t.In(time.Local)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 0, 1)
+}
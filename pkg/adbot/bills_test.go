@@ -0,0 +1,136 @@
+package adbot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(billsSuite))
+
+type billsSuite struct{}
+
+func (s *billsSuite) TestParseBillTime(c *check.C) {
+	var (
+		now = time.Date(2019, 6, 12, 15, 0, 0, 0, time.Local) // Wednesday
+		day = func(m time.Month, d, h, min int) time.Time { return time.Date(2019, m, d, h, min, 0, 0, time.Local) }
+	)
+
+	for text, expect := range map[string]time.Time{
+		"2019-06-10 11:42:01": time.Date(2019, 6, 10, 11, 42, 1, 0, time.Local),
+		"2019-06-10 11:42":    day(6, 10, 11, 42),
+		"今天-11:42":            day(6, 12, 11, 42),
+		"昨天-23:59":            day(6, 11, 23, 59),
+		"前天-00:01":            day(6, 10, 0, 1),
+		"周一-08:30":            day(6, 10, 8, 30),
+		"周三-08:30":            day(6, 5, 8, 30),
+		"06-01-10:00":         day(6, 1, 10, 0),
+		"12-31-10:00":         time.Date(2018, 12, 31, 10, 0, 0, 0, time.Local),
+		"2018-06-10-11:42":    time.Date(2018, 6, 10, 11, 42, 0, 0, time.Local),
+	} {
+		got, err := ParseBillTime(text, now)
+		c.Assert(err, check.IsNil, check.Commentf(text))
+		c.Assert(got.Equal(expect), check.Equals, true, check.Commentf("%s: %s != %s", text, got, expect))
+	}
+
+	for _, text := range []string{"", "11:42", "明天-11:42", "今天-25:00", "yesterday"} {
+		_, err := ParseBillTime(text, now)
+		c.Assert(err, check.NotNil, check.Commentf(text))
+	}
+}
+
+func (s *billsSuite) TestListDayBills(c *check.C) {
+	var (
+		sim       = NewSimulator()
+		dvc       = sim.AddDevice("sim-01")
+		today     = time.Now()
+		yesterday = today.AddDate(0, 0, -1)
+	)
+
+	c.Assert(dvc.InjectPayOrder(PaymentAppAlipay, &PayOrder{Comment: "111111", Amount: "0.01", Time: yesterday.Format("2006-01-02 15:04:05")}), check.IsNil)
+	c.Assert(dvc.InjectPayOrder(PaymentAppAlipay, &PayOrder{Comment: "222222", Amount: "0.02"}), check.IsNil)
+	c.Assert(dvc.InjectPayOrder(PaymentAppAlipay, &PayOrder{Comment: "333333", Amount: "+1.50"}), check.IsNil)
+
+	app, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+
+	bills, err := ListDayBills(context.Background(), app, today)
+	c.Assert(err, check.IsNil)
+	c.Assert(bills, check.HasLen, 2)
+	c.Assert(bills[0].Comment, check.Equals, "333333")
+	c.Assert(bills[0].Fee(), check.Equals, 150)
+	c.Assert(bills[1].Comment, check.Equals, "222222")
+
+	bills, err = ListDayBills(context.Background(), app, yesterday)
+	c.Assert(err, check.IsNil)
+	c.Assert(bills, check.HasLen, 1)
+	c.Assert(bills[0].Fee(), check.Equals, 1)
+
+	bills, err = ListDayBills(context.Background(), app, today.AddDate(0, 0, -2))
+	c.Assert(err, check.IsNil)
+	c.Assert(bills, check.HasLen, 0)
+}
+
+func (s *billsSuite) TestCollectDayBillsCanceled(c *check.C) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		now         = time.Now()
+		pages       int
+	)
+	defer cancel()
+
+	load := func() ([]*PayOrder, error) {
+		pages++
+		return []*PayOrder{{Comment: fmt.Sprintf("%06d", pages), Amount: "0.01", Time: now.Format("2006-01-02 15:04:05")}}, nil
+	}
+	scroll := func() error {
+		if pages == 2 {
+			cancel() // the op deadline exceeded while scrolling
+		}
+		return nil
+	}
+
+	bills, err := collectDayBills(ctx, now, load, scroll)
+	c.Assert(err, check.NotNil)
+	c.Assert(bills, check.IsNil)
+	c.Assert(pages, check.Equals, 2) // no more page loaded after the ctx done
+}
+
+func (s *billsSuite) TestCollectDayBillsOverlap(c *check.C) {
+	var (
+		now  = time.Now()
+		at   = now.Format("2006-01-02 15:04")
+		bill = func(comment, amount string) *PayOrder {
+			return &PayOrder{Comment: comment, Account: "bbk", Amount: amount, Time: at}
+		}
+		pages = [][]*PayOrder{
+			{bill("收钱码收款", "0.01"), bill("收钱码收款", "0.01"), bill("111111", "0.02")},
+			{bill("收钱码收款", "0.01"), bill("111111", "0.02"), bill("收钱码收款", "0.01"), bill("222222", "0.03")}, // scrolled by one bill
+			{bill("收钱码收款", "0.01"), bill("222222", "0.03")},                                                // the end of the list
+			{bill("收钱码收款", "0.01"), bill("222222", "0.03")},
+		}
+		page int
+	)
+
+	load := func() ([]*PayOrder, error) {
+		ret := pages[page]
+		if page < len(pages)-1 {
+			page++
+		}
+		return ret, nil
+	}
+	scroll := func() error { return nil }
+
+	bills, err := collectDayBills(context.Background(), now, load, scroll)
+	c.Assert(err, check.IsNil)
+
+	var comments []string
+	for _, bill := range bills {
+		comments = append(comments, bill.Comment)
+	}
+	// the identical bills within the same minute are all kept
+	c.Assert(comments, check.DeepEquals, []string{"收钱码收款", "收钱码收款", "111111", "收钱码收款", "222222"})
+	c.Assert(page, check.Equals, len(pages)-1)
+}
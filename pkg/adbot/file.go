@@ -0,0 +1,98 @@
+package adbot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	goadb "github.com/zach-klippenstein/goadb"
+)
+
+// AndroidFile is the file info on the android device
+type AndroidFile struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+}
+
+// IsDir is exported
+func (f *AndroidFile) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// ValidDevicePath check the given path is an absolute clean path on the device
+func ValidDevicePath(p string) error {
+	if p == "" {
+		return fmt.Errorf("device path required")
+	}
+	if !path.IsAbs(p) {
+		return fmt.Errorf("device path %q must be absolute", p)
+	}
+	if path.Clean(p) != p {
+		return fmt.Errorf("device path %q must be clean", p)
+	}
+	return nil
+}
+
+// ParseFileMode parse the octal permission bits, eg: 0644, empty means 0644
+func ParseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0644, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// StatFile implement AdbDeviceHandler
+func (dvc *AdbDevice) StatFile(p string) (*AndroidFile, error) {
+	entry, err := dvc.h.Stat(p)
+	if err != nil {
+		if goadb.HasErrCode(err, goadb.FileNoExistError) {
+			return nil, fmt.Errorf("device file %s not found", p)
+		}
+		return nil, err
+	}
+
+	return &AndroidFile{
+		Path:    p,
+		Mode:    entry.Mode,
+		Size:    int64(entry.Size),
+		ModTime: entry.ModifiedAt,
+	}, nil
+}
+
+// PushFile implement AdbDeviceHandler
+func (dvc *AdbDevice) PushFile(src io.Reader, dst string, perm os.FileMode) error {
+	w, err := dvc.h.OpenWrite(dst, perm, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+
+	// the close will wait for the device OKAY
+	return w.Close()
+}
+
+// PullFile implement AdbDeviceHandler
+func (dvc *AdbDevice) PullFile(src string) (io.ReadCloser, error) {
+	info, err := dvc.StatFile(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("device path %s is a directory", src)
+	}
+
+	return dvc.h.OpenRead(src)
+}
@@ -0,0 +1,557 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// Flow is a declarative device automation, described by yaml or json document, eg:
+//
+//   name: alipay-bill-search
+//   vars:
+//     keyword: "123456"
+//   steps:
+//     - action: start_activity
+//       activity: com.eg.android.AlipayGphone/.AlipayLogin
+//     - action: tap
+//       selector: 'TextView[text="我的"]'
+//       timeout: 10s
+//       retry: 2
+//     - action: input_text
+//       text: ${keyword}
+//     - action: extract
+//       selector: 'TextView[id$=":id/billAmount"]'
+//       regexp: '([0-9.]+)'
+//       var: amount
+//
+// the `${name}` within any step fields will be replaced by the flow variables
+type Flow struct {
+	Name  string            `json:"name"`
+	Desc  string            `json:"desc"`
+	Vars  map[string]string `json:"vars"` // default variables, could be overrided on each run
+	Steps []*FlowStep       `json:"steps"`
+}
+
+// nolint
+var (
+	FlowActionStartActivity = "start_activity" // am start -n {activity}
+	FlowActionWaitActivity  = "wait_activity"  // wait until top activity is {activity}
+	FlowActionFind          = "find"           // wait until {selector} shown up
+	FlowActionTap           = "tap"            // tap the first ui node matched {selector} or {x},{y}
+	FlowActionSwipe         = "swipe"          // swipe from {x},{y} to {x2},{y2}
+	FlowActionInputText     = "input_text"     // input {text}
+	FlowActionKeyEvent      = "keyevent"       // input keyevent {key}: home, back, or key code
+	FlowActionAssert        = "assert"         // assert {activity}, {selector} or {var} matches {regexp}
+	FlowActionExtract       = "extract"        // extract {attr} of the first ui node matched {selector} into {var}
+	FlowActionSleep         = "sleep"          // sleep {timeout}
+)
+
+// nolint
+var (
+	FlowStatusSucceed = "succeed"
+	FlowStatusFailed  = "failed"
+	FlowStatusSkipped = "skipped"
+)
+
+var (
+	flowDefaultTimeout       = time.Second * 10
+	flowDefaultRetryInterval = time.Second
+	flowMaxRetry             = 10
+	flowMaxSteps             = 200
+	flowVarRegexp            = regexp.MustCompile(`\$\{([a-zA-Z0-9_]+)\}`)
+	flowVarNameRegexp        = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	flowKeyCodes             = map[string]string{"home": "3", "back": "4", "power": "26", "enter": "66", "delete": "67", "wakeup": "224"}
+)
+
+// FlowStep is one step of the Flow
+type FlowStep struct {
+	Name          string `json:"name,omitempty"`
+	Action        string `json:"action"`
+	Activity      string `json:"activity,omitempty"`       // start_activity, wait_activity, assert. full activity or only the package name
+	Selector      string `json:"selector,omitempty"`       // find, tap, assert, extract. UISelector
+	Text          string `json:"text,omitempty"`           // input_text
+	Key           string `json:"key,omitempty"`            // keyevent
+	X             int    `json:"x,omitempty"`              // tap, swipe
+	Y             int    `json:"y,omitempty"`              // tap, swipe
+	X2            int    `json:"x2,omitempty"`             // swipe
+	Y2            int    `json:"y2,omitempty"`             // swipe
+	Attr          string `json:"attr,omitempty"`           // assert, extract. ui node attribute, default: text
+	Regexp        string `json:"regexp,omitempty"`         // assert: must match; extract: pick up the first sub match if any
+	Var           string `json:"var,omitempty"`            // assert: the variable to be checked; extract: the variable to be saved
+	Timeout       string `json:"timeout,omitempty"`        // wait_activity, find, tap, assert, extract, sleep. default: 10s
+	Retry         int    `json:"retry,omitempty"`          // retry times on failure, [0-10]
+	RetryInterval string `json:"retry_interval,omitempty"` // default: 1s
+	Optional      bool   `json:"optional,omitempty"`       // continue the flow even if this step failed
+}
+
+// FlowResult is the step by step trace of a flow run
+type FlowResult struct {
+	Flow     string            `json:"flow"`
+	Device   string            `json:"device"`
+	Status   string            `json:"status"` // succeed, failed
+	Errmsg   string            `json:"error"`
+	Vars     map[string]string `json:"vars"` // final variables, with all of extracted values
+	Steps    []*FlowStepResult `json:"steps"`
+	StartAt  time.Time         `json:"start_at"`
+	FinishAt time.Time         `json:"finish_at"`
+}
+
+// FlowStepResult is the trace of one flow step
+type FlowStepResult struct {
+	Index      int       `json:"index"`
+	Name       string    `json:"name"`
+	Action     string    `json:"action"`
+	Status     string    `json:"status"` // succeed, failed, skipped
+	Attempts   int       `json:"attempts"`
+	Output     string    `json:"output"`
+	Errmsg     string    `json:"error"`
+	Screenshot []byte    `json:"screenshot,omitempty"` // png screencap while the step failed
+	StartAt    time.Time `json:"start_at"`
+	Cost       string    `json:"cost"`
+}
+
+// ParseFlow parse the yaml or json flow document
+func ParseFlow(data []byte) (*Flow, error) {
+	jsonbs, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow document: %v", err)
+	}
+
+	var flow *Flow
+	dec := json.NewDecoder(bytes.NewReader(jsonbs))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&flow); err != nil {
+		return nil, fmt.Errorf("invalid flow document: %v", err)
+	}
+	if flow == nil {
+		return nil, errors.New("invalid flow document: empty")
+	}
+
+	if err := flow.Valid(); err != nil {
+		return nil, err
+	}
+	return flow, nil
+}
+
+// Valid is exported
+func (f *Flow) Valid() error {
+	if f.Name == "" {
+		return errors.New("flow name required")
+	}
+	if len(f.Steps) == 0 {
+		return errors.New("flow steps required")
+	}
+	if len(f.Steps) > flowMaxSteps {
+		return fmt.Errorf("too many flow steps, max %d", flowMaxSteps)
+	}
+	for name := range f.Vars {
+		if !flowVarNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid flow variable name %q", name)
+		}
+	}
+	for idx, step := range f.Steps {
+		if step == nil {
+			return fmt.Errorf("flow step #%d: null", idx)
+		}
+		if err := step.Valid(); err != nil {
+			return fmt.Errorf("flow step #%d: %v", idx, err)
+		}
+	}
+	return nil
+}
+
+// Valid is exported
+// note: the fields contains `${var}` could only be verified on runtime
+func (s *FlowStep) Valid() error {
+	switch s.Action {
+	case FlowActionStartActivity, FlowActionWaitActivity:
+		if s.Activity == "" {
+			return errors.New("activity required")
+		}
+
+	case FlowActionFind, FlowActionExtract:
+		if s.Selector == "" {
+			return errors.New("selector required")
+		}
+		if s.Action == FlowActionExtract && s.Var == "" {
+			return errors.New("var required")
+		}
+
+	case FlowActionTap:
+		if s.Selector == "" && (s.X <= 0 || s.Y <= 0) {
+			return errors.New("selector or x,y required")
+		}
+
+	case FlowActionSwipe:
+		if s.X < 0 || s.Y < 0 || s.X2 < 0 || s.Y2 < 0 {
+			return errors.New("bad x,y,x2,y2 value")
+		}
+
+	case FlowActionInputText:
+		if s.Text == "" {
+			return errors.New("text required")
+		}
+
+	case FlowActionKeyEvent:
+		if s.Key == "" {
+			return errors.New("key required")
+		}
+		if _, ok := flowKeyCodes[s.Key]; !ok && !hasFlowVar(s.Key) {
+			if _, err := strconv.Atoi(s.Key); err != nil {
+				return fmt.Errorf("unsupported key %q", s.Key)
+			}
+		}
+
+	case FlowActionAssert:
+		if s.Activity == "" && s.Selector == "" && s.Var == "" {
+			return errors.New("one of activity, selector, var required")
+		}
+
+	case FlowActionSleep:
+		if s.Timeout == "" {
+			return errors.New("timeout required")
+		}
+
+	case "":
+		return errors.New("action required")
+
+	default:
+		return fmt.Errorf("unsupported action %q", s.Action)
+	}
+
+	if s.Selector != "" && !hasFlowVar(s.Selector) {
+		if _, err := ParseUISelector(s.Selector); err != nil {
+			return err
+		}
+	}
+	if s.Regexp != "" && !hasFlowVar(s.Regexp) {
+		if _, err := regexp.Compile(s.Regexp); err != nil {
+			return fmt.Errorf("invalid regexp: %v", err)
+		}
+	}
+	if s.Attr != "" {
+		if _, ok := uiSelectorStringAttrs[s.Attr]; !ok {
+			return fmt.Errorf("unsupported attr %q", s.Attr)
+		}
+	}
+	if s.Var != "" && !flowVarNameRegexp.MatchString(s.Var) {
+		return fmt.Errorf("invalid var name %q", s.Var)
+	}
+	if s.Retry < 0 || s.Retry > flowMaxRetry {
+		return fmt.Errorf("retry must between [0-%d]", flowMaxRetry)
+	}
+	if _, err := parseFlowDuration(s.Timeout, flowDefaultTimeout); err != nil && !hasFlowVar(s.Timeout) {
+		return fmt.Errorf("timeout %v", err)
+	}
+	if _, err := parseFlowDuration(s.RetryInterval, flowDefaultRetryInterval); err != nil && !hasFlowVar(s.RetryInterval) {
+		return fmt.Errorf("retry interval %v", err)
+	}
+	return nil
+}
+
+func hasFlowVar(s string) bool {
+	return flowVarRegexp.MatchString(s)
+}
+
+func parseFlowDuration(s string, dft time.Duration) (time.Duration, error) {
+	if s == "" {
+		return dft, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must be positive")
+	}
+	return d, nil
+}
+
+// RunFlow run the flow on the given device with the extra variables
+// and return the step by step trace, the flow aborted on the first
+// non-optional step failure or once the ctx done
+func RunFlow(ctx context.Context, dvc AdbDeviceHandler, flow *Flow, vars map[string]string) *FlowResult {
+	serial, _ := dvc.Serial()
+
+	ret := &FlowResult{
+		Flow:    flow.Name,
+		Device:  serial,
+		Status:  FlowStatusSucceed,
+		Vars:    make(map[string]string),
+		Steps:   make([]*FlowStepResult, 0, len(flow.Steps)),
+		StartAt: time.Now(),
+	}
+	for k, v := range flow.Vars {
+		ret.Vars[k] = v
+	}
+	for k, v := range vars {
+		ret.Vars[k] = v
+	}
+
+	var aborted bool
+	for idx, step := range flow.Steps {
+		sret := &FlowStepResult{
+			Index:  idx,
+			Name:   step.Name,
+			Action: step.Action,
+		}
+		ret.Steps = append(ret.Steps, sret)
+
+		if aborted {
+			sret.Status = FlowStatusSkipped
+			continue
+		}
+
+		runFlowStep(ctx, dvc, step, ret.Vars, sret)
+		if sret.Status == FlowStatusFailed && !step.Optional {
+			aborted = true
+			ret.Status = FlowStatusFailed
+			ret.Errmsg = fmt.Sprintf("step #%d %s: %s", idx, step.Action, sret.Errmsg)
+		}
+	}
+
+	ret.FinishAt = time.Now()
+	return ret
+}
+
+func runFlowStep(ctx context.Context, dvc AdbDeviceHandler, step *FlowStep, vars map[string]string, sret *FlowStepResult) {
+	sret.StartAt = time.Now()
+	defer func() {
+		sret.Cost = time.Since(sret.StartAt).String()
+	}()
+
+	var (
+		output string
+		err    error
+	)
+
+	// render the step with current variables, note the variables maybe changed by previous steps
+	rendered, err := step.render(vars)
+	if err == nil {
+		err = rendered.Valid()
+	}
+	if err == nil {
+		var (
+			interval, _ = parseFlowDuration(rendered.RetryInterval, flowDefaultRetryInterval)
+		)
+		for i := 0; i <= rendered.Retry; i++ {
+			if i > 0 {
+				if err = sleepContext(ctx, interval); err != nil {
+					break
+				}
+			}
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			sret.Attempts++
+			output, err = rendered.run(ctx, dvc, vars)
+			if err == nil {
+				break
+			}
+		}
+	}
+
+	sret.Output = output
+	if err == nil {
+		sret.Status = FlowStatusSucceed
+		return
+	}
+
+	sret.Status = FlowStatusFailed
+	sret.Errmsg = err.Error()
+	sret.Screenshot, _ = dvc.ScreenCapContext(ctx)
+}
+
+// render return a copy of the step with all of `${var}` replaced
+func (s *FlowStep) render(vars map[string]string) (*FlowStep, error) {
+	var (
+		copied  = *s
+		missing []string
+	)
+
+	expand := func(text string) string {
+		return flowVarRegexp.ReplaceAllStringFunc(text, func(m string) string {
+			name := flowVarRegexp.FindStringSubmatch(m)[1]
+			val, ok := vars[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			return val
+		})
+	}
+
+	for _, field := range []*string{&copied.Activity, &copied.Selector, &copied.Text, &copied.Key, &copied.Regexp, &copied.Timeout, &copied.RetryInterval} {
+		*field = expand(*field)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined variables: %s", strings.Join(missing, ","))
+	}
+	return &copied, nil
+}
+
+// run the rendered step once
+func (s *FlowStep) run(ctx context.Context, dvc AdbDeviceHandler, vars map[string]string) (string, error) {
+	timeout, _ := parseFlowDuration(s.Timeout, flowDefaultTimeout)
+
+	switch s.Action {
+	case FlowActionStartActivity:
+		return dvc.RunContext(ctx, "am", "start", "-n", s.Activity)
+
+	case FlowActionWaitActivity:
+		return waitForActivity(ctx, dvc, s.Activity, timeout)
+
+	case FlowActionFind:
+		node, err := s.waitUINode(ctx, dvc, timeout)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d,%d", node.XY[0], node.XY[1]), nil
+
+	case FlowActionTap:
+		x, y := s.X, s.Y
+		if s.Selector != "" {
+			node, err := s.waitUINode(ctx, dvc, timeout)
+			if err != nil {
+				return "", err
+			}
+			if x, y, err = node.MiddleXY(); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%d,%d", x, y), dvc.Click(x, y)
+
+	case FlowActionSwipe:
+		return "", dvc.Swipe(s.X, s.Y, s.X2, s.Y2)
+
+	case FlowActionInputText:
+		return dvc.RunContext(ctx, "input", "text", strings.Replace(s.Text, " ", "%s", -1))
+
+	case FlowActionKeyEvent:
+		code, ok := flowKeyCodes[s.Key]
+		if !ok {
+			code = s.Key
+		}
+		return dvc.RunContext(ctx, "input", "keyevent", code)
+
+	case FlowActionAssert:
+		return s.runAssert(ctx, dvc, vars, timeout)
+
+	case FlowActionExtract:
+		node, err := s.waitUINode(ctx, dvc, timeout)
+		if err != nil {
+			return "", err
+		}
+		val, err := s.pickValue(s.nodeAttr(node))
+		if err != nil {
+			return "", err
+		}
+		vars[s.Var] = val
+		return val, nil
+
+	case FlowActionSleep:
+		return "", sleepContext(ctx, timeout)
+	}
+
+	return "", fmt.Errorf("unsupported action %q", s.Action)
+}
+
+func (s *FlowStep) runAssert(ctx context.Context, dvc AdbDeviceHandler, vars map[string]string, timeout time.Duration) (string, error) {
+	switch {
+	case s.Activity != "":
+		activity, err := dvc.CurrentTopActivityContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !matchActivity(activity, s.Activity) {
+			return activity, fmt.Errorf("top activity %s not matched %s", activity, s.Activity)
+		}
+		return activity, nil
+
+	case s.Selector != "":
+		node, err := s.waitUINode(ctx, dvc, timeout)
+		if err != nil {
+			return "", err
+		}
+		return s.pickValue(s.nodeAttr(node))
+
+	default:
+		val, ok := vars[s.Var]
+		if !ok {
+			return "", fmt.Errorf("undefined variable %s", s.Var)
+		}
+		return s.pickValue(val)
+	}
+}
+
+// wait until the first ui node matched the step selector shown up
+func (s *FlowStep) waitUINode(ctx context.Context, dvc AdbDeviceHandler, timeout time.Duration) (*AndroidUINode, error) {
+	dump := func() ([]*AndroidUINode, error) { return dvc.DumpCurrentUIContext(ctx) }
+	return waitForUINode(ctx, dump, s.Selector, timeout)
+}
+
+func (s *FlowStep) nodeAttr(node *AndroidUINode) string {
+	attr := s.Attr
+	if attr == "" {
+		attr = "text"
+	}
+	return uiSelectorStringAttrs[attr](node)
+}
+
+// pickValue return the first sub match (or the whole match) of the step regexp if given
+func (s *FlowStep) pickValue(val string) (string, error) {
+	if s.Regexp == "" {
+		return val, nil
+	}
+
+	rx, err := regexp.Compile(s.Regexp)
+	if err != nil {
+		return "", err
+	}
+
+	matches := rx.FindStringSubmatch(val)
+	switch len(matches) {
+	case 0:
+		return val, fmt.Errorf("%q not matched regexp %s", val, s.Regexp)
+	case 1:
+		return matches[0], nil
+	}
+	return matches[1], nil
+}
+
+func waitForActivity(ctx context.Context, dvc AdbDeviceHandler, expect string, timeout time.Duration) (string, error) {
+	var (
+		deadline = time.Now().Add(timeout)
+		activity string
+		err      error
+	)
+	for {
+		activity, err = dvc.CurrentTopActivityContext(ctx)
+		if err == nil && matchActivity(activity, expect) {
+			return activity, nil
+		}
+		if time.Now().After(deadline) {
+			return activity, fmt.Errorf("wait for activity %s timeout after %s", expect, timeout)
+		}
+		if err := sleepContext(ctx, time.Millisecond*500); err != nil {
+			return activity, fmt.Errorf("wait for activity %s: %v", expect, err)
+		}
+	}
+}
+
+// the expect could be the full activity name or only the package name
+func matchActivity(activity, expect string) bool {
+	if strings.Contains(expect, "/") {
+		return activity == expect
+	}
+	return strings.HasPrefix(activity, expect+"/")
+}
@@ -0,0 +1,129 @@
+package adbot
+
+import (
+	"context"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(flowSuite))
+
+type flowSuite struct{}
+
+var testFlowYAML = `
+name: alipay-bill-search
+vars:
+  keyword: "111111"
+steps:
+  - action: start_activity
+    activity: com.eg.android.AlipayGphone/.AlipayLogin
+  - name: wait alipay
+    action: wait_activity
+    activity: com.eg.android.AlipayGphone
+    timeout: 2s
+  - action: tap
+    selector: 'TextView[text="搜索"]'
+    timeout: 1s
+  - action: input_text
+    text: ${keyword} ok
+  - action: extract
+    selector: 'TextView[id$=":id/billAmount"]'
+    regexp: '([0-9.]+)'
+    var: amount
+  - action: assert
+    var: amount
+    regexp: '^0\.01$'
+  - action: find
+    selector: 'Button[text="${missing_label}"]'
+    timeout: 500ms
+    optional: true
+  - action: keyevent
+    key: home
+  - action: assert
+    activity: com.eg.android.AlipayGphone
+    retry: 1
+    retry_interval: 10ms
+  - action: sleep
+    timeout: 1s
+`
+
+func (s *flowSuite) TestParseFlow(c *check.C) {
+	flow, err := ParseFlow([]byte(testFlowYAML))
+	c.Assert(err, check.IsNil)
+	c.Assert(flow.Name, check.Equals, "alipay-bill-search")
+	c.Assert(flow.Steps, check.HasLen, 10)
+	c.Assert(flow.Steps[1].Timeout, check.Equals, "2s")
+
+	// json is valid yaml
+	flow, err = ParseFlow([]byte(`{"name":"home","steps":[{"action":"keyevent","key":"3"}]}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(flow.Steps[0].Key, check.Equals, "3")
+
+	for _, doc := range []string{
+		``,
+		`name: x`,
+		`{"name":"x","steps":[{"action":"nope"}]}`,
+		`{"name":"x","steps":[{"action":"tap"}]}`,
+		`{"name":"x","steps":[{"action":"tap","selektor":"Button"}]}`,
+		`{"name":"x","steps":[{"action":"find","selector":"Button["}]}`,
+		`{"name":"x","steps":[{"action":"extract","selector":"Button"}]}`,
+		`{"name":"x","steps":[{"action":"keyevent","key":"menu2"}]}`,
+		`{"name":"x","steps":[{"action":"sleep","timeout":"1x"}]}`,
+		`{"name":"x","steps":[{"action":"sleep","timeout":"1s","retry":11}]}`,
+	} {
+		_, err := ParseFlow([]byte(doc))
+		c.Assert(err, check.NotNil, check.Commentf(doc))
+	}
+}
+
+func (s *flowSuite) TestRunFlow(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	err := dvc.SetUIDump([]byte(`<hierarchy><node index="0" class="android.widget.FrameLayout" bounds="[0,0][720,1280]">` +
+		`<node index="0" class="android.widget.TextView" text="搜索" clickable="true" bounds="[0,100][200,300]" />` +
+		`<node index="1" class="android.widget.TextView" text="+0.01" resource-id="com.alipay.mobile.bill.list:id/billAmount" bounds="[0,300][200,400]" />` +
+		`</node></hierarchy>`))
+	c.Assert(err, check.IsNil)
+
+	flow, err := ParseFlow([]byte(testFlowYAML))
+	c.Assert(err, check.IsNil)
+
+	ret := RunFlow(context.Background(), dvc, flow, map[string]string{"missing_label": "确定"})
+	c.Assert(ret.Device, check.Equals, "sim-01")
+	c.Assert(ret.Status, check.Equals, FlowStatusFailed)
+	c.Assert(ret.Errmsg, check.Matches, "step #8 assert: top activity .* not matched .*")
+	c.Assert(ret.Vars["amount"], check.Equals, "0.01")
+	c.Assert(dvc.Clicks(), check.DeepEquals, [][2]int{{100, 200}})
+	c.Assert(dvc.Inputs(), check.DeepEquals, []string{"111111 ok"})
+
+	var statuses []string
+	for _, step := range ret.Steps {
+		statuses = append(statuses, step.Status)
+	}
+	c.Assert(statuses, check.DeepEquals, []string{
+		FlowStatusSucceed, FlowStatusSucceed, FlowStatusSucceed, FlowStatusSucceed, FlowStatusSucceed,
+		FlowStatusSucceed, FlowStatusFailed, FlowStatusSucceed, FlowStatusFailed, FlowStatusSkipped,
+	})
+
+	failed := ret.Steps[8]
+	c.Assert(failed.Attempts, check.Equals, 2)
+	c.Assert(failed.Output, check.Equals, SimLauncherActivity)
+	c.Assert(len(failed.Screenshot) > 0, check.Equals, true)
+	c.Assert(ret.Steps[9].Attempts, check.Equals, 0)
+
+	// undefined variables
+	ret = RunFlow(context.Background(), dvc, flow, nil)
+	c.Assert(ret.Steps[6].Errmsg, check.Equals, "undefined variables: missing_label")
+
+	// aborted once the op deadline exceeded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ret = RunFlow(ctx, dvc, flow, map[string]string{"missing_label": "确定"})
+	c.Assert(ret.Status, check.Equals, FlowStatusFailed)
+	c.Assert(ret.Steps[0].Errmsg, check.Equals, "context canceled")
+	c.Assert(ret.Steps[0].Attempts, check.Equals, 0)
+	c.Assert(ret.Steps[1].Status, check.Equals, FlowStatusSkipped)
+}
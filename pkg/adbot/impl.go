@@ -3,8 +3,10 @@ package adbot
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"regexp"
 	"strconv"
@@ -77,7 +79,9 @@ func (a *Adb) WatchAdbEvents() (<-chan *AdbEvent, chan struct{}) {
 // NewDevice implement AdbHandler
 func (a *Adb) NewDevice(serial string) (AdbDeviceHandler, error) {
 	dvc := &AdbDevice{
-		h: a.h.Device(goadb.DeviceWithSerial(serial)),
+		h:      a.h.Device(goadb.DeviceWithSerial(serial)),
+		serial: serial,
+		q:      NewOpQueue(),
 	}
 	_, err := dvc.h.Serial()
 	return dvc, err
@@ -89,12 +93,12 @@ func (a *Adb) NewDevice(serial string) (AdbDeviceHandler, error) {
 
 // AdbDevice is an AdbDeviceHandler implemention
 type AdbDevice struct {
-	h *goadb.Device
-	l sync.Mutex // synchronized Adb Ops including any combined or single ops, mostly are `input` ops
+	h      *goadb.Device
+	serial string
+	l      sync.Mutex // synchronized Adb Ops including any combined or single ops, mostly are `input` ops
+	q      *OpQueue   // prioritized device ops queue
 
-	// alipay button XY
-	alipayBillListSearchButton [2]int // 我的->账单->搜索
-	alipayBillSearchEmitButton [2]int // 我的->账单->搜索->搜索
+	apps paymentAppSet // payment app drivers
 }
 
 // Serial implement AdbDeviceHandler
@@ -129,7 +133,36 @@ func (dvc *AdbDevice) Reboot() error {
 
 // Run implement AdbDeviceHandler
 func (dvc *AdbDevice) Run(cmd string, args ...string) (string, error) {
-	return dvc.h.RunCommand(cmd, args...)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return dvc.RunContext(ctx, cmd, args...)
+}
+
+// RunContext implement AdbDeviceHandler
+// note: the goadb `RunCommand` can't be interrupted, so we read the raw shell stream
+// and close it once the ctx done to abort the hung command, eg: `uiautomator dump`
+func (dvc *AdbDevice) RunContext(ctx context.Context, cmd string, args ...string) (string, error) {
+	stream, err := openShellStream(dvc.serial, cmd, args...)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	donech := make(chan struct{})
+	defer close(donech)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-donech:
+		}
+	}()
+
+	bs, err := ioutil.ReadAll(stream)
+	if ctx.Err() != nil {
+		return string(bs), fmt.Errorf("run %s: %v", cmd, ctx.Err())
+	}
+	return string(bs), err
 }
 
 // SysInfo implement AdbDeviceHandler
@@ -147,6 +180,7 @@ func (dvc *AdbDevice) SysInfo() (*AndroidSysInfo, error) {
 	}
 
 	sysinfo.Battery = battery
+	sysinfo.OpQueue = dvc.q.Stats()
 	return sysinfo, nil
 }
 
@@ -194,8 +228,24 @@ func (dvc *AdbDevice) AwakenScreen() error {
 
 // ScreenCap implement AdbDeviceHandler
 func (dvc *AdbDevice) ScreenCap() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return dvc.ScreenCapContext(ctx)
+}
+
+// ScreenCapContext implement AdbDeviceHandler
+func (dvc *AdbDevice) ScreenCapContext(ctx context.Context) ([]byte, error) {
+	// prefer to read the png directly from the exec stream
+	if bs, err := dvc.screenCapExecOut(ctx); err == nil {
+		return bs, nil
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("screencap: %v", ctx.Err())
+	}
+
+	// fallback to the temp file for the legacy devices
 	tmpfile := "/sdcard/.adb.screen.temp.png"
-	out, err := dvc.Run("screencap", "-p", tmpfile)
+	out, err := dvc.RunContext(ctx, "screencap", "-p", tmpfile)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %s", err, out)
 	}
@@ -209,6 +259,39 @@ func (dvc *AdbDevice) ScreenCap() ([]byte, error) {
 	return ioutil.ReadAll(reader)
 }
 
+// similar as: adb exec-out screencap -p
+func (dvc *AdbDevice) screenCapExecOut(ctx context.Context) ([]byte, error) {
+	serial, err := dvc.h.Serial()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := openExecStream(serial, "screencap", "-p")
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	donech := make(chan struct{})
+	defer close(donech)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-donech:
+		}
+	}()
+
+	bs, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bs, pngMagic) {
+		return nil, errors.New("screencap exec-out: not a png output")
+	}
+	return bs, nil
+}
+
 // GotoHome implement AdbDeviceHandler
 func (dvc *AdbDevice) GotoHome() error {
 	dvc.l.Lock()
@@ -259,7 +342,14 @@ func (dvc *AdbDevice) swipeUnsafe(x1, y1, x2, y2 int) error {
 
 // CurrentTopActivity implement AdbDeviceHandler
 func (dvc *AdbDevice) CurrentTopActivity() (string, error) {
-	out, err := dvc.Run("dumpsys", "activity", "top")
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return dvc.CurrentTopActivityContext(ctx)
+}
+
+// CurrentTopActivityContext implement AdbDeviceHandler
+func (dvc *AdbDevice) CurrentTopActivityContext(ctx context.Context) (string, error) {
+	out, err := dvc.RunContext(ctx, "dumpsys", "activity", "top")
 	if err != nil {
 		return "", err
 	}
@@ -279,13 +369,20 @@ func (dvc *AdbDevice) CurrentTopActivity() (string, error) {
 
 // DumpCurrentUI implement AdbDeviceHandler
 func (dvc *AdbDevice) DumpCurrentUI() ([]*AndroidUINode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return dvc.DumpCurrentUIContext(ctx)
+}
+
+// DumpCurrentUIContext implement AdbDeviceHandler
+func (dvc *AdbDevice) DumpCurrentUIContext(ctx context.Context) ([]*AndroidUINode, error) {
 	dvc.l.Lock()
 	defer dvc.l.Unlock()
-	return dvc.dumpCurrentUIUnsafe()
+	return dvc.dumpCurrentUIUnsafe(ctx)
 }
 
-func (dvc *AdbDevice) dumpCurrentUIUnsafe() ([]*AndroidUINode, error) {
-	bs, err := dvc.Run("uiautomator", "dump")
+func (dvc *AdbDevice) dumpCurrentUIUnsafe(ctx context.Context) ([]*AndroidUINode, error) {
+	bs, err := dvc.RunContext(ctx, "uiautomator", "dump")
 	if err != nil {
 		log.Errorln("dumpCurrentUI().ui.dump error:", err)
 		return nil, err
@@ -320,13 +417,16 @@ func (dvc *AdbDevice) FindUINodeAndClick(resourceid, resourcetext string) (int,
 }
 
 func (dvc *AdbDevice) findUINodeAndClickUnsafe(resourceid, resourcetext string) (int, int, error) {
-	nodes, err := dvc.dumpCurrentUIUnsafe()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+
+	nodes, err := dvc.dumpCurrentUIUnsafe(ctx)
 	if err != nil {
 		log.Errorln("findUINodeAndClick().DumpCurrentUI() error:", err)
 		return -1, -1, err
 	}
 
-	var targetNode = dvc.findUINode(nodes, resourceid, resourcetext)
+	var targetNode = findUINode(nodes, resourceid, resourcetext)
 	if targetNode == nil {
 		return -1, -1, errUINodeNotFound
 	}
@@ -339,7 +439,7 @@ func (dvc *AdbDevice) findUINodeAndClickUnsafe(resourceid, resourcetext string)
 	return x, y, dvc.clickUnsafe(x, y)
 }
 
-func (dvc *AdbDevice) findUINode(nodes []*AndroidUINode, resourceid, resourcetext string) *AndroidUINode {
+func findUINode(nodes []*AndroidUINode, resourceid, resourcetext string) *AndroidUINode {
 	for _, node := range nodes {
 		if node.ResourceID == resourceid {
 			if resourcetext == "" {
@@ -353,8 +453,174 @@ func (dvc *AdbDevice) findUINode(nodes []*AndroidUINode, resourceid, resourcetex
 	return nil
 }
 
+// FindUINodes implement AdbDeviceHandler
+func (dvc *AdbDevice) FindUINodes(selector string) ([]*AndroidUINode, error) {
+	sel, err := ParseUISelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := dvc.DumpCurrentUI()
+	if err != nil {
+		return nil, err
+	}
+	return sel.Find(nodes), nil
+}
+
+// WaitForUINode implement AdbDeviceHandler
+func (dvc *AdbDevice) WaitForUINode(selector string, timeout time.Duration) (*AndroidUINode, error) {
+	return waitForUINode(context.Background(), dvc.DumpCurrentUI, selector, timeout)
+}
+
+// ClickSelector implement AdbDeviceHandler
+func (dvc *AdbDevice) ClickSelector(selector string) (int, int, error) {
+	sel, err := ParseUISelector(selector)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	dvc.l.Lock()
+	defer dvc.l.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+
+	nodes, err := dvc.dumpCurrentUIUnsafe(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	x, y, err := firstUINodeXY(sel.Find(nodes))
+	if err != nil {
+		return -1, -1, err
+	}
+	return x, y, dvc.clickUnsafe(x, y)
+}
+
+// waitForUINode poll the ui dump until the first ui node matched the selector shown up,
+// give up once the ctx done
+func waitForUINode(ctx context.Context, dumpFunc func() ([]*AndroidUINode, error), selector string, timeout time.Duration) (*AndroidUINode, error) {
+	sel, err := ParseUISelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		nodes, err := dumpFunc()
+		if err != nil {
+			log.Warnln("waitForUINode().DumpCurrentUI() error:", err)
+		}
+		if matched := sel.Find(nodes); len(matched) > 0 {
+			return matched[0], nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("wait for ui node %q timeout after %s", selector, timeout)
+		}
+		if err := sleepContext(ctx, time.Millisecond*500); err != nil {
+			return nil, fmt.Errorf("wait for ui node %q: %v", selector, err)
+		}
+	}
+}
+
+// sleepContext sleep for the duration, return the ctx error if the ctx done earlier
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func firstUINodeXY(nodes []*AndroidUINode) (int, int, error) {
+	if len(nodes) == 0 {
+		return -1, -1, errUINodeNotFound
+	}
+	x, y, err := nodes[0].MiddleXY()
+	if err != nil {
+		return -1, -1, fmt.Errorf("can't find the target UI node MiddleXY(): %v", err)
+	}
+	return x, y, nil
+}
+
+// sysLogCursor tracks the position of the received system logs, so the reconnected
+// logcat stream could be resumed from the last log time without the duplicated logs
+//
+// note: the logs of the same time are only told apart by the content, the received
+// logs of the last time are counted to skip exactly the same number of them on resume
+type sysLogCursor struct {
+	lastTime string         // time of the last received log
+	seen     map[string]int // received logs of the last time
+	replayed map[string]int // replayed logs of the last time after reconnected
+	resuming bool           // the reconnected stream is replaying the logs up to the last time
+	skipOne  bool           // the last buffered log printed by `-T 1` is not wanted
+}
+
+func newSysLogCursor() *sysLogCursor {
+	return &sysLogCursor{seen: make(map[string]int)}
+}
+
+// the logcat args to follow the logs from the cursor
+func (c *sysLogCursor) args() []string {
+	if c.lastTime == "" {
+		return []string{"-T", "1"} // only the newly logs, note: the last buffered log is printed
+	}
+	return []string{"-T", c.lastTime} // note: all of the logs of the last time are printed again
+}
+
+// reset the cursor on the newly opened logcat stream
+func (c *sysLogCursor) reconnected() {
+	c.resuming = c.lastTime != ""
+	c.skipOne = c.lastTime == ""
+	c.replayed = make(map[string]int)
+}
+
+// accept verify the log line is newly received, and move the cursor forward
+func (c *sysLogCursor) accept(line string) bool {
+	if strings.HasPrefix(line, "--------- beginning of ") { // the log buffer header, eg: main, system, crash
+		return false
+	}
+
+	if c.skipOne {
+		c.skipOne = false
+		return false
+	}
+
+	ent := parseSysLogLine(line)
+	if ent == nil { // can't tell whether received or not, skip if still replaying
+		return !c.resuming
+	}
+
+	switch {
+	case c.resuming && ent.Time < c.lastTime:
+		return false
+
+	case ent.Time == c.lastTime:
+		if c.resuming {
+			if c.replayed[line]++; c.replayed[line] <= c.seen[line] {
+				return false // received before reconnected
+			}
+		}
+		c.seen[line]++
+
+	default: // newer, or older while not resuming, eg: the device clock changed
+		c.lastTime = ent.Time
+		c.seen = map[string]int{line: 1}
+	}
+
+	c.resuming = false
+	return true
+}
+
 // TailSysLogs implement AdbDeviceHandler
-func (dvc *AdbDevice) TailSysLogs() (<-chan string, chan struct{}) {
+//
+// follow the system logs over a long-lived `logcat` shell stream and
+// reconnect the stream if the device dropped until the stopch closed
+func (dvc *AdbDevice) TailSysLogs(filter *SysLogFilter) (<-chan string, chan struct{}) {
 	var (
 		ch     = make(chan string, 10240)
 		stopch = make(chan struct{})
@@ -364,8 +630,7 @@ func (dvc *AdbDevice) TailSysLogs() (<-chan string, chan struct{}) {
 		log.Println("tail follow system logs loop started")
 		defer log.Println("tail follow system logs loop stopped")
 
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
+		defer close(ch)
 
 		sendFunc := func(e string) {
 			select {
@@ -374,25 +639,61 @@ func (dvc *AdbDevice) TailSysLogs() (<-chan string, chan struct{}) {
 			}
 		}
 
-		for {
-			select {
+		var (
+			cursor   = newSysLogCursor() // resume the logs after reconnected
+			delayMin = time.Second
+			delayMax = time.Second * 30
+			delay    = delayMin
+		)
 
-			case <-ticker.C:
-				out, err := dvc.Run("logcat", "-d") // dump the buffered logs
-				if err != nil {
-					log.Warnln("TailSysLogs().logcat.dump error:", err)
-					continue
+		for {
+			args := append(append([]string{}, filter.logcatArgs()...), cursor.args()...)
+
+			stream, err := dvc.openShellStream("logcat", args...)
+			if err != nil {
+				log.Warnf("TailSysLogs().logcat.stream error: %v, reconnect in %s", err, delay)
+				select {
+				case <-time.After(delay):
+				case <-stopch:
+					return
 				}
-
-				scanner := bufio.NewScanner(bytes.NewBufferString(out))
-				for scanner.Scan() {
-					sendFunc(scanner.Text())
+				if delay *= 2; delay > delayMax {
+					delay = delayMax
+				}
+				continue
+			}
+			delay = delayMin
+
+			// close the stream to abort the blocked reading once stopped
+			streamDone := make(chan struct{})
+			go func() {
+				select {
+				case <-stopch:
+				case <-streamDone:
+				}
+				stream.Close()
+			}()
+
+			scanner := bufio.NewScanner(stream)
+			cursor.reconnected()
+			for scanner.Scan() {
+				line := strings.TrimRight(scanner.Text(), "\r")
+				if cursor.accept(line) {
+					sendFunc(line)
 				}
+			}
+			close(streamDone)
 
-				dvc.Run("logcat", "-c") // clear the buffer logs
+			select {
+			case <-stopch:
+				return
+			default:
+			}
 
+			log.Warnf("TailSysLogs().logcat.stream closed: %v, reconnect in %s", scanner.Err(), delay)
+			select {
+			case <-time.After(delay):
 			case <-stopch:
-				close(ch)
 				return
 			}
 		}
@@ -401,13 +702,28 @@ func (dvc *AdbDevice) TailSysLogs() (<-chan string, chan struct{}) {
 	return ch, stopch
 }
 
+func (dvc *AdbDevice) openShellStream(cmd string, args ...string) (io.ReadCloser, error) {
+	serial, err := dvc.h.Serial()
+	if err != nil {
+		return nil, err
+	}
+	return openShellStream(serial, cmd, args...)
+}
+
 // WatchSysEvents implement AdbDeviceHandler
 func (dvc *AdbDevice) WatchSysEvents(keywords []string) (<-chan string, chan struct{}) {
+	return watchSysEvents(dvc, keywords)
+}
+
+// watch keywords in the system logs via the given device TailSysLogs()
+func watchSysEvents(dvc AdbDeviceHandler, keywords []string) (<-chan string, chan struct{}) {
 	var (
 		ch     = make(chan string, 10240)
 		stopch = make(chan struct{})
 	)
 
+	logch, logstopch := dvc.TailSysLogs(nil)
+
 	go func() {
 		log.Println("watch system events loop started")
 		defer log.Println("watch system events loop stopped")
@@ -419,19 +735,22 @@ func (dvc *AdbDevice) WatchSysEvents(keywords []string) (<-chan string, chan str
 			}
 		}
 
-		logch, logstopch := dvc.TailSysLogs()
+		defer close(ch)
+		defer close(logstopch)
 
 		for {
 			select {
-			case log := <-logch:
+			case line, ok := <-logch:
+				if !ok {
+					return
+				}
 				for _, keyword := range keywords {
-					if strings.Contains(log, keyword) {
-						sendFunc(log)
+					if strings.Contains(line, keyword) {
+						sendFunc(line)
+						break
 					}
 				}
 			case <-stopch:
-				close(logstopch)
-				close(ch)
 				return
 			}
 		}
@@ -565,289 +884,27 @@ func (dvc *AdbDevice) WatchSysNotifies() (<-chan *AndroidSysNotify, chan struct{
 }
 
 //
-// Alipay App
+// Payment Apps
 //
 
-// StartAliPay implement AdbDeviceHandler
-func (dvc *AdbDevice) StartAliPay() error {
-	var err error
-	for i := 1; i <= 5; i++ {
-		if dvc.isAlipayActive() {
-			return nil
-		}
-		_, err = dvc.Run("am", "start", "com.eg.android.AlipayGphone/.AlipayLogin")
-		if err != nil {
-			log.Warnf("StartAliPay() %d am.start error: %v", i, err)
-		}
-		time.Sleep(time.Second)
-	}
-	return err
+// PaymentApp implement AdbDeviceHandler
+func (dvc *AdbDevice) PaymentApp(name string) (PaymentApp, error) {
+	return dvc.apps.get(name, func() (PaymentApp, error) {
+		return NewPaymentApp(name, dvc)
+	})
 }
 
-// AlipaySearchOrder implement AdbDeviceHandler
-// 我的 -> 账单 -> 搜索 -> 搜索
-func (dvc *AdbDevice) AlipaySearchOrder(orderID string) (*AlipayOrder, error) {
-	dvc.l.Lock()
-	defer dvc.l.Unlock()
-
-	if orderID == "" {
-		return nil, errors.New("AlipaySearchOrder() order id required")
-	}
-
-	// clear any previous alipay notifies
-	if n := dvc.countAlipayNotifies(); n > 3 {
-		dvc.clearSysNotifiesUnsafe()
-	}
-
-	// ensure current top activity is alipay bill list page
-	if !dvc.isAlipayBillListActive() {
-		err := dvc.gotoAlipayListOrder()
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	var (
-		resourceid   string
-		resourcetext string
-		newX, newY   int
-		err          error
-	)
-
-	// 点击账单列表页的'搜索'
-	// if we know the button XY, directly click it
-	if currX, currY := dvc.alipayBillListSearchButton[0], dvc.alipayBillListSearchButton[1]; currX > 0 && currY > 0 {
-		dvc.clickUnsafe(currX, currY)
-		// ensure we got the right activity, otherwise re-caculate the button XY and click it
-		err = dvc.waitAlipayBillSearchActive(5, time.Second)
-		if err != nil {
-			log.Warnln("AlipaySearchOrder().DirectClick() on `Bill-List-Search-Button` maybe outdated, need fix the button XY")
-		} else {
-			goto EMITSEARCH
-		}
-	}
-
-	// caculate the button XY and click it
-	resourceid = "com.alipay.mobile.bill.list:id/search_btn"
-	resourcetext = "搜索"
-	newX, newY, err = dvc.findUINodeAndClickUnsafe(resourceid, resourcetext)
-	if err != nil {
-		log.Errorln("AlipaySearchOrder().findUINodeAndClick() on `Bill-List-Search-Button` error:", err)
-		return nil, err
-	}
-	// ensure we got the right activity
-	err = dvc.waitAlipayBillSearchActive(5, time.Second)
-	if err != nil {
-		log.Errorln("AlipaySearchOrder().waitAlipayBillSearchActive() error:", err)
-		return nil, err
-	}
-	// now we got the right activity
-	if newX > 0 && newY > 0 {
-		dvc.alipayBillListSearchButton = [2]int{newX, newY} // renew the new button XY
-		newX, newY = 0, 0                                   // clear the value
-	}
-
-EMITSEARCH:
-
-	// goback once afterwards to the alipay order list page
-	defer func() {
-		dvc.gobackUnsafe()
-		dvc.waitAlipayBillListActive(5, time.Second)
-	}()
-
-	// 输入订单号
-	if _, err := dvc.Run("input", "text", orderID); err != nil {
-		return nil, fmt.Errorf("AlipaySearchOrder() input text orderID error: %v", err)
-	}
-
-	// 点击账单搜索页的'搜索' 进行提交
-	// if we know the button XY, directly click it
-	if currX, currY := dvc.alipayBillSearchEmitButton[0], dvc.alipayBillSearchEmitButton[1]; currX > 0 && currY > 0 {
-		dvc.clickUnsafe(currX, currY)
-	} else { // caculate the button XY and click it
-		resourceid = ""
-		resourcetext = "搜索"
-		newX, newY, err = dvc.findUINodeAndClickUnsafe(resourceid, resourcetext)
-		if err != nil {
-			log.Errorln("AlipaySearchOrder().findUINodeAndClick() on `Bill-Search-Emit-Button` error:", err)
-			return nil, err
-		}
-		if newX > 0 && newY > 0 {
-			dvc.alipayBillSearchEmitButton = [2]int{newX, newY} // renew the new button XY
-			newX, newY = 0, 0                                   // clear the value
-		}
-	}
-
-	// parse the search result page
-	nodes, err := dvc.dumpCurrentUIUnsafe()
-	if err != nil {
-		log.Errorln("AlipaySearchOrder().dumpCurrentUI() on search result page error:", err)
-		return nil, err
-	}
-	// retry max 10 times if loading
-	for i := 1; i <= 10; i++ {
-		loadingNode := dvc.findUINode(nodes, "android:id/progress", "") // 加载中
-		if loadingNode != nil {
-			time.Sleep(time.Second)
-			nodes, _ = dvc.dumpCurrentUIUnsafe()
-			continue
-		}
-		break
-	}
-
-	// we assume alipay loaded the search result
-	resourceid = "com.alipay.mobile.antui:id/tips"
-	resourcetext = "没有找到"
-	tipNode := dvc.findUINode(nodes, resourceid, resourcetext)
-	if tipNode != nil { // not found this order
-		return nil, errors.New("no such order")
-	}
-
-	var (
-		billNameNode   = dvc.findUINode(nodes, "com.alipay.mobile.bill.list:id/billName", "") // comment-user-username
-		billAmountNode = dvc.findUINode(nodes, "com.alipay.mobile.bill.list:id/billAmount", "")
-		billTime1Node  = dvc.findUINode(nodes, "com.alipay.mobile.bill.list:id/timeInfo1", "")
-		billTime2Node  = dvc.findUINode(nodes, "com.alipay.mobile.bill.list:id/timeInfo2", "")
-		billComment    string // comment
-		billAccount    string // user-username
-		billAmount     string // +0.01
-		billTime1      string // 昨天
-		billTime2      string // 11:42
-	)
-
-	if billNameNode == nil {
-		return nil, errors.New("unexpected search result page: the `billName` UI node not found")
-	}
-	billNameText := billNameNode.Text // 111111111-bbk-bbk
-	fields := strings.SplitN(billNameText, "-", 2)
-	billComment = fields[0]
-	billAccount = fields[1]
-	if billComment == "" {
-		return nil, errors.New("unexpected search result page: the `billName` UI node missing order comment text")
-	}
-
-	if billAmountNode == nil {
-		return nil, errors.New("unexpected search result page: the `billAmount` UI node not found")
-	}
-	billAmount = billAmountNode.Text // +0.01
-	billAmount = strings.TrimPrefix(billAmount, "+")
-
-	if billTime1Node != nil {
-		billTime1 = billTime1Node.Text // 昨天
-	}
-	if billTime2Node != nil {
-		billTime2 = billTime2Node.Text // 11:42
-	}
-
-	return &AlipayOrder{
-		Comment: billComment,
-		Account: billAccount,
-		Amount:  billAmount,
-		Time:    billTime1 + "-" + billTime2,
-	}, nil
-}
-
-func (dvc *AdbDevice) countAlipayNotifies() int {
-	notifies := dvc.ListSysNotifies()
-	var n int
-	for _, notify := range notifies {
-		if notify.Source == "com.eg.android.AlipayGphone" {
-			n++
-		}
-	}
-	return n
+// DoOp implement AdbDeviceHandler
+func (dvc *AdbDevice) DoOp(ctx context.Context, prio OpPriority, name string, fn OpFunc) error {
+	return dvc.q.Do(ctx, prio, name, fn)
 }
 
-func (dvc *AdbDevice) gotoAlipayListOrder() error {
-	if err := dvc.gotoAlipayTabProfile(); err != nil {
-		return err
-	}
-
-	time.Sleep(time.Millisecond * 300)
-
-	var (
-		resourceid   = "com.alipay.mobile.antui:id/item_left_text"
-		resourcetext = "账单"
-	)
-	_, _, err := dvc.findUINodeAndClickUnsafe(resourceid, resourcetext)
-	if err != nil {
-		log.Errorln("gotoAlipayListOrder().findUINodeAndClick() error:", err)
-		return err
-	}
-
-	// now we expect the bill list activity at top
-	return dvc.waitAlipayBillListActive(10, time.Second)
+// CancelOp implement AdbDeviceHandler
+func (dvc *AdbDevice) CancelOp(id string) error {
+	return dvc.q.Cancel(id)
 }
 
-func (dvc *AdbDevice) gotoAlipayTabProfile() error {
-	if err := dvc.StartAliPay(); err != nil {
-		return err
-	}
-
-	time.Sleep(time.Millisecond * 300)
-
-	var (
-		resourceid   = "com.alipay.android.phone.wealth.home:id/tab_description"
-		resourcetext = "我的"
-		maxRetry     = 10
-		retryN       int
-		err          error
-	)
-
-RETRY:
-	retryN++
-	if retryN > maxRetry {
-		return fmt.Errorf("gotoAlipayTabProfile() failed after %d retries, error: %v", retryN, err)
-	}
-
-	dvc.StartAliPay() // ensure every time alipay at top
-	_, _, err = dvc.findUINodeAndClickUnsafe(resourceid, resourcetext)
-	if err != nil {
-		if err == errUINodeNotFound {
-			log.Warnln("gotoAlipayTabProfile() goback one step and retry to find the '我的' button ...")
-		} else {
-			log.Warnln("gotoAlipayTabProfile().findUINodeAndClick error:", err)
-		}
-		dvc.gobackUnsafe() // go back one step and retry
-		goto RETRY
-	}
-
-	return nil
-}
-
-func (dvc *AdbDevice) isAlipayActive() bool {
-	activity, _ := dvc.CurrentTopActivity()
-	return strings.Contains(activity, "com.eg.android.AlipayGphone")
-}
-
-func (dvc *AdbDevice) isAlipayBillListActive() bool { // 我的->订单
-	activity, _ := dvc.CurrentTopActivity()
-	return activity == "com.eg.android.AlipayGphone/com.alipay.mobile.bill.list.ui.BillMainListActivity"
-}
-
-func (dvc *AdbDevice) waitAlipayBillListActive(maxWait int, interval time.Duration) error {
-	for i := 1; i <= maxWait; i++ {
-		if dvc.isAlipayBillListActive() {
-			return nil
-		}
-		time.Sleep(interval)
-		continue
-	}
-	return errors.New("failed to wait for the AlipayBillList Activity")
-}
-
-func (dvc *AdbDevice) isAlipayBillSearchActive() bool { // 我的->订单->搜索
-	activity, _ := dvc.CurrentTopActivity()
-	return activity == "com.eg.android.AlipayGphone/com.alipay.mobile.bill.list.ui.BillWordSearchActivity_"
-}
-
-func (dvc *AdbDevice) waitAlipayBillSearchActive(maxWait int, interval time.Duration) error {
-	for i := 1; i <= maxWait; i++ {
-		if dvc.isAlipayBillSearchActive() {
-			return nil
-		}
-		time.Sleep(interval)
-		continue
-	}
-	return errors.New("failed to wait for the AlipayBillSearch Activity")
+// OpQueueStats implement AdbDeviceHandler
+func (dvc *AdbDevice) OpQueueStats() *OpQueueStats {
+	return dvc.q.Stats()
 }
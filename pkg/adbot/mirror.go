@@ -0,0 +1,301 @@
+package adbot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	pngMagic = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// nolint
+var (
+	MirrorEventTap     = "tap"     // tap {x},{y}
+	MirrorEventSwipe   = "swipe"   // swipe from {x},{y} to {x2},{y2}
+	MirrorEventKey     = "key"     // keyevent {key}: home, back, power, enter, delete, wakeup, or key code
+	MirrorEventText    = "text"    // input {text}
+	MirrorEventOptions = "options" // adjust the frame {fps}, {quality}, {max_width}
+	MirrorEventInfo    = "info"    // server side: the current screen and frame options
+	MirrorEventError   = "error"   // server side: the error message of the previous event
+)
+
+// MirrorOptions is the screen mirror frame options
+type MirrorOptions struct {
+	FPS      float64 `json:"fps"`       // frames per second, (0-10], default 1
+	Quality  int     `json:"quality"`   // jpeg quality, [1-100], default 50
+	MaxWidth int     `json:"max_width"` // scale down the frame if the screen is wider than this, 0 means original size
+}
+
+// Valid is exported
+func (o *MirrorOptions) Valid() error {
+	if o.FPS < 0 || o.FPS > 10 {
+		return errors.New("fps must between (0-10]")
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return errors.New("quality must between [1-100]")
+	}
+	if o.MaxWidth < 0 {
+		return errors.New("max width must be positive")
+	}
+	return nil
+}
+
+func (o *MirrorOptions) setDefault() {
+	if o.FPS == 0 {
+		o.FPS = 1
+	}
+	if o.Quality == 0 {
+		o.Quality = 50
+	}
+}
+
+func (o *MirrorOptions) interval() time.Duration {
+	return time.Duration(float64(time.Second) / o.FPS)
+}
+
+// MirrorEvent is the json text message on the screen mirror socket
+type MirrorEvent struct {
+	Type     string  `json:"type"`
+	X        int     `json:"x,omitempty"`
+	Y        int     `json:"y,omitempty"`
+	X2       int     `json:"x2,omitempty"`
+	Y2       int     `json:"y2,omitempty"`
+	Key      string  `json:"key,omitempty"`
+	Text     string  `json:"text,omitempty"`
+	FPS      float64 `json:"fps,omitempty"`
+	Quality  int     `json:"quality,omitempty"`
+	MaxWidth int     `json:"max_width,omitempty"`
+	Width    int     `json:"width,omitempty"`   // info: the screen width
+	Height   int     `json:"height,omitempty"`  // info: the screen height
+	Message  string  `json:"message,omitempty"` // error: the error message
+}
+
+// IsInput check if the event will interact with the device
+func (ev *MirrorEvent) IsInput() bool {
+	switch ev.Type {
+	case MirrorEventTap, MirrorEventSwipe, MirrorEventKey, MirrorEventText:
+		return true
+	}
+	return false
+}
+
+// Valid is exported
+func (ev *MirrorEvent) Valid() error {
+	switch ev.Type {
+	case MirrorEventTap:
+		if ev.X < 0 || ev.Y < 0 {
+			return errors.New("bad x,y value")
+		}
+	case MirrorEventSwipe:
+		if ev.X < 0 || ev.Y < 0 || ev.X2 < 0 || ev.Y2 < 0 {
+			return errors.New("bad x,y,x2,y2 value")
+		}
+	case MirrorEventKey:
+		if _, ok := flowKeyCodes[ev.Key]; !ok {
+			if _, err := strconv.Atoi(ev.Key); err != nil {
+				return fmt.Errorf("unsupported key %q", ev.Key)
+			}
+		}
+	case MirrorEventText:
+		if ev.Text == "" {
+			return errors.New("text required")
+		}
+	case MirrorEventOptions:
+		opts := &MirrorOptions{FPS: ev.FPS, Quality: ev.Quality, MaxWidth: ev.MaxWidth}
+		return opts.Valid()
+	default:
+		return fmt.Errorf("unsupported event type %q", ev.Type)
+	}
+	return nil
+}
+
+// ScreenMirror continuously capture the device screen as jpeg frames
+// and apply the remote input events onto the device
+type ScreenMirror struct {
+	dvc AdbDeviceHandler
+
+	sync.Mutex               // protect following
+	opts       MirrorOptions // current frame options
+	width      int           // current screen width
+	height     int           // current screen height
+
+	resetch chan struct{} // notify the capture loop the options changed
+	stopch  chan struct{}
+	once    sync.Once
+}
+
+// NewScreenMirror create a new ScreenMirror on the device
+func NewScreenMirror(dvc AdbDeviceHandler, opts *MirrorOptions) (*ScreenMirror, error) {
+	if err := opts.Valid(); err != nil {
+		return nil, err
+	}
+	o := *opts
+	o.setDefault()
+
+	return &ScreenMirror{
+		dvc:     dvc,
+		opts:    o,
+		resetch: make(chan struct{}, 1),
+		stopch:  make(chan struct{}),
+	}, nil
+}
+
+// Frames start the capture loop and return the jpeg frames channel,
+// the channel will be closed after the mirror stopped
+// note: the slow consumer will skip the frames instead of blocking the capture loop
+func (m *ScreenMirror) Frames() <-chan []byte {
+	ch := make(chan []byte, 1)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			start := time.Now()
+
+			frame, err := m.capture()
+			if err != nil {
+				log.Warnln("ScreenMirror.capture() error:", err)
+			} else {
+				select {
+				case ch <- frame:
+				default: // skip
+				}
+			}
+
+			m.Lock()
+			wait := m.opts.interval() - time.Since(start)
+			m.Unlock()
+
+			select {
+			case <-m.stopch:
+				return
+			case <-m.resetch:
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Info return the current screen size and frame options
+func (m *ScreenMirror) Info() *MirrorEvent {
+	m.Lock()
+	defer m.Unlock()
+	return &MirrorEvent{
+		Type:     MirrorEventInfo,
+		FPS:      m.opts.FPS,
+		Quality:  m.opts.Quality,
+		MaxWidth: m.opts.MaxWidth,
+		Width:    m.width,
+		Height:   m.height,
+	}
+}
+
+// Handle apply the event on the device or adjust the frame options
+// note: the event X,Y is the coordinate of the original screen, not the scaled frame
+func (m *ScreenMirror) Handle(ev *MirrorEvent) error {
+	if err := ev.Valid(); err != nil {
+		return err
+	}
+
+	switch ev.Type {
+	case MirrorEventTap:
+		return m.dvc.Click(ev.X, ev.Y)
+
+	case MirrorEventSwipe:
+		return m.dvc.Swipe(ev.X, ev.Y, ev.X2, ev.Y2)
+
+	case MirrorEventKey:
+		code, ok := flowKeyCodes[ev.Key]
+		if !ok {
+			code = ev.Key
+		}
+		_, err := m.dvc.Run("input", "keyevent", code)
+		return err
+
+	case MirrorEventText:
+		_, err := m.dvc.Run("input", "text", strings.Replace(ev.Text, " ", "%s", -1))
+		return err
+
+	case MirrorEventOptions:
+		m.Lock()
+		if ev.FPS > 0 {
+			m.opts.FPS = ev.FPS
+		}
+		if ev.Quality > 0 {
+			m.opts.Quality = ev.Quality
+		}
+		m.opts.MaxWidth = ev.MaxWidth
+		m.Unlock()
+
+		select {
+		case m.resetch <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Stop is exported
+func (m *ScreenMirror) Stop() {
+	m.once.Do(func() { close(m.stopch) })
+}
+
+// capture one screen frame and convert to jpeg
+func (m *ScreenMirror) capture() ([]byte, error) {
+	pngbs, err := m.dvc.ScreenCap()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(pngbs))
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	opts := m.opts
+	m.width, m.height = img.Bounds().Dx(), img.Bounds().Dy()
+	m.Unlock()
+
+	if opts.MaxWidth > 0 && img.Bounds().Dx() > opts.MaxWidth {
+		img = scaleImage(img, opts.MaxWidth)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale down the image to the given width with the nearest neighbor sampling
+func scaleImage(src image.Image, width int) image.Image {
+	var (
+		sb     = src.Bounds()
+		height = sb.Dy() * width / sb.Dx()
+		dst    = image.NewRGBA(image.Rect(0, 0, width, height))
+	)
+
+	for y := 0; y < height; y++ {
+		sy := sb.Min.Y + y*sb.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := sb.Min.X + x*sb.Dx()/width
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
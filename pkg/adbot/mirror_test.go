@@ -0,0 +1,74 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(mirrorSuite))
+
+type mirrorSuite struct{}
+
+func (s *mirrorSuite) TestScreenMirror(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	_, err := NewScreenMirror(dvc, &MirrorOptions{FPS: 11})
+	c.Assert(err, check.NotNil)
+
+	m, err := NewScreenMirror(dvc, &MirrorOptions{FPS: 10, MaxWidth: 360})
+	c.Assert(err, check.IsNil)
+
+	frames := m.Frames()
+	select {
+	case frame := <-frames:
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		c.Assert(err, check.IsNil)
+		c.Assert(img.Bounds().Dx(), check.Equals, 360)
+	case <-time.After(time.Second * 5):
+		c.Fatal("screen mirror frame not received")
+	}
+
+	info := m.Info()
+	c.Assert(info.Type, check.Equals, MirrorEventInfo)
+	c.Assert(info.Quality, check.Equals, 50)
+	c.Assert(info.Width > 360, check.Equals, true)
+
+	// input events
+	c.Assert(m.Handle(&MirrorEvent{Type: MirrorEventTap, X: 10, Y: 20}), check.IsNil)
+	c.Assert(dvc.Clicks(), check.DeepEquals, [][2]int{{10, 20}})
+	c.Assert(m.Handle(&MirrorEvent{Type: MirrorEventText, Text: "hello world"}), check.IsNil)
+	c.Assert(dvc.Inputs(), check.DeepEquals, []string{"hello world"})
+	app, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Start(context.Background()), check.IsNil)
+	c.Assert(m.Handle(&MirrorEvent{Type: MirrorEventKey, Key: "home"}), check.IsNil)
+	activity, _ := dvc.CurrentTopActivity()
+	c.Assert(activity, check.Equals, SimLauncherActivity)
+
+	// adjust options
+	c.Assert(m.Handle(&MirrorEvent{Type: MirrorEventOptions, FPS: 2, Quality: 80}), check.IsNil)
+	c.Assert(m.Info().FPS, check.Equals, float64(2))
+	c.Assert(m.Info().Quality, check.Equals, 80)
+	c.Assert(m.Info().MaxWidth, check.Equals, 0)
+
+	for _, ev := range []*MirrorEvent{
+		{Type: "nope"},
+		{Type: MirrorEventKey, Key: "menu2"},
+		{Type: MirrorEventText},
+		{Type: MirrorEventOptions, FPS: 20},
+	} {
+		c.Assert(m.Handle(ev), check.NotNil, check.Commentf("%+v", ev))
+	}
+
+	m.Stop()
+	m.Stop()
+	for range frames {
+	}
+}
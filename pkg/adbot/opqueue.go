@@ -0,0 +1,319 @@
+package adbot
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/utils"
+)
+
+//
+//  Device Operation Queue
+//
+//  all of the ops on one device are serialized by the queue, the pending op with
+//  the higher priority runs first, and the ops with the same priority run in order.
+//  every op carries a context deadline, the pending or running op could be cancelled
+//  by the context or by the op id.
+//
+
+// OpPriority is the priority of the device op, the higher one runs first
+type OpPriority int
+
+// nolint
+const (
+	OpPriorityDebug     OpPriority = iota // manual debugging, eg: click, screencap, exec
+	OpPriorityKeepAlive                   // keep the payment app alive on the top activity
+	OpPriorityOrder                       // order confirmation, eg: search order, gen qrcode
+)
+
+func (p OpPriority) String() string {
+	switch p {
+	case OpPriorityDebug:
+		return "debug"
+	case OpPriorityKeepAlive:
+		return "keepalive"
+	case OpPriorityOrder:
+		return "order"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// nolint
+var (
+	DefaultOpTimeout  = time.Minute      // the op deadline if the given context hasn't
+	DefaultRunTimeout = time.Second * 30 // the deadline of each single `adb shell` command
+
+	ErrOpNotFound = errors.New("device op not found")
+)
+
+// OpFunc is the device op body, it should give up as soon as the ctx done
+type OpFunc func(ctx context.Context) error
+
+// OpInfo is the brief of a pending or running device op
+type OpInfo struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Priority  string        `json:"priority"`
+	QueuedAt  time.Time     `json:"queued_at"`
+	StartedAt time.Time     `json:"started_at"` // zero if pending
+	Deadline  time.Time     `json:"deadline"`
+	Wait      time.Duration `json:"wait"` // waited in the queue, till now if pending
+}
+
+// OpQueueStats is the statistics of the device op queue
+type OpQueueStats struct {
+	Depth       int           `json:"depth"`        // nb of pending ops
+	Running     *OpInfo       `json:"running"`      // current running op, nil means idle
+	Pending     []*OpInfo     `json:"pending"`      // pending ops in the running order
+	NumDone     int64         `json:"num_done"`     // nb of finished ops
+	NumCanceled int64         `json:"num_canceled"` // nb of ops cancelled or expired before running
+	LastWait    time.Duration `json:"last_wait"`    // wait time of the latest started op
+	MaxWait     time.Duration `json:"max_wait"`     // max wait time of all started ops
+	AvgWait     time.Duration `json:"avg_wait"`     // average wait time of all started ops
+}
+
+type deviceOp struct {
+	id       string
+	name     string
+	prio     OpPriority
+	seq      uint64
+	deadline time.Time
+	queuedAt time.Time
+	startAt  time.Time
+	cancel   context.CancelFunc
+	readych  chan struct{} // closed once the op granted to run
+	index    int           // heap index, -1 means not pending
+}
+
+func (op *deviceOp) info() *OpInfo {
+	info := &OpInfo{
+		ID:        op.id,
+		Name:      op.name,
+		Priority:  op.prio.String(),
+		QueuedAt:  op.queuedAt,
+		StartedAt: op.startAt,
+		Deadline:  op.deadline,
+	}
+	if op.startAt.IsZero() {
+		info.Wait = time.Since(op.queuedAt)
+	} else {
+		info.Wait = op.startAt.Sub(op.queuedAt)
+	}
+	return info
+}
+
+// opHeap implement heap.Interface
+type opHeap []*deviceOp
+
+func (h opHeap) Len() int { return len(h) }
+
+func (h opHeap) Less(i, j int) bool {
+	if h[i].prio != h[j].prio {
+		return h[i].prio > h[j].prio
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h opHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *opHeap) Push(x interface{}) {
+	op := x.(*deviceOp)
+	op.index = len(*h)
+	*h = append(*h, op)
+}
+
+func (h *opHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	op := old[n-1]
+	old[n-1] = nil
+	op.index = -1
+	*h = old[:n-1]
+	return op
+}
+
+// OpQueue is the per-device op queue
+type OpQueue struct {
+	sync.Mutex // protect following
+	pending    opHeap
+	running    *deviceOp
+	seq        uint64
+
+	numDone     int64
+	numStarted  int64
+	numCanceled int64
+	totalWait   time.Duration
+	maxWait     time.Duration
+	lastWait    time.Duration
+}
+
+// NewOpQueue new an idle device op queue
+func NewOpQueue() *OpQueue {
+	return &OpQueue{}
+}
+
+// Do queue the op and block until the op finished or the ctx done.
+//
+// note: if the ctx done while the op running, Do returns at once, but the
+// device is still occupied until the op body returned, so the op body should
+// always respect the ctx and each single adb command is bounded by DefaultRunTimeout
+func (q *OpQueue) Do(ctx context.Context, prio OpPriority, name string, fn OpFunc) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultOpTimeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	op := q.push(ctx, cancel, prio, name)
+
+	select {
+	case <-op.readych:
+	case <-ctx.Done():
+		if q.remove(op) {
+			return fmt.Errorf("device op %s %s before running: %v", name, op.id, ctx.Err())
+		}
+		// granted at the same time, give it up
+		<-op.readych
+		q.done(op)
+		return fmt.Errorf("device op %s %s before running: %v", name, op.id, ctx.Err())
+	}
+
+	errch := make(chan error, 1)
+	go func() {
+		defer q.done(op)
+		errch <- fn(ctx)
+	}()
+
+	select {
+	case err := <-errch:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("device op %s %s: %v", name, op.id, ctx.Err())
+	}
+}
+
+// Cancel cancel the pending or running op by id
+func (q *OpQueue) Cancel(id string) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.running != nil && q.running.id == id {
+		q.running.cancel()
+		return nil
+	}
+	for _, op := range q.pending {
+		if op.id == id {
+			op.cancel()
+			return nil
+		}
+	}
+	return ErrOpNotFound
+}
+
+// Stats return the current statistics of the queue
+func (q *OpQueue) Stats() *OpQueueStats {
+	q.Lock()
+	defer q.Unlock()
+
+	stats := &OpQueueStats{
+		Depth:       len(q.pending),
+		Pending:     make([]*OpInfo, 0, len(q.pending)),
+		NumDone:     q.numDone,
+		NumCanceled: q.numCanceled,
+		LastWait:    q.lastWait,
+		MaxWait:     q.maxWait,
+	}
+	if q.running != nil {
+		stats.Running = q.running.info()
+	}
+	if q.numStarted > 0 {
+		stats.AvgWait = q.totalWait / time.Duration(q.numStarted)
+	}
+
+	// sort the pending ops by the running order
+	sorted := append(opHeap(nil), q.pending...)
+	sort.Slice(sorted, sorted.Less)
+	for _, op := range sorted {
+		stats.Pending = append(stats.Pending, op.info())
+	}
+
+	return stats
+}
+
+func (q *OpQueue) push(ctx context.Context, cancel context.CancelFunc, prio OpPriority, name string) *deviceOp {
+	q.Lock()
+	defer q.Unlock()
+
+	q.seq++
+	op := &deviceOp{
+		id:       utils.RandomString(8),
+		name:     name,
+		prio:     prio,
+		seq:      q.seq,
+		queuedAt: time.Now(),
+		cancel:   cancel,
+		readych:  make(chan struct{}),
+	}
+	op.deadline, _ = ctx.Deadline()
+
+	heap.Push(&q.pending, op)
+	q.scheduleLocked()
+	return op
+}
+
+// remove the pending op, return false if the op already granted
+func (q *OpQueue) remove(op *deviceOp) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if op.index < 0 {
+		return false
+	}
+	heap.Remove(&q.pending, op.index)
+	q.numCanceled++
+	return true
+}
+
+func (q *OpQueue) done(op *deviceOp) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.running == op {
+		q.running = nil
+		q.numDone++
+	}
+	q.scheduleLocked()
+}
+
+// grant the highest priority pending op to run if idle
+func (q *OpQueue) scheduleLocked() {
+	if q.running != nil || len(q.pending) == 0 {
+		return
+	}
+
+	op := heap.Pop(&q.pending).(*deviceOp)
+	op.startAt = time.Now()
+
+	wait := op.startAt.Sub(op.queuedAt)
+	q.numStarted++
+	q.totalWait += wait
+	q.lastWait = wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+
+	q.running = op
+	close(op.readych)
+}
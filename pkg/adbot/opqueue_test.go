@@ -0,0 +1,231 @@
+package adbot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(opqueueSuite))
+
+type opqueueSuite struct{}
+
+func (s *opqueueSuite) TestOpQueuePriority(c *check.C) {
+	var (
+		q       = NewOpQueue()
+		ctx     = context.Background()
+		startch = make(chan struct{})
+		holdch  = make(chan struct{})
+		mux     sync.Mutex
+		order   []string
+		wg      sync.WaitGroup
+	)
+
+	// hold the queue
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Do(ctx, OpPriorityDebug, "hold", func(context.Context) error {
+			close(startch)
+			<-holdch
+			return nil
+		})
+	}()
+	<-startch
+
+	enqueue := func(prio OpPriority, name string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Do(ctx, prio, name, func(context.Context) error {
+				mux.Lock()
+				order = append(order, name)
+				mux.Unlock()
+				return nil
+			})
+		}()
+		for !containsOp(q.Stats().Pending, name) { // ensure queued in order
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	enqueue(OpPriorityDebug, "debug1")
+	enqueue(OpPriorityKeepAlive, "keepalive1")
+	enqueue(OpPriorityOrder, "order1")
+	enqueue(OpPriorityDebug, "debug2")
+	enqueue(OpPriorityOrder, "order2")
+
+	stats := q.Stats()
+	c.Assert(stats.Depth, check.Equals, 5)
+	c.Assert(stats.Running, check.NotNil)
+	c.Assert(stats.Running.Name, check.Equals, "hold")
+	c.Assert(stats.Pending[0].Name, check.Equals, "order1")
+	c.Assert(stats.Pending[0].Priority, check.Equals, "order")
+
+	close(holdch)
+	wg.Wait()
+
+	c.Assert(order, check.DeepEquals, []string{"order1", "order2", "keepalive1", "debug1", "debug2"})
+
+	stats = q.Stats()
+	c.Assert(stats.Depth, check.Equals, 0)
+	c.Assert(stats.Running, check.IsNil)
+	c.Assert(stats.NumDone, check.Equals, int64(6))
+	c.Assert(stats.MaxWait > 0, check.Equals, true)
+}
+
+func (s *opqueueSuite) TestOpQueueCancel(c *check.C) {
+	var (
+		q       = NewOpQueue()
+		startch = make(chan struct{})
+		holdch  = make(chan struct{})
+		errch   = make(chan error, 2)
+	)
+	defer close(holdch)
+
+	go func() {
+		errch <- q.Do(context.Background(), OpPriorityOrder, "hold", func(ctx context.Context) error {
+			close(startch)
+			select {
+			case <-ctx.Done():
+				<-holdch
+				return ctx.Err()
+			case <-holdch:
+				return nil
+			}
+		})
+	}()
+	<-startch
+
+	// expired before running
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := q.Do(ctx, OpPriorityDebug, "expired", func(context.Context) error { return nil })
+	c.Assert(err, check.ErrorMatches, "device op expired .* before running: context deadline exceeded")
+	c.Assert(q.Stats().NumCanceled, check.Equals, int64(1))
+	c.Assert(q.Stats().Depth, check.Equals, 0)
+
+	// cancel the pending op by id
+	go func() {
+		errch <- q.Do(context.Background(), OpPriorityDebug, "pending", func(context.Context) error { return nil })
+	}()
+	var pendingID string
+	for pendingID == "" {
+		if stats := q.Stats(); stats.Depth > 0 {
+			pendingID = stats.Pending[0].ID
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(q.Cancel(pendingID), check.IsNil)
+	c.Assert(<-errch, check.ErrorMatches, ".*before running: context canceled")
+	c.Assert(q.Cancel(pendingID), check.Equals, ErrOpNotFound)
+
+	// cancel the running op by id, the caller returns at once
+	c.Assert(q.Cancel(q.Stats().Running.ID), check.IsNil)
+	c.Assert(<-errch, check.ErrorMatches, "device op hold .*: context canceled")
+}
+
+func (s *opqueueSuite) TestSimDeviceRunContext(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	holdch := make(chan struct{})
+	defer close(holdch)
+	dvc.HandleCmd("uiautomator", func(dvc *SimDevice, args []string) (string, error) {
+		<-holdch // hung
+		return "", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := dvc.RunContext(ctx, "uiautomator", "dump")
+	c.Assert(err, check.ErrorMatches, "run uiautomator: context deadline exceeded")
+
+	// the op stats exposed with the sysinfo
+	err = dvc.DoOp(context.Background(), OpPriorityOrder, "getprop", func(ctx context.Context) error {
+		_, err := dvc.RunContext(ctx, "getprop")
+		return err
+	})
+	c.Assert(err, check.IsNil)
+	info, err := dvc.SysInfo()
+	c.Assert(err, check.IsNil)
+	c.Assert(info.OpQueue, check.NotNil)
+	c.Assert(info.OpQueue.NumDone, check.Equals, int64(1))
+}
+
+func (s *opqueueSuite) TestCancelRunningOpOnDevice(c *check.C) {
+	var (
+		sim       = NewSimulator()
+		dvc       = sim.AddDevice("sim-01")
+		abortedch = make(chan error, 1)
+		releasech = make(chan struct{})
+		errch     = make(chan error, 2)
+	)
+
+	hungch := make(chan struct{})
+	defer close(hungch)
+	dvc.HandleCmd("uiautomator", func(dvc *SimDevice, args []string) (string, error) {
+		<-hungch
+		return "", nil
+	})
+
+	// the op body passes the ctx to the device command, then takes a while to cleanup
+	go func() {
+		errch <- dvc.DoOp(context.Background(), OpPriorityOrder, "hung", func(ctx context.Context) error {
+			_, err := dvc.RunContext(ctx, "uiautomator", "dump")
+			abortedch <- err
+			<-releasech
+			return err
+		})
+	}()
+	for q := dvc.OpQueueStats(); q.Running == nil; q = dvc.OpQueueStats() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// cancel the running op, the hung command aborted by the op ctx
+	c.Assert(dvc.CancelOp(dvc.OpQueueStats().Running.ID), check.IsNil)
+	c.Assert(<-errch, check.ErrorMatches, "device op hung .*: context canceled")
+	c.Assert(<-abortedch, check.ErrorMatches, "run uiautomator: context canceled")
+
+	// the queue is not released until the op body returned
+	var started bool
+	go func() {
+		errch <- dvc.DoOp(context.Background(), OpPriorityDebug, "next", func(ctx context.Context) error {
+			started = true
+			_, err := dvc.ScreenCapContext(ctx)
+			return err
+		})
+	}()
+	for !containsOp(dvc.OpQueueStats().Pending, "next") {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 20)
+	stats := dvc.OpQueueStats()
+	c.Assert(stats.Running, check.NotNil)
+	c.Assert(stats.Running.Name, check.Equals, "hung")
+	c.Assert(stats.Depth, check.Equals, 1)
+
+	close(releasech)
+	c.Assert(<-errch, check.IsNil)
+	c.Assert(started, check.Equals, true)
+	c.Assert(dvc.OpQueueStats().NumDone, check.Equals, int64(2))
+
+	// the cancelled ctx never runs the device commands
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dvc.ScreenCapContext(ctx)
+	c.Assert(err, check.ErrorMatches, "screencap: context canceled")
+}
+
+func containsOp(ops []*OpInfo, name string) bool {
+	for _, op := range ops {
+		if op.Name == name {
+			return true
+		}
+	}
+	return false
+}
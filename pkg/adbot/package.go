@@ -0,0 +1,236 @@
+package adbot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/utils"
+)
+
+var (
+	apkTempDir       = "/data/local/tmp"
+	pmInstallTimeout = time.Minute * 5
+
+	packageNamerx    = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*(\.[a-zA-Z0-9_]+)+$`)
+	packageSectionrx = regexp.MustCompile(`^\s*Package \[([^\]]+)\]`)
+)
+
+// AndroidPackage is an installed android package
+type AndroidPackage struct {
+	Name             string `json:"name"`
+	CodePath         string `json:"code_path"`
+	VersionName      string `json:"version_name"`
+	VersionCode      int    `json:"version_code"`
+	FirstInstallTime string `json:"first_install_time"`
+	LastUpdateTime   string `json:"last_update_time"`
+}
+
+// ValidPackageName is exported
+func ValidPackageName(name string) error {
+	if !packageNamerx.MatchString(name) {
+		return fmt.Errorf("invalid package name %q", name)
+	}
+	return nil
+}
+
+// ListPackages implement AdbDeviceHandler
+func (dvc *AdbDevice) ListPackages(thirdParty bool) ([]*AndroidPackage, error) {
+	return listPackages(dvc, thirdParty)
+}
+
+// PackageInfo implement AdbDeviceHandler
+func (dvc *AdbDevice) PackageInfo(name string) (*AndroidPackage, error) {
+	return packageInfo(dvc, name)
+}
+
+// InstallPackage implement AdbDeviceHandler
+func (dvc *AdbDevice) InstallPackage(apk io.Reader) error {
+	return installPackage(context.Background(), dvc, apk)
+}
+
+// InstallPackageContext implement AdbDeviceHandler
+func (dvc *AdbDevice) InstallPackageContext(ctx context.Context, apk io.Reader) error {
+	return installPackage(ctx, dvc, apk)
+}
+
+// UninstallPackage implement AdbDeviceHandler
+func (dvc *AdbDevice) UninstallPackage(name string) error {
+	return uninstallPackage(dvc, name)
+}
+
+// the following helpers only rely on the `pm` & `dumpsys` shell commands
+// and the file pushing, so they are shared by all of AdbDeviceHandler implementions
+
+// pm list packages [-3] -> dumpsys package packages
+func listPackages(dvc AdbDeviceHandler, thirdParty bool) ([]*AndroidPackage, error) {
+	args := []string{"list", "packages"}
+	if thirdParty {
+		args = append(args, "-3")
+	}
+	out, err := dvc.Run("pm", args...)
+	if err != nil {
+		return nil, err
+	}
+	names := parsePackageList(out)
+
+	out, err = dvc.Run("dumpsys", "package", "packages")
+	if err != nil {
+		return nil, err
+	}
+	infos := parsePackageDump(out)
+
+	ret := make([]*AndroidPackage, 0, len(names))
+	for _, name := range names {
+		if info, ok := infos[name]; ok {
+			ret = append(ret, info)
+		} else {
+			ret = append(ret, &AndroidPackage{Name: name})
+		}
+	}
+	return ret, nil
+}
+
+// dumpsys package {name}
+func packageInfo(dvc AdbDeviceHandler, name string) (*AndroidPackage, error) {
+	if err := ValidPackageName(name); err != nil {
+		return nil, err
+	}
+
+	out, err := dvc.Run("dumpsys", "package", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := parsePackageDump(out)[name]
+	if !ok {
+		return nil, fmt.Errorf("package %s not found", name)
+	}
+	return info, nil
+}
+
+// push the apk into the temp dir -> pm install -r -> rm
+func installPackage(ctx context.Context, dvc AdbDeviceHandler, apk io.Reader) error {
+	tmpfile := fmt.Sprintf("%s/adbot-%s.apk", apkTempDir, utils.RandomString(8))
+	if err := dvc.PushFile(apk, tmpfile, 0644); err != nil {
+		return fmt.Errorf("push apk: %v", err)
+	}
+	defer dvc.Run("rm", "-f", tmpfile) // note: always cleanup, even if the ctx done
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("install apk: %v", err)
+	}
+
+	// pm install may take a while on the large apk
+	ctx, cancel := context.WithTimeout(ctx, pmInstallTimeout)
+	defer cancel()
+
+	out, err := dvc.RunContext(ctx, "pm", "install", "-r", tmpfile)
+	if err != nil {
+		return err
+	}
+	return pmResult(out)
+}
+
+// pm uninstall {name}
+func uninstallPackage(dvc AdbDeviceHandler, name string) error {
+	if err := ValidPackageName(name); err != nil {
+		return err
+	}
+
+	out, err := dvc.Run("pm", "uninstall", name)
+	if err != nil {
+		return err
+	}
+	return pmResult(out)
+}
+
+// the `pm` command always exit with zero, so check the last output line
+// Success | Failure [INSTALL_FAILED_INVALID_APK]
+func pmResult(out string) error {
+	out = strings.TrimSpace(out)
+	lines := strings.Split(out, "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if last == "Success" {
+		return nil
+	}
+	if last == "" {
+		return errors.New("pm: empty output")
+	}
+	return errors.New(last)
+}
+
+// package:com.eg.android.AlipayGphone
+func parsePackageList(text string) []string {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "package:") {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(line, "package:"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+//	Package [com.eg.android.AlipayGphone] (3f1c2a0):
+//	  codePath=/data/app/com.eg.android.AlipayGphone-1
+//	  versionCode=151 minSdk=16 targetSdk=26
+//	  versionName=10.1.60.8888
+//	  firstInstallTime=2019-06-10 11:42:01
+//	  lastUpdateTime=2019-06-10 11:42:01
+//
+// note: only the first section is kept, the latter maybe `Hidden system packages`
+func parsePackageDump(text string) map[string]*AndroidPackage {
+	var (
+		ret     = make(map[string]*AndroidPackage)
+		current *AndroidPackage
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if matches := packageSectionrx.FindStringSubmatch(line); len(matches) == 2 {
+			current = nil
+			if _, ok := ret[matches[1]]; !ok {
+				current = &AndroidPackage{Name: matches[1]}
+				ret[matches[1]] = current
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "codePath="):
+			current.CodePath = strings.TrimPrefix(line, "codePath=")
+		case strings.HasPrefix(line, "versionCode="):
+			fields := strings.Fields(strings.TrimPrefix(line, "versionCode="))
+			if len(fields) > 0 {
+				current.VersionCode, _ = strconv.Atoi(fields[0])
+			}
+		case strings.HasPrefix(line, "versionName="):
+			current.VersionName = strings.TrimPrefix(line, "versionName=")
+		case strings.HasPrefix(line, "firstInstallTime="):
+			current.FirstInstallTime = strings.TrimPrefix(line, "firstInstallTime=")
+		case strings.HasPrefix(line, "lastUpdateTime="):
+			current.LastUpdateTime = strings.TrimPrefix(line, "lastUpdateTime=")
+		}
+	}
+
+	return ret
+}
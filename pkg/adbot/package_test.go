@@ -0,0 +1,127 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(packageSuite))
+
+type packageSuite struct{}
+
+func (s *packageSuite) TestParsePackageDump(c *check.C) {
+	text := `Packages:
+  Package [com.eg.android.AlipayGphone] (3f1c2a0):
+    userId=10086
+    codePath=/data/app/com.eg.android.AlipayGphone-1
+    versionCode=151 minSdk=16 targetSdk=26
+    versionName=10.1.60.8888
+    firstInstallTime=2019-06-10 11:42:01
+    lastUpdateTime=2019-06-12 09:00:00
+
+Hidden system packages:
+  Package [com.eg.android.AlipayGphone] (1a2b3c4):
+    codePath=/system/app/Alipay
+    versionCode=100 minSdk=16 targetSdk=26
+    versionName=9.0.0
+`
+	pkgs := parsePackageDump(text)
+	c.Assert(len(pkgs), check.Equals, 1)
+
+	pkg := pkgs["com.eg.android.AlipayGphone"]
+	c.Assert(pkg, check.NotNil)
+	c.Assert(pkg.CodePath, check.Equals, "/data/app/com.eg.android.AlipayGphone-1")
+	c.Assert(pkg.VersionCode, check.Equals, 151)
+	c.Assert(pkg.VersionName, check.Equals, "10.1.60.8888")
+	c.Assert(pkg.FirstInstallTime, check.Equals, "2019-06-10 11:42:01")
+	c.Assert(pkg.LastUpdateTime, check.Equals, "2019-06-12 09:00:00")
+
+	c.Assert(pmResult("\tpkg: /data/local/tmp/a.apk\nSuccess\n"), check.IsNil)
+	c.Assert(pmResult("Failure [INSTALL_FAILED_INVALID_APK]\n"), check.ErrorMatches, `Failure \[INSTALL_FAILED_INVALID_APK\]`)
+}
+
+func (s *packageSuite) TestSimDeviceFiles(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	_, err := dvc.StatFile("/sdcard/a.txt")
+	c.Assert(err, check.ErrorMatches, ".*not found")
+
+	err = dvc.PushFile(bytes.NewBufferString("hello"), "/sdcard/a.txt", 0644)
+	c.Assert(err, check.IsNil)
+
+	info, err := dvc.StatFile("/sdcard/a.txt")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Size, check.Equals, int64(5))
+	c.Assert(info.IsDir(), check.Equals, false)
+
+	r, err := dvc.PullFile("/sdcard/a.txt")
+	c.Assert(err, check.IsNil)
+	bs, _ := ioutil.ReadAll(r)
+	r.Close()
+	c.Assert(string(bs), check.Equals, "hello")
+
+	_, err = dvc.PullFile("/")
+	c.Assert(err, check.ErrorMatches, ".*is a directory")
+
+	c.Assert(ValidDevicePath("/sdcard/a.txt"), check.IsNil)
+	c.Assert(ValidDevicePath("sdcard/a.txt"), check.NotNil)
+	c.Assert(ValidDevicePath("/sdcard/../a.txt"), check.NotNil)
+}
+
+func (s *packageSuite) TestSimDevicePackages(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	pkgs, err := dvc.ListPackages(true)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(pkgs), check.Equals, 1)
+	c.Assert(pkgs[0].Name, check.Equals, SimAlipayPackage)
+	c.Assert(pkgs[0].VersionCode, check.Equals, 151)
+
+	pkgs, err = dvc.ListPackages(false)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(pkgs), check.Equals, 2)
+
+	// install
+	err = dvc.InstallPackage(bytes.NewReader(SimAPK("com.example.demo", "1.0.1", 2)))
+	c.Assert(err, check.IsNil)
+
+	pkg, err := dvc.PackageInfo("com.example.demo")
+	c.Assert(err, check.IsNil)
+	c.Assert(pkg.VersionName, check.Equals, "1.0.1")
+	c.Assert(pkg.VersionCode, check.Equals, 2)
+
+	// the temp apk file should be removed
+	c.Assert(len(dvc.files), check.Equals, 0)
+
+	// downgrade & invalid apk
+	err = dvc.InstallPackage(bytes.NewReader(SimAPK("com.example.demo", "1.0.0", 1)))
+	c.Assert(err, check.ErrorMatches, ".*INSTALL_FAILED_VERSION_DOWNGRADE.*")
+	err = dvc.InstallPackage(bytes.NewBufferString("not an apk"))
+	c.Assert(err, check.ErrorMatches, ".*INSTALL_FAILED_INVALID_APK.*")
+
+	// cancelled before pm install, the temp apk file still removed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = dvc.InstallPackageContext(ctx, bytes.NewReader(SimAPK("com.example.demo", "1.0.2", 3)))
+	c.Assert(err, check.ErrorMatches, "install apk: context canceled")
+	c.Assert(len(dvc.files), check.Equals, 0)
+	pkg, err = dvc.PackageInfo("com.example.demo")
+	c.Assert(err, check.IsNil)
+	c.Assert(pkg.VersionCode, check.Equals, 2)
+
+	// uninstall
+	c.Assert(dvc.UninstallPackage("com.example.demo"), check.IsNil)
+	_, err = dvc.PackageInfo("com.example.demo")
+	c.Assert(err, check.ErrorMatches, "package com.example.demo not found")
+	c.Assert(dvc.UninstallPackage("com.example.demo"), check.NotNil)
+	c.Assert(dvc.UninstallPackage("bad name"), check.NotNil)
+}
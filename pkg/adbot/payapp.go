@@ -0,0 +1,275 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+//  Payment App Drivers
+//
+//  a payment app (wallet) driver only operates the device through the AdbDeviceHandler,
+//  so adding a new wallet doesn't require touching any of AdbDeviceHandler implementions
+//
+//  the ui operations take the ctx of the device op, so the driver gives up and frees
+//  the device once the op deadline exceeded or cancelled
+//
+
+// PaymentApp is a payment app driver on one adb device
+type PaymentApp interface {
+	Name() string                                                       // registered driver name, same as the order qrcode type, eg: alipay
+	Package() string                                                    // android package name, eg: com.eg.android.AlipayGphone
+	Start(ctx context.Context) error                                    // bring the app to the foreground
+	IsForeground(ctx context.Context) bool                              // is the app the current top activity
+	ParseNotify(notify *AndroidSysNotify) *PayNotice                    // parse the payment notice from the system notify, nil means not a payment notify
+	SearchOrder(ctx context.Context, orderID string) (*PayOrder, error) // search one paid order by the order comment
+	ListBills(ctx context.Context) ([]*PayOrder, error)                 // list the recent bills
+}
+
+// PaymentQrCoder is an optional interface of PaymentApp,
+// for the wallets which collect qrcode could only be generated within the app
+type PaymentQrCoder interface {
+	GenQrCode(ctx context.Context, fee int, comment string) ([]byte, error)
+}
+
+// PaymentAppFactory new a PaymentApp driver on the given adb device
+type PaymentAppFactory func(dvc AdbDeviceHandler) PaymentApp
+
+// PayOrder is a paid order found in the payment app
+type PayOrder struct {
+	Comment string `json:"comment"`
+	Account string `json:"account"`
+	Amount  string `json:"amount"`
+	Time    string `json:"time"`
+}
+
+// PayNotice is a payment system notify of the payment app
+type PayNotice struct {
+	App     string    `json:"app"`
+	Message string    `json:"message"`
+	Amount  string    `json:"amount"` // paid amount by CNY, eg: 0.01, empty if not recognized
+	Payer   string    `json:"payer"`  // payer hint, eg: payer nickname, maybe empty
+	Time    time.Time `json:"time"`   // received time
+}
+
+// Fee return the paid amount by CNY cent, 0 if not recognized
+func (n *PayNotice) Fee() int {
+	fee, _ := parseYuanFee(n.Amount)
+	return fee
+}
+
+// new a payment notice, the amount is normalized as 0.00 if recognized
+func newPayNotice(app, message, amount, payer string) *PayNotice {
+	notice := &PayNotice{
+		App:     app,
+		Message: message,
+		Payer:   strings.TrimSpace(payer),
+		Time:    time.Now(),
+	}
+	if fee, err := parseYuanFee(amount); err == nil {
+		notice.Amount = fmt.Sprintf("%0.2f", float64(fee)/float64(100))
+	}
+	return notice
+}
+
+// parse the amount by CNY into cent, eg: 0.01 -> 1
+func parseYuanFee(amount string) (int, error) {
+	yuan, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+	if err != nil {
+		return 0, err
+	}
+	if yuan <= 0 {
+		return 0, fmt.Errorf("invalid amount %s", amount)
+	}
+	return int(math.Round(yuan * 100)), nil
+}
+
+var (
+	paymentAppsMux sync.RWMutex
+	paymentApps    = make(map[string]PaymentAppFactory)
+)
+
+// RegisterPaymentApp register a payment app driver by name,
+// it panics if the name registered twice or the factory is nil
+func RegisterPaymentApp(name string, factory PaymentAppFactory) {
+	paymentAppsMux.Lock()
+	defer paymentAppsMux.Unlock()
+
+	if factory == nil {
+		panic("adbot: register payment app " + name + " with nil factory")
+	}
+	if _, ok := paymentApps[name]; ok {
+		panic("adbot: payment app " + name + " registered twice")
+	}
+	paymentApps[name] = factory
+}
+
+// PaymentApps return the sorted names of all registered payment app drivers
+func PaymentApps() []string {
+	paymentAppsMux.RLock()
+	defer paymentAppsMux.RUnlock()
+
+	ret := make([]string, 0, len(paymentApps))
+	for name := range paymentApps {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewPaymentApp new a registered payment app driver on the given adb device
+func NewPaymentApp(name string, dvc AdbDeviceHandler) (PaymentApp, error) {
+	paymentAppsMux.RLock()
+	factory, ok := paymentApps[name]
+	paymentAppsMux.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("payment app %s not registered", name)
+	}
+	return factory(dvc), nil
+}
+
+// paymentAppSet hold the payment app drivers of one device, so the per-device
+// driver states (eg: the cached button XY) survive across calls
+type paymentAppSet struct {
+	sync.Mutex
+	m map[string]PaymentApp
+}
+
+func (s *paymentAppSet) get(name string, newFunc func() (PaymentApp, error)) (PaymentApp, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if app, ok := s.m[name]; ok {
+		return app, nil
+	}
+
+	app, err := newFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.m == nil {
+		s.m = make(map[string]PaymentApp)
+	}
+	s.m[name] = app
+	return app, nil
+}
+
+//
+// ui helpers for the payment app drivers
+//
+
+func waitTopActivity(ctx context.Context, dvc AdbDeviceHandler, activity string, maxWait int, interval time.Duration) error {
+	for i := 1; i <= maxWait; i++ {
+		if curr, _ := dvc.CurrentTopActivityContext(ctx); curr == activity {
+			return nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return fmt.Errorf("wait for the %s Activity: %v", activity, err)
+		}
+	}
+	return fmt.Errorf("failed to wait for the %s Activity", activity)
+}
+
+func clickText(ctx context.Context, dvc AdbDeviceHandler, text string) (int, int, error) {
+	nodes, err := dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return clickUINode(dvc, findUINodeByText(nodes, text))
+}
+
+// similar as AdbDeviceHandler.FindUINodeAndClick, but aborted once the ctx done
+func findUINodeAndClick(ctx context.Context, dvc AdbDeviceHandler, resourceid, resourcetext string) (int, int, error) {
+	nodes, err := dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return clickUINode(dvc, findUINode(nodes, resourceid, resourcetext))
+}
+
+func clickUINode(dvc AdbDeviceHandler, node *AndroidUINode) (int, int, error) {
+	if node == nil {
+		return -1, -1, errUINodeNotFound
+	}
+
+	x, y, err := node.MiddleXY()
+	if err != nil {
+		return -1, -1, err
+	}
+	return x, y, dvc.Click(x, y)
+}
+
+// the last matched one, the dialog buttons are always dumped after the page
+func findUINodeByText(nodes []*AndroidUINode, text string) *AndroidUINode {
+	var ret *AndroidUINode
+	for _, node := range nodes {
+		if node.Text == text {
+			ret = node
+		}
+	}
+	return ret
+}
+
+// the first node matched the resource id under the node in the hierarchy order
+func findUINodeUnder(node *AndroidUINode, resourceid string) *AndroidUINode {
+	if node.ResourceID == resourceid {
+		return node
+	}
+	for _, child := range node.Children() {
+		if ret := findUINodeUnder(child, resourceid); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// all of non-empty texts under the node in the hierarchy order
+func uiNodeTexts(node *AndroidUINode) []string {
+	var ret []string
+	if text := strings.TrimSpace(node.Text); text != "" {
+		ret = append(ret, text)
+	}
+	for _, child := range node.Children() {
+		ret = append(ret, uiNodeTexts(child)...)
+	}
+	return ret
+}
+
+func cropPNG(bs []byte, rect image.Rectangle) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, errors.New("the screen image can't be cropped")
+	}
+
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return nil, errors.New("the crop area is out of the screen")
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sub.SubImage(rect)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,169 @@
+package adbot
+
+import (
+	"context"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(payappSuite))
+
+type payappSuite struct{}
+
+func (s *payappSuite) TestPaymentAppRegistry(c *check.C) {
+	c.Assert(PaymentApps(), check.DeepEquals, []string{PaymentAppAlipay, PaymentAppWxpay})
+
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	_, err := NewPaymentApp("nope", dvc)
+	c.Assert(err, check.ErrorMatches, "payment app nope not registered")
+	_, err = dvc.PaymentApp("nope")
+	c.Assert(err, check.NotNil)
+
+	app1, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+	app2, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+	c.Assert(app1, check.Equals, app2)
+	c.Assert(app1.Package(), check.Equals, AlipayPackage)
+
+	// alipay collect qrcode is built by the master, not by the app
+	_, ok := app1.(PaymentQrCoder)
+	c.Assert(ok, check.Equals, false)
+
+	c.Assert(func() { RegisterPaymentApp(PaymentAppAlipay, newAlipay) }, check.PanicMatches, ".*registered twice")
+	c.Assert(func() { RegisterPaymentApp("nil", nil) }, check.PanicMatches, ".*nil factory")
+}
+
+func (s *payappSuite) TestParsePayNotify(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	ali, _ := dvc.PaymentApp(PaymentAppAlipay)
+	wx, _ := dvc.PaymentApp(PaymentAppWxpay)
+
+	notify := &AndroidSysNotify{Source: WxpayPackage, Message: "微信支付: 微信支付收款0.01元"}
+	c.Assert(ali.ParseNotify(notify), check.IsNil)
+	notice := wx.ParseNotify(notify)
+	c.Assert(notice, check.NotNil)
+	c.Assert(notice.App, check.Equals, PaymentAppWxpay)
+	c.Assert(notice.Message, check.Equals, notify.Message)
+	c.Assert(notice.Amount, check.Equals, "0.01")
+	c.Assert(notice.Fee(), check.Equals, 1)
+	c.Assert(notice.Time.IsZero(), check.Equals, false)
+
+	notify = &AndroidSysNotify{Source: WxpayPackage, Message: "微信支付: [2条]微信支付: 个人收款码到账¥12.5"}
+	c.Assert(wx.ParseNotify(notify).Fee(), check.Equals, 1250)
+
+	notify = &AndroidSysNotify{Source: WxpayPackage, Message: "bbk: hello"}
+	c.Assert(wx.ParseNotify(notify), check.IsNil)
+
+	notify = &AndroidSysNotify{Source: AlipayPackage, Message: "你已成功收款0.01元"}
+	notice = ali.ParseNotify(notify)
+	c.Assert(notice.App, check.Equals, PaymentAppAlipay)
+	c.Assert(notice.Amount, check.Equals, "0.01")
+	c.Assert(notice.Payer, check.Equals, "")
+	c.Assert(wx.ParseNotify(notify), check.IsNil)
+
+	notify = &AndroidSysNotify{Source: AlipayPackage, Message: "支付宝通知: bbk通过扫码向你付款100元"}
+	notice = ali.ParseNotify(notify)
+	c.Assert(notice.Amount, check.Equals, "100.00")
+	c.Assert(notice.Fee(), check.Equals, 10000)
+	c.Assert(notice.Payer, check.Equals, "bbk")
+
+	// not a payment, still reported but without amount
+	notify = &AndroidSysNotify{Source: AlipayPackage, Message: "蚂蚁森林: 你收取了10g能量"}
+	notice = ali.ParseNotify(notify)
+	c.Assert(notice, check.NotNil)
+	c.Assert(notice.Amount, check.Equals, "")
+	c.Assert(notice.Fee(), check.Equals, 0)
+}
+
+func (s *payappSuite) TestParseAlipayNotifyOutgoing(c *check.C) {
+	ali := newAlipay(nil)
+
+	for _, msg := range []string{
+		"你已成功付款0.01元",                // outgoing payment
+		"支付宝通知: 你已向bbk付款0.01元",       // outgoing payment
+		"付款成功: 你在便利店付款0.01元",         // outgoing payment
+		"退款通知: 你有一笔退款0.01元已到账",       // refund
+		"支付宝通知: 你向bbk的退款0.01元已退回",    // refund out
+		"转账通知: 你已成功转账给bbk0.01元",      // transfer out
+		"转账通知: 对方已成功收款0.01元",         // transfer out, confirmed by the payee
+		"余额宝: 转出0.01元到余额，已成功收款0.01元", // transfer out
+	} {
+		notice := ali.ParseNotify(&AndroidSysNotify{Source: AlipayPackage, Message: msg})
+		c.Assert(notice, check.NotNil, check.Commentf(msg))
+		c.Assert(notice.Amount, check.Equals, "", check.Commentf(msg))
+		c.Assert(notice.Fee(), check.Equals, 0, check.Commentf(msg))
+	}
+
+	// the incoming ones
+	for msg, fee := range map[string]int{
+		"你已成功收款0.01元": 1,
+		"成功收款12.5元。享免费提现等更多专属服务，点击查看": 1250,
+		"支付宝通知: bbk通过扫码向你付款100元":      10000,
+		"bbk已通过扫码向你付款 0.02 元":         2,
+	} {
+		notice := ali.ParseNotify(&AndroidSysNotify{Source: AlipayPackage, Message: msg})
+		c.Assert(notice.Fee(), check.Equals, fee, check.Commentf(msg))
+	}
+}
+
+func (s *payappSuite) TestParseAlipayBills(c *check.C) {
+	xmldata := `<hierarchy rotation="0">
+<node index="0" text="" class="android.widget.ListView" bounds="[0,0][720,1280]">
+  <node index="0" text="" class="android.widget.RelativeLayout" bounds="[0,100][720,250]">
+    <node index="0" text="111111-bbk-bbk" resource-id="com.alipay.mobile.bill.list:id/billName" bounds="[20,120][500,160]" />
+    <node index="1" text="+0.01" resource-id="com.alipay.mobile.bill.list:id/billAmount" bounds="[500,120][700,160]" />
+    <node index="2" text="今天" resource-id="com.alipay.mobile.bill.list:id/timeInfo1" bounds="[20,180][200,220]" />
+    <node index="3" text="11:42" resource-id="com.alipay.mobile.bill.list:id/timeInfo2" bounds="[200,180][400,220]" />
+  </node>
+  <node index="1" text="" class="android.widget.RelativeLayout" bounds="[0,250][720,400]">
+    <node index="0" text="222222" resource-id="com.alipay.mobile.bill.list:id/billName" bounds="[20,270][500,310]" />
+    <node index="1" text="+2.54" resource-id="com.alipay.mobile.bill.list:id/billAmount" bounds="[500,270][700,310]" />
+  </node>
+</node>
+</hierarchy>`
+
+	nodes, err := parseAndroidUINodes([]byte(xmldata))
+	c.Assert(err, check.IsNil)
+
+	bills := parseAlipayBills(nodes)
+	c.Assert(bills, check.HasLen, 2)
+	c.Assert(bills[0], check.DeepEquals, &PayOrder{Comment: "111111", Account: "bbk-bbk", Amount: "0.01", Time: "今天-11:42"})
+	c.Assert(bills[1], check.DeepEquals, &PayOrder{Comment: "222222", Amount: "2.54", Time: "-"})
+}
+
+func (s *payappSuite) TestPaymentAppCanceled(c *check.C) {
+	var (
+		sim         = NewSimulator()
+		dvc         = sim.AddDevice("sim-01")
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	cancel() // the op deadline exceeded
+
+	for _, name := range []string{PaymentAppAlipay, PaymentAppWxpay} {
+		app, err := NewPaymentApp(name, dvc)
+		c.Assert(err, check.IsNil)
+
+		startAt := time.Now()
+		c.Assert(app.IsForeground(ctx), check.Equals, false)
+		c.Assert(app.Start(ctx), check.ErrorMatches, ".*context canceled", check.Commentf(name))
+		_, err = app.SearchOrder(ctx, "111111")
+		c.Assert(err, check.ErrorMatches, ".*context canceled", check.Commentf(name))
+		_, err = app.ListBills(ctx)
+		c.Assert(err, check.ErrorMatches, ".*context canceled", check.Commentf(name))
+		c.Assert(time.Since(startAt) < time.Second, check.Equals, true, check.Commentf(name)) // gave up without waiting
+	}
+	c.Assert(dvc.Clicks(), check.HasLen, 0)
+
+	err := waitTopActivity(ctx, dvc, AlipayBillListActivity, 10, time.Second)
+	c.Assert(err, check.ErrorMatches, ".*context canceled")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -54,7 +55,7 @@ func main() {
 	for {
 		select {
 		case notify := <-notifych:
-			if notify.Source == "com.eg.android.AlipayGphone" {
+			if notify.Source == adbot.AlipayPackage {
 				fmt.Println(":::::", notify)
 				fullSearchCurrentDeviceOrders(dvc, id)
 			}
@@ -72,16 +73,22 @@ func fullSearchCurrentDeviceOrders(dvc adbot.AdbDeviceHandler, device string) {
 		return
 	}
 
+	app, err := dvc.PaymentApp(adbot.PaymentAppAlipay)
+	if err != nil {
+		log.Warnln("get alipay payment app error:", err)
+		return
+	}
+
 	fmt.Println("=====", oids)
 	for _, oid := range oids {
 		fmt.Println("***** confirming order", oid)
-		order, err := dvc.AlipaySearchOrder(oid)
+		order, err := app.SearchOrder(context.Background(), oid)
 		if err != nil {
-			log.Errorf("AlipaySearchOrder() %s error: %v", oid, err)
+			log.Errorf("SearchOrder() %s error: %v", oid, err)
 			continue
 		}
 
-		go func(order *adbot.AlipayOrder, oid string) {
+		go func(order *adbot.PayOrder, oid string) {
 			if err = sendCallback(order); err != nil {
 				log.Errorf("sendCallback() for order %s error: %v", oid, err)
 				return
@@ -151,7 +158,11 @@ func testFull() {
 		*/
 
 		// start alipay app
-		err = dvc.StartAliPay()
+		app, err := dvc.PaymentApp(adbot.PaymentAppAlipay)
+		if err != nil {
+			log.Fatalln(serial, "get alipay payment app error:", err)
+		}
+		err = app.Start(context.Background())
 		if err != nil {
 			log.Fatalln(serial, "start alipay app error:", err)
 		}
@@ -160,7 +171,7 @@ func testFull() {
 		// dvc.GotoAlipayTabProfile() // no need
 		// dvc.GotoAlipayListOrder() // no need
 		odid := "91a01eada32c"
-		od, err := dvc.AlipaySearchOrder(odid)
+		od, err := app.SearchOrder(context.Background(), odid)
 		if err != nil {
 			log.Errorln(serial, "search order id", odid, "error:", err)
 		}
@@ -294,7 +305,7 @@ func queryRemoteOrders(device, status string) ([]string, error) {
 	return ids, err
 }
 
-func sendCallback(order *adbot.AlipayOrder) error {
+func sendCallback(order *adbot.PayOrder) error {
 	var (
 		orderID = order.Comment
 		aliUser = order.Account
@@ -0,0 +1,347 @@
+package adbot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UISelector is a compiled ui node selector with css-like syntax:
+//
+//   selector   := compound (combinator compound)*
+//   combinator := ' ' (descendant) | '>' (child)
+//   compound   := [class | '*'] ('[' attr [op value] ']')*
+//   op         := '=' (equals) | '*=' (contains) | '^=' (prefix) | '$=' (suffix) | '~=' (regex)
+//
+// the class matches the full class name or the short name, eg: `TextView` matches `android.widget.TextView`
+// the attrs: class, resource-id(id), text, desc(content-desc), package, index, depth
+//            checkable, checked, clickable, enabled, focusable, focused, scrollable, long-clickable, selected
+// the boolean attrs only support `=` with true/false, and `[clickable]` is short for `[clickable=true]`
+//
+// eg:
+//   ListView > TextView[resource-id="com.alipay.mobile.bill.list:id/billAmount"][text~="^\+[0-9.]+$"]
+//   FrameLayout[package="com.android.systemui"] Button[desc*="清除"][clickable]
+type UISelector struct {
+	raw   string
+	steps []*uiSelectorStep
+}
+
+type uiSelectorStep struct {
+	combinator byte // relation to the previous step: ' ' descendant, '>' child, 0 for the first step
+	class      string
+	conds      []*uiSelectorCond
+}
+
+type uiSelectorCond struct {
+	attr  string
+	op    string
+	value string
+	rx    *regexp.Regexp // compiled value for op `~=`
+}
+
+var (
+	uiSelectorStringAttrs = map[string]func(n *AndroidUINode) string{
+		"class":        func(n *AndroidUINode) string { return n.Class },
+		"resource-id":  func(n *AndroidUINode) string { return n.ResourceID },
+		"id":           func(n *AndroidUINode) string { return n.ResourceID },
+		"text":         func(n *AndroidUINode) string { return n.Text },
+		"desc":         func(n *AndroidUINode) string { return n.ContentDesc },
+		"content-desc": func(n *AndroidUINode) string { return n.ContentDesc },
+		"package":      func(n *AndroidUINode) string { return n.Package },
+		"index":        func(n *AndroidUINode) string { return n.Index },
+		"depth":        func(n *AndroidUINode) string { return strconv.Itoa(n.Depth) },
+	}
+
+	uiSelectorBoolAttrs = map[string]func(n *AndroidUINode) bool{
+		"checkable":      func(n *AndroidUINode) bool { return n.Checkable },
+		"checked":        func(n *AndroidUINode) bool { return n.Checked },
+		"clickable":      func(n *AndroidUINode) bool { return n.Clickable },
+		"enabled":        func(n *AndroidUINode) bool { return n.Enabled },
+		"focusable":      func(n *AndroidUINode) bool { return n.Focusable },
+		"focused":        func(n *AndroidUINode) bool { return n.Focused },
+		"scrollable":     func(n *AndroidUINode) bool { return n.Scrollable },
+		"long-clickable": func(n *AndroidUINode) bool { return n.LongClickable },
+		"selected":       func(n *AndroidUINode) bool { return n.Selected },
+	}
+)
+
+// ParseUISelector compile the given selector text
+func ParseUISelector(text string) (*UISelector, error) {
+	p := &uiSelectorParser{text: text}
+	steps, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid ui selector %q: %v", text, err)
+	}
+	return &UISelector{raw: text, steps: steps}, nil
+}
+
+// String is exported
+func (sel *UISelector) String() string {
+	return sel.raw
+}
+
+// Match check if the given ui node matches the selector
+func (sel *UISelector) Match(node *AndroidUINode) bool {
+	return sel.matchAt(node, len(sel.steps)-1)
+}
+
+// Find return all of the matched ui nodes with the original order
+func (sel *UISelector) Find(nodes []*AndroidUINode) []*AndroidUINode {
+	ret := []*AndroidUINode{}
+	for _, node := range nodes {
+		if sel.Match(node) {
+			ret = append(ret, node)
+		}
+	}
+	return ret
+}
+
+// match the node against the steps[:idx+1] from right to left
+func (sel *UISelector) matchAt(node *AndroidUINode, idx int) bool {
+	step := sel.steps[idx]
+	if !step.match(node) {
+		return false
+	}
+	if idx == 0 {
+		return true
+	}
+
+	switch step.combinator {
+	case '>':
+		return node.parent != nil && sel.matchAt(node.parent, idx-1)
+	default: // descendant
+		for p := node.parent; p != nil; p = p.parent {
+			if sel.matchAt(p, idx-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (step *uiSelectorStep) match(node *AndroidUINode) bool {
+	if step.class != "" && step.class != "*" {
+		if node.Class != step.class && !strings.HasSuffix(node.Class, "."+step.class) {
+			return false
+		}
+	}
+	for _, cond := range step.conds {
+		if !cond.match(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond *uiSelectorCond) match(node *AndroidUINode) bool {
+	if getter, ok := uiSelectorBoolAttrs[cond.attr]; ok {
+		return strconv.FormatBool(getter(node)) == cond.value
+	}
+
+	val := uiSelectorStringAttrs[cond.attr](node)
+	switch cond.op {
+	case "=":
+		return val == cond.value
+	case "*=":
+		return strings.Contains(val, cond.value)
+	case "^=":
+		return strings.HasPrefix(val, cond.value)
+	case "$=":
+		return strings.HasSuffix(val, cond.value)
+	case "~=":
+		return cond.rx.MatchString(val)
+	}
+	return false
+}
+
+//
+// selector parser
+//
+
+type uiSelectorParser struct {
+	text string
+	pos  int
+}
+
+func (p *uiSelectorParser) parse() ([]*uiSelectorStep, error) {
+	var steps []*uiSelectorStep
+
+	p.skipSpaces()
+	if p.eof() {
+		return nil, errors.New("empty selector")
+	}
+
+	var combinator byte
+	for {
+		step, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		step.combinator = combinator
+		steps = append(steps, step)
+
+		hasSpace := p.skipSpaces()
+		if p.eof() {
+			break
+		}
+
+		combinator = ' '
+		if p.peek() == '>' {
+			combinator = '>'
+			p.pos++
+			p.skipSpaces()
+		} else if !hasSpace {
+			return nil, fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+		}
+		if p.eof() {
+			return nil, errors.New("missing selector after combinator")
+		}
+	}
+
+	return steps, nil
+}
+
+func (p *uiSelectorParser) parseCompound() (*uiSelectorStep, error) {
+	step := &uiSelectorStep{
+		class: p.readWhile(func(c byte) bool {
+			return c == '*' || c == '.' || c == '_' || c == '$' || isAlnum(c)
+		}),
+	}
+
+	for !p.eof() && p.peek() == '[' {
+		p.pos++
+		cond, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		step.conds = append(step.conds, cond)
+	}
+
+	if step.class == "" && len(step.conds) == 0 {
+		if p.eof() {
+			return nil, errors.New("unexpected end of selector")
+		}
+		return nil, fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+	}
+	return step, nil
+}
+
+func (p *uiSelectorParser) parseCond() (*uiSelectorCond, error) {
+	p.skipSpaces()
+	attr := p.readWhile(func(c byte) bool { return c == '-' || isAlnum(c) })
+	if attr == "" {
+		return nil, fmt.Errorf("attribute name required at %d", p.pos)
+	}
+
+	_, isBool := uiSelectorBoolAttrs[attr]
+	if _, ok := uiSelectorStringAttrs[attr]; !ok && !isBool {
+		return nil, fmt.Errorf("unsupported attribute %q", attr)
+	}
+
+	p.skipSpaces()
+	if p.eof() {
+		return nil, errors.New("unclosed attribute condition")
+	}
+
+	// short for [attr=true]
+	if p.peek() == ']' {
+		p.pos++
+		if !isBool {
+			return nil, fmt.Errorf("attribute %q requires a value", attr)
+		}
+		return &uiSelectorCond{attr: attr, op: "=", value: "true"}, nil
+	}
+
+	var op string
+	for _, candidate := range []string{"*=", "^=", "$=", "~=", "="} {
+		if strings.HasPrefix(p.text[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("unexpected %q at %d, operator required", p.peek(), p.pos)
+	}
+
+	p.skipSpaces()
+	value, err := p.readValue()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.eof() || p.peek() != ']' {
+		return nil, errors.New("unclosed attribute condition")
+	}
+	p.pos++
+
+	cond := &uiSelectorCond{attr: attr, op: op, value: value}
+	if isBool {
+		if op != "=" || (value != "true" && value != "false") {
+			return nil, fmt.Errorf("boolean attribute %q only supports =true or =false", attr)
+		}
+	}
+	if op == "~=" {
+		if cond.rx, err = regexp.Compile(value); err != nil {
+			return nil, err
+		}
+	}
+	return cond, nil
+}
+
+// read quoted or bare value
+func (p *uiSelectorParser) readValue() (string, error) {
+	if p.eof() {
+		return "", errors.New("attribute value required")
+	}
+
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return p.readWhile(func(c byte) bool { return c != ']' && c != ' ' && c != '\t' }), nil
+	}
+
+	p.pos++
+	var buf []byte
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '\\' && !p.eof() && (p.peek() == quote || p.peek() == '\\'):
+			buf = append(buf, p.peek())
+			p.pos++
+		case c == quote:
+			return string(buf), nil
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", errors.New("unclosed quoted value")
+}
+
+func (p *uiSelectorParser) readWhile(fn func(c byte) bool) string {
+	start := p.pos
+	for !p.eof() && fn(p.peek()) {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+func (p *uiSelectorParser) skipSpaces() bool {
+	n := len(p.readWhile(func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }))
+	return n > 0
+}
+
+func (p *uiSelectorParser) peek() byte {
+	return p.text[p.pos]
+}
+
+func (p *uiSelectorParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
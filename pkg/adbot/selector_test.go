@@ -0,0 +1,87 @@
+package adbot
+
+import (
+	"io/ioutil"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(selectorSuite))
+
+type selectorSuite struct {
+	nodes []*AndroidUINode
+}
+
+func (s *selectorSuite) SetUpSuite(c *check.C) {
+	bs, err := ioutil.ReadFile("run/ui/window_dump.xml")
+	c.Assert(err, check.IsNil)
+	s.nodes, err = parseAndroidUINodes(bs)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *selectorSuite) TestParseUIHierarchy(c *check.C) {
+	c.Assert(len(s.nodes) > 0, check.Equals, true)
+
+	root := s.nodes[0]
+	c.Assert(root.Parent(), check.IsNil)
+	c.Assert(root.Class, check.Equals, "android.widget.FrameLayout")
+	c.Assert(root.Path, check.Equals, "0")
+	c.Assert(root.Depth, check.Equals, 0)
+	c.Assert(root.Enabled, check.Equals, true)
+
+	child := s.nodes[1]
+	c.Assert(child.Parent(), check.Equals, root)
+	c.Assert(child.ResourceID, check.Equals, "com.android.systemui:id/notification_panel")
+	c.Assert(child.Path, check.Equals, "0/0")
+	c.Assert(child.Depth, check.Equals, 1)
+	c.Assert(root.Children()[0], check.Equals, child)
+
+	_, err := parseAndroidUINodes([]byte("<hierarchy><node"))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *selectorSuite) TestSelectorFind(c *check.C) {
+	cases := []struct {
+		selector string
+		texts    []string
+	}{
+		{`TextView[text="网络助手"]`, []string{"网络助手"}},
+		{`android.widget.TextView[resource-id="android:id/title"][text*="USB调试"]`, []string{"已连接到USB调试"}},
+		{`TextView[text~="^触摸.*数据$"]`, []string{"触摸开始更新数据"}},
+		{`TextView[text^='建议'] `, []string{"建议开启查找手机"}},
+		{`ScrollView FrameLayout[clickable] TextView[id$=":id/title"][text$="助手"]`, []string{"网络助手"}},
+		{`LinearLayout[id="android:id/line1"] > TextView[id="android:id/notification_time"][text="19/6/24"]`, []string{"19/6/24"}},
+		{`FrameLayout[clickable=false] > TextView[text="网络助手"]`, []string{}},
+		{`ScrollView > TextView`, []string{}},
+	}
+
+	for _, cas := range cases {
+		sel, err := ParseUISelector(cas.selector)
+		c.Assert(err, check.IsNil, check.Commentf(cas.selector))
+
+		texts := []string{}
+		for _, node := range sel.Find(s.nodes) {
+			texts = append(texts, node.Text)
+		}
+		c.Assert(texts, check.DeepEquals, cas.texts, check.Commentf(cas.selector))
+	}
+}
+
+func (s *selectorSuite) TestSelectorInvalid(c *check.C) {
+	for _, selector := range []string{
+		``,
+		`   `,
+		`TextView[`,
+		`TextView[text]`,
+		`TextView[nope="x"]`,
+		`TextView[clickable=yes]`,
+		`TextView[clickable*=true]`,
+		`TextView[text~="("]`,
+		`TextView[text="unclosed]`,
+		`TextView >`,
+		`TextView,Button`,
+	} {
+		_, err := ParseUISelector(selector)
+		c.Assert(err, check.NotNil, check.Commentf(selector))
+	}
+}
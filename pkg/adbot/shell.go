@@ -0,0 +1,115 @@
+package adbot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the goadb only provides one-shot `RunCommand` which reads until the stream EOF,
+// here we talk to the adb host with the raw smart socket protocol to obtain a
+// long-lived shell stream, eg: `logcat` in follow mode
+// See: https://android.googlesource.com/platform/system/core/+/master/adb/SERVICES.TXT
+
+var (
+	adbServerAddr        = "127.0.0.1:5037"
+	adbServerDialTimeout = time.Second * 5
+)
+
+// openShellStream open a long-lived `adb -s {serial} shell {cmd}` output stream
+// the caller should close the returned stream to terminate the remote command
+func openShellStream(serial, cmd string, args ...string) (io.ReadCloser, error) {
+	return openServiceStream(serial, "shell", cmd, args...)
+}
+
+// openExecStream open a raw `adb -s {serial} exec-out {cmd}` output stream
+// note: unlike the shell service, the exec service doesn't allocate pty, so
+// the binary output won't be mangled by the LF -> CRLF translation (android 5.0+)
+func openExecStream(serial, cmd string, args ...string) (io.ReadCloser, error) {
+	return openServiceStream(serial, "exec", cmd, args...)
+}
+
+func openServiceStream(serial, service, cmd string, args ...string) (io.ReadCloser, error) {
+	cmdline, err := shellCommandLine(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", adbServerAddr, adbServerDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := adbRequest(conn, "host:transport:"+serial); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("switch to device %s transport: %v", serial, err)
+	}
+
+	if err := adbRequest(conn, service+":"+cmdline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open %s stream on device %s: %v", service, serial, err)
+	}
+
+	return conn, nil
+}
+
+// send one adb request and read the status
+func adbRequest(conn net.Conn, req string) error {
+	conn.SetDeadline(time.Now().Add(adbServerDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := fmt.Fprintf(conn, "%04x%s", len(req), req); err != nil {
+		return err
+	}
+
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return err
+	}
+
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		return readAdbFailure(conn)
+	}
+	return fmt.Errorf("unexpected adb status: %q", status)
+}
+
+func readAdbFailure(conn net.Conn) error {
+	lenbs := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lenbs); err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(string(lenbs), 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid adb failure message length: %q", lenbs)
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(conn, int64(n)))
+	return errors.New(string(msg))
+}
+
+// similar as goadb prepareCommandLine()
+func shellCommandLine(cmd string, args ...string) (string, error) {
+	if strings.TrimSpace(cmd) == "" {
+		return "", errors.New("command cannot be empty")
+	}
+
+	fields := []string{cmd}
+	for idx, arg := range args {
+		if strings.ContainsRune(arg, '"') {
+			return "", fmt.Errorf("arg at index %d contains an invalid double quote: %s", idx, arg)
+		}
+		if strings.ContainsAny(arg, " \t\r\n") {
+			arg = `"` + arg + `"`
+		}
+		fields = append(fields, arg)
+	}
+
+	return strings.Join(fields, " "), nil
+}
@@ -0,0 +1,1399 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/qrcode"
+)
+
+//
+//  AdbHandler Simulator Implemention
+//
+//  an in-memory scriptable adb host with virtual devices, so the code paths touching
+//  devices could be exercised without any real phone attached on 127.0.0.1:5037
+//
+
+// nolint
+var (
+	SimAlipayPackage       = AlipayPackage
+	SimAlipayLoginActivity = AlipayLoginActivity
+	SimLauncherActivity    = "com.android.launcher3/.Launcher"
+)
+
+var (
+	simMaxSysLogs = 10240
+
+	// the launch activity & the payment notify of the payment apps on virtual device
+	simPayLaunchActivities = map[string]string{
+		AlipayPackage: AlipayLoginActivity,
+		WxpayPackage:  WxpayLauncherActivity,
+	}
+	simPayNotifyFormats = map[string]string{
+		AlipayPackage: "你已成功收款%s元",
+		WxpayPackage:  "微信支付: 微信支付收款%s元",
+	}
+)
+
+var (
+	errSimDeviceNotFound = errors.New("DeviceNotFound: simulated device not found")
+	errSimDeviceOffline  = errors.New("simulated device offline")
+)
+
+// NewSimulator new an in-memory AdbHandler with no devices attached
+func NewSimulator() *Simulator {
+	return &Simulator{
+		devices: make(map[string]*SimDevice),
+		subs:    make(map[chan *AdbEvent]struct{}),
+	}
+}
+
+// Simulator is an AdbHandler implemention with virtual devices
+type Simulator struct {
+	sync.RWMutex                             // protect following
+	devices      map[string]*SimDevice       // virtual devices
+	subs         map[chan *AdbEvent]struct{} // adb events subscribers
+}
+
+// AddDevice attach a new online virtual device with default sysinfo
+// the existing device will be returned if the serial already attached
+func (s *Simulator) AddDevice(serial string) *SimDevice {
+	s.Lock()
+	dvc, ok := s.devices[serial]
+	if !ok {
+		dvc = newSimDevice(s, serial)
+		s.devices[serial] = dvc
+	}
+	s.Unlock()
+
+	if !ok {
+		s.emit(serial, AdbEventDeviceAlive, "offline->online")
+	}
+	return dvc
+}
+
+// RemoveDevice detach the virtual device
+func (s *Simulator) RemoveDevice(serial string) {
+	s.Lock()
+	_, ok := s.devices[serial]
+	delete(s.devices, serial)
+	s.Unlock()
+
+	if ok {
+		s.emit(serial, AdbEventDeviceDie, "online->disconnected")
+	}
+}
+
+// Device return the attached virtual device
+func (s *Simulator) Device(serial string) (*SimDevice, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	dvc, ok := s.devices[serial]
+	return dvc, ok
+}
+
+// ListAdbDevices implement AdbHandler
+func (s *Simulator) ListAdbDevices() ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	ret := make([]string, 0, len(s.devices))
+	for serial := range s.devices {
+		ret = append(ret, serial)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// WatchAdbEvents implement AdbHandler
+func (s *Simulator) WatchAdbEvents() (<-chan *AdbEvent, chan struct{}) {
+	var (
+		ch     = make(chan *AdbEvent, 1024)
+		stopch = make(chan struct{})
+	)
+
+	s.Lock()
+	s.subs[ch] = struct{}{}
+	s.Unlock()
+
+	go func() {
+		<-stopch
+		s.Lock()
+		delete(s.subs, ch)
+		close(ch)
+		s.Unlock()
+	}()
+
+	return ch, stopch
+}
+
+// NewDevice implement AdbHandler
+func (s *Simulator) NewDevice(serial string) (AdbDeviceHandler, error) {
+	dvc, ok := s.Device(serial)
+	if !ok {
+		return nil, errSimDeviceNotFound
+	}
+	return dvc, nil
+}
+
+func (s *Simulator) emit(serial, typ, msg string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	ev := &AdbEvent{Serial: serial, Type: typ, Message: msg, Time: time.Now()}
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+//
+//  AdbDeviceHandler Simulator Implemention
+//
+
+// SimDevice is an AdbDeviceHandler implemention of virtual device
+type SimDevice struct {
+	sim    *Simulator
+	serial string
+
+	sync.Mutex                           // protect following
+	online      bool                     // online or offline
+	awake       bool                     // screen awake or not
+	sysinfo     AndroidSysInfo           // getprop
+	battery     AndroidBatteryInfo       // dumpsys battery
+	activity    string                   // current top activity
+	uinodes     []*AndroidUINode         // current ui dump, nil to use the built-in per-activity ui
+	notifies    []*AndroidSysNotify      // current system notifies
+	notifySeq   int                      // system notify id sequence
+	payOrders   map[string][]*PayOrder   // injected paid orders by payment app name
+	payQrCodes  []string                 // history of generated payment qrcode texts
+	apps        paymentAppSet            // payment app drivers
+	q           *OpQueue                 // prioritized device ops queue
+	logs        []string                 // buffered system logs, dump by `logcat -d` and clear by `logcat -c`
+	logSubs     map[chan string]struct{} // system logs followers
+	screen      [2]int                   // screen width,height
+	clicks      [][2]int                 // history of clicked X,Y
+	inputs      []string                 // history of `input text`
+	files       map[string]*simFile      // pushed files by absolute path
+	packages    map[string]*simPackage   // installed packages by name
+	cmdHandlers map[string]SimCmdHandler // extra shell commands
+}
+
+type simFile struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+type simPackage struct {
+	AndroidPackage
+	thirdParty bool
+}
+
+// SimAPK build a fake apk content which could be installed onto the virtual device
+func SimAPK(name, versionName string, versionCode int) []byte {
+	return []byte(fmt.Sprintf("SIMAPK\n%s\n%s\n%d\n", name, versionName, versionCode))
+}
+
+// SimCmdHandler is a scripted handler for `adb shell` command on virtual device
+type SimCmdHandler func(dvc *SimDevice, args []string) (string, error)
+
+func newSimDevice(sim *Simulator, serial string) *SimDevice {
+	now := time.Now()
+	return &SimDevice{
+		sim:    sim,
+		serial: serial,
+		online: true,
+		awake:  true,
+		sysinfo: AndroidSysInfo{
+			SerialNo:           serial,
+			DeviceName:         "simulator " + serial,
+			Manufacturer:       "Simulator",
+			ProductBrand:       "Simulator",
+			ProductModel:       "Virtual Phone",
+			ProductName:        "simulator",
+			ProductLocale:      "zh-CN",
+			ReleaseVersion:     "6.0.1",
+			SDKVersion:         "23",
+			TimeZone:           "Asia/Shanghai",
+			GsmOperatorAlpha:   "中国移动",
+			GsmOperatorCountry: "cn",
+			GsmSimState:        "READY",
+			BootTime:           strconv.FormatInt(now.Unix(), 10),
+			BootTimeAt:         time.Unix(now.Unix(), 0),
+		},
+		battery: AndroidBatteryInfo{
+			ACPowered:       "false",
+			USBPowered:      "true",
+			WireLessPowered: "false",
+			Status:          "2",
+			Level:           100,
+			Scale:           100,
+		},
+		activity:  SimLauncherActivity,
+		payOrders: make(map[string][]*PayOrder),
+		logSubs:   make(map[chan string]struct{}),
+		screen:    [2]int{720, 1280},
+		files:     make(map[string]*simFile),
+		packages: map[string]*simPackage{
+			SimAlipayPackage: {
+				AndroidPackage: AndroidPackage{
+					Name:             SimAlipayPackage,
+					CodePath:         "/data/app/" + SimAlipayPackage + "-1",
+					VersionName:      "10.1.60.8888",
+					VersionCode:      151,
+					FirstInstallTime: now.Format("2006-01-02 15:04:05"),
+					LastUpdateTime:   now.Format("2006-01-02 15:04:05"),
+				},
+				thirdParty: true,
+			},
+			"com.android.launcher3": {
+				AndroidPackage: AndroidPackage{
+					Name:        "com.android.launcher3",
+					CodePath:    "/system/priv-app/Launcher3",
+					VersionName: "6.0.1",
+					VersionCode: 23,
+				},
+			},
+		},
+		cmdHandlers: make(map[string]SimCmdHandler),
+		q:           NewOpQueue(),
+	}
+}
+
+//
+// scripting methods
+//
+
+// SetOnline mark the virtual device online or offline and emit the adb event
+func (dvc *SimDevice) SetOnline(online bool) {
+	dvc.Lock()
+	changed := dvc.online != online
+	dvc.online = online
+	dvc.Unlock()
+
+	if !changed {
+		return
+	}
+	if online {
+		dvc.sim.emit(dvc.serial, AdbEventDeviceAlive, "offline->online")
+	} else {
+		dvc.sim.emit(dvc.serial, AdbEventDeviceDie, "online->offline")
+	}
+}
+
+// SetAwake set the virtual device screen awake or asleep
+func (dvc *SimDevice) SetAwake(awake bool) {
+	dvc.Lock()
+	dvc.awake = awake
+	dvc.Unlock()
+}
+
+// SetSysInfo replace the virtual device sysinfo, the battery field is ignored
+func (dvc *SimDevice) SetSysInfo(info AndroidSysInfo) {
+	info.Battery = nil
+	dvc.Lock()
+	dvc.sysinfo = info
+	dvc.Unlock()
+}
+
+// SetBattery set the virtual device battery level and status
+func (dvc *SimDevice) SetBattery(level int, status string) {
+	dvc.Lock()
+	dvc.battery.Level = level
+	dvc.battery.Status = status
+	dvc.Unlock()
+}
+
+// SetTopActivity set the virtual device current top activity
+func (dvc *SimDevice) SetTopActivity(activity string) {
+	dvc.Lock()
+	dvc.activity = activity
+	dvc.Unlock()
+}
+
+// SetUINodes set the virtual device ui dump, nil to reset to the built-in ui
+func (dvc *SimDevice) SetUINodes(nodes []*AndroidUINode) {
+	dvc.Lock()
+	dvc.uinodes = nodes
+	dvc.Unlock()
+}
+
+// SetUIDump set the virtual device ui dump by uiautomator xml data
+func (dvc *SimDevice) SetUIDump(xmldata []byte) error {
+	nodes, err := parseAndroidUINodes(xmldata)
+	if err != nil {
+		return err
+	}
+	dvc.SetUINodes(nodes)
+	return nil
+}
+
+// HandleCmd register a scripted handler for given `adb shell` command
+func (dvc *SimDevice) HandleCmd(cmd string, handler SimCmdHandler) {
+	dvc.Lock()
+	dvc.cmdHandlers[cmd] = handler
+	dvc.Unlock()
+}
+
+// PushSysNotify post a new system notify on the virtual device
+func (dvc *SimDevice) PushSysNotify(source, message string) *AndroidSysNotify {
+	dvc.Lock()
+	dvc.notifySeq++
+	notify := &AndroidSysNotify{
+		ID:      strconv.Itoa(dvc.notifySeq),
+		Source:  source,
+		Message: message,
+	}
+	dvc.notifies = append(dvc.notifies, notify)
+	dvc.Unlock()
+
+	dvc.AppendSysLog("I", "NotificationService", fmt.Sprintf("pkg=%s id=%s tickerText=%s", source, notify.ID, message))
+	return notify
+}
+
+// AppendSysLog append one log to the virtual device system logs
+// with logcat `-v time` format, eg: 06-10 11:42:01.123 I/ActivityManager( 1234): message
+func (dvc *SimDevice) AppendSysLog(priority, tag, message string) {
+	line := fmt.Sprintf("%s %s/%s( 1024): %s", time.Now().Format("01-02 15:04:05.000"), priority, tag, message)
+
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	dvc.logs = append(dvc.logs, line)
+	if n := len(dvc.logs); n > simMaxSysLogs { // ring buffer as the device logcat buffer
+		dvc.logs = dvc.logs[n-simMaxSysLogs:]
+	}
+	for ch := range dvc.logSubs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// InjectPayOrder make the order searchable in the virtual device payment app bills
+// and post a payment system notify of the app
+func (dvc *SimDevice) InjectPayOrder(app string, order *PayOrder) error {
+	if order == nil || order.Comment == "" {
+		return fmt.Errorf("%s order comment required", app)
+	}
+
+	driver, err := NewPaymentApp(app, dvc)
+	if err != nil {
+		return err
+	}
+
+	o := *order
+	if o.Time == "" {
+		o.Time = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	dvc.Lock()
+	dvc.payOrders[app] = append(dvc.payOrders[app], &o)
+	dvc.Unlock()
+
+	format, ok := simPayNotifyFormats[driver.Package()]
+	if !ok {
+		format = "收款%s元"
+	}
+	dvc.PushSysNotify(driver.Package(), fmt.Sprintf(format, o.Amount))
+	return nil
+}
+
+// PayQrCodes return the history of the payment qrcode texts generated on the virtual device
+func (dvc *SimDevice) PayQrCodes() []string {
+	dvc.Lock()
+	defer dvc.Unlock()
+	return append([]string{}, dvc.payQrCodes...)
+}
+
+// Clicks return the history of clicked X,Y on the virtual device
+func (dvc *SimDevice) Clicks() [][2]int {
+	dvc.Lock()
+	defer dvc.Unlock()
+	return append([][2]int{}, dvc.clicks...)
+}
+
+// Inputs return the history of the input texts on the virtual device
+func (dvc *SimDevice) Inputs() []string {
+	dvc.Lock()
+	defer dvc.Unlock()
+	return append([]string{}, dvc.inputs...)
+}
+
+//
+// AdbDeviceHandler implemention
+//
+
+// Serial implement AdbDeviceHandler
+func (dvc *SimDevice) Serial() (string, error) {
+	if !dvc.Exists() {
+		return "", errSimDeviceNotFound
+	}
+	return dvc.serial, nil
+}
+
+// Exists implement AdbDeviceHandler
+func (dvc *SimDevice) Exists() bool {
+	curr, ok := dvc.sim.Device(dvc.serial)
+	return ok && curr == dvc
+}
+
+// Online implement AdbDeviceHandler
+func (dvc *SimDevice) Online() bool {
+	dvc.Lock()
+	defer dvc.Unlock()
+	return dvc.online
+}
+
+// Reboot implement AdbDeviceHandler
+func (dvc *SimDevice) Reboot() error {
+	if err := dvc.ensureOnline(); err != nil {
+		return err
+	}
+
+	dvc.Lock()
+	dvc.notifies = nil
+	dvc.logs = nil
+	dvc.activity = SimLauncherActivity
+	dvc.sysinfo.BootTime = strconv.FormatInt(time.Now().Unix(), 10)
+	dvc.sysinfo.BootTimeAt = time.Unix(time.Now().Unix(), 0)
+	dvc.Unlock()
+
+	dvc.SetOnline(false)
+	go func() {
+		time.Sleep(time.Second * 3)
+		dvc.SetOnline(true)
+	}()
+	return nil
+}
+
+// Run implement AdbDeviceHandler
+//
+// besides the commands used by AdbDevice, the pseudo command `sim` is supported
+// to script the virtual device through the normal device exec api, eg:
+//
+//	sim pay_order {app} {comment} {amount} [account]
+//	sim alipay_order|wxpay_order {comment} {amount} [account]
+//	sim notify {source} {message}
+//	sim battery {level} [status]
+//	sim awake|sleep|offline
+func (dvc *SimDevice) Run(cmd string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return dvc.RunContext(ctx, cmd, args...)
+}
+
+// RunContext implement AdbDeviceHandler
+func (dvc *SimDevice) RunContext(ctx context.Context, cmd string, args ...string) (string, error) {
+	type result struct {
+		out string
+		err error
+	}
+
+	resch := make(chan result, 1)
+	go func() {
+		out, err := dvc.run(cmd, args...)
+		resch <- result{out, err}
+	}()
+
+	select {
+	case res := <-resch:
+		return res.out, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("run %s: %v", cmd, ctx.Err())
+	}
+}
+
+func (dvc *SimDevice) run(cmd string, args ...string) (string, error) {
+	if cmd == "sim" {
+		return dvc.runSimCmd(args)
+	}
+
+	if err := dvc.ensureOnline(); err != nil {
+		return "", err
+	}
+
+	dvc.Lock()
+	handler, ok := dvc.cmdHandlers[cmd]
+	dvc.Unlock()
+	if ok {
+		return handler(dvc, args)
+	}
+
+	switch cmd {
+	case "getprop":
+		return dvc.getprop(), nil
+
+	case "dumpsys":
+		if len(args) == 0 {
+			return "", nil
+		}
+		switch args[0] {
+		case "battery":
+			return dvc.dumpsysBattery(), nil
+		case "window":
+			return fmt.Sprintf("    mScreenOnEarly=%v mScreenOnFully=%v\n", dvc.IsAwake(), dvc.IsAwake()), nil
+		case "activity":
+			activity, _ := dvc.CurrentTopActivity()
+			return fmt.Sprintf("TASK %s id=1\n  ACTIVITY %s 4a1b2c3 pid=1024\n", SimAlipayPackage, activity), nil
+		case "notification":
+			return dvc.dumpsysNotification(), nil
+		case "package":
+			return dvc.dumpsysPackage(args[1:]), nil
+		}
+		return "", nil
+
+	case "pm":
+		return dvc.runPm(args)
+
+	case "rm":
+		dvc.Lock()
+		for _, arg := range args {
+			delete(dvc.files, arg)
+		}
+		dvc.Unlock()
+		return "", nil
+
+	case "input":
+		return "", dvc.runInput(args)
+
+	case "am":
+		if len(args) >= 2 && args[0] == "start" {
+			dvc.SetTopActivity(args[len(args)-1])
+		}
+		return "", nil
+
+	case "logcat":
+		return dvc.runLogcat(args), nil
+
+	case "reboot":
+		return "", dvc.Reboot()
+
+	case "echo":
+		return strings.Join(args, " ") + "\n", nil
+	}
+
+	return "", fmt.Errorf("/system/bin/sh: %s: not found", cmd)
+}
+
+// SysInfo implement AdbDeviceHandler
+func (dvc *SimDevice) SysInfo() (*AndroidSysInfo, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return nil, err
+	}
+
+	dvc.Lock()
+	info := dvc.sysinfo
+	battery := dvc.battery
+	dvc.Unlock()
+
+	info.Battery = &battery
+	info.OpQueue = dvc.q.Stats()
+	return &info, nil
+}
+
+// BatteryInfo implement AdbDeviceHandler
+func (dvc *SimDevice) BatteryInfo() (*AndroidBatteryInfo, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return nil, err
+	}
+
+	dvc.Lock()
+	battery := dvc.battery
+	dvc.Unlock()
+	return &battery, nil
+}
+
+// IsAwake implement AdbDeviceHandler
+func (dvc *SimDevice) IsAwake() bool {
+	dvc.Lock()
+	defer dvc.Unlock()
+	return dvc.online && dvc.awake
+}
+
+// AwakenScreen implement AdbDeviceHandler
+func (dvc *SimDevice) AwakenScreen() error {
+	if err := dvc.ensureOnline(); err != nil {
+		return err
+	}
+	dvc.SetAwake(true)
+	return nil
+}
+
+// ScreenCap implement AdbDeviceHandler
+func (dvc *SimDevice) ScreenCap() ([]byte, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return nil, err
+	}
+
+	dvc.Lock()
+	w, h := dvc.screen[0], dvc.screen[1]
+	dvc.Unlock()
+
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff // blank white screen
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GotoHome implement AdbDeviceHandler
+func (dvc *SimDevice) GotoHome() error {
+	_, err := dvc.Run("input", "keyevent", "3")
+	return err
+}
+
+// GoBack implement AdbDeviceHandler
+func (dvc *SimDevice) GoBack() error {
+	_, err := dvc.Run("input", "keyevent", "4")
+	return err
+}
+
+// Click implement AdbDeviceHandler
+func (dvc *SimDevice) Click(x, y int) error {
+	_, err := dvc.Run("input", "tap", strconv.Itoa(x), strconv.Itoa(y))
+	return err
+}
+
+// Swipe implement AdbDeviceHandler
+func (dvc *SimDevice) Swipe(x1, y1, x2, y2 int) error {
+	_, err := dvc.Run("input", "swipe", strconv.Itoa(x1), strconv.Itoa(y1), strconv.Itoa(x2), strconv.Itoa(y2))
+	return err
+}
+
+// CurrentTopActivity implement AdbDeviceHandler
+func (dvc *SimDevice) CurrentTopActivity() (string, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return "", err
+	}
+
+	dvc.Lock()
+	defer dvc.Unlock()
+	return dvc.activity, nil
+}
+
+// DumpCurrentUI implement AdbDeviceHandler
+func (dvc *SimDevice) DumpCurrentUI() ([]*AndroidUINode, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return nil, err
+	}
+
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	if dvc.uinodes != nil {
+		return dvc.uinodes, nil
+	}
+
+	// the built-in ui: a full screen frame layout of current top activity
+	xmldata := fmt.Sprintf(`<hierarchy rotation="0"><node index="0" text="" resource-id="android:id/content" class="android.widget.FrameLayout" package="%s" content-desc="%s" enabled="true" bounds="[0,0][%d,%d]" /></hierarchy>`,
+		strings.SplitN(dvc.activity, "/", 2)[0], dvc.activity, dvc.screen[0], dvc.screen[1])
+	return parseAndroidUINodes([]byte(xmldata))
+}
+
+// FindUINodeAndClick implement AdbDeviceHandler
+func (dvc *SimDevice) FindUINodeAndClick(resourceid, resourcetext string) (int, int, error) {
+	nodes, err := dvc.DumpCurrentUI()
+	if err != nil {
+		return -1, -1, err
+	}
+
+	for _, node := range nodes {
+		if node.ResourceID != resourceid {
+			continue
+		}
+		if resourcetext != "" && !strings.Contains(node.Text, resourcetext) {
+			continue
+		}
+		x, y, err := node.MiddleXY()
+		if err != nil {
+			return -1, -1, fmt.Errorf("findUINodeAndClick() can't find the target UI node MiddleXY(): %v", err)
+		}
+		return x, y, dvc.Click(x, y)
+	}
+
+	return -1, -1, errUINodeNotFound
+}
+
+// FindUINodes implement AdbDeviceHandler
+func (dvc *SimDevice) FindUINodes(selector string) ([]*AndroidUINode, error) {
+	sel, err := ParseUISelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := dvc.DumpCurrentUI()
+	if err != nil {
+		return nil, err
+	}
+	return sel.Find(nodes), nil
+}
+
+// WaitForUINode implement AdbDeviceHandler
+func (dvc *SimDevice) WaitForUINode(selector string, timeout time.Duration) (*AndroidUINode, error) {
+	return waitForUINode(context.Background(), dvc.DumpCurrentUI, selector, timeout)
+}
+
+// ClickSelector implement AdbDeviceHandler
+func (dvc *SimDevice) ClickSelector(selector string) (int, int, error) {
+	nodes, err := dvc.FindUINodes(selector)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	x, y, err := firstUINodeXY(nodes)
+	if err != nil {
+		return -1, -1, err
+	}
+	return x, y, dvc.Click(x, y)
+}
+
+// TailSysLogs implement AdbDeviceHandler
+func (dvc *SimDevice) TailSysLogs(filter *SysLogFilter) (<-chan string, chan struct{}) {
+	var (
+		ch     = make(chan string, 10240)
+		sub    = make(chan string, 10240)
+		stopch = make(chan struct{})
+	)
+
+	dvc.Lock()
+	dvc.logSubs[sub] = struct{}{}
+	dvc.Unlock()
+
+	go func() {
+		defer func() {
+			dvc.Lock()
+			delete(dvc.logSubs, sub)
+			dvc.Unlock()
+			close(ch)
+		}()
+
+		for {
+			select {
+			case line := <-sub:
+				if !filter.Match(line) {
+					continue
+				}
+				select {
+				case ch <- line:
+				default:
+				}
+			case <-stopch:
+				return
+			}
+		}
+	}()
+
+	return ch, stopch
+}
+
+// WatchSysEvents implement AdbDeviceHandler
+func (dvc *SimDevice) WatchSysEvents(keywords []string) (<-chan string, chan struct{}) {
+	return watchSysEvents(dvc, keywords)
+}
+
+// ListSysNotifies implement AdbDeviceHandler
+func (dvc *SimDevice) ListSysNotifies() []*AndroidSysNotify {
+	if !dvc.Online() {
+		return nil
+	}
+
+	dvc.Lock()
+	defer dvc.Unlock()
+	return append([]*AndroidSysNotify{}, dvc.notifies...)
+}
+
+// ClearSysNotifies implement AdbDeviceHandler
+func (dvc *SimDevice) ClearSysNotifies() error {
+	if err := dvc.ensureOnline(); err != nil {
+		return err
+	}
+
+	dvc.Lock()
+	dvc.notifies = nil
+	dvc.Unlock()
+	return nil
+}
+
+// WatchSysNotifies implement AdbDeviceHandler
+func (dvc *SimDevice) WatchSysNotifies() (<-chan *AndroidSysNotify, chan struct{}) {
+	var (
+		ch     = make(chan *AndroidSysNotify, 10240)
+		stopch = make(chan struct{})
+	)
+
+	var seen = make(map[string]bool)
+	for _, notify := range dvc.ListSysNotifies() {
+		seen[notify.ID] = true // skip the pre-existing notifies
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Millisecond * 200)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				for _, notify := range dvc.ListSysNotifies() {
+					if seen[notify.ID] {
+						continue
+					}
+					seen[notify.ID] = true
+					select {
+					case ch <- notify:
+					default:
+					}
+				}
+			case <-stopch:
+				close(ch)
+				return
+			}
+		}
+	}()
+
+	return ch, stopch
+}
+
+// DoOp implement AdbDeviceHandler
+func (dvc *SimDevice) DoOp(ctx context.Context, prio OpPriority, name string, fn OpFunc) error {
+	return dvc.q.Do(ctx, prio, name, fn)
+}
+
+// CancelOp implement AdbDeviceHandler
+func (dvc *SimDevice) CancelOp(id string) error {
+	return dvc.q.Cancel(id)
+}
+
+// OpQueueStats implement AdbDeviceHandler
+func (dvc *SimDevice) OpQueueStats() *OpQueueStats {
+	return dvc.q.Stats()
+}
+
+// PaymentApp implement AdbDeviceHandler
+//
+// the registered driver is wrapped, the orders & bills come from the injected orders
+func (dvc *SimDevice) PaymentApp(name string) (PaymentApp, error) {
+	return dvc.apps.get(name, func() (PaymentApp, error) {
+		driver, err := NewPaymentApp(name, dvc)
+		if err != nil {
+			return nil, err
+		}
+		app := &simPaymentApp{PaymentApp: driver, dvc: dvc}
+		if _, ok := driver.(PaymentQrCoder); ok {
+			return &simPaymentQrCoder{app}, nil
+		}
+		return app, nil
+	})
+}
+
+// StatFile implement AdbDeviceHandler
+func (dvc *SimDevice) StatFile(p string) (*AndroidFile, error) {
+	if err := dvc.ensureOnline(); err != nil {
+		return nil, err
+	}
+
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	if p == "/" || p == apkTempDir {
+		return &AndroidFile{Path: p, Mode: os.ModeDir | 0771}, nil
+	}
+	f, ok := dvc.files[p]
+	if !ok {
+		return nil, fmt.Errorf("device file %s not found", p)
+	}
+	return &AndroidFile{Path: p, Mode: f.mode, Size: int64(len(f.data)), ModTime: f.modTime}, nil
+}
+
+// PushFile implement AdbDeviceHandler
+func (dvc *SimDevice) PushFile(src io.Reader, dst string, perm os.FileMode) error {
+	if err := dvc.ensureOnline(); err != nil {
+		return err
+	}
+	if !path.IsAbs(dst) {
+		return fmt.Errorf("device path %q must be absolute", dst)
+	}
+
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	dvc.Lock()
+	dvc.files[dst] = &simFile{data: data, mode: perm, modTime: time.Now()}
+	dvc.Unlock()
+	return nil
+}
+
+// PullFile implement AdbDeviceHandler
+func (dvc *SimDevice) PullFile(src string) (io.ReadCloser, error) {
+	info, err := dvc.StatFile(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("device path %s is a directory", src)
+	}
+
+	dvc.Lock()
+	data := append([]byte{}, dvc.files[src].data...)
+	dvc.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ListPackages implement AdbDeviceHandler
+func (dvc *SimDevice) ListPackages(thirdParty bool) ([]*AndroidPackage, error) {
+	return listPackages(dvc, thirdParty)
+}
+
+// ScreenCapContext implement AdbDeviceHandler
+func (dvc *SimDevice) ScreenCapContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("screencap: %v", err)
+	}
+	return dvc.ScreenCap()
+}
+
+// CurrentTopActivityContext implement AdbDeviceHandler
+func (dvc *SimDevice) CurrentTopActivityContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("dumpsys activity: %v", err)
+	}
+	return dvc.CurrentTopActivity()
+}
+
+// DumpCurrentUIContext implement AdbDeviceHandler
+func (dvc *SimDevice) DumpCurrentUIContext(ctx context.Context) ([]*AndroidUINode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("uiautomator dump: %v", err)
+	}
+	return dvc.DumpCurrentUI()
+}
+
+// PackageInfo implement AdbDeviceHandler
+func (dvc *SimDevice) PackageInfo(name string) (*AndroidPackage, error) {
+	return packageInfo(dvc, name)
+}
+
+// InstallPackage implement AdbDeviceHandler
+// note: only the content built by SimAPK() could be installed
+func (dvc *SimDevice) InstallPackage(apk io.Reader) error {
+	return installPackage(context.Background(), dvc, apk)
+}
+
+// InstallPackageContext implement AdbDeviceHandler
+func (dvc *SimDevice) InstallPackageContext(ctx context.Context, apk io.Reader) error {
+	return installPackage(ctx, dvc, apk)
+}
+
+// UninstallPackage implement AdbDeviceHandler
+func (dvc *SimDevice) UninstallPackage(name string) error {
+	return uninstallPackage(dvc, name)
+}
+
+//
+// internal
+//
+
+func (dvc *SimDevice) ensureOnline() error {
+	if !dvc.Exists() {
+		return errSimDeviceNotFound
+	}
+	if !dvc.Online() {
+		return errSimDeviceOffline
+	}
+	return nil
+}
+
+func (dvc *SimDevice) getprop() string {
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	info := dvc.sysinfo
+	props := [][2]string{
+		{"ro.serialno", info.SerialNo},
+		{"persist.sys.device_name", info.DeviceName},
+		{"ro.product.manufacturer", info.Manufacturer},
+		{"ro.product.brand", info.ProductBrand},
+		{"ro.product.model", info.ProductModel},
+		{"ro.product.name", info.ProductName},
+		{"ro.product.locale", info.ProductLocale},
+		{"ro.build.version.release", info.ReleaseVersion},
+		{"ro.build.version.sdk", info.SDKVersion},
+		{"ro.build.date.utc", info.BuildDateUTC},
+		{"persist.sys.timezone", info.TimeZone},
+		{"gsm.operator.alpha", info.GsmOperatorAlpha},
+		{"gsm.operator.iso-country", info.GsmOperatorCountry},
+		{"gsm.serial", info.GsmSerial},
+		{"gsm.sim.state", info.GsmSimState},
+		{"gsm.nitz.time", info.GsmNitzTime},
+		{"ro.runtime.firstboot", info.BootTime},
+	}
+
+	var buf bytes.Buffer
+	for _, prop := range props {
+		fmt.Fprintf(&buf, "[%s]: [%s]\n", prop[0], prop[1])
+	}
+	return buf.String()
+}
+
+func (dvc *SimDevice) dumpsysBattery() string {
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	b := dvc.battery
+	return fmt.Sprintf("Current Battery Service state:\n  AC powered: %s\n  USB powered: %s\n  Wireless powered: %s\n  status: %s\n  level: %d\n  scale: %d\n",
+		b.ACPowered, b.USBPowered, b.WireLessPowered, b.Status, b.Level, b.Scale)
+}
+
+func (dvc *SimDevice) dumpsysNotification() string {
+	var buf bytes.Buffer
+	for _, notify := range dvc.ListSysNotifies() {
+		fmt.Fprintf(&buf, "  NotificationRecord(0x00000000: pkg=%s user=UserHandle{0} id=%s tag=null score=0)\n", notify.Source, notify.ID)
+		fmt.Fprintf(&buf, "    tickerText=%s\n", notify.Message)
+	}
+	return buf.String()
+}
+
+func (dvc *SimDevice) dumpsysPackage(args []string) string {
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	var names []string
+	if len(args) == 0 || args[0] == "packages" {
+		for name := range dvc.packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if _, ok := dvc.packages[args[0]]; ok {
+		names = []string{args[0]}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("Packages:\n")
+	for _, name := range names {
+		pkg := dvc.packages[name]
+		fmt.Fprintf(&buf, "  Package [%s] (%x):\n", pkg.Name, len(pkg.Name))
+		fmt.Fprintf(&buf, "    codePath=%s\n", pkg.CodePath)
+		fmt.Fprintf(&buf, "    versionCode=%d minSdk=16 targetSdk=23\n", pkg.VersionCode)
+		fmt.Fprintf(&buf, "    versionName=%s\n", pkg.VersionName)
+		fmt.Fprintf(&buf, "    firstInstallTime=%s\n", pkg.FirstInstallTime)
+		fmt.Fprintf(&buf, "    lastUpdateTime=%s\n", pkg.LastUpdateTime)
+	}
+	return buf.String()
+}
+
+// pm list packages [-3] | pm install [-r] {path} | pm uninstall {name}
+func (dvc *SimDevice) runPm(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("pm: missing arguments")
+	}
+
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	switch sub, args := args[0], args[1:]; sub {
+	case "list":
+		thirdParty := len(args) > 1 && args[1] == "-3"
+		var buf bytes.Buffer
+		for name, pkg := range dvc.packages {
+			if thirdParty && !pkg.thirdParty {
+				continue
+			}
+			fmt.Fprintf(&buf, "package:%s\n", name)
+		}
+		return buf.String(), nil
+
+	case "install":
+		if len(args) == 0 {
+			return "", errors.New("pm install: missing apk path")
+		}
+		f, ok := dvc.files[args[len(args)-1]]
+		if !ok {
+			return "Failure [INSTALL_FAILED_INVALID_URI]\n", nil
+		}
+		fields := strings.Split(strings.TrimSpace(string(f.data)), "\n")
+		if len(fields) != 4 || fields[0] != "SIMAPK" {
+			return "Failure [INSTALL_FAILED_INVALID_APK]\n", nil
+		}
+		code, _ := strconv.Atoi(fields[3])
+		now := time.Now().Format("2006-01-02 15:04:05")
+		pkg, ok := dvc.packages[fields[1]]
+		if !ok {
+			pkg = &simPackage{thirdParty: true}
+			pkg.Name = fields[1]
+			pkg.CodePath = "/data/app/" + fields[1] + "-1"
+			pkg.FirstInstallTime = now
+			dvc.packages[fields[1]] = pkg
+		} else if code < pkg.VersionCode {
+			return "Failure [INSTALL_FAILED_VERSION_DOWNGRADE]\n", nil
+		}
+		pkg.VersionName = fields[2]
+		pkg.VersionCode = code
+		pkg.LastUpdateTime = now
+		return "Success\n", nil
+
+	case "uninstall":
+		if len(args) == 0 {
+			return "", errors.New("pm uninstall: missing package name")
+		}
+		pkg, ok := dvc.packages[args[len(args)-1]]
+		if !ok || !pkg.thirdParty {
+			return "Failure [DELETE_FAILED_INTERNAL_ERROR]\n", nil
+		}
+		delete(dvc.packages, pkg.Name)
+		return "Success\n", nil
+
+	default:
+		return "", fmt.Errorf("pm: unknown command %s", sub)
+	}
+}
+
+func (dvc *SimDevice) runInput(args []string) error {
+	if len(args) == 0 {
+		return errors.New("input: missing arguments")
+	}
+
+	switch args[0] {
+	case "keyevent":
+		if len(args) < 2 {
+			return errors.New("input keyevent: missing key code")
+		}
+		switch args[1] {
+		case "3": // home
+			dvc.SetTopActivity(SimLauncherActivity)
+		case "4": // back
+			if activity, _ := dvc.CurrentTopActivity(); strings.HasPrefix(activity, SimAlipayPackage) && activity != SimAlipayLoginActivity {
+				dvc.SetTopActivity(SimAlipayLoginActivity)
+			} else {
+				dvc.SetTopActivity(SimLauncherActivity)
+			}
+		case "26": // power
+			dvc.Lock()
+			dvc.awake = !dvc.awake
+			dvc.Unlock()
+		case "224": // wakeup
+			dvc.SetAwake(true)
+		}
+
+	case "tap":
+		if len(args) < 3 {
+			return errors.New("input tap: missing X,Y")
+		}
+		x, _ := strconv.Atoi(args[1])
+		y, _ := strconv.Atoi(args[2])
+		dvc.Lock()
+		dvc.clicks = append(dvc.clicks, [2]int{x, y})
+		dvc.Unlock()
+
+	case "text":
+		if len(args) < 2 {
+			return errors.New("input text: missing text")
+		}
+		dvc.Lock()
+		dvc.inputs = append(dvc.inputs, strings.Replace(args[1], "%s", " ", -1))
+		dvc.Unlock()
+	}
+
+	return nil
+}
+
+func (dvc *SimDevice) runLogcat(args []string) string {
+	dvc.Lock()
+	defer dvc.Unlock()
+
+	if len(args) > 0 && args[0] == "-c" {
+		dvc.logs = nil
+		return ""
+	}
+	if len(dvc.logs) == 0 {
+		return ""
+	}
+	return strings.Join(dvc.logs, "\n") + "\n"
+}
+
+func (dvc *SimDevice) runSimCmd(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("sim: sub command required")
+	}
+
+	switch sub, args := args[0], args[1:]; sub {
+	case "alipay_order", "wxpay_order":
+		return dvc.runSimCmd(append([]string{"pay_order", strings.TrimSuffix(sub, "_order")}, args...))
+
+	case "pay_order":
+		if len(args) < 3 {
+			return "", errors.New("usage: sim pay_order {app} {comment} {amount} [account]")
+		}
+		order := &PayOrder{Comment: args[1], Amount: args[2]}
+		if len(args) > 3 {
+			order.Account = args[3]
+		}
+		return "", dvc.InjectPayOrder(args[0], order)
+
+	case "notify":
+		if len(args) < 2 {
+			return "", errors.New("usage: sim notify {source} {message}")
+		}
+		notify := dvc.PushSysNotify(args[0], strings.Join(args[1:], " "))
+		return notify.ID + "\n", nil
+
+	case "log":
+		if len(args) < 3 {
+			return "", errors.New("usage: sim log {priority} {tag} {message}")
+		}
+		dvc.AppendSysLog(strings.ToUpper(args[0]), args[1], strings.Join(args[2:], " "))
+
+	case "battery":
+		if len(args) < 1 {
+			return "", errors.New("usage: sim battery {level} [status]")
+		}
+		level, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid battery level: %v", err)
+		}
+		status := "2"
+		if len(args) > 1 {
+			status = args[1]
+		}
+		dvc.SetBattery(level, status)
+
+	case "awake":
+		dvc.SetAwake(true)
+
+	case "sleep":
+		dvc.SetAwake(false)
+
+	case "online":
+		dvc.SetOnline(true)
+
+	case "offline":
+		dvc.SetOnline(false)
+
+	default:
+		return "", fmt.Errorf("sim: unknown sub command %s", sub)
+	}
+
+	return "", nil
+}
+
+//
+// PaymentApp wrapper on virtual device
+//
+
+type simPaymentApp struct {
+	PaymentApp
+	dvc *SimDevice
+}
+
+// Start implement PaymentApp
+func (app *simPaymentApp) Start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s.Start() %v", app.Name(), err)
+	}
+	if err := app.dvc.ensureOnline(); err != nil {
+		return err
+	}
+	activity, ok := simPayLaunchActivities[app.Package()]
+	if !ok {
+		activity = app.Package() + "/.MainActivity"
+	}
+	app.dvc.SetTopActivity(activity)
+	return nil
+}
+
+// SearchOrder implement PaymentApp
+func (app *simPaymentApp) SearchOrder(ctx context.Context, orderID string) (*PayOrder, error) {
+	if orderID == "" {
+		return nil, fmt.Errorf("%s.SearchOrder() order id required", app.Name())
+	}
+
+	bills, err := app.ListBills(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bill := range bills {
+		if bill.Comment == orderID {
+			return bill, nil
+		}
+	}
+	return nil, errors.New("no such order")
+}
+
+// ListBills implement PaymentApp, the latest bill first
+func (app *simPaymentApp) ListBills(ctx context.Context) ([]*PayOrder, error) {
+	if err := app.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	app.dvc.Lock()
+	defer app.dvc.Unlock()
+
+	orders := app.dvc.payOrders[app.Name()]
+	ret := make([]*PayOrder, 0, len(orders))
+	for i := len(orders) - 1; i >= 0; i-- {
+		o := *orders[i]
+		ret = append(ret, &o)
+	}
+	return ret, nil
+}
+
+// ListDayBills implement PaymentDayBiller, the latest bill first
+func (app *simPaymentApp) ListDayBills(ctx context.Context, day time.Time) ([]*PayOrder, error) {
+	bills, err := app.ListBills(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return collectDayBills(ctx, day, func() ([]*PayOrder, error) { return bills, nil }, nil)
+}
+
+type simPaymentQrCoder struct {
+	*simPaymentApp
+}
+
+// GenQrCode implement PaymentQrCoder
+func (app *simPaymentQrCoder) GenQrCode(ctx context.Context, fee int, comment string) ([]byte, error) {
+	if fee <= 0 {
+		return nil, fmt.Errorf("%s.GenQrCode() fee must be positive", app.Name())
+	}
+	if comment == "" {
+		return nil, fmt.Errorf("%s.GenQrCode() order comment required", app.Name())
+	}
+	if err := app.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	qrtext := fmt.Sprintf("%s://%s?amount=%0.2f&comment=%s", app.Name(), app.dvc.serial, float64(fee)/float64(100), comment)
+	qrpng, err := qrcode.Encode(qrtext)
+	if err != nil {
+		return nil, err
+	}
+
+	app.dvc.Lock()
+	app.dvc.payQrCodes = append(app.dvc.payQrCodes, qrtext)
+	app.dvc.Unlock()
+	return qrpng, nil
+}
@@ -0,0 +1,254 @@
+package adbot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(simulatorSuite))
+
+type simulatorSuite struct{}
+
+func TestAdbot(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *simulatorSuite) TestSimulatorDevices(c *check.C) {
+	var (
+		sim         = NewSimulator()
+		ch, stopch  = sim.WatchAdbEvents()
+		_           = sim.AddDevice("sim-02")
+		dvc         = sim.AddDevice("sim-01")
+		serials, er = sim.ListAdbDevices()
+	)
+	defer close(stopch)
+
+	c.Assert(er, check.IsNil)
+	c.Assert(serials, check.DeepEquals, []string{"sim-01", "sim-02"})
+
+	ev := <-ch
+	c.Assert(ev.Type, check.Equals, AdbEventDeviceAlive)
+	c.Assert(ev.Serial, check.Equals, "sim-02")
+	<-ch
+
+	info, err := dvc.SysInfo()
+	c.Assert(err, check.IsNil)
+	c.Assert(info.SerialNo, check.Equals, "sim-01")
+	c.Assert(info.Battery.Level, check.Equals, 100)
+
+	// getprop & dumpsys output could be parsed as the real device
+	out, err := dvc.Run("getprop")
+	c.Assert(err, check.IsNil)
+	c.Assert(parseAndroidSysinfo(out).SerialNo, check.Equals, "sim-01")
+
+	dvc.SetBattery(42, "3")
+	out, err = dvc.Run("dumpsys", "battery")
+	c.Assert(err, check.IsNil)
+	c.Assert(parseAndroidBatteryInfo(out).Level, check.Equals, 42)
+
+	// offline transition
+	dvc.SetOnline(false)
+	ev = <-ch
+	c.Assert(ev.Type, check.Equals, AdbEventDeviceDie)
+	c.Assert(dvc.Online(), check.Equals, false)
+	_, err = dvc.SysInfo()
+	c.Assert(err, check.NotNil)
+
+	dvc.SetOnline(true)
+	ev = <-ch
+	c.Assert(ev.Type, check.Equals, AdbEventDeviceAlive)
+
+	// removed
+	sim.RemoveDevice("sim-01")
+	c.Assert(dvc.Exists(), check.Equals, false)
+	_, err = sim.NewDevice("sim-01")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *simulatorSuite) TestSimulatorAlipayOrder(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	ch, stopch := dvc.WatchSysNotifies()
+	defer close(stopch)
+
+	app, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+
+	_, err = app.SearchOrder(context.Background(), "111111")
+	c.Assert(err, check.NotNil)
+
+	_, err = dvc.Run("sim", "alipay_order", "111111", "0.01", "bbk")
+	c.Assert(err, check.IsNil)
+
+	select {
+	case notify := <-ch:
+		c.Assert(notify.Source, check.Equals, SimAlipayPackage)
+		c.Assert(app.ParseNotify(notify), check.NotNil)
+	case <-time.After(time.Second * 5):
+		c.Fatal("alipay order notify not received")
+	}
+
+	notifies := dvc.ListSysNotifies()
+	c.Assert(notifies, check.HasLen, 1)
+
+	out, err := dvc.Run("dumpsys", "notification")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, "(?s).*pkg=com.eg.android.AlipayGphone.*")
+
+	order, err := app.SearchOrder(context.Background(), "111111")
+	c.Assert(err, check.IsNil)
+	c.Assert(order.Amount, check.Equals, "0.01")
+	c.Assert(order.Account, check.Equals, "bbk")
+
+	bills, err := app.ListBills(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(bills, check.HasLen, 1)
+
+	c.Assert(dvc.ClearSysNotifies(), check.IsNil)
+	c.Assert(dvc.ListSysNotifies(), check.HasLen, 0)
+}
+
+func (s *simulatorSuite) TestSimulatorUI(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	err := dvc.SetUIDump([]byte(`<hierarchy><node index="0" text="账单" resource-id="com.alipay.mobile.antui:id/item_left_text" bounds="[0,100][200,300]" /></hierarchy>`))
+	c.Assert(err, check.IsNil)
+
+	x, y, err := dvc.FindUINodeAndClick("com.alipay.mobile.antui:id/item_left_text", "账单")
+	c.Assert(err, check.IsNil)
+	c.Assert([2]int{x, y}, check.Equals, [2]int{100, 200})
+	c.Assert(dvc.Clicks(), check.DeepEquals, [][2]int{{100, 200}})
+
+	_, _, err = dvc.FindUINodeAndClick("not-exists", "")
+	c.Assert(err, check.Equals, errUINodeNotFound)
+
+	app, err := dvc.PaymentApp(PaymentAppAlipay)
+	c.Assert(err, check.IsNil)
+	c.Assert(app.Start(context.Background()), check.IsNil)
+	c.Assert(app.IsForeground(context.Background()), check.Equals, true)
+	activity, _ := dvc.CurrentTopActivity()
+	c.Assert(activity, check.Equals, SimAlipayLoginActivity)
+	c.Assert(dvc.GotoHome(), check.IsNil)
+	activity, _ = dvc.CurrentTopActivity()
+	c.Assert(activity, check.Equals, SimLauncherActivity)
+
+	png, err := dvc.ScreenCap()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(png) > 0, check.Equals, true)
+}
+
+func (s *simulatorSuite) TestSimulatorSysLogs(c *check.C) {
+	var (
+		sim    = NewSimulator()
+		dvc    = sim.AddDevice("sim-01")
+		filter = &SysLogFilter{Tags: []string{"ActivityManager"}, Priority: "w"}
+	)
+	c.Assert(filter.Valid(), check.IsNil)
+	c.Assert(filter.logcatArgs(), check.DeepEquals, []string{"-v", "time", "ActivityManager:W", "*:S"})
+	c.Assert((&SysLogFilter{Buffers: []string{"nope"}}).Valid(), check.NotNil)
+
+	ch, stopch := dvc.TailSysLogs(filter)
+	evch, evstopch := dvc.WatchSysEvents([]string{"tickerText"})
+
+	dvc.AppendSysLog("I", "ActivityManager", "start proc")
+	dvc.AppendSysLog("E", "NotificationService", "boom")
+	dvc.AppendSysLog("E", "ActivityManager", "anr in com.eg.android.AlipayGphone")
+	dvc.PushSysNotify(SimAlipayPackage, "你已成功收款0.01元")
+
+	select {
+	case line := <-ch:
+		ent := parseSysLogLine(line)
+		c.Assert(ent, check.NotNil)
+		c.Assert(ent.Priority, check.Equals, "E")
+		c.Assert(ent.Tag, check.Equals, "ActivityManager")
+		c.Assert(ent.Message, check.Equals, "anr in com.eg.android.AlipayGphone")
+	case <-time.After(time.Second * 5):
+		c.Fatal("system log not received")
+	}
+
+	select {
+	case line := <-evch:
+		c.Assert(line, check.Matches, ".*tickerText=你已成功收款0.01元")
+	case <-time.After(time.Second * 5):
+		c.Fatal("system event not received")
+	}
+
+	close(stopch)
+	close(evstopch)
+	for range ch {
+	}
+}
+
+func (s *simulatorSuite) TestSysLogCursor(c *check.C) {
+	var (
+		cursor = newSysLogCursor()
+		recv   []string
+		feed   = func(lines ...string) {
+			for _, line := range lines {
+				if cursor.accept(line) {
+					recv = append(recv, line)
+				}
+			}
+		}
+	)
+
+	// the first stream skips the headers & the last buffered log printed by `-T 1`
+	c.Assert(cursor.args(), check.DeepEquals, []string{"-T", "1"})
+	cursor.reconnected()
+	feed(
+		"--------- beginning of main",
+		"--------- beginning of system",
+		"06-10 11:42:00.001 I/ActivityManager( 1234): buffered",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): a",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+	)
+	c.Assert(recv, check.DeepEquals, []string{
+		"06-10 11:42:01.123 I/ActivityManager( 1234): a",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+	})
+
+	// resumed from the last time, the received logs of the same time are replayed
+	recv = nil
+	c.Assert(cursor.args(), check.DeepEquals, []string{"-T", "06-10 11:42:01.123"})
+	cursor.reconnected()
+	feed(
+		"--------- beginning of main",
+		"06-10 11:42:01.100 I/ActivityManager( 1234): older",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): a",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b", // the newly one of the same time
+		"06-10 11:42:01.123 I/ActivityManager( 1234): c",
+		"06-10 11:42:02.000 I/ActivityManager( 1234): d",
+		"    continued message",
+	)
+	c.Assert(recv, check.DeepEquals, []string{
+		"06-10 11:42:01.123 I/ActivityManager( 1234): b",
+		"06-10 11:42:01.123 I/ActivityManager( 1234): c",
+		"06-10 11:42:02.000 I/ActivityManager( 1234): d",
+		"    continued message",
+	})
+
+	// the stream starts with a header, instead of the last sent log
+	recv = nil
+	cursor.reconnected()
+	feed(
+		"--------- beginning of crash",
+		"06-10 11:42:02.000 I/ActivityManager( 1234): d",
+		"06-10 11:42:03.000 I/ActivityManager( 1234): e",
+	)
+	c.Assert(recv, check.DeepEquals, []string{
+		"06-10 11:42:03.000 I/ActivityManager( 1234): e",
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	mrand "math/rand"
 	"regexp"
@@ -27,15 +29,17 @@ func init() {
 var (
 	AdbEventDeviceDie   = "device_die"
 	AdbEventDeviceAlive = "device_alive"
-	AdbEventAlipayOrder = "alipay_order"
+	AdbEventPayOrder    = "pay_order"
 )
 
 // AdbEvent is an adb device event
 type AdbEvent struct {
-	Serial  string    `json:"serial"`
-	Type    string    `json:"type"` // device_die,device_alive,alipay_order
-	Message string    `json:"message"`
-	Time    time.Time `json:"time"`
+	Serial  string     `json:"serial"`
+	Type    string     `json:"type"`   // device_die,device_alive,pay_order
+	App     string     `json:"app"`    // payment app name of pay_order event, eg: alipay, wxpay
+	Notice  *PayNotice `json:"notice"` // parsed payment notice of pay_order event, nil means NOOP event
+	Message string     `json:"message"`
+	Time    time.Time  `json:"time"`
 }
 
 // Valid is exported
@@ -78,6 +82,7 @@ type AndroidSysInfo struct {
 	BootTimeAt         time.Time           `json:"boot_time_at"`         // parsed from above
 	BootTimeFor        string              `json:"boot_time_for"`        // parsed from above
 	Battery            *AndroidBatteryInfo `json:"battery"`              // battery info
+	OpQueue            *OpQueueStats       `json:"op_queue"`             // device op queue stats
 }
 
 func parseAndroidSysinfo(text string) *AndroidSysInfo {
@@ -177,13 +182,38 @@ func parseAndroidBatteryInfo(text string) *AndroidBatteryInfo {
 
 // AndroidUINode is exported
 type AndroidUINode struct {
-	Index       string `json:"index"`        // 4
-	Text        string `json:"text"`         // 手机电池已充满(100%)
-	ResourceID  string `json:"resource_id"`  // com.android.systemui:id/clear_all_button
-	Package     string `json:"package"`      // com.android.systemui
-	ContentDesc string `json:"content_desc"` // 清除所有通知。
-	Bounds      string `json:"bounds"`       // [301,1138][419,1256]
-	XY          [2]int `json:"xy"`           // MiddleXY() of UINode
+	Index         string `json:"index"`          // 4
+	Text          string `json:"text"`           // 手机电池已充满(100%)
+	ResourceID    string `json:"resource_id"`    // com.android.systemui:id/clear_all_button
+	Class         string `json:"class"`          // android.widget.TextView
+	Package       string `json:"package"`        // com.android.systemui
+	ContentDesc   string `json:"content_desc"`   // 清除所有通知。
+	Checkable     bool   `json:"checkable"`      // false
+	Checked       bool   `json:"checked"`        // false
+	Clickable     bool   `json:"clickable"`      // true
+	Enabled       bool   `json:"enabled"`        // true
+	Focusable     bool   `json:"focusable"`      // true
+	Focused       bool   `json:"focused"`        // false
+	Scrollable    bool   `json:"scrollable"`     // false
+	LongClickable bool   `json:"long_clickable"` // false
+	Selected      bool   `json:"selected"`       // false
+	Bounds        string `json:"bounds"`         // [301,1138][419,1256]
+	XY            [2]int `json:"xy"`             // MiddleXY() of UINode
+	Path          string `json:"path"`           // position in the ui hierarchy: child index of each level from the root, eg: 0/1/3
+	Depth         int    `json:"depth"`          // depth in the ui hierarchy, 0 means the top level
+
+	parent   *AndroidUINode   // nil means the top level
+	children []*AndroidUINode // child nodes
+}
+
+// Parent return the parent node, nil means the top level node
+func (n *AndroidUINode) Parent() *AndroidUINode {
+	return n.parent
+}
+
+// Children return the child nodes
+func (n *AndroidUINode) Children() []*AndroidUINode {
+	return n.children
 }
 
 // MiddleXY is exported
@@ -215,45 +245,77 @@ func (n *AndroidUINode) MiddleXY() (int, int, error) {
 	return x, y, nil
 }
 
-func parseAndroidUINodes(xmldata []byte) ([]*AndroidUINode, error) {
-	var (
-		nodes        = make([]string, 0, 0)
-		noderx       = regexp.MustCompile(`<node ([^>]*)/>`)
-		nodesMatched = noderx.FindAllSubmatch(xmldata, -1)
-	)
+// Rect return the screen area of the UINode
+func (n *AndroidUINode) Rect() (image.Rectangle, error) {
+	var x1, y1, x2, y2 int
+	_, err := fmt.Sscanf(n.Bounds, "[%d,%d][%d,%d]", &x1, &y1, &x2, &y2)
+	if err != nil {
+		return image.Rectangle{}, errors.New("the UI bounds are invalid")
+	}
+	return image.Rect(x1, y1, x2, y2), nil
+}
 
-	for _, nodeMatched := range nodesMatched {
-		if len(nodeMatched) >= 2 {
-			nodes = append(nodes, string(nodeMatched[1]))
-		}
+// uiautomator dump xml format:
+//   <hierarchy rotation="0"><node index="0" text="" resource-id="" class="android.widget.FrameLayout" ...><node ... /></node></hierarchy>
+type uiXMLNode struct {
+	Attrs []xml.Attr  `xml:",any,attr"`
+	Nodes []uiXMLNode `xml:"node"`
+}
+
+// parseAndroidUINodes parse the uiautomator dump xml and return all of the
+// ui nodes in the hierarchy with depth-first order, the tree relations are kept
+// by the node parent & children
+func parseAndroidUINodes(xmldata []byte) ([]*AndroidUINode, error) {
+	var root uiXMLNode
+	if err := xml.Unmarshal(xmldata, &root); err != nil {
+		return nil, fmt.Errorf("parse ui dump xml: %v", err)
 	}
 
 	var (
-		nodekvrx = regexp.MustCompile(`([^ \t]+)="([^"]+)"`)
-		ret      = []*AndroidUINode{}
+		ret  = []*AndroidUINode{}
+		walk func(xnodes []uiXMLNode, parent *AndroidUINode, path string, depth int)
 	)
-	for _, node := range nodes {
-		nodekvsMatched := nodekvrx.FindAllSubmatch([]byte(node), -1)
-		lbs := label.Labels{}
-		for _, nodekvMatched := range nodekvsMatched {
-			if len(nodekvMatched) >= 3 {
-				key := string(nodekvMatched[1])
-				val := string(nodekvMatched[2])
-				lbs.Set(key, val)
+
+	walk = func(xnodes []uiXMLNode, parent *AndroidUINode, path string, depth int) {
+		for idx, xnode := range xnodes {
+			lbs := label.Labels{}
+			for _, attr := range xnode.Attrs {
+				lbs.Set(attr.Name.Local, attr.Value)
 			}
+
+			uinode := &AndroidUINode{
+				Index:         lbs.Get("index"),
+				Text:          lbs.Get("text"),
+				ResourceID:    lbs.Get("resource-id"),
+				Class:         lbs.Get("class"),
+				Package:       lbs.Get("package"),
+				ContentDesc:   lbs.Get("content-desc"),
+				Checkable:     lbs.Get("checkable") == "true",
+				Checked:       lbs.Get("checked") == "true",
+				Clickable:     lbs.Get("clickable") == "true",
+				Enabled:       lbs.Get("enabled") == "true",
+				Focusable:     lbs.Get("focusable") == "true",
+				Focused:       lbs.Get("focused") == "true",
+				Scrollable:    lbs.Get("scrollable") == "true",
+				LongClickable: lbs.Get("long-clickable") == "true",
+				Selected:      lbs.Get("selected") == "true",
+				Bounds:        lbs.Get("bounds"),
+				Path:          strings.TrimPrefix(path+"/"+strconv.Itoa(idx), "/"),
+				Depth:         depth,
+				parent:        parent,
+			}
+			x, y, _ := uinode.MiddleXY()
+			uinode.XY = [2]int{x, y}
+
+			if parent != nil {
+				parent.children = append(parent.children, uinode)
+			}
+			ret = append(ret, uinode)
+
+			walk(xnode.Nodes, uinode, uinode.Path, depth+1)
 		}
-		uinode := &AndroidUINode{ // here we only pick up the fields we want
-			Index:       lbs.Get("index"),
-			Text:        lbs.Get("text"),
-			ResourceID:  lbs.Get("resource-id"),
-			Package:     lbs.Get("package"),
-			ContentDesc: lbs.Get("content-desc"),
-			Bounds:      lbs.Get("bounds"),
-		}
-		x, y, _ := uinode.MiddleXY()
-		uinode.XY = [2]int{x, y}
-		ret = append(ret, uinode)
 	}
+	walk(root.Nodes, nil, "", 0)
 
 	return ret, nil
 }
@@ -270,12 +332,107 @@ func (n *AndroidSysNotify) EqualsTo(new *AndroidSysNotify) bool {
 	return n.ID == new.ID && n.Source == new.Source && n.Message == new.Message
 }
 
-// AlipayOrder is exported
-type AlipayOrder struct {
-	Comment string `json:"comment"`
-	Account string `json:"account"`
-	Amount  string `json:"amount"`
-	Time    string `json:"time"`
+// SysLogFilter is the logcat filter on tailing system logs
+type SysLogFilter struct {
+	Buffers  []string `json:"buffers"`  // main,system,radio,events,crash,all - empty means logcat default
+	Tags     []string `json:"tags"`     // only logs with given tags, empty means all tags
+	Priority string   `json:"priority"` // minimal priority V,D,I,W,E,F - empty means V
+}
+
+var (
+	sysLogBuffers    = []string{"main", "system", "radio", "events", "crash", "all"}
+	sysLogPriorities = "VDIWEF"
+)
+
+// Valid is exported
+func (f *SysLogFilter) Valid() error {
+	for _, buf := range f.Buffers {
+		if !utils.SliceContains(sysLogBuffers, buf) {
+			return fmt.Errorf("unsupported logcat buffer: %s", buf)
+		}
+	}
+	for _, tag := range f.Tags {
+		if tag == "" || strings.ContainsAny(tag, ": \t\"") {
+			return fmt.Errorf("invalid logcat tag: %q", tag)
+		}
+	}
+	if p := f.Priority; p != "" {
+		if len(p) != 1 || !strings.Contains(sysLogPriorities, strings.ToUpper(p)) {
+			return fmt.Errorf("unsupported logcat priority: %s", p)
+		}
+	}
+	return nil
+}
+
+// logcatArgs generate the logcat arguments (without the follow mode args)
+func (f *SysLogFilter) logcatArgs() []string {
+	args := []string{"-v", "time"}
+	if f == nil {
+		return args
+	}
+
+	for _, buf := range f.Buffers {
+		args = append(args, "-b", buf)
+	}
+
+	priority := strings.ToUpper(f.Priority)
+	if priority == "" {
+		priority = "V"
+	}
+	if len(f.Tags) > 0 {
+		for _, tag := range f.Tags {
+			args = append(args, tag+":"+priority)
+		}
+		args = append(args, "*:S") // silence all of others
+	} else if priority != "V" {
+		args = append(args, "*:"+priority)
+	}
+	return args
+}
+
+// Match check if the given log line matches the tags & priority of the filter
+// note: the buffers are ignored as the log line doesn't contain buffer name
+func (f *SysLogFilter) Match(line string) bool {
+	if f == nil || (len(f.Tags) == 0 && f.Priority == "") {
+		return true
+	}
+
+	ent := parseSysLogLine(line)
+	if ent == nil {
+		return false
+	}
+	if len(f.Tags) > 0 && !utils.SliceContains(f.Tags, ent.Tag) {
+		return false
+	}
+	if p := strings.ToUpper(f.Priority); p != "" {
+		return strings.Index(sysLogPriorities, ent.Priority) >= strings.Index(sysLogPriorities, p)
+	}
+	return true
+}
+
+// SysLogEntry is a parsed logcat `-v time` format log line
+type SysLogEntry struct {
+	Time     string `json:"time"`     // 06-10 11:42:01.123
+	Priority string `json:"priority"` // I
+	Tag      string `json:"tag"`      // ActivityManager
+	Message  string `json:"message"`
+}
+
+var sysLogLinerx = regexp.MustCompile(`^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+([VDIWEF])/([^(:]*?)\s*(?:\(\s*\d+\))?: ?(.*)$`)
+
+// parse log line like:
+//   06-10 11:42:01.123 I/ActivityManager( 1234): Start proc com.eg.android.AlipayGphone
+func parseSysLogLine(line string) *SysLogEntry {
+	matched := sysLogLinerx.FindStringSubmatch(line)
+	if len(matched) != 5 {
+		return nil
+	}
+	return &SysLogEntry{
+		Time:     matched[1],
+		Priority: matched[2],
+		Tag:      matched[3],
+		Message:  matched[4],
+	}
 }
 
 // AlipayChargingQrCode is exported
@@ -0,0 +1,363 @@
+package adbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// nolint
+var (
+	PaymentAppWxpay = "wxpay"
+
+	WxpayPackage               = "com.tencent.mm"
+	WxpayLauncherActivity      = "com.tencent.mm/.ui.LauncherUI"
+	WxpayCollectActivity       = "com.tencent.mm/.plugin.collect.ui.CollectMainUI"         // 二维码收款
+	WxpayCollectAmountActivity = "com.tencent.mm/.plugin.collect.ui.CollectCreateQRCodeUI" // 二维码收款 -> 设置金额
+)
+
+var (
+	wxpayAmountrx       = regexp.MustCompile(`^[￥¥]?\s*([0-9]+\.[0-9]{2})$`)                  // ￥0.01
+	wxpayNotifyAmountrx = regexp.MustCompile(`(?:收款|到账)\s*[￥¥]?\s*([0-9]+(?:\.[0-9]{1,2})?)`) // 微信支付收款0.01元, 个人收款码到账¥0.01
+)
+
+func init() {
+	RegisterPaymentApp(PaymentAppWxpay, newWxpay)
+}
+
+// wxpay is the PaymentApp driver of WeChat App
+type wxpay struct {
+	dvc        AdbDeviceHandler
+	sync.Mutex // synchronized the combined ops on the app
+}
+
+func newWxpay(dvc AdbDeviceHandler) PaymentApp {
+	return &wxpay{dvc: dvc}
+}
+
+// Name implement PaymentApp
+func (app *wxpay) Name() string {
+	return PaymentAppWxpay
+}
+
+// Package implement PaymentApp
+func (app *wxpay) Package() string {
+	return WxpayPackage
+}
+
+// Start implement PaymentApp
+func (app *wxpay) Start(ctx context.Context) error {
+	var err error
+	for i := 1; i <= 5; i++ {
+		if app.IsForeground(ctx) {
+			return nil
+		}
+		_, err = app.dvc.RunContext(ctx, "am", "start", WxpayLauncherActivity)
+		if err != nil {
+			log.Warnf("wxpay.Start() %d am.start error: %v", i, err)
+		}
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return fmt.Errorf("wxpay.Start() %v", err)
+		}
+	}
+	return err
+}
+
+// IsForeground implement PaymentApp
+func (app *wxpay) IsForeground(ctx context.Context) bool {
+	activity, _ := app.dvc.CurrentTopActivityContext(ctx)
+	return strings.Contains(activity, WxpayPackage)
+}
+
+// ParseNotify implement PaymentApp
+//
+//	微信支付: 微信支付收款0.01元
+//	微信支付: [2条]微信支付: 个人收款码到账¥0.01
+//
+// note: the wechat pay notify doesn't contain the payer
+func (app *wxpay) ParseNotify(notify *AndroidSysNotify) *PayNotice {
+	if notify == nil || notify.Source != WxpayPackage {
+		return nil
+	}
+	if !strings.Contains(notify.Message, "微信支付") { // skip the chat messages
+		return nil
+	}
+
+	var amount string
+	if matched := wxpayNotifyAmountrx.FindStringSubmatch(notify.Message); len(matched) == 2 {
+		amount = matched[1]
+	}
+	return newPayNotice(PaymentAppWxpay, notify.Message, amount, "")
+}
+
+// GenQrCode implement PaymentQrCoder
+// 二维码收款 -> 设置金额 -> 添加收款理由 -> 确定 -> 截取收款码
+//
+// note: the wechat collect qrcode text can't be built outside of the app,
+// so we set the amount & comment in the app and cut the qrcode image from the screen
+func (app *wxpay) GenQrCode(ctx context.Context, fee int, comment string) ([]byte, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	if fee <= 0 {
+		return nil, errors.New("wxpay.GenQrCode() fee must be positive")
+	}
+	if comment == "" {
+		return nil, errors.New("wxpay.GenQrCode() order comment required")
+	}
+
+	var (
+		dvc     = app.dvc
+		feeYuan = fmt.Sprintf("%0.2f", float64(fee)/float64(100))
+	)
+
+	// back to home afterwards, so the keep-alive payment app could take over the screen
+	defer dvc.GotoHome()
+
+	// 二维码收款
+	if _, err := dvc.RunContext(ctx, "am", "start", "-n", WxpayCollectActivity); err != nil {
+		return nil, fmt.Errorf("wxpay.GenQrCode() am.start collect activity error: %v", err)
+	}
+	if err := waitTopActivity(ctx, dvc, WxpayCollectActivity, 10, time.Second); err != nil {
+		return nil, err
+	}
+
+	// 清除金额: clear the amount set by previous order
+	if _, _, err := clickText(ctx, dvc, "清除金额"); err == nil {
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	// 设置金额
+	if _, _, err := clickText(ctx, dvc, "设置金额"); err != nil {
+		log.Errorln("wxpay.GenQrCode().click `设置金额` error:", err)
+		return nil, err
+	}
+	if err := waitTopActivity(ctx, dvc, WxpayCollectAmountActivity, 5, time.Second); err != nil {
+		return nil, err
+	}
+
+	// 输入金额: the amount input box is focused by default
+	if _, err := dvc.RunContext(ctx, "input", "text", feeYuan); err != nil {
+		return nil, fmt.Errorf("wxpay.GenQrCode() input text fee error: %v", err)
+	}
+
+	// 添加收款理由 -> 输入订单号 -> 确定
+	if _, _, err := clickText(ctx, dvc, "添加收款理由"); err != nil {
+		log.Errorln("wxpay.GenQrCode().click `添加收款理由` error:", err)
+		return nil, err
+	}
+	if err := sleepContext(ctx, time.Second); err != nil {
+		return nil, err
+	}
+	if _, err := dvc.RunContext(ctx, "input", "text", comment); err != nil {
+		return nil, fmt.Errorf("wxpay.GenQrCode() input text comment error: %v", err)
+	}
+	if _, _, err := clickText(ctx, dvc, "确定"); err != nil {
+		log.Errorln("wxpay.GenQrCode().click comment dialog `确定` error:", err)
+		return nil, err
+	}
+	if err := sleepContext(ctx, time.Second); err != nil {
+		return nil, err
+	}
+
+	// 确定: submit and back to the collect page with the new qrcode
+	if _, _, err := clickText(ctx, dvc, "确定"); err != nil {
+		log.Errorln("wxpay.GenQrCode().click `确定` error:", err)
+		return nil, err
+	}
+	if err := waitTopActivity(ctx, dvc, WxpayCollectActivity, 5, time.Second); err != nil {
+		return nil, err
+	}
+
+	// ensure the qrcode refreshed with our amount
+	nodes, err := dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if findUINodeByText(nodes, feeYuan) == nil {
+		return nil, fmt.Errorf("wxpay.GenQrCode() the collect page missing the amount %s", feeYuan)
+	}
+
+	qrnode := findWxpayQrCodeNode(nodes)
+	if qrnode == nil {
+		return nil, errors.New("unexpected collect page: the qrcode UI node not found")
+	}
+	rect, err := qrnode.Rect()
+	if err != nil {
+		return nil, err
+	}
+
+	screen, err := dvc.ScreenCapContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cropPNG(screen, rect)
+}
+
+// SearchOrder implement PaymentApp
+// 微信 -> 微信支付 -> 收款到账通知 (收款理由)
+func (app *wxpay) SearchOrder(ctx context.Context, orderID string) (*PayOrder, error) {
+	if orderID == "" {
+		return nil, errors.New("wxpay.SearchOrder() order id required")
+	}
+
+	bills, err := app.ListBills(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the latest message is dumped at the last
+	for i := len(bills) - 1; i >= 0; i-- {
+		if bills[i].Comment == orderID {
+			return bills[i], nil
+		}
+	}
+	return nil, errors.New("no such order")
+}
+
+// ListBills implement PaymentApp
+// 微信 -> 微信支付 -> 收款到账通知
+func (app *wxpay) ListBills(ctx context.Context) ([]*PayOrder, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	// back to home afterwards, so the keep-alive payment app could take over the screen
+	defer app.dvc.GotoHome()
+
+	if err := app.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	// 微信支付: the wechat pay official account in the conversation list
+	if _, _, err := clickText(ctx, app.dvc, "微信支付"); err != nil {
+		log.Errorln("wxpay.ListBills().click `微信支付` error:", err)
+		return nil, err
+	}
+	if err := sleepContext(ctx, time.Second*2); err != nil {
+		return nil, err
+	}
+
+	nodes, err := app.dvc.DumpCurrentUIContext(ctx)
+	if err != nil {
+		log.Errorln("wxpay.ListBills().dumpCurrentUI() on wxpay messages page error:", err)
+		return nil, err
+	}
+
+	return parseWxpayBills(nodes), nil
+}
+
+// ListDayBills implement PaymentDayBiller
+// 微信 -> 微信支付 -> 收款到账通知, the latest message at the bottom, scroll down to load the older ones
+func (app *wxpay) ListDayBills(ctx context.Context, day time.Time) ([]*PayOrder, error) {
+	app.Lock()
+	defer app.Unlock()
+
+	defer app.dvc.GotoHome()
+
+	if err := app.Start(ctx); err != nil {
+		return nil, err
+	}
+	if _, _, err := clickText(ctx, app.dvc, "微信支付"); err != nil {
+		log.Errorln("wxpay.ListDayBills().click `微信支付` error:", err)
+		return nil, err
+	}
+	if err := sleepContext(ctx, time.Second*2); err != nil {
+		return nil, err
+	}
+
+	load := func() ([]*PayOrder, error) {
+		nodes, err := app.dvc.DumpCurrentUIContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return parseWxpayBills(nodes), nil
+	}
+	scroll := func() error {
+		return swipeScrollable(ctx, app.dvc, false)
+	}
+	return collectDayBills(ctx, day, load, scroll)
+}
+
+// the qrcode is the biggest square image on the collect page
+func findWxpayQrCodeNode(nodes []*AndroidUINode) *AndroidUINode {
+	var (
+		ret  *AndroidUINode
+		size int
+	)
+	for _, node := range nodes {
+		if !strings.HasSuffix(node.Class, "ImageView") {
+			continue
+		}
+		rect, err := node.Rect()
+		if err != nil {
+			continue
+		}
+		w, h := rect.Dx(), rect.Dy()
+		if w < 100 || w-h > 10 || h-w > 10 {
+			continue
+		}
+		if w > size {
+			ret, size = node, w
+		}
+	}
+	return ret
+}
+
+// the wxpay message card looks like:
+//
+//	收款到账通知
+//	￥0.01
+//	付款方   bbk
+//	收款理由 2019610114201-ABCD
+//	到账时间 2019-06-10 11:42:01
+func parseWxpayBills(nodes []*AndroidUINode) []*PayOrder {
+	var ret []*PayOrder
+	for _, node := range nodes {
+		if node.Text != "收款理由" {
+			continue
+		}
+
+		// lookup the whole message card: the nearest ancestor contains the amount
+		var texts []string
+		for card := node.Parent(); card != nil && texts == nil; card = card.Parent() {
+			for _, text := range uiNodeTexts(card) {
+				if wxpayAmountrx.MatchString(text) {
+					texts = uiNodeTexts(card)
+					break
+				}
+			}
+		}
+
+		order := new(PayOrder)
+		for idx, text := range texts {
+			if matched := wxpayAmountrx.FindStringSubmatch(text); len(matched) == 2 && order.Amount == "" {
+				order.Amount = matched[1]
+				continue
+			}
+			if idx+1 >= len(texts) {
+				continue
+			}
+			switch text {
+			case "付款方":
+				order.Account = texts[idx+1]
+			case "收款理由":
+				order.Comment = texts[idx+1]
+			case "到账时间":
+				order.Time = texts[idx+1]
+			}
+		}
+
+		if order.Amount != "" && order.Comment != "" {
+			ret = append(ret, order)
+		}
+	}
+	return ret
+}
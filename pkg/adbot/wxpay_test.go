@@ -0,0 +1,123 @@
+package adbot
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"strings"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(wxpaySuite))
+
+type wxpaySuite struct{}
+
+func (s *wxpaySuite) TestParseWxpayBills(c *check.C) {
+	xmldata := `<hierarchy rotation="0">
+<node index="0" text="" class="android.widget.ListView" bounds="[0,0][720,1280]">
+  <node index="0" text="" class="android.widget.LinearLayout" bounds="[0,100][720,500]">
+    <node index="0" text="收款到账通知" class="android.widget.TextView" bounds="[20,120][300,160]" />
+    <node index="1" text="￥0.02" class="android.widget.TextView" bounds="[20,180][300,240]" />
+    <node index="2" text="" class="android.widget.LinearLayout" bounds="[20,260][700,300]">
+      <node index="0" text="收款理由" class="android.widget.TextView" bounds="[20,260][200,300]" />
+      <node index="1" text="2019610114200-AAAA" class="android.widget.TextView" bounds="[200,260][700,300]" />
+    </node>
+  </node>
+  <node index="1" text="" class="android.widget.LinearLayout" bounds="[0,500][720,900]">
+    <node index="0" text="收款到账通知" class="android.widget.TextView" bounds="[20,520][300,560]" />
+    <node index="1" text="￥0.01" class="android.widget.TextView" bounds="[20,580][300,640]" />
+    <node index="2" text="" class="android.widget.LinearLayout" bounds="[20,660][700,700]">
+      <node index="0" text="付款方" class="android.widget.TextView" bounds="[20,660][200,700]" />
+      <node index="1" text="bbk" class="android.widget.TextView" bounds="[200,660][700,700]" />
+    </node>
+    <node index="3" text="" class="android.widget.LinearLayout" bounds="[20,700][700,740]">
+      <node index="0" text="收款理由" class="android.widget.TextView" bounds="[20,700][200,740]" />
+      <node index="1" text="2019610114201-ABCD" class="android.widget.TextView" bounds="[200,700][700,740]" />
+    </node>
+    <node index="4" text="" class="android.widget.LinearLayout" bounds="[20,740][700,780]">
+      <node index="0" text="到账时间" class="android.widget.TextView" bounds="[20,740][200,780]" />
+      <node index="1" text="2019-06-10 11:42:01" class="android.widget.TextView" bounds="[200,740][700,780]" />
+    </node>
+  </node>
+</node>
+</hierarchy>`
+
+	nodes, err := parseAndroidUINodes([]byte(xmldata))
+	c.Assert(err, check.IsNil)
+
+	bills := parseWxpayBills(nodes)
+	c.Assert(bills, check.HasLen, 2)
+	c.Assert(bills[0].Comment, check.Equals, "2019610114200-AAAA")
+	c.Assert(bills[0].Amount, check.Equals, "0.02")
+	c.Assert(bills[0].Account, check.Equals, "")
+
+	order := bills[1]
+	c.Assert(order.Comment, check.Equals, "2019610114201-ABCD")
+	c.Assert(order.Amount, check.Equals, "0.01")
+	c.Assert(order.Account, check.Equals, "bbk")
+	c.Assert(order.Time, check.Equals, "2019-06-10 11:42:01")
+}
+
+func (s *wxpaySuite) TestCropPNG(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	screen, err := dvc.ScreenCap()
+	c.Assert(err, check.IsNil)
+
+	node := &AndroidUINode{Bounds: "[100,200][400,500]"}
+	rect, err := node.Rect()
+	c.Assert(err, check.IsNil)
+
+	bs, err := cropPNG(screen, rect)
+	c.Assert(err, check.IsNil)
+	img, err := png.Decode(bytes.NewReader(bs))
+	c.Assert(err, check.IsNil)
+	c.Assert(img.Bounds().Dx(), check.Equals, 300)
+	c.Assert(img.Bounds().Dy(), check.Equals, 300)
+
+	node.Bounds = "[800,1300][900,1400]"
+	rect, _ = node.Rect()
+	_, err = cropPNG(screen, rect)
+	c.Assert(err, check.ErrorMatches, ".*out of the screen")
+}
+
+func (s *wxpaySuite) TestSimDeviceWxpay(c *check.C) {
+	var (
+		sim = NewSimulator()
+		dvc = sim.AddDevice("sim-01")
+	)
+
+	app, err := dvc.PaymentApp(PaymentAppWxpay)
+	c.Assert(err, check.IsNil)
+	qrcoder, ok := app.(PaymentQrCoder)
+	c.Assert(ok, check.Equals, true)
+
+	_, err = qrcoder.GenQrCode(context.Background(), 0, "111111")
+	c.Assert(err, check.NotNil)
+
+	qrpng, err := qrcoder.GenQrCode(context.Background(), 1, "111111")
+	c.Assert(err, check.IsNil)
+	c.Assert(bytes.HasPrefix(qrpng, pngMagic), check.Equals, true)
+	c.Assert(dvc.PayQrCodes(), check.HasLen, 1)
+	c.Assert(strings.Contains(dvc.PayQrCodes()[0], "amount=0.01&comment=111111"), check.Equals, true)
+	c.Assert(app.IsForeground(context.Background()), check.Equals, true)
+
+	_, err = app.SearchOrder(context.Background(), "111111")
+	c.Assert(err, check.ErrorMatches, "no such order")
+
+	_, err = dvc.Run("sim", "wxpay_order", "111111", "0.01", "bbk")
+	c.Assert(err, check.IsNil)
+
+	order, err := app.SearchOrder(context.Background(), "111111")
+	c.Assert(err, check.IsNil)
+	c.Assert(order.Amount, check.Equals, "0.01")
+	c.Assert(order.Account, check.Equals, "bbk")
+
+	notifies := dvc.ListSysNotifies()
+	c.Assert(notifies, check.HasLen, 1)
+	c.Assert(notifies[0].Source, check.Equals, WxpayPackage)
+}
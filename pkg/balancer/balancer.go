@@ -2,6 +2,7 @@ package balancer
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -19,6 +20,11 @@ func NewWeight() Balancer {
 	return new(weightBalancer)
 }
 
+// NewSmoothWeight is exported
+func NewSmoothWeight() Balancer {
+	return &smoothWeightBalancer{current: make(map[string]int)}
+}
+
 //
 // interface define and implemention
 //
@@ -37,6 +43,13 @@ type Item interface {
 	WeightN() int
 }
 
+// KeyItem is an Item with an uniq key, only used for smoothWeightBalancer
+// to track each item's current weight across the Next calls
+type KeyItem interface {
+	Item
+	Key() string
+}
+
 // note: when using rrBalancer, the items slice Size & Order should be fixed
 //
 // if item adding / removing occured during multi Next calls,
@@ -94,3 +107,52 @@ func (b *weightBalancer) Next(items []Item) Item {
 	}
 	return nil
 }
+
+// smooth weighted round-robin, the same as nginx upstream:
+// on each Next call, every item's current weight increases by its weight, the
+// item with the max current weight is selected and decreases by the weight sum
+//
+// note: only the KeyItem could be selected, the items could be changed during
+// multi Next calls, and the smoothWeightBalancer is safe for concurrent use
+type smoothWeightBalancer struct {
+	sync.Mutex
+	current map[string]int
+}
+
+func (b *smoothWeightBalancer) Next(items []Item) Item {
+	b.Lock()
+	defer b.Unlock()
+
+	var (
+		wsum int
+		best KeyItem
+	)
+	for _, item := range items {
+		kitem, ok := item.(KeyItem)
+		if !ok {
+			continue
+		}
+		val := kitem.WeightN()
+		if val < 0 {
+			val = -val
+		}
+		if val == 0 {
+			continue
+		}
+
+		key := kitem.Key()
+		b.current[key] += val
+		wsum += val
+		if best == nil || b.current[key] > b.current[best.Key()] {
+			best = kitem
+		}
+	}
+
+	// if all of weight value equals 0, return nil
+	if best == nil {
+		return nil
+	}
+
+	b.current[best.Key()] -= wsum
+	return best
+}
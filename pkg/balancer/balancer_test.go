@@ -0,0 +1,48 @@
+package balancer
+
+import (
+	"testing"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(balancerSuit))
+
+type balancerSuit struct{}
+
+func TestBalancer(t *testing.T) {
+	check.TestingT(t)
+}
+
+type node struct {
+	id     string
+	weight int
+}
+
+func (n *node) WeightN() int { return n.weight }
+func (n *node) Key() string  { return n.id }
+
+func (s *balancerSuit) TestSmoothWeight(c *check.C) {
+	var (
+		b     = NewSmoothWeight()
+		items = []Item{&node{"a", 5}, &node{"b", 1}, &node{"c", 1}, &node{"d", 0}}
+		got   []string
+	)
+	for i := 0; i < 7; i++ {
+		got = append(got, b.Next(items).(*node).id)
+	}
+	c.Assert(got, check.DeepEquals, []string{"a", "a", "b", "a", "c", "a", "a"})
+
+	// the next round is the same
+	got = got[:0]
+	for i := 0; i < 7; i++ {
+		got = append(got, b.Next(items).(*node).id)
+	}
+	c.Assert(got, check.DeepEquals, []string{"a", "a", "b", "a", "c", "a", "a"})
+}
+
+func (s *balancerSuit) TestSmoothWeightDisabled(c *check.C) {
+	b := NewSmoothWeight()
+	c.Assert(b.Next(nil), check.IsNil)
+	c.Assert(b.Next([]Item{&node{"a", 0}, &node{"b", 0}}), check.IsNil)
+}
@@ -72,6 +72,17 @@ func (o *Params) SetIgnoreNull(key, value string) {
 	o.Set(key, value)
 }
 
+// Join return the `key=value` pairs joined by `&` in the key ordering,
+// note: the values are escaped by Escape, so the separators within the
+// values can't make two different params joined as the same string
+func (o *Params) Join() string {
+	var pairs = make([]string, 0, o.Len())
+	for _, key := range o.Keys() {
+		pairs = append(pairs, key+"="+Escape(o.Get(key)))
+	}
+	return strings.Join(pairs, "&")
+}
+
 // implement sort.Interface
 func (o *Params) Len() int {
 	return len(o.keyOrdering)
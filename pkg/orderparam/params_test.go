@@ -0,0 +1,35 @@
+package orderparam
+
+import (
+	"testing"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(testSuit))
+
+type testSuit struct{}
+
+func TestAll(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *testSuit) TestJoin(c *check.C) {
+	params := New()
+	params.SetIgnoreNull("qrtype", "alipay")
+	params.SetIgnoreNull("attach", "")
+	params.SetIgnoreNull("fee", "19")
+	params.SetIgnoreNull("notify_url", "http://requestbin.net/ve1?a=1&b=2")
+	c.Assert(params.Join(), check.Equals, "fee=19&notify_url=http%3A%2F%2Frequestbin.net%2Fve1%3Fa%3D1%26b%3D2&qrtype=alipay")
+
+	// the separators within the values never make up another param
+	forged := New()
+	forged.Set("attach", "x&fee=1")
+	other := New()
+	other.Set("attach", "x")
+	other.Set("fee", "1")
+	c.Assert(forged.Join(), check.Not(check.Equals), other.Join())
+	c.Assert(forged.Join(), check.Equals, "attach=x%26fee%3D1")
+
+	c.Assert(Escape("a b*c~d-e_f.g"), check.Equals, "a%20b%2Ac%7Ed-e_f.g")
+}
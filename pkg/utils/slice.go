@@ -1,5 +1,7 @@
 package utils
 
+import "strings"
+
 // SliceContains check if a slice has given element
 func SliceContains(slice []string, ele string) bool {
 	for _, val := range slice {
@@ -37,3 +39,14 @@ func MakeUniq(slice []string) []string {
 	}
 	return slice[:len(m)]
 }
+
+// SplitNonEmpty split the given string by sep and drop the empty (after trimmed) elements
+func SplitNonEmpty(s, sep string) []string {
+	var ret []string
+	for _, val := range strings.Split(s, sep) {
+		if val = strings.TrimSpace(val); val != "" {
+			ret = append(ret, val)
+		}
+	}
+	return ret
+}
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Truncate truncate given string to maximum given length
@@ -14,6 +15,32 @@ func Truncate(s string, maxLen int) string {
 	return s
 }
 
+// TruncateUTF8 truncate given string to maximum given bytes on the rune boundary,
+// the invalid utf8 bytes are dropped
+func TruncateUTF8(s string, maxLen int) string {
+	var (
+		buf       = make([]byte, 0, len(s))
+		truncated bool
+	)
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError && size == 1 {
+			s = s[size:] // invalid byte, drop it
+			continue
+		}
+		if len(buf)+size > maxLen {
+			truncated = true
+			break
+		}
+		buf = append(buf, s[:size]...)
+		s = s[size:]
+	}
+	if truncated {
+		return string(buf) + " ..."
+	}
+	return string(buf)
+}
+
 // StripSpaces remove all white chars in the given string
 func StripSpaces(s string) string {
 	return strings.Map(func(r rune) rune {
@@ -0,0 +1,64 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(xlsxSuite))
+
+type xlsxSuite struct{}
+
+func TestXLSX(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *xlsxSuite) TestCellRef(c *check.C) {
+	for col, expect := range map[int]string{0: "A1", 25: "Z1", 26: "AA1", 51: "AZ1", 52: "BA1", 701: "ZZ1", 702: "AAA1"} {
+		c.Assert(cellRef(col, 1), check.Equals, expect)
+	}
+}
+
+func (s *xlsxSuite) TestWriter(c *check.C) {
+	buf := bytes.NewBuffer(nil)
+
+	w, err := NewWriter(buf, "orders & bills")
+	c.Assert(err, check.IsNil)
+	c.Assert(w.Write([]interface{}{"id", "fee", "rate", "paid", "at"}), check.IsNil)
+	c.Assert(w.Write([]interface{}{"<a1>", 100, 0.5, true, time.Date(2019, 6, 10, 11, 42, 1, 0, time.Local)}), check.IsNil)
+	c.Assert(w.Write([]interface{}{nil, int64(7)}), check.IsNil)
+	c.Assert(w.Close(), check.IsNil)
+	c.Assert(w.Write([]interface{}{"x"}), check.NotNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, check.IsNil)
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		c.Assert(err, check.IsNil)
+		bs, err := ioutil.ReadAll(rc)
+		rc.Close()
+		c.Assert(err, check.IsNil)
+		parts[f.Name] = string(bs)
+	}
+	c.Assert(parts, check.HasLen, 5)
+	c.Assert(strings.Contains(parts["xl/workbook.xml"], `name="orders &amp; bills"`), check.Equals, true)
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, expect := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t>id</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t>&lt;a1&gt;</t></is></c><c r="B2"><v>100</v></c><c r="C2"><v>0.5</v></c><c r="D2" t="b"><v>1</v></c>`,
+		`<c r="E2" t="inlineStr"><is><t>2019-06-10 11:42:01</t></is></c>`,
+		`<row r="3"><c r="B3"><v>7</v></c></row>`,
+		`</sheetData></worksheet>`,
+	} {
+		c.Assert(strings.Contains(sheet, expect), check.Equals, true, check.Commentf(expect))
+	}
+}
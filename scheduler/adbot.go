@@ -7,14 +7,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
-	"strings"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bbklab/adbot/pkg/adbot"
-	"github.com/bbklab/adbot/pkg/balancer"
 	"github.com/bbklab/adbot/pkg/mole"
 	"github.com/bbklab/adbot/pkg/qrcode"
 	"github.com/bbklab/adbot/pkg/utils"
@@ -22,100 +21,61 @@ import (
 	"github.com/bbklab/adbot/types"
 )
 
-var (
-	errSignError = errors.New("signature error")
-)
-
-var (
-	// failure retry interval for sending our callback
-	sendFailureRetry = []time.Duration{
-		time.Second * 10,  // 10s
-		time.Second * 30,  // 30s
-		time.Second * 120, // 2m
-		time.Second * 300, // 5m
-		time.Second * 900, // 15m
-	}
-)
-
-// VerifySignature verify the given request
-func VerifySignature(key string, data interface{}) error {
-	switch req := data.(type) {
-	case nil:
-		return errors.New("nil data for signature verify")
-
-	case *types.NewAdbOrderReq:
-		var expect = sign(key, req.StringToSign())
-		if req.Sign != expect {
-			return errSignError
-		}
-
-	default:
-		return errors.New("unexpected data type for signature verify")
-	}
-	return nil
-}
-
-func sign(key, data string) string {
-	return strings.ToUpper(utils.Md5sum([]byte(strings.TrimSpace(data + "&key=" + key))))
-}
-
-// SubscribeAdbOrderAndSendCallback subscribe wait given adb order's callback until timeout and
-// send our callback to adb order's NotifyURL according by given failure retry interval
+// SubscribeAdbOrderAndSendCallback subscribe wait given adb order's callback until the order ttl
+// timeout and put our callback into the db delivery queue, the leader will send it to adb order's
+// NotifyURL with the failure retries
 //
 // note: this may take a long time
 func SubscribeAdbOrderAndSendCallback(orderID string) {
 	RegisterGoroutine("adb_order_callback", orderID)
 	defer DeRegisterGoroutine("adb_order_callback", orderID)
 
-	// wait adb order callback event
-	err := SubscribeAdbOrderCallbackEvent(orderID, types.AdbOrderTimeout)
+	order, err := store.DB().GetAdbOrder(orderID)
 	if err != nil {
-		MemoAdbOrderStatus(orderID, types.AdbOrderStatusTimeout)
+		log.Errorf("subscribe adb order %s callback error: %v", orderID, err)
 		return
 	}
 
-	// now got callback! send our callback
-	MemoAdbOrderCallbackStatus(orderID, types.AdbOrderCallbackStatusOngoing)
-	err = SendAdbOrderCallback(orderID, sendFailureRetry)
+	// wait adb order callback event
+	err = SubscribeAdbOrderCallbackEvent(orderID, time.Until(order.Deadline()))
+	if err == errAdbOrderClosed {
+		return // closed by the merchant, no callback
+	}
 	if err != nil {
-		MemoAdbOrderCallbackStatus(orderID, types.AdbOrderCallbackStatusError) // see callback history
-		return
+		err = TransitAdbOrderStatus(orderID, types.AdbOrderStatusPending, types.AdbOrderStatusTimeout, "payment waiting timeout")
+		if err == nil {
+			return
+		}
+		// note: the order maybe paid just after the waiting timeout, queue its callback as well,
+		// except the manual overridden ones, their callbacks are decided by the operator
+		if order, _ := store.DB().GetAdbOrder(orderID); order == nil || order.Status != types.AdbOrderStatusPaid || len(order.Overrides) > 0 {
+			return
+		}
 	}
-	MemoAdbOrderCallbackStatus(orderID, types.AdbOrderCallbackStatusSucceed)
-}
-
-// BootupReCallbackAbortedAdbOrders is called while bootup to
-// re-sending callback for aborted adb order callback
-//
-// note: this may take a long time
-func BootupReCallbackAbortedAdbOrders(orders []*types.AdbOrder) {
-	for _, order := range orders {
-		log.Printf("boot up recallback aborted adb order %s", order.ID)
 
-		MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusOngoing)
-		err := SendAdbOrderCallback(order.ID, sendFailureRetry)
-		if err != nil {
-			MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusError) // see callback history
-			continue
-		}
-		MemoAdbOrderCallbackStatus(order.ID, types.AdbOrderCallbackStatusSucceed)
+	// now got callback! queue our callback
+	if err := EnqueueAdbOrderCallback(orderID); err != nil {
+		log.Errorf("queue adb order %s callback error: %v", orderID, err)
 	}
 }
 
-// SendAdbOrderCallback send given adb order's callback with given retry interval
-//
-// note: this may take a long time
-func SendAdbOrderCallback(orderID string, retryInterval []time.Duration) error {
+// SendAdbOrderCallback send given adb order's callback once, without any retry
+func SendAdbOrderCallback(orderID string) error {
 	// status must has already been memo update the db adb order
 	order, err := store.DB().GetAdbOrder(orderID)
 	if err != nil {
 		return err
 	}
+	return sendAdbOrderCallbackOnce(order)
+}
 
+// send the adb order's callback once and memo the callback history
+func sendAdbOrderCallbackOnce(order *types.AdbOrder) error {
 	// skip if notify url not provided
 	notifyURL := order.NotifyURL
 	if notifyURL == "" {
 		log.Printf("adb order %s notify url not provided, skip sending callback", order.ID)
+		AppendAdbOrderEvents(order.ID, types.NewAdbOrderEvent(types.AdbOrderEventCallback, "skipped, notify url not provided"))
 		return nil
 	}
 
@@ -124,53 +84,129 @@ func SendAdbOrderCallback(orderID string, retryInterval []time.Duration) error {
 	if err != nil {
 		return err
 	}
-	MemoAdbOrderCallback(orderID, callback)
+	MemoAdbOrderCallback(order.ID, callback)
 
-	// send once
-	err = sendCallbackOnce(notifyURL, callback)
-	if err == nil { // succeed, return
-		AppendAdbOrderCallbackHistory(orderID, "")
-		return nil
-	}
-	AppendAdbOrderCallbackHistory(orderID, err.Error())
-
-	// failed, retry
-	for _, timeout := range retryInterval {
-		time.Sleep(timeout)
-		err = sendCallbackOnce(notifyURL, callback)
-		if err == nil {
-			AppendAdbOrderCallbackHistory(orderID, "")
-			return nil
-		}
-		AppendAdbOrderCallbackHistory(orderID, err.Error())
+	startAt := time.Now()
+	code, body, err := sendCallbackOnce(notifyURL, callback)
+	AppendAdbOrderEvents(order.ID, newAdbOrderCallbackEvent(notifyURL, code, body, time.Since(startAt), err))
+	if err != nil {
+		AppendAdbOrderCallbackHistory(order.ID, err.Error())
+		return err
 	}
-
-	return err // final failed, no more retry
+	AppendAdbOrderCallbackHistory(order.ID, "")
+	return nil
 }
 
-// construct our callback
+// construct our callback with a fresh signature
 func genCallbackOfAdbOrder(order *types.AdbOrder) (*types.NewAdbOrderCallback, error) {
 	if order.Status != types.AdbOrderStatusPaid {
 		return nil, errors.New("can't generate callback for `un-paid` order")
 	}
 
-	// note: in fact the same signature algoritmo with the request
-	// so we don't need to re-caculate the callback signature
-	// key := settings.GlobalAttrs.Get(types.GlobalAttrPaygateSecretKey)
-	// sign := sign(key, fmt.Sprintf("out_order_id=%s&fee=%d", order.OutOrderID, order.Fee))
-	sign := order.Sign
+	merchant, err := adbOrderMerchant(order)
+	if err != nil {
+		return nil, fmt.Errorf("merchant of the order: %v", err)
+	}
 
-	return &types.NewAdbOrderCallback{
+	cb := &types.NewAdbOrderCallback{
 		Code:       1,
+		AppID:      order.AppID,
+		OrderID:    order.ID,
 		OutOrderID: order.OutOrderID,
 		Fee:        order.Fee,
+		PayFee:     order.Payable(),
 		Attach:     order.Attach,
-		Sign:       sign,
+		Status:     order.Status,
+		PaidAt:     order.PaidAt.Unix(),
 		Time:       time.Now(),
-	}, nil
+	}
+	signCallback(merchant, order.SignType, cb)
+	return cb, nil
+}
+
+// PaygateAdbOrder lookup the merchant's adb order by the order id or out order id
+func PaygateAdbOrder(merchant *types.Merchant, orderID, outOrderID string) (*types.AdbOrder, error) {
+	query := bson.M{"merchant_id": MerchantAdbOrdersFilter(merchant.ID)}
+	if orderID != "" {
+		query["id"] = orderID
+	}
+	if outOrderID != "" {
+		query["out_order_id"] = outOrderID
+	}
+
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors.New("adb order not found")
+	}
+	return orders[0], nil
+}
+
+// CloseAdbOrder close the pending adb order before paid, the order no longer occupies
+// the device slot and its callback event waitting is stopped at once
+func CloseAdbOrder(order *types.AdbOrder) error {
+	if order.Status != types.AdbOrderStatusPending {
+		return fmt.Errorf("only pending adb order could be closed, current status: %s", order.Status)
+	}
+
+	// note: maybe paid or timeout concurrently, the transition only succeed while still pending
+	if err := TransitAdbOrderStatus(order.ID, types.AdbOrderStatusPending, types.AdbOrderStatusClosed, "closed by the merchant"); err != nil {
+		return err
+	}
+	PublishAdbOrderClosedEvent(order.ID)
+	return nil
+}
+
+// GenPaygateOrderResp generate the signed paygate response of the merchant's adb order
+func GenPaygateOrderResp(merchant *types.Merchant, order *types.AdbOrder) *types.PaygateOrderResp {
+	resp := &types.PaygateOrderResp{
+		Code:       1,
+		AppID:      order.AppID,
+		OrderID:    order.ID,
+		OutOrderID: order.OutOrderID,
+		QRType:     order.QRType,
+		Fee:        order.Fee,
+		FeeYuan:    float64(order.Fee) / float64(100),
+		PayFee:     order.Payable(),
+		Attach:     order.Attach,
+		Status:     order.Status,
+		CreatedAt:  order.CreatedAt.Unix(),
+		ExpireAt:   order.Deadline().Unix(),
+	}
+	if !order.PaidAt.IsZero() {
+		resp.PaidAt = order.PaidAt.Unix()
+	}
+	if !order.ClosedAt.IsZero() {
+		resp.ClosedAt = order.ClosedAt.Unix()
+	}
+	signPaygateOrderResp(merchant.Secret, resp)
+	return resp
 }
 
-func sendCallbackOnce(url string, cb *types.NewAdbOrderCallback) error {
+// the lifecycle event of one callback delivery attempt, with the truncated response body
+func newAdbOrderCallbackEvent(url string, code int, body string, latency time.Duration, err error) *types.AdbOrderEvent {
+	message := "succeed"
+	if err != nil {
+		message = err.Error()
+	}
+
+	var status string
+	if code > 0 {
+		status = strconv.Itoa(code)
+	}
+
+	return types.NewAdbOrderEvent(types.AdbOrderEventCallback, message,
+		"url", url,
+		"http_status", status,
+		"latency_ms", strconv.FormatInt(int64(latency/time.Millisecond), 10),
+		"body", utils.TruncateUTF8(body, types.AdbOrderEventBodyMax),
+	)
+}
+
+// send the callback once, return the http status code & the response body
+func sendCallbackOnce(url string, cb *types.NewAdbOrderCallback) (int, string, error) {
 	var (
 		cbbs, _ = json.Marshal(cb)
 		ctype   = "application/json; charset=UTF-8"
@@ -178,26 +214,32 @@ func sendCallbackOnce(url string, cb *types.NewAdbOrderCallback) error {
 
 	resp, err := utils.InsecureHTTPClient().Post(url, ctype, bytes.NewBuffer(cbbs))
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	bs, _ := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 
 	if code := resp.StatusCode; code != 200 {
-		return fmt.Errorf("%d - %s", code, utils.Truncate(string(bs), 20))
+		return code, string(bs), fmt.Errorf("%d - %s", code, utils.Truncate(string(bs), 20))
 	}
 
-	return nil
+	return resp.StatusCode, string(bs), nil
 }
 
-// SmartPickupAdbDevice pick up an avaliable device from all of adb devices
-func SmartPickupAdbDevice(req *types.NewAdbOrderReq) (*types.AdbDevice, error) {
+// SmartPickupAdbDevice pick up an avaliable device from the merchant's device pool
+// by the pickup strategy, and return the pickup decision trace
+func SmartPickupAdbDevice(merchant *types.Merchant, req *types.NewAdbOrderReq) (*types.AdbDevice, *types.AdbDevicePickup, error) {
 	// list sutiable adb devices
 	query := bson.M{
 		"status":     types.AdbDeviceStatusOnline, // only online devices
 		"weight":     bson.M{"$gt": 0},            // only weight > 0 devices
 		"over_quota": false,                       // only not over-quoted devices
 	}
+	if len(merchant.Devices) > 0 {
+		query["id"] = bson.M{"$in": merchant.Devices} // dedicated pool
+	} else if dedicated := dedicatedAdbDevices(); len(dedicated) > 0 {
+		query["id"] = bson.M{"$nin": dedicated} // shared pool
+	}
 	switch req.QRType {
 	case types.QRCodeTypeAlipay:
 		query["alipay"] = bson.M{"$ne": nil}
@@ -206,23 +248,11 @@ func SmartPickupAdbDevice(req *types.NewAdbOrderReq) (*types.AdbDevice, error) {
 	}
 	dvcs, _ := store.DB().ListAdbDevices(nil, query)
 	if len(dvcs) == 0 {
-		return nil, errors.New("no available adb devices")
-	}
-
-	// pick up one from device list by weight balancer
-	var (
-		wb    = balancer.NewWeight()
-		items = make([]balancer.Item, len(dvcs))
-	)
-	for idx, dvc := range dvcs {
-		items[idx] = dvc
-	}
-	next := wb.Next(items)
-	if next == nil {
-		return nil, errors.New("can't select a adb device by weight balancer")
+		return nil, nil, errors.New("no available adb devices")
 	}
 
-	return next.(*types.AdbDevice), nil
+	// pick up one from device list by the pickup strategy
+	return pickupAdbDevice(merchant, req, dvcs)
 }
 
 // GenAdbpayQrCode generate qrcode for given adb device
@@ -255,6 +285,14 @@ func GenAdbpayQrCode(dvcid, typ string, fee int, comment string) ([]byte, string
 		if wxpay == nil {
 			return nil, "", errors.New("device hasn't bind any wxpay account yet")
 		}
+
+		// the wxpay qrcode could only be generated by the wechat app on the device,
+		// the qrcode text is unknown as the png is cropped from the device screen
+		qrpng, err := DoNodeGenAdbPayQrCode(dvc.NodeID, dvc.ID, typ, fee, comment)
+		if err != nil {
+			return nil, "", err
+		}
+		return qrpng, "", nil
 	}
 
 	return nil, "", errors.New("unsupported qrcode type")
@@ -318,7 +356,7 @@ func countAdbDeviceTodayPaidOrders(dvcID string) (int, int) {
 		start, end = utils.Today()
 		query      = bson.M{
 			"device_id": dvcID,
-			"status":    types.AdbOrderStatusPaid,
+			"status":    bson.M{"$in": []string{types.AdbOrderStatusPaid, types.AdbOrderStatusPaidAfterTimeout}}, // received
 			"$and":      []bson.M{{"created_at": bson.M{"$gt": start}}, {"created_at": bson.M{"$lt": end}}},
 		}
 	)
@@ -490,7 +528,13 @@ func RunAdbEventWatcherLoop() {
 			MemoAdbDeviceStatus(dvcid, types.AdbDeviceStatusOffline, "adb device offline event")
 		case adbot.AdbEventDeviceAlive:
 			MemoAdbDeviceStatus(dvcid, types.AdbDeviceStatusOnline, "")
-		case adbot.AdbEventAlipayOrder:
+		case adbot.AdbEventPayOrder:
+			// recognized payment notice, match the pending orders without UI searching
+			if notice := adbev.Notice; notice != nil && notice.Fee() > 0 {
+				matchDevicePayNotice(dvcid, notice)
+				continue
+			}
+			// NOOP event or unrecognized notice, UI searching the aged pending orders in case of missing notice
 			if !IsRegisteredGoRoutine("check_adb_device_pending_orders", dvcid) {
 				go checkDevicePendingOrders(dvcid)
 			}
@@ -498,50 +542,242 @@ func RunAdbEventWatcherLoop() {
 	}
 }
 
-// note: only check pending orders within 5 minutes
+// match the payment notice against the device pending orders by the payment app & payable amount,
+// only fall back to UI searching while more than one pending orders matched
+func matchDevicePayNotice(dvcid string, notice *adbot.PayNotice) {
+	query := bson.M{
+		"device_id": dvcid,
+		"status":    types.AdbOrderStatusPending,
+		"qrtype":    notice.App,
+		"$or": []bson.M{
+			{"pay_fee": notice.Fee()},
+			{"pay_fee": bson.M{"$in": []interface{}{nil, 0}}, "fee": notice.Fee()}, // legacy orders without pay fee
+		},
+	}
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		log.Errorf("query pending adb orders for device %s notice [%s] error: %v", dvcid, notice.Message, err)
+		return
+	}
+
+	switch n := len(orders); n {
+	case 0:
+		log.Warnf("no pending adb order on device %s matched the notice [%s]", dvcid, notice.Message)
+		matchDeviceLatePayNotice(dvcid, notice)
+	case 1:
+		log.Infof("adb order %s on device %s matched the notice [%s]", orders[0].ID, dvcid, notice.Message)
+		AppendAdbOrderEvents(orders[0].ID, newAdbOrderNoticeEvent(dvcid, notice, 1))
+		memoAdbOrderPaid(orders[0].ID)
+	default:
+		log.Warnf("%d pending adb orders on device %s matched the notice [%s], fall back to UI searching", n, dvcid, notice.Message)
+		for _, order := range orders {
+			AppendAdbOrderEvents(order.ID, newAdbOrderNoticeEvent(dvcid, notice, n))
+		}
+		go checkAdbOrdersOnDevice(orders)
+	}
+}
+
+// match the payment notice against the device recent timeout orders, the only matched one
+// is marked as paid after timeout without callback, waiting for the operator
+func matchDeviceLatePayNotice(dvcid string, notice *adbot.PayNotice) {
+	query := bson.M{
+		"device_id":  dvcid,
+		"status":     types.AdbOrderStatusTimeout,
+		"qrtype":     notice.App,
+		"created_at": bson.M{"$gt": time.Now().Add(-types.AdbOrderLatePaymentWindow)},
+		"$or": []bson.M{
+			{"pay_fee": notice.Fee()},
+			{"pay_fee": bson.M{"$in": []interface{}{nil, 0}}, "fee": notice.Fee()}, // legacy orders without pay fee
+		},
+	}
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		log.Errorf("query timeout adb orders for device %s notice [%s] error: %v", dvcid, notice.Message, err)
+		return
+	}
+
+	switch n := len(orders); n {
+	case 0:
+	case 1:
+		log.Warnf("timeout adb order %s on device %s matched the late notice [%s]", orders[0].ID, dvcid, notice.Message)
+		AppendAdbOrderEvents(orders[0].ID, newAdbOrderNoticeEvent(dvcid, notice, 1))
+		memoAdbOrderPaid(orders[0].ID)
+	default:
+		log.Warnf("%d timeout adb orders on device %s matched the late notice [%s], leave to the operator", n, dvcid, notice.Message)
+		for _, order := range orders {
+			AppendAdbOrderEvents(order.ID, newAdbOrderNoticeEvent(dvcid, notice, n))
+		}
+	}
+}
+
+// the lifecycle event of the payment notice matched with the other `matched-1` orders
+func newAdbOrderNoticeEvent(dvcid string, notice *adbot.PayNotice, matched int) *types.AdbOrderEvent {
+	return types.NewAdbOrderEvent(types.AdbOrderEventNoticeMatched, notice.Message,
+		"device_id", dvcid,
+		"app", notice.App,
+		"amount", notice.Amount,
+		"payer", notice.Payer,
+		"received_at", notice.Time.Format(time.RFC3339),
+		"matched", strconv.Itoa(matched),
+	)
+}
+
+// note: only check pending orders created before `AdbOrderNoticeWait` and not expired yet,
+// the younger ones are expected to be confirmed by the payment notice, the expired ones are
+// left to the timeout
 func checkDevicePendingOrders(dvcid string) {
 	RegisterGoroutine("check_adb_device_pending_orders", dvcid)
 	defer DeRegisterGoroutine("check_adb_device_pending_orders", dvcid)
 
 	// query device pending orders
-	query := bson.M{"device_id": dvcid, "status": types.AdbOrderStatusPending}
+	var (
+		now   = time.Now()
+		query = bson.M{
+			"device_id":  dvcid,
+			"status":     types.AdbOrderStatusPending,
+			"created_at": bson.M{"$lt": now.Add(-types.AdbOrderNoticeWait)},
+		}
+	)
 	orders, err := store.DB().ListAdbOrders(nil, query)
 	if err != nil {
 		log.Errorf("query pending adb orders for device %s error: %v", dvcid, err)
 		return
 	}
 
+	var unexpired []*types.AdbOrder
 	for _, order := range orders {
-		nid, dvcid, orderid := order.NodeID, order.DeviceID, order.ID
-		_, err := DoNodeCheckAdbOrder(nid, dvcid, orderid)
+		if order.Deadline().After(now) {
+			unexpired = append(unexpired, order)
+		}
+	}
+
+	checkAdbOrdersOnDevice(unexpired)
+}
+
+// SweepExpiredAdbOrders mark the pending adb orders expired for more than the grace as timeout,
+// the orders are normally timeout by their callback waitting, the sweeper only catches the orphan
+// ones whose waitting was lost, eg: by restart
+func SweepExpiredAdbOrders(grace time.Duration) int {
+	var (
+		before = time.Now().Add(-grace)
+		query  = bson.M{
+			"status": types.AdbOrderStatusPending,
+			"$or": []bson.M{
+				{"expire_at": bson.M{"$lt": before, "$gt": time.Time{}}},
+				{"expire_at": bson.M{"$in": []interface{}{nil, time.Time{}}}, "created_at": bson.M{"$lt": before.Add(-types.AdbOrderTimeout)}}, // legacy orders without the expire time
+			},
+		}
+	)
+
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		log.Errorf("query expired pending adb orders error: %v", err)
+		return 0
+	}
+
+	var num int
+	for _, order := range orders {
+		if err := TransitAdbOrderStatus(order.ID, types.AdbOrderStatusPending, types.AdbOrderStatusTimeout, "payment waiting timeout, swept"); err == nil {
+			num++
+		}
+	}
+	return num
+}
+
+// sweep the orphan expired pending orders, triggered by the cron daemon on the leader
+func sweepExpiredAdbOrders() {
+	if !isLeader() {
+		return
+	}
+	if num := SweepExpiredAdbOrders(types.AdbOrderSweepGrace); num > 0 {
+		log.Warnf("swept %d orphan expired pending adb orders as timeout", num)
+	}
+}
+
+// search the orders one by one on the node adb device
+func checkAdbOrdersOnDevice(orders []*types.AdbOrder) {
+	for _, order := range orders {
+		var (
+			nid, dvcid, orderid = order.NodeID, order.DeviceID, order.ID
+		)
+		// the payment app driver on the device is the same as the order qrcode type
+		bill, err := DoNodeCheckAdbOrder(nid, dvcid, order.QRType, orderid)
 		if err != nil {
 			log.Warnf("query node %s adb device %s order %s error: %v", nid, dvcid, orderid, err)
+			AppendAdbOrderEvents(orderid, types.NewAdbOrderEvent(types.AdbOrderEventDeviceCheck, err.Error(), "node_id", nid, "device_id", dvcid, "result", "not found"))
 			continue
 		}
-		// now we got the order on node adb device, then
-		//  - memo update the node status as paid
-		//  - publish adb event -> triger sending order callback
-		MemoAdbOrderStatus(order.ID, types.AdbOrderStatusPaid)
-		PublishAdbOrderCallbackEvent(order.ID)
+		evs := []*types.AdbOrderEvent{types.NewAdbOrderEvent(types.AdbOrderEventDeviceCheck, "payment found", "node_id", nid, "device_id", dvcid, "result", "found")}
+		if bill != nil {
+			evs = append(evs, types.NewAdbOrderEvent(types.AdbOrderEventBillMatched, bill.Comment,
+				"account", bill.Account, "amount", bill.Amount, "paid_at", bill.Time))
+		}
+		AppendAdbOrderEvents(orderid, evs...)
+		memoAdbOrderPaid(order.ID)
 	}
 }
 
+// now we got the order paid, then
+//   - transit the pending order status as paid
+//   - publish adb event -> triger sending order callback
+// or the late payment of the timeout order
+//   - transit the timeout order status as paid after timeout, without callback
+// the others (eg: closed, already paid) are rejected and audited
+func memoAdbOrderPaid(orderID string) {
+	order, err := store.DB().GetAdbOrder(orderID)
+	if err != nil {
+		log.Errorf("memo adb order %s paid error: %v", orderID, err)
+		return
+	}
+
+	if order.Status == types.AdbOrderStatusPending {
+		err = TransitAdbOrderStatus(orderID, types.AdbOrderStatusPending, types.AdbOrderStatusPaid, "payment confirmed")
+		if err == nil {
+			PublishAdbOrderCallbackEvent(orderID)
+			return
+		}
+		// maybe timeout just now, re-check the current status
+		if order, err = store.DB().GetAdbOrder(orderID); err != nil {
+			return
+		}
+	}
+
+	if order.Status == types.AdbOrderStatusTimeout {
+		err = TransitAdbOrderStatus(orderID, types.AdbOrderStatusTimeout, types.AdbOrderStatusPaidAfterTimeout, "payment confirmed after timeout")
+		if err == nil {
+			log.Warnf("adb order %s paid after timeout, waiting for the operator", orderID)
+		}
+		return
+	}
+
+	TransitAdbOrderStatus(orderID, order.Status, types.AdbOrderStatusPaid, "payment confirmed") // rejected & audited
+}
+
 // EnsureAdbDeviceIdle check adb device to ensure the given device
 //  - weight=0
-//  - pending orders count = 0
+//  - pending orders & holding timeout orders count = 0
 func EnsureAdbDeviceIdle(dvc *types.AdbDevice) error {
 	if dvc.Weight > 0 {
 		return errors.New("device inusing, pls first disable this device by set weight = 0")
 	}
 
-	query := bson.M{"device_id": dvc.ID, "status": types.AdbOrderStatusPending}
+	query := bson.M{"device_id": dvc.ID, "$or": adbDeviceBusyOrdersFilter(time.Now())}
 	if orders, _ := store.DB().ListAdbOrders(nil, query); len(orders) > 0 {
-		return fmt.Errorf("device locked by %d related pending orders", len(orders))
+		return fmt.Errorf("device locked by %d related pending or holding orders", len(orders))
 	}
 
 	return nil
 }
 
+// the db adb orders query conditions of the orders keeping the device busy: the pending orders
+// and the timeout orders still holding their payable amounts within the device hold
+func adbDeviceBusyOrdersFilter(now time.Time) []bson.M {
+	return []bson.M{
+		{"status": types.AdbOrderStatusPending},
+		{"status": types.AdbOrderStatusTimeout, "hold_until": bson.M{"$gt": now}},
+	}
+}
+
 //
 // AdbNode ReFresh Notifier Manager
 //
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+//  Adb Order Callback Delivery Queue
+//
+//  the ongoing callbacks are queued in the db adb orders with the next attempt time,
+//  the leader claims the due callbacks with a lease and sends them by bounded workers,
+//  the failed one is re-scheduled by the merchant backoff, and becomes a dead letter
+//  after all of the retries failed.
+//
+//  the lease is longer than the callback http timeout, so neither the restarted
+//  master nor the new leader could claim and re-send an in-flight callback.
+//
+
+var (
+	callbackQueuePoll   = time.Second * 3
+	callbackQueueWakeup = make(chan struct{}, 1)
+)
+
+// EnqueueAdbOrderCallback put the adb order's fresh callback into the delivery queue to be sent at once
+func EnqueueAdbOrderCallback(orderID string) error {
+	from := []string{types.AdbOrderCallbackStatusNone}
+	if err := resetAdbOrderCallback(orderID, from, "callback queued"); err != nil {
+		return err
+	}
+	wakeupAdbOrderCallbackQueue()
+	return nil
+}
+
+// RequeueAdbOrderCallback put the adb order's ongoing & aborted callback (by restart)
+// into the delivery queue again
+func RequeueAdbOrderCallback(orderID string) error {
+	from := []string{types.AdbOrderCallbackStatusOngoing, types.AdbOrderCallbackStatusAborted, types.AdbOrderCallbackStatusManual}
+	if err := resetAdbOrderCallback(orderID, from, "callback re-queued while restart"); err != nil {
+		return err
+	}
+	wakeupAdbOrderCallbackQueue()
+	return nil
+}
+
+// ReplayAdbOrderCallbacks re-queue the given dead letter callbacks, or all of dead letters if all,
+// return the re-queued adb order ids
+func ReplayAdbOrderCallbacks(all bool, orderIDs []string) ([]string, error) {
+	query := bson.M{"callback_status": bson.M{"$in": types.AdbOrderCallbackDeadStatuses}}
+	if !all {
+		if len(orderIDs) == 0 {
+			return nil, errors.New("at least one order id required")
+		}
+		query["id"] = bson.M{"$in": orderIDs}
+	}
+
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	if !all && len(orders) == 0 {
+		return nil, errors.New("dead letter callback not found")
+	}
+
+	ret := make([]string, 0, len(orders))
+	for _, order := range orders {
+		// note: skip the ones replayed by others concurrently
+		if err := resetAdbOrderCallback(order.ID, types.AdbOrderCallbackDeadStatuses, "callback replayed"); err != nil {
+			continue
+		}
+		AppendAdbOrderCallbackHistory(order.ID, "callback replayed")
+		ret = append(ret, order.ID)
+	}
+
+	if len(ret) > 0 {
+		wakeupAdbOrderCallbackQueue()
+	}
+	return ret, nil
+}
+
+// reset the callback delivery state as a fresh ongoing one, only if it's still one of `from`
+func resetAdbOrderCallback(orderID string, from []string, reason string) error {
+	set := bson.M{
+		"callback_tries":    0,
+		"callback_next_at":  time.Now(),
+		"callback_lease":    "",
+		"callback_lease_at": time.Time{},
+	}
+	return TransitAdbOrderCallbackStatus(orderID, from, types.AdbOrderCallbackStatusOngoing, reason, set)
+}
+
+// ReCallbackAdbOrder send the paid adb order's callback once manually, without any retry,
+// the concurrent manual re-callbacks or the queued one are rejected
+func ReCallbackAdbOrder(order *types.AdbOrder) error {
+	from := []string{order.CallbackStatus}
+	if err := TransitAdbOrderCallbackStatus(order.ID, from, types.AdbOrderCallbackStatusManual, "manual re-callback", nil); err != nil {
+		return err
+	}
+
+	if err := SendAdbOrderCallback(order.ID); err != nil {
+		TransitAdbOrderCallbackStatus(order.ID, []string{types.AdbOrderCallbackStatusManual}, types.AdbOrderCallbackStatusDead, "manual re-callback failed", nil) // see callback history
+		return err
+	}
+	return TransitAdbOrderCallbackStatus(order.ID, []string{types.AdbOrderCallbackStatusManual}, types.AdbOrderCallbackStatusSucceed, "manual re-callback succeed", nil)
+}
+
+func wakeupAdbOrderCallbackQueue() {
+	select {
+	case callbackQueueWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// RunAdbOrderCallbackQueueLoop claim the due callbacks from the delivery queue and
+// send them with bounded concurrency while we're the leader
+func RunAdbOrderCallbackQueueLoop() {
+	var (
+		loopName = fmt.Sprintf("adb order callback delivery queue loop")
+	)
+
+	RegisterGoroutine("adb_order_callback_queue", "system")
+	defer DeRegisterGoroutine("adb_order_callback_queue", "system")
+
+	log.Printf("starting %s ...", loopName)
+	defer log.Warnf("stopped %s, this should never happen", loopName)
+
+	var (
+		ticker  = time.NewTicker(callbackQueuePoll)
+		workers = make(chan struct{}, types.AdbOrderCallbackWorkers)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-callbackQueueWakeup:
+		}
+
+		// drain all of the due callbacks
+		claim := func(lease string) (*types.AdbOrder, error) {
+			return store.DB().ClaimAdbOrderCallback(lease, types.AdbOrderCallbackLease)
+		}
+		err := drainAdbOrderCallbacks(workers, isLeader, claim, deliverAdbOrderCallback)
+		if err != nil && !store.DB().ErrNotFound(err) {
+			log.Errorln("claim adb order callback error:", err)
+		}
+	}
+}
+
+// claim the due callbacks one by one with a new lease each, and dispatch them to the
+// bounded workers, until none due, the claim failed or we're not the leader any more
+func drainAdbOrderCallbacks(workers chan struct{}, leader func() bool, claim func(lease string) (*types.AdbOrder, error), deliver func(*types.AdbOrder)) error {
+	for leader() {
+		workers <- struct{}{}
+
+		order, err := claim(utils.RandomString(16))
+		if err != nil {
+			<-workers
+			return err
+		}
+
+		go func(order *types.AdbOrder) {
+			defer func() { <-workers }()
+			deliver(order)
+		}(order)
+	}
+	return nil
+}
+
+// send the claimed callback once and re-schedule it by the backoff if failed
+func deliverAdbOrderCallback(order *types.AdbOrder) {
+	var (
+		err = sendAdbOrderCallbackOnce(order)
+		set = adbOrderCallbackDelivered(order, err, adbOrderCallbackBackoff(order), time.Now())
+	)
+
+	if set["callback_status"] == types.AdbOrderCallbackStatusDead {
+		log.Warnf("adb order %s callback failed after %d tries, moved to dead letters: %v", order.ID, set["callback_tries"], err)
+	}
+
+	// note: if the lease lost (expired & claimed by another one), leave it to the new lease holder
+	if err := store.DB().UpdateLeasedAdbOrder(order.ID, order.CallbackLease, bson.M{"$set": set}); err != nil {
+		log.Warnf("memo adb order %s callback delivery error: %v", order.ID, err)
+	}
+}
+
+// the callback delivery state after the claimed attempt, the lease is released:
+// succeed, re-scheduled by the backoff, or moved to the dead letters after all of the retries failed
+func adbOrderCallbackDelivered(order *types.AdbOrder, err error, backoff []time.Duration, now time.Time) bson.M {
+	var (
+		tries = order.CallbackTries + 1
+		set   = bson.M{
+			"callback_tries":    tries,
+			"callback_lease":    "",
+			"callback_lease_at": time.Time{},
+		}
+	)
+
+	switch {
+	case err == nil:
+		set["callback_status"] = types.AdbOrderCallbackStatusSucceed
+	case tries > len(backoff):
+		set["callback_status"] = types.AdbOrderCallbackStatusDead
+	default:
+		set["callback_next_at"] = now.Add(backoff[tries-1])
+	}
+	return set
+}
+
+// the callback failure retry backoff of the adb order's merchant
+func adbOrderCallbackBackoff(order *types.AdbOrder) []time.Duration {
+	merchant, err := adbOrderMerchant(order)
+	if err != nil {
+		return types.AdbOrderCallbackBackoff
+	}
+	return merchant.Backoff()
+}
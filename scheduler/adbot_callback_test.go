@@ -0,0 +1,153 @@
+package scheduler
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(callbackSuite))
+
+type callbackSuite struct{}
+
+func (s *callbackSuite) TestDrainCallbacks(c *check.C) {
+	var (
+		errNone  = errors.New("not found")
+		workers  = make(chan struct{}, 2)
+		release  = make(chan struct{})
+		mux      sync.Mutex
+		leases   = make(map[string]bool)
+		inflight int
+		maxIn    int
+		reused   bool
+		wg       sync.WaitGroup
+	)
+
+	due := 5
+	claim := func(lease string) (*types.AdbOrder, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		if due == 0 {
+			return nil, errNone
+		}
+		due--
+		reused = reused || lease == "" || leases[lease] // a new lease for each claim
+		leases[lease] = true
+		wg.Add(1)
+		return &types.AdbOrder{ID: lease, CallbackLease: lease}, nil
+	}
+	deliver := func(order *types.AdbOrder) {
+		defer wg.Done()
+		mux.Lock()
+		if inflight++; inflight > maxIn {
+			maxIn = inflight
+		}
+		mux.Unlock()
+		<-release
+		mux.Lock()
+		inflight--
+		mux.Unlock()
+	}
+
+	// the claim is blocked while all of the workers are busy
+	done := make(chan error)
+	go func() { done <- drainAdbOrderCallbacks(workers, func() bool { return true }, claim, deliver) }()
+	select {
+	case <-done:
+		c.Fatal("drained while the workers are busy")
+	case <-time.After(time.Millisecond * 100):
+	}
+	mux.Lock()
+	c.Assert(due, check.Equals, 3)
+	mux.Unlock()
+
+	close(release)
+	select {
+	case err := <-done:
+		c.Assert(err, check.Equals, errNone)
+	case <-time.After(time.Second * 5):
+		c.Fatal("not drained")
+	}
+	wg.Wait()
+	c.Assert(leases, check.HasLen, 5)
+	c.Assert(reused, check.Equals, false)
+	c.Assert(maxIn <= cap(workers), check.Equals, true)
+
+	// all of the workers released, the slot is freed after the delivery returns
+	deadline := time.Now().Add(time.Second * 5)
+	for len(workers) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	c.Assert(len(workers), check.Equals, 0)
+}
+
+func (s *callbackSuite) TestDrainCallbacksNotLeader(c *check.C) {
+	claim := func(lease string) (*types.AdbOrder, error) {
+		c.Fatal("claimed while not the leader")
+		return nil, nil
+	}
+	err := drainAdbOrderCallbacks(make(chan struct{}, 1), func() bool { return false }, claim, func(*types.AdbOrder) {})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *callbackSuite) TestCallbackDelivered(c *check.C) {
+	var (
+		now     = time.Now()
+		backoff = []time.Duration{time.Second * 10, time.Second * 30}
+		order   = &types.AdbOrder{ID: "2019620183258-BA01", CallbackLease: "k2Jd8xPqR0aZ"}
+		failed  = errors.New("502 - bad gateway")
+	)
+
+	// the lease is released after each attempt
+	for _, set := range []map[string]interface{}{
+		adbOrderCallbackDelivered(order, nil, backoff, now),
+		adbOrderCallbackDelivered(order, failed, backoff, now),
+	} {
+		c.Assert(set["callback_lease"], check.Equals, "")
+		c.Assert(set["callback_lease_at"], check.Equals, time.Time{})
+		c.Assert(set["callback_tries"], check.Equals, 1)
+	}
+
+	set := adbOrderCallbackDelivered(order, nil, backoff, now)
+	c.Assert(set["callback_status"], check.Equals, types.AdbOrderCallbackStatusSucceed)
+
+	// re-scheduled by the backoff
+	set = adbOrderCallbackDelivered(order, failed, backoff, now)
+	c.Assert(set["callback_status"], check.IsNil)
+	c.Assert(set["callback_next_at"], check.Equals, now.Add(time.Second*10))
+
+	order.CallbackTries = 1
+	set = adbOrderCallbackDelivered(order, failed, backoff, now)
+	c.Assert(set["callback_next_at"], check.Equals, now.Add(time.Second*30))
+
+	// dead after all of the retries failed
+	order.CallbackTries = 2
+	set = adbOrderCallbackDelivered(order, failed, backoff, now)
+	c.Assert(set["callback_status"], check.Equals, types.AdbOrderCallbackStatusDead)
+	c.Assert(set["callback_tries"], check.Equals, 3)
+	c.Assert(set["callback_next_at"], check.IsNil)
+
+	// the lease must outlive the in-flight callback
+	c.Assert(types.AdbOrderCallbackLease > time.Minute, check.Equals, true)
+}
+
+func (s *callbackSuite) TestCallbackEventBody(c *check.C) {
+	ev := newAdbOrderCallbackEvent("http://merchant/notify", 200, "ok\xff\xfe", time.Millisecond*20, nil)
+	c.Assert(ev.Attrs["body"], check.Equals, "ok")
+	c.Assert(ev.Attrs["http_status"], check.Equals, "200")
+	c.Assert(ev.Attrs["latency_ms"], check.Equals, "20")
+
+	// truncated on the rune boundary
+	body := "a" + strings.Repeat("中", types.AdbOrderEventBodyMax)
+	ev = newAdbOrderCallbackEvent("http://merchant/notify", 500, body, time.Second, errors.New("bad status"))
+	c.Assert(utf8.ValidString(ev.Attrs["body"]), check.Equals, true)
+	c.Assert(strings.HasSuffix(ev.Attrs["body"], " ..."), check.Equals, true)
+	c.Assert(len(strings.TrimSuffix(ev.Attrs["body"], " ...")), check.Equals, 1+types.AdbOrderEventBodyMax/3*3)
+	c.Assert(ev.Message, check.Equals, "bad status")
+}
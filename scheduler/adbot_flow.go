@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+// RunAdbFlow run the automation flow on the target adb devices concurrently
+// and collect the step by step traces of each device
+//
+// note: this may take a long time
+func RunAdbFlow(flow *adbot.Flow, req *types.AdbFlowRunReq) ([]*types.AdbFlowRunResult, error) {
+	dvcs, err := pickupFlowAdbDevices(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(dvcs) == 0 {
+		return nil, errors.New("no online adb devices matched")
+	}
+
+	var (
+		wg  sync.WaitGroup
+		ret = make([]*types.AdbFlowRunResult, len(dvcs))
+	)
+
+	for idx, dvc := range dvcs {
+		ret[idx] = &types.AdbFlowRunResult{DeviceID: dvc.ID, NodeID: dvc.NodeID}
+
+		// ensure device idle
+		if err := EnsureAdbDeviceIdle(dvc); err != nil {
+			ret[idx].Errmsg = err.Error()
+			continue
+		}
+
+		wg.Add(1)
+		go func(dvc *types.AdbDevice, r *types.AdbFlowRunResult) {
+			defer wg.Done()
+
+			RegisterGoroutine("adb_flow_run", dvc.ID)
+			defer DeRegisterGoroutine("adb_flow_run", dvc.ID)
+
+			result, err := DoNodeRunAdbDeviceFlow(dvc.NodeID, dvc.ID, flow, req.Vars)
+			if err != nil {
+				r.Errmsg = err.Error()
+				return
+			}
+			r.Result = result
+			log.Printf("adb flow %s on device %s finished: %s %s", flow.Name, dvc.ID, result.Status, result.Errmsg)
+		}(dvc, ret[idx])
+	}
+
+	wg.Wait()
+	return ret, nil
+}
+
+func pickupFlowAdbDevices(req *types.AdbFlowRunReq) ([]*types.AdbDevice, error) {
+	if req.DeviceID != "" {
+		dvc, err := store.DB().GetAdbDevice(req.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		if dvc.Status != types.AdbDeviceStatusOnline {
+			return nil, fmt.Errorf("adb device %s not online", dvc.ID)
+		}
+		return []*types.AdbDevice{dvc}, nil
+	}
+
+	return pickupLabelAdbDevices(req.Labels)
+}
+
+// pickup all of online adb devices of the label-selected nodes
+func pickupLabelAdbDevices(labels map[string]string) ([]*types.AdbDevice, error) {
+	query := bson.M{}
+	for key, val := range labels {
+		query[fmt.Sprintf("labels.%s", key)] = val
+	}
+	nodes, err := store.DB().ListNodes(nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIDs := make([]string, len(nodes))
+	for idx, node := range nodes {
+		nodeIDs[idx] = node.ID
+	}
+
+	return store.DB().ListAdbDevices(nil, bson.M{
+		"node_id": bson.M{"$in": nodeIDs},
+		"status":  types.AdbDeviceStatusOnline,
+	})
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+//  Adb Order Manual Adjudications
+//
+//  the operator could mark the adb order as paid, timeout or void, or leave a refund note,
+//  by the override transitions of the state machine in types with compare-and-set on the
+//  current status. each override is appended to the order history with the operator,
+//  the reason & the previous status in the same db update.
+//
+
+// OverrideAdbOrder apply the operator's manual adjudication on the adb order,
+// and queue the merchant callback if required
+func OverrideAdbOrder(orderID string, req *types.AdbOrderOverrideReq, operatorID, operator string) (*types.AdbOrderOverride, error) {
+	order, err := store.DB().GetAdbOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		from   = order.Status
+		reason = fmt.Sprintf("manual %s by %s: %s", req.Action, operator, req.Reason)
+	)
+
+	to, err := types.ValidAdbOrderOverride(from, req.Action)
+	if err != nil {
+		return nil, rejectAdbOrderTransition(orderID, "status", from, req.Action, reason, err)
+	}
+
+	override := &types.AdbOrderOverride{
+		Action:     req.Action,
+		From:       from,
+		To:         to,
+		Reason:     strings.TrimSpace(req.Reason),
+		Callback:   req.Callback,
+		OperatorID: operatorID,
+		Operator:   operator,
+		Time:       time.Now(),
+	}
+
+	set := bson.M{"status": to}
+	if to == types.AdbOrderStatusPaid && order.PaidAt.IsZero() {
+		set["paid_at"] = override.Time
+	}
+	ev := types.NewAdbOrderEvent(types.AdbOrderEventStatusChanged, reason, "from", from, "to", to, "operator", operator)
+	update := bson.M{"$set": set, "$push": bson.M{"overrides": override, "events": ev}}
+
+	// note: the order maybe paid, timeout or overridden concurrently, only succeed while still `from`
+	err = store.DB().TransitAdbOrder(orderID, "status", []string{from}, update)
+	if store.DB().ErrNotFound(err) {
+		return nil, rejectAdbOrderTransition(orderID, "status", from, to, reason, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Warnf("adb order %s overridden %s -> %s (%s)", orderID, from, to, reason)
+
+	if from == types.AdbOrderStatusPending {
+		PublishAdbOrderClosedEvent(orderID) // stop the payment waitting, the callback is decided by the operator
+	}
+	if to != from {
+		PublishAdbOrderStatusEvent(orderID, to) // drive the hosted cashier pages
+	}
+
+	if req.Callback {
+		from := append([]string{types.AdbOrderCallbackStatusNone, types.AdbOrderCallbackStatusAborted}, types.AdbOrderCallbackDeadStatuses...)
+		if err := resetAdbOrderCallback(orderID, from, reason); err != nil {
+			return override, fmt.Errorf("adb order overridden, but queue the merchant callback error: %v", err)
+		}
+		AppendAdbOrderCallbackHistory(orderID, "callback queued by the manual override")
+		wakeupAdbOrderCallbackQueue()
+	}
+
+	return override, nil
+}
+
+// ListAdbOrderOverrides list all of the manual adjudications on the adb orders matched
+// by the query, optionally filtered by the operator & action, sorted by time desc
+func ListAdbOrderOverrides(query bson.M, operator, action string) ([]*types.AdbOrderOverrideRecord, error) {
+	if query == nil {
+		query = bson.M{}
+	}
+	query["overrides.0"] = bson.M{"$exists": true}
+
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	return adbOrderOverrideRecords(orders, operator, action), nil
+}
+
+// flatten the manual adjudications of the adb orders, optionally filtered
+// by the operator & action, sorted by time desc
+func adbOrderOverrideRecords(orders []*types.AdbOrder, operator, action string) []*types.AdbOrderOverrideRecord {
+	ret := make([]*types.AdbOrderOverrideRecord, 0)
+	for _, order := range orders {
+		for _, override := range order.Overrides {
+			if operator != "" && override.Operator != operator {
+				continue
+			}
+			if action != "" && override.Action != action {
+				continue
+			}
+			ret = append(ret, &types.AdbOrderOverrideRecord{
+				OrderID:          order.ID,
+				MerchantID:       order.MerchantID,
+				OutOrderID:       order.OutOrderID,
+				DeviceID:         order.DeviceID,
+				Fee:              order.Fee,
+				PayFee:           order.Payable(),
+				Status:           order.Status,
+				AdbOrderOverride: override,
+			})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.After(ret[j].Time)
+	})
+	return ret
+}
@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(new(overrideSuite))
+
+type overrideSuite struct{}
+
+func (s *overrideSuite) TestOverrideRecords(c *check.C) {
+	var (
+		t0     = time.Date(2019, 6, 20, 18, 32, 58, 0, time.Local)
+		orders = []*types.AdbOrder{
+			{
+				ID:         "2019620183258-BA01",
+				Status:     types.AdbOrderStatusVoid,
+				MerchantID: "shop01",
+				PayFee:     1998,
+				Overrides: []*types.AdbOrderOverride{
+					{Action: types.AdbOrderOverridePaid, From: "timeout", To: "paid", Operator: "admin", Time: t0},
+					{Action: types.AdbOrderOverrideVoid, From: "paid", To: "void", Operator: "bob", Time: t0.Add(time.Hour)},
+				},
+				NewAdbOrderReq: types.NewAdbOrderReq{OutOrderID: "000082", Fee: 2000},
+			},
+			{
+				ID:             "2019620183300-BA02",
+				Status:         types.AdbOrderStatusPaid,
+				Overrides:      []*types.AdbOrderOverride{{Action: types.AdbOrderOverrideRefund, From: "paid", To: "paid", Operator: "admin", Time: t0.Add(time.Minute)}},
+				NewAdbOrderReq: types.NewAdbOrderReq{OutOrderID: "000083", Fee: 100}, // legacy order without pay fee
+			},
+		}
+	)
+
+	records := adbOrderOverrideRecords(orders, "", "")
+	c.Assert(records, check.HasLen, 3)
+	c.Assert(records[0].Action, check.Equals, types.AdbOrderOverrideVoid) // latest first
+	c.Assert(records[1].Action, check.Equals, types.AdbOrderOverrideRefund)
+	c.Assert(records[1].PayFee, check.Equals, 100)
+	c.Assert(records[2].Action, check.Equals, types.AdbOrderOverridePaid)
+	c.Assert(records[2].OrderID, check.Equals, "2019620183258-BA01")
+	c.Assert(records[2].OutOrderID, check.Equals, "000082")
+	c.Assert(records[2].Status, check.Equals, types.AdbOrderStatusVoid) // the current status
+
+	c.Assert(adbOrderOverrideRecords(orders, "admin", ""), check.HasLen, 2)
+	c.Assert(adbOrderOverrideRecords(orders, "admin", types.AdbOrderOverrideRefund), check.HasLen, 1)
+	c.Assert(adbOrderOverrideRecords(orders, "nobody", ""), check.HasLen, 0)
+}
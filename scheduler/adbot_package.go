@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/types"
+)
+
+// RolloutAdbPackage install the apk file onto all of online adb devices of the
+// label-selected nodes, the progress callback will be called serially on each
+// device status changes
+//
+// note: this may take a long time
+func RolloutAdbPackage(apkFile string, req *types.AdbPackageRolloutReq, progress func(*types.AdbPackageRolloutProgress)) error {
+	dvcs, err := pickupLabelAdbDevices(req.Labels)
+	if err != nil {
+		return err
+	}
+	if len(dvcs) == 0 {
+		return errors.New("no online adb devices matched")
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mux   sync.Mutex // protect following & serialize the progress callback
+		done  int
+		total = len(dvcs)
+		sema  = make(chan struct{}, req.Concurrency)
+	)
+
+	report := func(dvc *types.AdbDevice, status, errmsg string, pkg *adbot.AndroidPackage, finished bool) {
+		mux.Lock()
+		defer mux.Unlock()
+		if finished {
+			done++
+		}
+		p := &types.AdbPackageRolloutProgress{
+			DeviceID: dvc.ID,
+			NodeID:   dvc.NodeID,
+			Status:   status,
+			Errmsg:   errmsg,
+			Package:  pkg,
+			Done:     done,
+			Total:    total,
+			Time:     time.Now(),
+		}
+		progress(p)
+	}
+
+	for _, dvc := range dvcs {
+		// ensure device idle
+		if err := EnsureAdbDeviceIdle(dvc); err != nil {
+			report(dvc, types.AdbPackageRolloutSkipped, err.Error(), nil, true)
+			continue
+		}
+
+		wg.Add(1)
+		go func(dvc *types.AdbDevice) {
+			defer wg.Done()
+
+			sema <- struct{}{}
+			defer func() { <-sema }()
+
+			RegisterGoroutine("adb_package_rollout", dvc.ID)
+			defer DeRegisterGoroutine("adb_package_rollout", dvc.ID)
+
+			report(dvc, types.AdbPackageRolloutInstalling, "", nil, false)
+
+			err := installAdbPackageFile(dvc, apkFile)
+			if err != nil {
+				log.Warnf("adb package rollout on device %s error: %v", dvc.ID, err)
+				report(dvc, types.AdbPackageRolloutFailed, err.Error(), nil, true)
+				return
+			}
+
+			// query the installed version
+			var pkg *adbot.AndroidPackage
+			if req.Package != "" {
+				pkg, _ = DoNodeAdbDevicePackageInfo(dvc.NodeID, dvc.ID, req.Package)
+			}
+			report(dvc, types.AdbPackageRolloutSucceed, "", pkg, true)
+		}(dvc)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func installAdbPackageFile(dvc *types.AdbDevice, apkFile string) error {
+	fd, err := os.Open(apkFile)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return DoNodeInstallAdbDevicePackage(dvc.NodeID, dvc.ID, fd)
+}
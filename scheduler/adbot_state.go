@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+//  Adb Order State Transitions
+//
+//  the adb order status & callback status are only moved by the state machine in types
+//  with compare-and-set on the db store, so the late or concurrent transitions from the
+//  stale state are rejected, eg: a late UI searching can't flip a timeout order to paid.
+//
+//  all of the rejected transitions are audited.
+//
+
+// TransitAdbOrderStatus move the adb order status from -> to only if it's still `from`
+func TransitAdbOrderStatus(orderID, from, to, reason string) error {
+	if err := types.ValidAdbOrderTransition(from, to); err != nil {
+		return rejectAdbOrderTransition(orderID, "status", from, to, reason, err)
+	}
+
+	set := bson.M{"status": to}
+	switch to {
+	case types.AdbOrderStatusPaid, types.AdbOrderStatusPaidAfterTimeout:
+		set["paid_at"] = time.Now()
+	case types.AdbOrderStatusClosed:
+		set["closed_at"] = time.Now()
+	}
+
+	ev := types.NewAdbOrderEvent(types.AdbOrderEventStatusChanged, reason, "from", from, "to", to)
+
+	err := store.DB().TransitAdbOrder(orderID, "status", []string{from}, bson.M{"$set": set, "$push": bson.M{"events": ev}})
+	if store.DB().ErrNotFound(err) {
+		return rejectAdbOrderTransition(orderID, "status", from, to, reason, nil)
+	}
+	if err == nil {
+		PublishAdbOrderStatusEvent(orderID, to) // drive the hosted cashier pages
+	}
+	return err
+}
+
+// TransitAdbOrderCallbackStatus move the adb order callback status to `to` with the
+// extra fields set, only if it's still one of `from`
+func TransitAdbOrderCallbackStatus(orderID string, from []string, to, reason string, set bson.M) error {
+	for _, f := range from {
+		if err := types.ValidAdbOrderCallbackTransition(f, to); err != nil {
+			return rejectAdbOrderTransition(orderID, "callback_status", f, to, reason, err)
+		}
+	}
+
+	if set == nil {
+		set = bson.M{}
+	}
+	set["callback_status"] = to
+
+	err := store.DB().TransitAdbOrder(orderID, "callback_status", from, bson.M{"$set": set})
+	if store.DB().ErrNotFound(err) {
+		return rejectAdbOrderTransition(orderID, "callback_status", fmt.Sprintf("%v", from), to, reason, nil)
+	}
+	return err
+}
+
+// audit the rejected transition and return the conflict error,
+// the illegal one with the state machine error, the lost one (state changed) without
+func rejectAdbOrderTransition(orderID, field, from, to, reason string, illegal error) error {
+	var current string
+	if order, err := store.DB().GetAdbOrder(orderID); err != nil {
+		if store.DB().ErrNotFound(err) {
+			return err // order not exists, nothing to audit
+		}
+		current = "unknown"
+	} else if field == "status" {
+		current = order.Status
+	} else {
+		current = order.CallbackStatus
+	}
+
+	errmsg := fmt.Sprintf("adb order %s %s transition conflict: %s -> %s rejected, current: %s", orderID, field, from, to, current)
+	if illegal != nil {
+		errmsg += ", " + illegal.Error()
+	}
+
+	log.Warnln(errmsg, "("+reason+")")
+	LogAuditEntry(&types.AuditEntry{
+		Verb:       "transit",
+		VerbStatus: types.VerbStatusFail,
+		RequestURI: fmt.Sprintf("/adb_orders/%s/%s", orderID, field),
+		Source:     "scheduler",
+		Time:       time.Now(),
+		Annotations: map[string]string{
+			"from":    from,
+			"to":      to,
+			"current": current,
+			"reason":  reason,
+		},
+		ResponseErrMsg: errmsg,
+	})
+
+	return fmt.Errorf("%s", errmsg)
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+// PaygateMerchant lookup the merchant of the paygate request app id,
+// the empty app id means the default merchant
+func PaygateMerchant(appID string) (*types.Merchant, error) {
+	if appID == "" {
+		appID = types.DefaultMerchantID
+	}
+	merchant, err := store.DB().GetMerchant(appID)
+	if err != nil {
+		if store.DB().ErrNotFound(err) {
+			return nil, errors.New("merchant not found")
+		}
+		return nil, err
+	}
+	if merchant.ID != appID { // matched by name, app id must be the merchant id
+		return nil, errors.New("merchant not found")
+	}
+	return merchant, nil
+}
+
+// MerchantAdbOrdersFilter return the db adb orders query condition on `merchant_id`
+// of the given merchant, the default merchant also owns the orders created before the multi-merchant
+func MerchantAdbOrdersFilter(merchantID string) interface{} {
+	if merchantID == types.DefaultMerchantID {
+		return bson.M{"$in": []interface{}{merchantID, nil}}
+	}
+	return merchantID
+}
+
+// the merchant of the adb order, the orders created before
+// the multi-merchant belong to the default merchant
+func adbOrderMerchant(order *types.AdbOrder) (*types.Merchant, error) {
+	if order.MerchantID == "" {
+		return store.DB().GetMerchant(types.DefaultMerchantID)
+	}
+	return store.DB().GetMerchant(order.MerchantID)
+}
+
+// dedicatedAdbDevices return all of the adb devices dedicated to any merchants,
+// they are excluded from the shared device pool
+func dedicatedAdbDevices() []string {
+	merchants, _ := store.DB().ListMerchants(nil, bson.M{"devices.0": bson.M{"$exists": true}})
+
+	var ret []string
+	for _, merchant := range merchants {
+		ret = append(ret, merchant.Devices...)
+	}
+	return ret
+}
+
+// EnsureDefaultMerchant create the default merchant from the paygate global
+// settings attrs if not exists, so the paygate requests without app id are
+// still served as before the multi-merchant
+func EnsureDefaultMerchant() error {
+	if _, err := store.DB().GetMerchant(types.DefaultMerchantID); !store.DB().ErrNotFound(err) {
+		return err
+	}
+
+	settings, err := store.DB().GetSettings()
+	if err != nil {
+		return err
+	}
+
+	backoff := settings.GlobalAttrs.Get(types.GlobalAttrPaygateCallbackBackoff)
+	if _, err := types.ParseCallbackBackoff(backoff); err != nil {
+		backoff = ""
+	}
+
+	return store.DB().AddMerchant(&types.Merchant{
+		ID:              types.DefaultMerchantID,
+		Name:            types.DefaultMerchantID,
+		Secret:          settings.GlobalAttrs.Get(types.GlobalAttrPaygateSecretKey),
+		QRTypes:         []string{},
+		Devices:         []string{},
+		SignLegacy:      settings.PaygateSignLegacy(),
+		CallbackBackoff: backoff,
+		Desc:            "migrated from the paygate global settings",
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	})
+}
@@ -9,10 +9,16 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
 
 	"github.com/bbklab/adbot/pkg/adbot"
 	"github.com/bbklab/adbot/pkg/mole"
@@ -150,9 +156,14 @@ func DoNodeQueryAdbDevices(id string) (map[string]*adbot.AndroidSysInfo, error)
 	return dvcsinfo, err
 }
 
-// DoNodeCheckAdbOrder query node's adb device order
-func DoNodeCheckAdbOrder(id, dvcid, orderID string) (*adbot.AlipayOrder, error) {
-	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/alipay_order?device_id=%s&order_id=%s", id, dvcid, orderID), nil)
+// DoNodeCheckAdbOrder query node's adb device order by the payment app
+func DoNodeCheckAdbOrder(id, dvcid, app, orderID string) (*adbot.PayOrder, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("app", app)
+	query.Set("order_id", orderID)
+
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/pay_order?%s", id, query.Encode()), nil)
 
 	resp, err := ProxyNode(id, nodeReq, 0)
 	if err != nil {
@@ -165,11 +176,126 @@ func DoNodeCheckAdbOrder(id, dvcid, orderID string) (*adbot.AlipayOrder, error)
 		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
 	}
 
-	var order *adbot.AlipayOrder
+	var order *adbot.PayOrder
 	err = json.NewDecoder(resp.Body).Decode(&order)
 	return order, err
 }
 
+// DoNodeListAdbPayBills list node's adb device recent bills of the payment app
+func DoNodeListAdbPayBills(id, dvcid, app string) ([]*adbot.PayOrder, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("app", app)
+
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/pay_bills?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var bills []*adbot.PayOrder
+	err = json.NewDecoder(resp.Body).Decode(&bills)
+	return bills, err
+}
+
+// DoNodeListAdbPayDayBills list node's adb device all of the bills of the given day (2006-01-02) of the payment app
+func DoNodeListAdbPayDayBills(id, dvcid, app, date string) ([]*adbot.PayOrder, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("app", app)
+	query.Set("date", date)
+
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/pay_bills?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var bills []*adbot.PayOrder
+	err = json.NewDecoder(resp.Body).Decode(&bills)
+	return bills, err
+}
+
+// DoNodeGenAdbPayQrCode generate collect qrcode by the payment app on node's adb device
+func DoNodeGenAdbPayQrCode(id, dvcid, app string, fee int, comment string) ([]byte, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("app", app)
+	query.Set("fee", strconv.Itoa(fee))
+	query.Set("comment", comment)
+
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/pay_qrcode?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// DoNodeAdbDeviceOpQueue query node's adb device op queue stats
+func DoNodeAdbDeviceOpQueue(id, dvcid string) (*adbot.OpQueueStats, error) {
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/ops?device_id=%s", id, dvcid), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var stats *adbot.OpQueueStats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+// DoNodeCancelAdbDeviceOp cancel node's adb device pending or running op
+func DoNodeCancelAdbDeviceOp(id, dvcid, opID string) error {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("op_id", opID)
+
+	nodeReq, _ := http.NewRequest("DELETE", fmt.Sprintf("http://%s/api/adbot/device/ops?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return nil
+}
+
 // DoNodeScreenCapAdbDevice screen cap on node's adb device
 func DoNodeScreenCapAdbDevice(id, dvcid string) ([]byte, error) {
 	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/screencap?device_id=%s", id, dvcid), nil)
@@ -188,9 +314,35 @@ func DoNodeScreenCapAdbDevice(id, dvcid string) ([]byte, error) {
 	return ioutil.ReadAll(resp.Body)
 }
 
-// DoNodeDumpUIAdbDevice dump node's adb device UI
-func DoNodeDumpUIAdbDevice(id, dvcid string) ([]*adbot.AndroidUINode, error) {
-	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/uinodes?device_id=%s", id, dvcid), nil)
+// DoNodeTailAdbDeviceSysLogs redirect node's adb device live stream system logs output
+func DoNodeTailAdbDeviceSysLogs(id, dvcid string, filter *adbot.SysLogFilter) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("buffers", strings.Join(filter.Buffers, ","))
+	query.Set("tags", strings.Join(filter.Tags, ","))
+	query.Set("priority", filter.Priority)
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/syslogs?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return resp.Body, nil
+}
+
+// DoNodeDumpUIAdbDevice dump node's adb device UI, filtered by the UISelector if given
+func DoNodeDumpUIAdbDevice(id, dvcid, selector string) ([]*adbot.AndroidUINode, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("selector", selector)
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/uinodes?%s", id, query.Encode()), nil)
 
 	resp, err := ProxyNode(id, nodeReq, 0)
 	if err != nil {
@@ -299,6 +451,188 @@ func DoNodeAdbDeviceExec(id, dvcid string, cmd *types.AdbDeviceCmd) ([]byte, err
 	return ioutil.ReadAll(resp.Body)
 }
 
+// DialNodeAdbDeviceMirror dial the node's adb device live screen mirror websocket
+// through the node connection, the caller should close the returned websocket conn
+func DialNodeAdbDeviceMirror(id, dvcid string, opts *adbot.MirrorOptions) (*websocket.Conn, error) {
+	node := Node(id)
+	if node == nil {
+		return nil, &ProxyNodeError{id, fmt.Sprintf(ErrMsgNoSuchNodeOnline, id)}
+	}
+
+	nodeConn, err := node.Dial("", "")
+	if err != nil {
+		return nil, &ProxyNodeError{id, err.Error()}
+	}
+	if tcpConn, ok := nodeConn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+	}
+
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("fps", strconv.FormatFloat(opts.FPS, 'f', -1, 64))
+	query.Set("quality", strconv.Itoa(opts.Quality))
+	query.Set("max_width", strconv.Itoa(opts.MaxWidth))
+	u := &url.URL{Scheme: "ws", Host: id, Path: "/api/adbot/device/mirror", RawQuery: query.Encode()}
+
+	wsConn, resp, err := websocket.NewClient(nodeConn, u, nil, 1024, 1024*64)
+	if err != nil {
+		nodeConn.Close()
+		if resp != nil {
+			bs, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("node:%s - %d - %s", id, resp.StatusCode, string(bs))
+		}
+		return nil, err
+	}
+
+	return wsConn, nil
+}
+
+// DoNodeRunAdbDeviceFlow run the automation flow on node's adb device
+//
+// note: this may take a long time
+func DoNodeRunAdbDeviceFlow(id, dvcid string, flow *adbot.Flow, vars map[string]string) (*adbot.FlowResult, error) {
+	reqbs, _ := json.Marshal(&types.AdbDeviceFlowReq{Flow: flow, Vars: vars})
+	nodeReq, _ := http.NewRequest("POST", fmt.Sprintf("http://%s/api/adbot/device/flow?device_id=%s", id, dvcid), bytes.NewBuffer(reqbs))
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var result *adbot.FlowResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// DoNodePullAdbDeviceFile redirect node's adb device file content and the file size
+func DoNodePullAdbDeviceFile(id, dvcid, path string) (io.ReadCloser, int64, error) {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("path", path)
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/file?%s", id, query.Encode()), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// DoNodePushAdbDeviceFile write the file onto node's adb device
+func DoNodePushAdbDeviceFile(id, dvcid, path string, mode os.FileMode, src io.Reader) error {
+	query := url.Values{}
+	query.Set("device_id", dvcid)
+	query.Set("path", path)
+	query.Set("mode", fmt.Sprintf("%o", mode))
+	nodeReq, _ := http.NewRequest("PUT", fmt.Sprintf("http://%s/api/adbot/device/file?%s", id, query.Encode()), src)
+	nodeReq.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return nil
+}
+
+// DoNodeListAdbDevicePackages list node's adb device installed packages
+func DoNodeListAdbDevicePackages(id, dvcid string, thirdParty bool) ([]*adbot.AndroidPackage, error) {
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/packages?device_id=%s&third_party=%v", id, dvcid, thirdParty), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var pkgs []*adbot.AndroidPackage
+	err = json.NewDecoder(resp.Body).Decode(&pkgs)
+	return pkgs, err
+}
+
+// DoNodeAdbDevicePackageInfo query node's adb device installed package
+func DoNodeAdbDevicePackageInfo(id, dvcid, name string) (*adbot.AndroidPackage, error) {
+	nodeReq, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/adbot/device/package?device_id=%s&name=%s", id, dvcid, name), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	var pkg *adbot.AndroidPackage
+	err = json.NewDecoder(resp.Body).Decode(&pkg)
+	return pkg, err
+}
+
+// DoNodeInstallAdbDevicePackage install or upgrade the apk on node's adb device
+func DoNodeInstallAdbDevicePackage(id, dvcid string, apk io.Reader) error {
+	nodeReq, _ := http.NewRequest("POST", fmt.Sprintf("http://%s/api/adbot/device/package?device_id=%s", id, dvcid), apk)
+	nodeReq.Header.Set("Content-Type", "application/vnd.android.package-archive")
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return nil
+}
+
+// DoNodeUninstallAdbDevicePackage uninstall the package on node's adb device
+func DoNodeUninstallAdbDevicePackage(id, dvcid, name string) error {
+	nodeReq, _ := http.NewRequest("DELETE", fmt.Sprintf("http://%s/api/adbot/device/package?device_id=%s&name=%s", id, dvcid, name), nil)
+
+	resp, err := ProxyNode(id, nodeReq, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != 200 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("node:%s - %d - %s", id, code, string(bs))
+	}
+
+	return nil
+}
+
 //
 // Terminal
 //
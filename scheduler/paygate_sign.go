@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/orderparam"
+	"github.com/bbklab/adbot/pkg/utils"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+//  Paygate Signature
+//
+//  - MD5 (legacy): MD5("out_order_id={out_order_id}&fee={fee}&key={key}"), only
+//    accepted while the merchant allows the legacy signature during the migration,
+//    the callback additionally signs the status, so the request signature can't be replayed as a callback
+//  - HMAC-SHA256: HMAC-SHA256(key, "k1=v1&k2=v2...") over all of the non-empty parameters
+//    except the sign in the key ordering, the values are url escaped, with the timestamp
+//    & nonce replay protection
+//
+//  the signature is always in upper case hex.
+//
+
+var (
+	errSignError          = errors.New("signature error")
+	errSignLegacyDisabled = errors.New("legacy MD5 signature disabled, pls sign by HMAC-SHA256")
+	errSignExpired        = errors.New("signature timestamp expired")
+	errSignReplayed       = errors.New("signature nonce replayed")
+)
+
+// VerifySignature verify the given request with the merchant secret key,
+// the legacy MD5 signature is only accepted if the merchant allowed
+func VerifySignature(merchant *types.Merchant, data interface{}) error {
+	key := merchant.Secret
+
+	switch req := data.(type) {
+	case nil:
+		return errors.New("nil data for signature verify")
+
+	case *types.NewAdbOrderReq:
+		switch req.SignType {
+		case "", types.SignTypeMD5:
+			if !merchant.SignLegacy {
+				return errSignLegacyDisabled
+			}
+			return verifySign(req.Sign, signMD5(key, req.StringToSign()))
+
+		case types.SignTypeHMACSHA256:
+			if err := verifySign(req.Sign, signHMACSHA256(key, req.SignParams())); err != nil {
+				return err
+			}
+			return verifyTimestampNonce(merchant.ID, req.Timestamp, req.Nonce)
+
+		default:
+			return errors.New("signature type unrecoginized")
+		}
+
+	case *types.PaygateOrderReq:
+		if req.SignType != types.SignTypeHMACSHA256 {
+			return errors.New("signature type unrecoginized")
+		}
+		if err := verifySign(req.Sign, signHMACSHA256(key, req.SignParams())); err != nil {
+			return err
+		}
+		return verifyTimestampNonce(merchant.ID, req.Timestamp, req.Nonce)
+
+	default:
+		return errors.New("unexpected data type for signature verify")
+	}
+}
+
+// sign the callback by the same signature type with the order request
+// note: the HMAC-SHA256 callback carries its own timestamp & nonce, so each delivery attempt
+// gets a fresh signature covering the order status and paid time, the legacy MD5 callback
+// only covers the order status if the merchant opted in the v2 callback signature
+func signCallback(merchant *types.Merchant, signType string, cb *types.NewAdbOrderCallback) {
+	key := merchant.Secret
+
+	switch signType {
+	case types.SignTypeHMACSHA256:
+		cb.SignType = signType
+		cb.Timestamp = time.Now().Unix()
+		cb.Nonce = utils.RandomString(16)
+		cb.Sign = signHMACSHA256(key, cb.SignParams())
+	default:
+		cb.SignType = types.SignTypeMD5
+		if merchant.SignLegacyV2 {
+			cb.Sign = signMD5(key, cb.StringToSignV2())
+		} else {
+			cb.Sign = signMD5(key, cb.StringToSign())
+		}
+	}
+}
+
+// sign the paygate order query & close response by HMAC-SHA256 with a fresh timestamp & nonce
+func signPaygateOrderResp(key string, resp *types.PaygateOrderResp) {
+	resp.SignType = types.SignTypeHMACSHA256
+	resp.Timestamp = time.Now().Unix()
+	resp.Nonce = utils.RandomString(16)
+	resp.Sign = signHMACSHA256(key, resp.SignParams())
+}
+
+func verifySign(sign, expect string) error {
+	if !hmac.Equal([]byte(strings.ToUpper(sign)), []byte(expect)) {
+		return errSignError
+	}
+	return nil
+}
+
+func verifyTimestampNonce(merchantID string, timestamp int64, nonce string) error {
+	return checkTimestampNonce(store.DB(), time.Now(), merchantID, timestamp, nonce)
+}
+
+// nonceStore is the part of store.Store recording the seen nonces
+type nonceStore interface {
+	AddPaygateNonce(nonce string) error
+	ErrDuplicated(error) bool
+}
+
+func checkTimestampNonce(db nonceStore, now time.Time, merchantID string, timestamp int64, nonce string) error {
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew > types.SignExpire || skew < -types.SignExpire {
+		return errSignExpired
+	}
+
+	// note: only record the nonce after the signature verified, so
+	// the forged requests can't exhaust any nonce of the merchant
+	err := db.AddPaygateNonce(merchantID + "/" + nonce)
+	if db.ErrDuplicated(err) {
+		return errSignReplayed
+	}
+	return err
+}
+
+func signMD5(key, data string) string {
+	return strings.ToUpper(utils.Md5sum([]byte(strings.TrimSpace(data + "&key=" + key))))
+}
+
+func signHMACSHA256(key string, params *orderparam.Params) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(params.Join()))
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(signSuite))
+
+type signSuite struct{}
+
+func (s *signSuite) req() *types.NewAdbOrderReq {
+	return &types.NewAdbOrderReq{
+		AppID:      "shop01",
+		OutOrderID: "000082",
+		QRType:     types.QRCodeTypeAlipay,
+		Fee:        19,
+		Attach:     "any thing&fee=1",
+		NotifyURL:  "http://requestbin.net/ve1?a=1",
+		SignType:   types.SignTypeHMACSHA256,
+		Timestamp:  1561025578,
+		Nonce:      "k2Jd8xPqR0aZ",
+	}
+}
+
+func (s *signSuite) TestSignHMACSHA256(c *check.C) {
+	req := s.req()
+	sign := signHMACSHA256("secret01", req.SignParams())
+	c.Assert(sign, check.Equals, "1DF149804C8FDB9E41E0AABFF7BCB03225E314DF4EB0DDDBDFEB695E9C546EED")
+	c.Assert(verifySign(sign, signHMACSHA256("secret01", req.SignParams())), check.IsNil)
+	c.Assert(verifySign(sign, signHMACSHA256("secret02", req.SignParams())), check.Equals, errSignError)
+
+	// every signed field is covered
+	req.Fee = 1
+	c.Assert(verifySign(sign, signHMACSHA256("secret01", req.SignParams())), check.Equals, errSignError)
+}
+
+func (s *signSuite) TestSignLegacyCallback(c *check.C) {
+	var (
+		req = s.req()
+		cb  = &types.NewAdbOrderCallback{Code: 1, OrderID: "2019620183258-BA01", OutOrderID: req.OutOrderID, Fee: req.Fee, Status: types.AdbOrderStatusPaid}
+	)
+
+	c.Assert(signMD5("secret01", req.StringToSign()), check.Equals, "387B45A728061A6AB11E4312FF2B8F4F")
+
+	// unchanged for the existing legacy merchants
+	merchant := &types.Merchant{ID: "shop01", Secret: "secret01", SignLegacy: true}
+	signCallback(merchant, "", cb)
+	c.Assert(cb.SignType, check.Equals, types.SignTypeMD5)
+	c.Assert(cb.Sign, check.Equals, signMD5("secret01", "out_order_id=000082&fee=19"))
+
+	// the opted in legacy request signature can't be replayed as the callback's
+	merchant.SignLegacyV2 = true
+	signCallback(merchant, types.SignTypeMD5, cb)
+	c.Assert(cb.SignType, check.Equals, types.SignTypeMD5)
+	c.Assert(cb.Sign, check.Not(check.Equals), signMD5("secret01", req.StringToSign()))
+	c.Assert(cb.Sign, check.Equals, signMD5("secret01", "out_order_id=000082&fee=19&status=paid"))
+
+	// the HMAC-SHA256 callback gets a fresh timestamp & nonce
+	signCallback(merchant, types.SignTypeHMACSHA256, cb)
+	c.Assert(cb.Nonce, check.HasLen, 16)
+	c.Assert(cb.Sign, check.Equals, signHMACSHA256("secret01", cb.SignParams()))
+}
+
+type fakeNonceStore map[string]bool
+
+var errFakeDup = errors.New("duplicated")
+
+func (f fakeNonceStore) AddPaygateNonce(nonce string) error {
+	if f[nonce] {
+		return errFakeDup
+	}
+	f[nonce] = true
+	return nil
+}
+
+func (f fakeNonceStore) ErrDuplicated(err error) bool { return err == errFakeDup }
+
+func (s *signSuite) TestCheckTimestampNonce(c *check.C) {
+	var (
+		db  = make(fakeNonceStore)
+		now = time.Unix(1561025578, 0)
+		ts  = now.Unix()
+	)
+
+	c.Assert(checkTimestampNonce(db, now, "shop01", ts, "k2Jd8xPqR0aZ"), check.IsNil)
+	c.Assert(checkTimestampNonce(db, now, "shop01", ts, "k2Jd8xPqR0aZ"), check.Equals, errSignReplayed)
+	c.Assert(checkTimestampNonce(db, now, "shop02", ts, "k2Jd8xPqR0aZ"), check.IsNil) // nonce is per merchant
+
+	// the skew within the sign expire both sides
+	c.Assert(checkTimestampNonce(db, now, "shop01", now.Add(-types.SignExpire).Unix(), "n1"), check.IsNil)
+	c.Assert(checkTimestampNonce(db, now, "shop01", now.Add(types.SignExpire).Unix(), "n2"), check.IsNil)
+	c.Assert(checkTimestampNonce(db, now, "shop01", now.Add(-types.SignExpire-time.Second).Unix(), "n3"), check.Equals, errSignExpired)
+	c.Assert(checkTimestampNonce(db, now, "shop01", now.Add(types.SignExpire+time.Second).Unix(), "n4"), check.Equals, errSignExpired)
+
+	// the expired requests never record the nonce
+	c.Assert(db["shop01/n3"], check.Equals, false)
+}
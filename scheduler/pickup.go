@@ -0,0 +1,469 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/balancer"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+//  Adb Device Pickup Strategies
+//
+//  the paygate picks up one adb device for the new order among the candidates, by
+//  the strategy of the merchant, or the global settings, default weighted random.
+//
+//  the payable amount keeps uniq among the pending orders (and the timeout orders within
+//  the merchant device hold) of the same qrcode type on each device, as the same amount
+//  payment notice can't tell them apart:
+//    - prefer the candidates accepting the exact fee
+//    - then the candidates accepting a few cents less within the settings `pay_fee_offset`
+//    - the others are excluded
+//  the pickup & the order saving must be serialized by LockAdbOrderPickup() to keep it uniq
+//  within this master, and the db uniq index among the pending orders guards the concurrent
+//  pickups on the other masters, SaveAdbOrder() retries the next candidate amount if rejected.
+//
+//  each pickup leaves a decision trace on the order to explain why the device was chosen.
+//
+
+// pickupStrategy select one candidate and return the reason
+type pickupStrategy func(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string)
+
+var pickupStrategies = map[string]pickupStrategy{
+	types.PickupStrategyWeight:        pickupByWeight,
+	types.PickupStrategyRoundRobin:    pickupByRoundRobin,
+	types.PickupStrategyLeastPending:  pickupByLeastPending,
+	types.PickupStrategyQuotaHeadroom: pickupByQuotaHeadroom,
+	types.PickupStrategySuccessRate:   pickupBySuccessRate,
+	types.PickupStrategyStickyPayer:   pickupByStickyPayer,
+}
+
+var (
+	pickupRoundRobin = balancer.NewSmoothWeight() // shared by all of the round-robin pickups
+	pickupMutex      sync.Mutex                   // serialize the pickup & the order saving
+)
+
+// LockAdbOrderPickup serialize the adb device pickup & the new pending adb order saving,
+// so the payable amount keeps uniq among the pending orders on each adb device
+func LockAdbOrderPickup() (unlock func()) {
+	pickupMutex.Lock()
+	return pickupMutex.Unlock
+}
+
+type pickupContext struct {
+	merchant *types.Merchant
+	req      *types.NewAdbOrderReq
+}
+
+// pickupCandidate is a candidate adb device, implement balancer.KeyItem
+type pickupCandidate struct {
+	dvc     *types.AdbDevice
+	trace   *types.PickupCandidate
+	weight  int          // the balancer weight
+	pending map[int]bool // the payable amounts of the same qrcode type pending orders
+}
+
+func (c *pickupCandidate) WeightN() int { return c.weight }
+func (c *pickupCandidate) Key() string  { return c.dvc.ID }
+
+// pick up one of given adb devices for the order request by the merchant's strategy
+func pickupAdbDevice(merchant *types.Merchant, req *types.NewAdbOrderReq, dvcs []*types.AdbDevice) (*types.AdbDevice, *types.AdbDevicePickup, error) {
+	var (
+		pctx  = &pickupContext{merchant: merchant, req: req}
+		trace = &types.AdbDevicePickup{
+			Candidates: make([]*types.PickupCandidate, 0, len(dvcs)),
+			Time:       time.Now(),
+		}
+	)
+
+	trace.Strategy, trace.Source = pickupStrategyOf(merchant)
+	strategy, ok := pickupStrategies[trace.Strategy]
+	if !ok {
+		return nil, trace, fmt.Errorf("pickup strategy %s unrecoginized", trace.Strategy)
+	}
+
+	cands := newPickupCandidates(req, dvcs)
+	for _, cand := range cands {
+		trace.Candidates = append(trace.Candidates, cand.trace)
+	}
+
+	// keep the payable amount uniq on each candidate
+	var (
+		offset          = payFeeOffset()
+		exact, adjusted []*pickupCandidate
+	)
+	for _, cand := range cands {
+		cand.trace.PayFee = cand.payable(req.Fee, offset)
+		switch pay := cand.trace.PayFee; {
+		case pay == req.Fee:
+			exact = append(exact, cand)
+		case pay > 0:
+			adjusted = append(adjusted, cand)
+		default:
+			cand.trace.Excluded = fmt.Sprintf("no uniq payable amount within %d cents offset", offset)
+		}
+	}
+	if len(exact) > 0 {
+		for _, cand := range adjusted {
+			cand.trace.Excluded = "holding pending orders of the same amount"
+		}
+		cands = exact
+	} else {
+		cands = adjusted
+	}
+	if len(cands) == 0 {
+		return nil, trace, errors.New("all of the adb devices are holding pending orders of the same amount, pls try again later")
+	}
+
+	chosen, reason := strategy(pctx, cands)
+	if chosen == nil {
+		return nil, trace, errors.New("can't select a adb device by " + trace.Strategy + " strategy")
+	}
+
+	trace.DeviceID = chosen.dvc.ID
+	trace.PayFee = chosen.trace.PayFee
+	trace.Reason = reason
+	if trace.PayFee != req.Fee {
+		trace.Reason += fmt.Sprintf(", payable amount adjusted to %d", trace.PayFee)
+	}
+	return chosen.dvc, trace, nil
+}
+
+// the max cents to reduce the payable amount by the global settings
+func payFeeOffset() int {
+	if settings, _ := store.DB().GetSettings(); settings != nil {
+		return settings.PayFeeOffset
+	}
+	return 0
+}
+
+// the first uniq payable amount from the fee down to the (fee - offset) on the candidate, 0 if none
+func (c *pickupCandidate) payable(fee, offset int) int {
+	return uniqPayable(c.pending, fee, offset)
+}
+
+// the first payable amount from the fee down to the (fee - offset) not in the busy ones, 0 if none
+func uniqPayable(busy map[int]bool, fee, offset int) int {
+	for pay := fee; pay >= fee-offset && pay > 0; pay-- {
+		if !busy[pay] {
+			return pay
+		}
+	}
+	return 0
+}
+
+// SaveAdbOrder save the newly pending adb order picked up by SmartPickupAdbDevice,
+// if its payable amount was taken by a concurrent pickup (maybe on another master)
+// on the same device, retry the next candidate amount within the pay fee offset
+func SaveAdbOrder(order *types.AdbOrder) error {
+	busy := func() map[int]bool {
+		return adbDeviceBusyPayFees(order.DeviceID, order.QRType)
+	}
+	return saveAdbOrder(order, payFeeOffset(), busy, store.DB().AddAdbOrder, store.DB().ErrPayFeeTaken)
+}
+
+func saveAdbOrder(order *types.AdbOrder, offset int, busy func() map[int]bool, add func(*types.AdbOrder) error, taken func(error) bool) error {
+	tried := make(map[int]bool)
+	for {
+		order.Events = types.NewAdbOrderCreatedEvents(order) // by the final payable amount
+
+		err := add(order)
+		if err == nil || !taken(err) {
+			return err
+		}
+		tried[order.PayFee] = true
+
+		// the busy amounts on the device now, including the concurrent pending ones
+		// & the timeout ones within the device hold which are not guarded by the db
+		amounts := busy()
+		for pay := range tried {
+			amounts[pay] = true
+		}
+
+		pay := uniqPayable(amounts, order.Fee, offset)
+		if pay == 0 {
+			return fmt.Errorf("the payable amount %d was taken concurrently on the adb device %s, pls try again later", order.PayFee, order.DeviceID)
+		}
+		if order.Pickup != nil {
+			order.Pickup.PayFee = pay
+			order.Pickup.Reason += fmt.Sprintf(", payable amount %d taken concurrently, adjusted to %d", order.PayFee, pay)
+		}
+		order.PayFee = pay
+	}
+}
+
+// the payable amounts of the same qrcode type busy orders on the adb device
+func adbDeviceBusyPayFees(dvcid, qrtype string) map[int]bool {
+	var (
+		busy  = make(map[int]bool)
+		query = bson.M{"device_id": dvcid, "qrtype": qrtype, "$or": adbDeviceBusyOrdersFilter(time.Now())}
+	)
+	orders, _ := store.DB().ListAdbOrders(nil, query)
+	for _, order := range orders {
+		busy[order.Payable()] = true
+	}
+	return busy
+}
+
+// the merchant's pickup strategy, fall back to the global settings, then the default
+func pickupStrategyOf(merchant *types.Merchant) (string, string) {
+	if merchant != nil && merchant.PickupStrategy != "" {
+		return merchant.PickupStrategy, "merchant"
+	}
+	if settings, _ := store.DB().GetSettings(); settings != nil && settings.PickupStrategy != "" {
+		return settings.PickupStrategy, "settings"
+	}
+	return types.PickupStrategyWeight, "default"
+}
+
+// collect the candidate metrics of each adb device
+func newPickupCandidates(req *types.NewAdbOrderReq, dvcs []*types.AdbDevice) []*pickupCandidate {
+	var (
+		ids   = make([]string, len(dvcs))
+		cands = make([]*pickupCandidate, len(dvcs))
+		idx   = make(map[string]*pickupCandidate, len(dvcs))
+	)
+	for i, dvc := range dvcs {
+		ids[i] = dvc.ID
+	}
+
+	metrics := loadPickupMetrics(ids, time.Now())
+	for i, dvc := range dvcs {
+		cands[i] = &pickupCandidate{
+			dvc:     dvc,
+			weight:  dvc.Weight,
+			pending: make(map[int]bool),
+			trace: &types.PickupCandidate{
+				DeviceID:    dvc.ID,
+				Weight:      dvc.Weight,
+				Headroom:    adbDeviceQuotaHeadroom(dvc, metrics.today[dvc.ID]),
+				SuccessRate: adbDeviceSuccessRate(metrics.recent[dvc.ID]),
+			},
+		}
+		idx[dvc.ID] = cands[i]
+	}
+
+	// pending orders & timeout orders within the device hold
+	query := bson.M{"device_id": bson.M{"$in": ids}, "$or": adbDeviceBusyOrdersFilter(time.Now())}
+	pendings, _ := store.DB().ListAdbOrders(nil, query)
+	for _, order := range pendings {
+		cand, ok := idx[order.DeviceID]
+		if !ok {
+			continue
+		}
+		if order.Status == types.AdbOrderStatusPending {
+			cand.trace.Pending++
+		} else {
+			cand.trace.Holding++
+		}
+		if order.QRType != req.QRType {
+			continue
+		}
+		cand.pending[order.Payable()] = true
+		if order.Payable() == req.Fee {
+			cand.trace.SamePending++
+		}
+	}
+
+	return cands
+}
+
+// pickupMetrics is the recent order rollups of the candidate adb devices
+type pickupMetrics struct {
+	today  map[string]*types.AdbOrderStats // the today rollup by device
+	recent map[string]*types.AdbOrderStats // the hour rollups within the success rate window summed by device
+}
+
+// load the pickup metrics of the adb devices from the order rollups by two queries,
+// instead of counting the orders of each device while holding the pickup lock
+//
+// note: the rollups lag behind the orders within one minute, which is fine for the ranking,
+// the device quotas are still guarded by the over quota flag
+func loadPickupMetrics(ids []string, now time.Time) *pickupMetrics {
+	metrics := &pickupMetrics{
+		today:  make(map[string]*types.AdbOrderStats),
+		recent: make(map[string]*types.AdbOrderStats),
+	}
+
+	query := bson.M{
+		"granularity": types.StatsGranularityDay,
+		"dimension":   types.StatsDimensionDevice,
+		"key":         bson.M{"$in": ids},
+		"time":        types.StatsBucketOf(types.StatsGranularityDay, now),
+	}
+	today, _ := store.DB().ListAdbOrderStats(nil, query)
+	for _, stat := range today {
+		metrics.today[stat.Key] = stat
+	}
+
+	query["granularity"] = types.StatsGranularityHour
+	query["time"] = bson.M{"$gte": types.StatsBucketOf(types.StatsGranularityHour, now.Add(-types.PickupSuccessRateWindow))}
+	recent, _ := store.DB().ListAdbOrderStats(nil, query)
+	for _, stat := range recent {
+		sum, ok := metrics.recent[stat.Key]
+		if !ok {
+			sum = &types.AdbOrderStats{Dimension: stat.Dimension, Key: stat.Key}
+			metrics.recent[stat.Key] = sum
+		}
+		sum.Add(stat)
+	}
+
+	return metrics
+}
+
+// today quota headroom [0-1] by the max amount & max bill limits of the received
+// orders in the today rollup, 1 means unlimit
+func adbDeviceQuotaHeadroom(dvc *types.AdbDevice, today *types.AdbOrderStats) float64 {
+	if dvc.MaxAmount == 0 && dvc.MaxBill == 0 { // unlimited device
+		return 1
+	}
+	if today == nil { // no orders today yet
+		today = new(types.AdbOrderStats)
+	}
+
+	var (
+		num, fee = today.Paid + today.PaidAfterTimeout, today.PaidFee
+		headroom = float64(1)
+	)
+	if dvc.MaxAmount > 0 {
+		headroom = math.Min(headroom, 1-float64(fee)/float64(dvc.MaxAmount))
+	}
+	if dvc.MaxBill > 0 {
+		headroom = math.Min(headroom, 1-float64(num)/float64(dvc.MaxBill))
+	}
+	return math.Max(headroom, 0)
+}
+
+// recent paid rate [0-1] of the finished (paid or timeout) orders in the recent rollups,
+// with the laplace smoothing so the new devices start from 0.5
+func adbDeviceSuccessRate(recent *types.AdbOrderStats) float64 {
+	if recent == nil { // no recent orders
+		recent = new(types.AdbOrderStats)
+	}
+	return float64(recent.Paid+1) / float64(recent.Paid+recent.Timeout+2)
+}
+
+//
+// strategies
+//
+
+func pickupByWeight(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	next := balancer.NewWeight().Next(pickupItems(cands))
+	if next == nil {
+		return nil, ""
+	}
+	return next.(*pickupCandidate), fmt.Sprintf("weighted random among %d candidates", len(cands))
+}
+
+func pickupByRoundRobin(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	next := pickupRoundRobin.Next(pickupItems(cands))
+	if next == nil {
+		return nil, ""
+	}
+	return next.(*pickupCandidate), fmt.Sprintf("smooth weighted round-robin among %d candidates", len(cands))
+}
+
+func pickupByLeastPending(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	for _, cand := range cands {
+		cand.trace.Score = float64(-cand.trace.Pending)
+	}
+	chosen := pickupByScore(cands)
+	if chosen == nil {
+		return nil, ""
+	}
+	return chosen, fmt.Sprintf("least pending orders: %d", chosen.trace.Pending)
+}
+
+func pickupByQuotaHeadroom(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	for _, cand := range cands {
+		cand.trace.Score = cand.trace.Headroom
+	}
+	chosen := pickupByScore(cands)
+	if chosen == nil {
+		return nil, ""
+	}
+	return chosen, fmt.Sprintf("most today quota headroom: %0.2f", chosen.trace.Headroom)
+}
+
+func pickupBySuccessRate(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	for _, cand := range cands {
+		cand.trace.Score = float64(cand.dvc.Weight) * cand.trace.SuccessRate
+		cand.weight = int(math.Ceil(cand.trace.Score * 100))
+	}
+	next := balancer.NewWeight().Next(pickupItems(cands))
+	if next == nil {
+		return nil, ""
+	}
+	chosen := next.(*pickupCandidate)
+	return chosen, fmt.Sprintf("weighted random by weight * success rate, success rate: %0.2f", chosen.trace.SuccessRate)
+}
+
+func pickupByStickyPayer(pctx *pickupContext, cands []*pickupCandidate) (*pickupCandidate, string) {
+	payer := pctx.req.PayerID
+	if payer == "" {
+		chosen, reason := pickupByWeight(pctx, cands)
+		return chosen, "no payer id, fall back to " + reason
+	}
+
+	ids := make([]string, len(cands))
+	for i, cand := range cands {
+		ids[i] = cand.dvc.ID
+	}
+
+	query := bson.M{
+		"merchant_id": MerchantAdbOrdersFilter(pctx.merchant.ID),
+		"payer_id":    payer,
+		"device_id":   bson.M{"$in": ids},
+	}
+	if orders, _ := store.DB().ListAdbOrders(limitPager(1), query); len(orders) > 0 {
+		for _, cand := range cands {
+			if cand.dvc.ID == orders[0].DeviceID {
+				return cand, fmt.Sprintf("sticky to payer %s last order %s", payer, orders[0].ID)
+			}
+		}
+	}
+
+	chosen, reason := pickupByWeight(pctx, cands)
+	return chosen, fmt.Sprintf("no previous order of payer %s on the candidates, fall back to %s", payer, reason)
+}
+
+// pick up the max score candidate, break the ties by the weight, then randomly
+func pickupByScore(cands []*pickupCandidate) *pickupCandidate {
+	if len(cands) == 0 {
+		return nil
+	}
+
+	sorted := make([]*pickupCandidate, len(cands))
+	copy(sorted, cands)
+	rand.Shuffle(len(sorted), func(i, j int) { sorted[i], sorted[j] = sorted[j], sorted[i] })
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := sorted[i].trace.Score, sorted[j].trace.Score; a != b {
+			return a > b
+		}
+		return sorted[i].dvc.Weight > sorted[j].dvc.Weight
+	})
+	return sorted[0]
+}
+
+func pickupItems(cands []*pickupCandidate) []balancer.Item {
+	items := make([]balancer.Item, len(cands))
+	for idx, cand := range cands {
+		items[idx] = cand
+	}
+	return items
+}
+
+// limitPager is a types.Pager only limits the first N records
+type limitPager int
+
+func (p limitPager) Offset() int { return 0 }
+func (p limitPager) Limit() int  { return int(p) }
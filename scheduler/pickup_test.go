@@ -0,0 +1,186 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(pickupSuite))
+
+type pickupSuite struct{}
+
+func (s *pickupSuite) TestPayable(c *check.C) {
+	cand := &pickupCandidate{pending: map[int]bool{2000: true, 1999: true, 1997: true}}
+	c.Assert(cand.payable(2001, 0), check.Equals, 2001)
+	c.Assert(cand.payable(2000, 0), check.Equals, 0)
+	c.Assert(cand.payable(2000, 1), check.Equals, 0)
+	c.Assert(cand.payable(2000, 2), check.Equals, 1998)
+	c.Assert(cand.payable(1999, 5), check.Equals, 1998)
+
+	// only adjusted downward, never below 1 cent
+	cand.pending = map[int]bool{1: true, 2: true}
+	c.Assert(cand.payable(2, 99), check.Equals, 0)
+	c.Assert(cand.payable(3, 99), check.Equals, 3)
+}
+
+func (s *pickupSuite) TestSaveAdbOrderRetry(c *check.C) {
+	var (
+		errTaken = errors.New("E11000 duplicate key error index: uniq_pending_pay_fee")
+		taken    = func(err error) bool { return err == errTaken }
+		saved    []int
+	)
+
+	newOrder := func() *types.AdbOrder {
+		return &types.AdbOrder{
+			ID:             "2019620183258-BA01",
+			DeviceID:       "dvc01",
+			PayFee:         2000,
+			Pickup:         &types.AdbDevicePickup{PayFee: 2000, Reason: "least pending orders: 0", Time: time.Now()},
+			NewAdbOrderReq: types.NewAdbOrderReq{QRType: types.QRCodeTypeAlipay, Fee: 2000},
+			CreatedAt:      time.Now(),
+		}
+	}
+
+	// 2000 & 1999 taken by the concurrent pickups, 1998 held by a timeout order
+	var (
+		order   = newOrder()
+		pending = map[int]bool{2000: true, 1999: true}
+		busy    = func() map[int]bool { return map[int]bool{2000: true, 1999: true, 1998: true} }
+		add     = func(o *types.AdbOrder) error {
+			saved = append(saved, o.PayFee)
+			if pending[o.PayFee] {
+				return errTaken
+			}
+			return nil
+		}
+	)
+	c.Assert(saveAdbOrder(order, 5, busy, add, taken), check.IsNil)
+	c.Assert(saved, check.DeepEquals, []int{2000, 1997})
+	c.Assert(order.PayFee, check.Equals, 1997)
+	c.Assert(order.Pickup.PayFee, check.Equals, 1997)
+	c.Assert(order.Pickup.Reason, check.Matches, ".*payable amount 2000 taken concurrently, adjusted to 1997")
+	c.Assert(order.Events[0].Attrs["pay_fee"], check.Equals, "1997")
+
+	// 1999 is tried after 2000 even if the busy amounts lag behind
+	saved, order = nil, newOrder()
+	busy = func() map[int]bool { return map[int]bool{} }
+	c.Assert(saveAdbOrder(order, 5, busy, add, taken), check.IsNil)
+	c.Assert(saved, check.DeepEquals, []int{2000, 1999, 1998})
+
+	// no more candidate amounts within the offset
+	saved, order = nil, newOrder()
+	c.Assert(saveAdbOrder(order, 1, busy, add, taken), check.ErrorMatches, "the payable amount 1999 was taken concurrently .*")
+	c.Assert(saved, check.DeepEquals, []int{2000, 1999})
+
+	// the other errors are returned without retry
+	saved, order = nil, newOrder()
+	errOther := errors.New("E11000 duplicate key error index: merchant_id_1_out_order_id_1")
+	add = func(o *types.AdbOrder) error { saved = append(saved, o.PayFee); return errOther }
+	c.Assert(saveAdbOrder(order, 5, busy, add, taken), check.Equals, errOther)
+	c.Assert(saved, check.DeepEquals, []int{2000})
+}
+
+func (s *pickupSuite) cand(id string, weight int, trace types.PickupCandidate) *pickupCandidate {
+	trace.DeviceID, trace.Weight = id, weight
+	return &pickupCandidate{dvc: &types.AdbDevice{ID: id, Weight: weight}, weight: weight, trace: &trace}
+}
+
+func (s *pickupSuite) TestQuotaHeadroom(c *check.C) {
+	dvc := &types.AdbDevice{ID: "dvc01"}
+	c.Assert(adbDeviceQuotaHeadroom(dvc, &types.AdbOrderStats{Paid: 100}), check.Equals, float64(1)) // unlimited
+
+	dvc.MaxBill = 10
+	c.Assert(adbDeviceQuotaHeadroom(dvc, nil), check.Equals, float64(1)) // no orders today yet
+	c.Assert(adbDeviceQuotaHeadroom(dvc, &types.AdbOrderStats{Paid: 3, PaidAfterTimeout: 1, Timeout: 5}), check.Equals, 0.6)
+
+	dvc.MaxAmount = 10000 // the less one of the two quotas
+	c.Assert(adbDeviceQuotaHeadroom(dvc, &types.AdbOrderStats{Paid: 3, PaidAfterTimeout: 1, PaidFee: 7500}), check.Equals, 0.25)
+	c.Assert(adbDeviceQuotaHeadroom(dvc, &types.AdbOrderStats{Paid: 12, PaidFee: 7500}), check.Equals, float64(0)) // over quota
+}
+
+func (s *pickupSuite) TestSuccessRate(c *check.C) {
+	c.Assert(adbDeviceSuccessRate(nil), check.Equals, 0.5) // the new device
+	c.Assert(adbDeviceSuccessRate(&types.AdbOrderStats{Paid: 8}), check.Equals, 0.9)
+	c.Assert(adbDeviceSuccessRate(&types.AdbOrderStats{Paid: 2, Timeout: 6, PaidAfterTimeout: 3, Pending: 5}), check.Equals, 0.3)
+}
+
+func (s *pickupSuite) TestPickupByScore(c *check.C) {
+	pctx := &pickupContext{req: &types.NewAdbOrderReq{Fee: 2000}}
+
+	cands := []*pickupCandidate{
+		s.cand("dvc01", 10, types.PickupCandidate{Pending: 3, Headroom: 0.2}),
+		s.cand("dvc02", 10, types.PickupCandidate{Pending: 1, Headroom: 0.9}),
+		s.cand("dvc03", 50, types.PickupCandidate{Pending: 1, Headroom: 0.5}),
+	}
+
+	// the ties broken by the weight
+	chosen, reason := pickupByLeastPending(pctx, cands)
+	c.Assert(chosen.dvc.ID, check.Equals, "dvc03")
+	c.Assert(reason, check.Equals, "least pending orders: 1")
+	c.Assert(cands[0].trace.Score, check.Equals, float64(-3))
+
+	chosen, reason = pickupByQuotaHeadroom(pctx, cands)
+	c.Assert(chosen.dvc.ID, check.Equals, "dvc02")
+	c.Assert(reason, check.Equals, "most today quota headroom: 0.90")
+
+	// the full ties broken randomly
+	var (
+		seen = make(map[string]bool)
+		ties = []*pickupCandidate{
+			s.cand("dvc01", 10, types.PickupCandidate{Score: 0.5}),
+			s.cand("dvc02", 10, types.PickupCandidate{Score: 0.5}),
+		}
+	)
+	for i := 0; i < 100; i++ {
+		seen[pickupByScore(ties).dvc.ID] = true
+	}
+	c.Assert(seen, check.HasLen, 2)
+
+	c.Assert(pickupByScore(nil), check.IsNil)
+}
+
+func (s *pickupSuite) TestPickupBySuccessRate(c *check.C) {
+	pctx := &pickupContext{req: &types.NewAdbOrderReq{Fee: 2000}}
+
+	cands := []*pickupCandidate{
+		s.cand("dvc01", 10, types.PickupCandidate{SuccessRate: 0.25}),
+		s.cand("dvc02", 0, types.PickupCandidate{SuccessRate: 0.99}), // disabled by the weight
+	}
+	for i := 0; i < 10; i++ {
+		chosen, reason := pickupBySuccessRate(pctx, cands)
+		c.Assert(chosen.dvc.ID, check.Equals, "dvc01")
+		c.Assert(reason, check.Equals, "weighted random by weight * success rate, success rate: 0.25")
+	}
+	c.Assert(cands[0].trace.Score, check.Equals, 2.5)
+	c.Assert(cands[0].weight, check.Equals, 250)
+	c.Assert(cands[1].weight, check.Equals, 0)
+}
+
+func (s *pickupSuite) TestPickupByRoundRobin(c *check.C) {
+	pctx := &pickupContext{req: &types.NewAdbOrderReq{Fee: 2000}}
+
+	cands := []*pickupCandidate{
+		s.cand("rr-dvc01", 2, types.PickupCandidate{}),
+		s.cand("rr-dvc02", 1, types.PickupCandidate{}),
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		chosen, reason := pickupByRoundRobin(pctx, cands)
+		c.Assert(reason, check.Equals, "smooth weighted round-robin among 2 candidates")
+		counts[chosen.dvc.ID]++
+	}
+	c.Assert(counts, check.DeepEquals, map[string]int{"rr-dvc01": 20, "rr-dvc02": 10})
+}
+
+func (s *pickupSuite) TestPickupByStickyPayerWithoutPayer(c *check.C) {
+	pctx := &pickupContext{req: &types.NewAdbOrderReq{Fee: 2000}}
+
+	cands := []*pickupCandidate{s.cand("dvc01", 10, types.PickupCandidate{})}
+	chosen, reason := pickupByStickyPayer(pctx, cands)
+	c.Assert(chosen.dvc.ID, check.Equals, "dvc01")
+	c.Assert(reason, check.Equals, "no payer id, fall back to weighted random among 1 candidates")
+}
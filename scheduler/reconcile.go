@@ -0,0 +1,409 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Daily Reconciliation
+//
+//  list all of the bills of the day on each adb device payment app, and compare them against
+//  the adb orders of the day on the device:
+//    - the bill comment is the order id, otherwise matched by the only paid order with the same payable amount,
+//      or the only unpaid (pending, timeout, closed) one if none of the paid orders has the amount
+//    - unmatched_bill:   incoming payment bill without any matched order
+//    - missing_bill:     order marked as paid but no bill found
+//    - amount_mismatch:  bill amount differs from the order payable amount
+//    - unpaid_with_bill: bill found but the order is not marked as paid
+//
+
+var (
+	reconcileMux sync.Mutex // protect the reconciliation startup
+
+	reconcileConcurrency = 4             // max devices listing the day bills at the same time
+	reconcileTimeout     = time.Hour * 2 // the devices not scanned before are reported as error
+	errReconcileTimeout  = errors.New("skipped, the reconciliation timeout")
+)
+
+// IsAdbReconcileRunning check if the reconciliation of the day (2006-01-02) is running
+func IsAdbReconcileRunning(date string) bool {
+	return IsRegisteredGoRoutine("adb_reconcile", date)
+}
+
+// StartAdbReconcile start the reconciliation of the day in background,
+// return conflict error if the same day reconciliation is running
+func StartAdbReconcile(day time.Time) error {
+	date := day.Format("2006-01-02")
+
+	reconcileMux.Lock()
+	defer reconcileMux.Unlock()
+
+	if IsAdbReconcileRunning(date) {
+		return fmt.Errorf("conflict: the reconciliation of %s is running", date)
+	}
+	RegisterGoroutine("adb_reconcile", date)
+
+	go func() {
+		defer DeRegisterGoroutine("adb_reconcile", date)
+		if _, err := runAdbReconcile(day); err != nil {
+			log.Errorf("adb reconciliation of %s error: %v", date, err)
+		}
+	}()
+	return nil
+}
+
+// reconcile the yesterday, triggered by the cron daemon on the leader
+func reconcileYesterday() {
+	if !isLeader() {
+		return
+	}
+	if err := StartAdbReconcile(time.Now().AddDate(0, 0, -1)); err != nil {
+		log.Warnln(err)
+	}
+}
+
+func runAdbReconcile(day time.Time) (ret *types.AdbReconcile, err error) {
+	var (
+		start, end = dayRange(day)
+		date       = start.Format("2006-01-02")
+		reconcile  = &types.AdbReconcile{
+			ID:        date,
+			Status:    types.AdbReconcileStatusRunning,
+			Devices:   []*types.AdbReconcileDevice{},
+			CreatedAt: time.Now(),
+		}
+	)
+
+	if err = store.DB().UpsertAdbReconcile(reconcile); err != nil {
+		return nil, err
+	}
+
+	// never leave the report running on any exit path
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		finishAdbReconcile(reconcile, err)
+		if uerr := store.DB().UpsertAdbReconcile(reconcile); uerr != nil && err == nil {
+			err = uerr
+		}
+		if err != nil {
+			ret = nil
+		}
+	}()
+
+	dvcs, err := store.DB().ListAdbDevices(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("adb reconciliation of %s started on %d devices", date, len(dvcs))
+
+	type task struct {
+		dvc *types.AdbDevice
+		app string
+	}
+	var tasks []task
+	for _, dvc := range dvcs {
+		for _, app := range boundPaymentApps(dvc) {
+			tasks = append(tasks, task{dvc, app})
+		}
+	}
+
+	var (
+		deadline = time.Now().Add(reconcileTimeout)
+		results  = make([]*types.AdbReconcileDevice, len(tasks))
+		tokens   = make(chan struct{}, reconcileConcurrency)
+		wg       sync.WaitGroup
+	)
+	for idx, t := range tasks {
+		tokens <- struct{}{}
+		if time.Now().After(deadline) {
+			<-tokens
+			results[idx] = &types.AdbReconcileDevice{DeviceID: t.dvc.ID, NodeID: t.dvc.NodeID, App: t.app, Issues: []*types.AdbReconcileIssue{}, Error: errReconcileTimeout.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, t task) {
+			defer func() { <-tokens; wg.Done() }()
+			results[idx] = reconcileAdbDevice(t.dvc, t.app, start, end)
+		}(idx, t)
+	}
+	wg.Wait()
+
+	for _, rd := range results {
+		reconcile.Devices = append(reconcile.Devices, rd)
+		reconcile.NumBills += rd.NumBills
+		reconcile.NumOrders += rd.NumOrders
+		reconcile.NumIssues += len(rd.Issues)
+		if rd.Error != "" {
+			reconcile.NumErrors++
+		}
+	}
+
+	log.Printf("adb reconciliation of %s finished with %d issues", date, reconcile.NumIssues)
+
+	if err := PushTGMessage(reconcileSummaryText(reconcile)); err != nil {
+		log.Warnf("push adb reconciliation of %s to telegram error: %v", date, err)
+	}
+
+	return reconcile, nil
+}
+
+// mark the reconciliation report as done or failed with the error
+func finishAdbReconcile(reconcile *types.AdbReconcile, err error) {
+	reconcile.Status = types.AdbReconcileStatusDone
+	reconcile.ErrMsg = ""
+	if err != nil {
+		reconcile.Status = types.AdbReconcileStatusFailed
+		reconcile.ErrMsg = err.Error()
+	}
+	reconcile.FinishedAt = time.Now()
+}
+
+// the payment apps bound on the adb device
+func boundPaymentApps(dvc *types.AdbDevice) []string {
+	apps := []string{}
+	if dvc.Alipay != nil {
+		apps = append(apps, types.QRCodeTypeAlipay)
+	}
+	if dvc.Wxpay != nil {
+		apps = append(apps, types.QRCodeTypeWxpay)
+	}
+	return apps
+}
+
+func reconcileAdbDevice(dvc *types.AdbDevice, app string, start, end time.Time) *types.AdbReconcileDevice {
+	ret := &types.AdbReconcileDevice{
+		DeviceID: dvc.ID,
+		NodeID:   dvc.NodeID,
+		App:      app,
+		Issues:   []*types.AdbReconcileIssue{},
+	}
+
+	bills, err := DoNodeListAdbPayDayBills(dvc.NodeID, dvc.ID, app, start.Format("2006-01-02"))
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+
+	// the paid orders by the paid time, the others by the created time
+	query := bson.M{
+		"device_id": dvc.ID,
+		"qrtype":    app,
+		"$or": []bson.M{
+			{
+				"status":  bson.M{"$in": []string{types.AdbOrderStatusPaid, types.AdbOrderStatusPaidAfterTimeout}},
+				"paid_at": bson.M{"$gte": start, "$lt": end},
+			},
+			{
+				"status":     bson.M{"$in": []string{types.AdbOrderStatusPending, types.AdbOrderStatusTimeout, types.AdbOrderStatusClosed}},
+				"created_at": bson.M{"$gte": start, "$lt": end},
+			},
+		},
+	}
+	orders, err := store.DB().ListAdbOrders(nil, query)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+
+	ret.NumBills = len(bills)
+	ret.NumOrders = len(orders)
+	for _, bill := range bills {
+		ret.BillFee += bill.Fee()
+	}
+	for _, order := range orders {
+		if isAdbOrderPaid(order) {
+			ret.NumPaid++
+			ret.PaidFee += order.Payable()
+		}
+	}
+
+	ret.Issues = reconcileBills(bills, orders)
+	return ret
+}
+
+// compare the bills against the orders and return the found issues
+func reconcileBills(bills []*adbot.PayOrder, orders []*types.AdbOrder) []*types.AdbReconcileIssue {
+	var (
+		issues   = []*types.AdbReconcileIssue{}
+		byID     = make(map[string]*types.AdbOrder)
+		matched  = make(map[string]bool) // order id -> matched with a bill
+		leftover = []*adbot.PayOrder{}
+	)
+
+	for _, order := range orders {
+		byID[order.ID] = order
+	}
+
+	// match by the bill comment
+	for _, bill := range bills {
+		order, ok := byID[strings.TrimSpace(bill.Comment)]
+		if !ok || matched[order.ID] {
+			leftover = append(leftover, bill)
+			continue
+		}
+		matched[order.ID] = true
+		issues = append(issues, checkBillOrder(bill, order)...)
+	}
+
+	// match the leftover bills by the only unmatched paid order with the same payable amount,
+	// then the only unpaid one, eg: the payment arrived after the order timeout
+	for _, bill := range leftover {
+		candidates := amountCandidates(bill, orders, matched, true)
+		if len(candidates) == 0 {
+			candidates = amountCandidates(bill, orders, matched, false)
+			if len(candidates) == 1 {
+				order := candidates[0]
+				matched[order.ID] = true
+				issues = append(issues, &types.AdbReconcileIssue{
+					Type:        types.AdbReconcileIssueUnpaidWithBill,
+					OrderID:     order.ID,
+					OrderStatus: order.Status,
+					OrderFee:    order.Payable(),
+					Bill:        bill,
+					Message:     fmt.Sprintf("bill matched by the amount only, but the order is %s", order.Status),
+				})
+				continue
+			}
+		}
+
+		if len(candidates) != 1 {
+			issues = append(issues, &types.AdbReconcileIssue{
+				Type:    types.AdbReconcileIssueUnmatchedBill,
+				Bill:    bill,
+				Message: fmt.Sprintf("incoming payment %s without matched order, %d candidates", bill.Amount, len(candidates)),
+			})
+			continue
+		}
+
+		matched[candidates[0].ID] = true
+	}
+
+	// the paid orders without any bill
+	for _, order := range orders {
+		if matched[order.ID] || !isAdbOrderPaid(order) {
+			continue
+		}
+		issues = append(issues, &types.AdbReconcileIssue{
+			Type:        types.AdbReconcileIssueMissingBill,
+			OrderID:     order.ID,
+			OrderStatus: order.Status,
+			OrderFee:    order.Payable(),
+			Message:     "order marked as paid but no bill found",
+		})
+	}
+
+	return issues
+}
+
+// the unmatched paid or unpaid orders with the same payable amount of the bill
+func amountCandidates(bill *adbot.PayOrder, orders []*types.AdbOrder, matched map[string]bool, paid bool) []*types.AdbOrder {
+	var candidates []*types.AdbOrder
+	for _, order := range orders {
+		if matched[order.ID] || isAdbOrderPaid(order) != paid || order.Payable() != bill.Fee() {
+			continue
+		}
+		candidates = append(candidates, order)
+	}
+	return candidates
+}
+
+// check the order against the bill which comment matched the order id
+func checkBillOrder(bill *adbot.PayOrder, order *types.AdbOrder) []*types.AdbReconcileIssue {
+	var issues []*types.AdbReconcileIssue
+
+	if fee := bill.Fee(); fee != order.Payable() {
+		issues = append(issues, &types.AdbReconcileIssue{
+			Type:        types.AdbReconcileIssueAmountMismatch,
+			OrderID:     order.ID,
+			OrderStatus: order.Status,
+			OrderFee:    order.Payable(),
+			Bill:        bill,
+			Message:     fmt.Sprintf("bill amount %d != order payable amount %d", fee, order.Payable()),
+		})
+	}
+
+	if !isAdbOrderPaid(order) {
+		issues = append(issues, &types.AdbReconcileIssue{
+			Type:        types.AdbReconcileIssueUnpaidWithBill,
+			OrderID:     order.ID,
+			OrderStatus: order.Status,
+			OrderFee:    order.Payable(),
+			Bill:        bill,
+			Message:     fmt.Sprintf("bill found but the order is %s", order.Status),
+		})
+	}
+
+	return issues
+}
+
+func isAdbOrderPaid(order *types.AdbOrder) bool {
+	return order.Status == types.AdbOrderStatusPaid || order.Status == types.AdbOrderStatusPaidAfterTimeout
+}
+
+func reconcileSummaryText(reconcile *types.AdbReconcile) string {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "adb reconciliation %s\n", reconcile.ID)
+	fmt.Fprintf(buf, "bills: %d, orders: %d, issues: %d, errors: %d\n",
+		reconcile.NumBills, reconcile.NumOrders, reconcile.NumIssues, reconcile.NumErrors)
+
+	for _, rd := range reconcile.Devices {
+		if rd.Error == "" && len(rd.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "\n%s/%s:", rd.DeviceID, rd.App)
+		if rd.Error != "" {
+			fmt.Fprintf(buf, " error: %s", rd.Error)
+		}
+		counts := make(map[string]int)
+		for _, issue := range rd.Issues {
+			counts[issue.Type]++
+		}
+		for _, typ := range []string{
+			types.AdbReconcileIssueUnmatchedBill,
+			types.AdbReconcileIssueMissingBill,
+			types.AdbReconcileIssueAmountMismatch,
+			types.AdbReconcileIssueUnpaidWithBill,
+		} {
+			if n := counts[typ]; n > 0 {
+				fmt.Fprintf(buf, " %s=%d", typ, n)
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// the local day start & end of the given time
+func dayRange(t time.Time) (time.Time, time.Time) {
+	t = t.In(time.Local)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// ParseReconcileDate parse the reconciliation day (2006-01-02) by the local time,
+// which must be earlier than tomorrow
+func ParseReconcileDate(date string) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, end := dayRange(time.Now()); !day.Before(end) {
+		return time.Time{}, errors.New("can't reconcile the future day")
+	}
+	return day, nil
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"errors"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(reconcileSuite))
+
+type reconcileSuite struct{}
+
+func (s *reconcileSuite) order(id, status string, payFee int) *types.AdbOrder {
+	return &types.AdbOrder{ID: id, Status: status, PayFee: payFee, NewAdbOrderReq: types.NewAdbOrderReq{Fee: payFee}}
+}
+
+func (s *reconcileSuite) issues(issues []*types.AdbReconcileIssue) map[string][]string {
+	ret := make(map[string][]string)
+	for _, issue := range issues {
+		ret[issue.Type] = append(ret[issue.Type], issue.OrderID)
+	}
+	return ret
+}
+
+func (s *reconcileSuite) TestReconcileBillsByComment(c *check.C) {
+	var (
+		orders = []*types.AdbOrder{
+			s.order("o1", types.AdbOrderStatusPaid, 100),
+			s.order("o2", types.AdbOrderStatusPaid, 200),
+			s.order("o3", types.AdbOrderStatusTimeout, 300),
+			s.order("o4", types.AdbOrderStatusPaidAfterTimeout, 400),
+		}
+		bills = []*adbot.PayOrder{
+			{Comment: "o1", Amount: "1.00"},
+			{Comment: " o2 ", Amount: "1.99"}, // amount mismatch
+			{Comment: "o3", Amount: "3.00"},   // paid after the order timeout
+		}
+	)
+
+	issues := s.issues(reconcileBills(bills, orders))
+	c.Assert(issues, check.DeepEquals, map[string][]string{
+		types.AdbReconcileIssueAmountMismatch: {"o2"},
+		types.AdbReconcileIssueUnpaidWithBill: {"o3"},
+		types.AdbReconcileIssueMissingBill:    {"o4"},
+	})
+
+	// all matched
+	c.Assert(reconcileBills(bills[:1], orders[:1]), check.HasLen, 0)
+}
+
+func (s *reconcileSuite) TestReconcileBillsByAmount(c *check.C) {
+	var (
+		orders = []*types.AdbOrder{
+			s.order("o1", types.AdbOrderStatusPaid, 100),
+			s.order("o2", types.AdbOrderStatusPaid, 200),
+			s.order("o3", types.AdbOrderStatusPaid, 200),
+			s.order("o4", types.AdbOrderStatusTimeout, 100), // the paid o1 with the same amount preferred
+			s.order("o5", types.AdbOrderStatusTimeout, 500),
+			s.order("o6", types.AdbOrderStatusPending, 600),
+			s.order("o7", types.AdbOrderStatusTimeout, 700),
+			s.order("o8", types.AdbOrderStatusClosed, 700),
+		}
+		bills = []*adbot.PayOrder{
+			{Comment: "", Amount: "1.00"},      // the only paid o1
+			{Comment: "bbk", Amount: "2.00"},   // ambiguous o2 & o3
+			{Comment: "", Amount: "5.00"},      // the only unpaid o5, timed out
+			{Comment: "o9", Amount: "6.00"},    // the only unpaid o6, still pending
+			{Comment: "", Amount: "7.00"},      // ambiguous unpaid o7 & o8
+			{Comment: "", Amount: "8.00"},      // nothing
+			{Comment: "o1", Amount: "1.00"},    // o1 matched already, the only unpaid o4 left
+			{Comment: "", Amount: "not a fee"}, // unrecognized
+		}
+	)
+
+	ret := reconcileBills(bills, orders)
+	issues := s.issues(ret)
+	c.Assert(issues[types.AdbReconcileIssueUnpaidWithBill], check.DeepEquals, []string{"o4", "o5", "o6"})
+	c.Assert(issues[types.AdbReconcileIssueUnmatchedBill], check.HasLen, 4) // 2.00, 7.00, 8.00, not a fee
+	c.Assert(issues[types.AdbReconcileIssueMissingBill], check.DeepEquals, []string{"o2", "o3"})
+	c.Assert(issues[types.AdbReconcileIssueAmountMismatch], check.HasLen, 0)
+
+	for _, issue := range ret {
+		switch issue.Type {
+		case types.AdbReconcileIssueUnpaidWithBill:
+			c.Assert(issue.Message, check.Matches, "bill matched by the amount only, but the order is (timeout|pending)")
+		case types.AdbReconcileIssueUnmatchedBill:
+			c.Assert(issue.Bill, check.NotNil)
+		}
+	}
+}
+
+func (s *reconcileSuite) TestFinishAdbReconcile(c *check.C) {
+	reconcile := &types.AdbReconcile{ID: "2019-06-10", Status: types.AdbReconcileStatusRunning}
+
+	finishAdbReconcile(reconcile, errors.New("list adb devices: no reachable servers"))
+	c.Assert(reconcile.Status, check.Equals, types.AdbReconcileStatusFailed)
+	c.Assert(reconcile.ErrMsg, check.Equals, "list adb devices: no reachable servers")
+	c.Assert(reconcile.FinishedAt.IsZero(), check.Equals, false)
+
+	finishAdbReconcile(reconcile, nil)
+	c.Assert(reconcile.Status, check.Equals, types.AdbReconcileStatusDone)
+	c.Assert(reconcile.ErrMsg, check.Equals, "")
+}
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
@@ -126,6 +127,18 @@ func MemoSettingsSet(req *types.UpdateSettingsReq) error {
 	if req.TGBotToken != nil {
 		setUpdator["tg_bot_token"] = *req.TGBotToken
 	}
+	if req.TGChatID != nil {
+		setUpdator["tg_chat_id"] = *req.TGChatID
+	}
+	if req.PickupStrategy != nil {
+		setUpdator["pickup_strategy"] = *req.PickupStrategy
+	}
+	if req.PayFeeOffset != nil {
+		setUpdator["pay_fee_offset"] = *req.PayFeeOffset
+	}
+	if req.CashierBaseURL != nil {
+		setUpdator["cashier_base_url"] = strings.TrimSuffix(*req.CashierBaseURL, "/")
+	}
 	return store.DB().UpsertSettings(bson.M{"$set": setUpdator})
 }
 
@@ -192,35 +205,37 @@ func MemoAdbDeviceAlipay(id string, alipay *types.AlipayAccount) error {
 	return store.DB().UpdateAdbDevice(id, bson.M{"$set": setUpdator})
 }
 
+// MemoAdbDeviceWxpay update db AdbDevice's Wxpay
+func MemoAdbDeviceWxpay(id string, wxpay *types.WxpayAccount) error {
+	setUpdator := bson.M{"wxpay": wxpay}
+	return store.DB().UpdateAdbDevice(id, bson.M{"$set": setUpdator})
+}
+
 //
 // adb orders
 //
 
-// MemoAdbOrderStatus update db Adb Order's Status
-func MemoAdbOrderStatus(orderID, status string) error {
-	setUpdator := bson.M{"status": status}
-	if status == types.AdbOrderStatusPaid {
-		setUpdator["paid_at"] = time.Now()
-	}
-	update := bson.M{"$set": setUpdator}
-	return store.DB().UpdateAdbOrder(orderID, update)
-}
-
 // MemoAdbOrderResponse update db Adb Order's Response
 func MemoAdbOrderResponse(orderID string, resp *types.NewAdbOrderResp) error {
 	update := bson.M{"$set": bson.M{"response": resp}}
 	return store.DB().UpdateAdbOrder(orderID, update)
 }
 
+// MemoAdbOrderQRCode update db Adb Order's QRCode
+func MemoAdbOrderQRCode(orderID string, qrpng []byte) error {
+	update := bson.M{"$set": bson.M{"qrcode": qrpng}}
+	return store.DB().UpdateAdbOrder(orderID, update)
+}
+
 // MemoAdbOrderCallback update db Adb Order's Callback
 func MemoAdbOrderCallback(orderID string, cb *types.NewAdbOrderCallback) error {
 	update := bson.M{"$set": bson.M{"callback": cb}}
 	return store.DB().UpdateAdbOrder(orderID, update)
 }
 
-// MemoAdbOrderCallbackStatus update db Adb Order's CallbackStatus
-func MemoAdbOrderCallbackStatus(orderID, status string) error {
-	update := bson.M{"$set": bson.M{"callback_status": status}}
+// AppendAdbOrderEvents push db Adb Order's lifecycle Events
+func AppendAdbOrderEvents(orderID string, evs ...*types.AdbOrderEvent) error {
+	update := bson.M{"$push": bson.M{"events": bson.M{"$each": evs}}}
 	return store.DB().UpdateAdbOrder(orderID, update)
 }
 
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Order Settlement Report
+//
+//  the orders are iterated from the db cursor and counted into the groups one by one,
+//  so the memory only grows with the number of groups, not the orders.
+//
+
+// AdbOrderSettlement build the settlement report of the adb orders matched the query
+func AdbOrderSettlement(query bson.M, groupBy string, startAt, endAt time.Time) (*types.AdbOrderReport, error) {
+	if err := types.ValidAdbOrderReportGroupBy(groupBy); err != nil {
+		return nil, err
+	}
+	if groupBy == types.AdbOrderReportByAlipay {
+		query["qrtype"] = types.QRCodeTypeAlipay
+	}
+
+	iter := func(fn func(*types.AdbOrder) error) error {
+		return store.DB().IterAdbOrders(query, fn)
+	}
+	return settleAdbOrders(iter, newReportNamer(), groupBy, startAt, endAt)
+}
+
+// count the iterated orders into the groups and settle the report
+func settleAdbOrders(iter func(func(*types.AdbOrder) error) error, namer *reportNamer, groupBy string, startAt, endAt time.Time) (*types.AdbOrderReport, error) {
+	groups := make(map[string]*types.AdbOrderReportRow)
+
+	err := iter(func(order *types.AdbOrder) error {
+		key, name := namer.group(order, groupBy)
+		row, ok := groups[key]
+		if !ok {
+			row = types.NewAdbOrderReportRow(key, name)
+			groups[key] = row
+		}
+		row.Add(order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.AdbOrderReport{
+		GroupBy: groupBy,
+		StartAt: startAt,
+		EndAt:   endAt,
+		Rows:    make([]*types.AdbOrderReportRow, 0, len(groups)),
+		Total:   types.NewAdbOrderReportRow("total", ""),
+	}
+	for _, row := range groups {
+		row.Settle()
+		report.Rows = append(report.Rows, row)
+		report.Total.Merge(row)
+	}
+	report.Total.Settle()
+
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Key < report.Rows[j].Key })
+	return report, nil
+}
+
+// reportNamer resolve the group key & name of the orders,
+// cache the devices & merchants as they are looked up repeatly
+type reportNamer struct {
+	devices   map[string]*types.AdbDevice
+	merchants map[string]*types.Merchant
+
+	getDevice   func(id string) (*types.AdbDevice, error)
+	getMerchant func(id string) (*types.Merchant, error)
+}
+
+func newReportNamer() *reportNamer {
+	return newReportNamerWith(store.DB().GetAdbDevice, store.DB().GetMerchant)
+}
+
+func newReportNamerWith(getDevice func(string) (*types.AdbDevice, error), getMerchant func(string) (*types.Merchant, error)) *reportNamer {
+	return &reportNamer{
+		devices:     make(map[string]*types.AdbDevice),
+		merchants:   make(map[string]*types.Merchant),
+		getDevice:   getDevice,
+		getMerchant: getMerchant,
+	}
+}
+
+func (n *reportNamer) group(order *types.AdbOrder, groupBy string) (string, string) {
+	switch groupBy {
+
+	case types.AdbOrderReportByDay:
+		day := order.CreatedAt.In(time.Local).Format("2006-01-02")
+		return day, day
+
+	case types.AdbOrderReportByDevice:
+		if dvc := n.device(order.DeviceID); dvc != nil {
+			return order.DeviceID, dvc.Desc
+		}
+		return order.DeviceID, ""
+
+	case types.AdbOrderReportByAlipay:
+		if alipay := order.Alipay; alipay != nil {
+			return alipay.UserID, alipay.Username
+		}
+		return "", "" // the legacy orders created without the payee account
+
+	case types.AdbOrderReportByMerchant:
+		id := order.MerchantOrDefault()
+		if merchant := n.merchant(id); merchant != nil {
+			return id, merchant.Name
+		}
+		return id, ""
+	}
+
+	return "", ""
+}
+
+func (n *reportNamer) device(id string) *types.AdbDevice {
+	if dvc, ok := n.devices[id]; ok {
+		return dvc
+	}
+	dvc, _ := n.getDevice(id) // nil if removed
+	n.devices[id] = dvc
+	return dvc
+}
+
+func (n *reportNamer) merchant(id string) *types.Merchant {
+	if merchant, ok := n.merchants[id]; ok {
+		return merchant
+	}
+	merchant, _ := n.getMerchant(id) // nil if removed
+	n.merchants[id] = merchant
+	return merchant
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(reportSuite))
+
+type reportSuite struct{}
+
+func (s *reportSuite) namer() *reportNamer {
+	var (
+		devices = map[string]*types.AdbDevice{
+			"dvc01": {ID: "dvc01", Desc: "shelf 1", Alipay: &types.AlipayAccount{UserID: "2088000000000003", Username: "rebound"}},
+		}
+		merchants = map[string]*types.Merchant{
+			types.DefaultMerchantID: {ID: types.DefaultMerchantID, Name: "default"},
+			"shop01":                {ID: "shop01", Name: "Shop 01"},
+		}
+		errNotFound = errors.New("not found")
+	)
+
+	return newReportNamerWith(
+		func(id string) (*types.AdbDevice, error) {
+			if dvc, ok := devices[id]; ok {
+				return dvc, nil
+			}
+			return nil, errNotFound
+		},
+		func(id string) (*types.Merchant, error) {
+			if merchant, ok := merchants[id]; ok {
+				return merchant, nil
+			}
+			return nil, errNotFound
+		},
+	)
+}
+
+func (s *reportSuite) orders() []*types.AdbOrder {
+	var (
+		day1   = time.Date(2019, 6, 17, 23, 59, 0, 0, time.Local)
+		day2   = day1.Add(time.Minute * 2)
+		alipay = &types.AlipayAccount{UserID: "2088000000000001", Username: "payee1"}
+		other  = &types.AlipayAccount{UserID: "2088000000000002", Username: "payee2"}
+	)
+	return []*types.AdbOrder{
+		{ID: "o1", Status: types.AdbOrderStatusPaid, DeviceID: "dvc01", Alipay: alipay, NewAdbOrderReq: types.NewAdbOrderReq{Fee: 100}, CreatedAt: day1},
+		{ID: "o2", Status: types.AdbOrderStatusTimeout, MerchantID: "shop01", DeviceID: "dvc01", Alipay: other, NewAdbOrderReq: types.NewAdbOrderReq{Fee: 200}, CreatedAt: day1},
+		{ID: "o3", Status: types.AdbOrderStatusPaid, MerchantID: types.DefaultMerchantID, DeviceID: "dvc01", Alipay: alipay, NewAdbOrderReq: types.NewAdbOrderReq{Fee: 300}, CreatedAt: day2},
+		{ID: "o4", Status: types.AdbOrderStatusPaid, MerchantID: "shop02", DeviceID: "dvc02", NewAdbOrderReq: types.NewAdbOrderReq{Fee: 400}, CreatedAt: day2}, // legacy without the payee account
+	}
+}
+
+func (s *reportSuite) settle(c *check.C, groupBy string) *types.AdbOrderReport {
+	iter := func(fn func(*types.AdbOrder) error) error {
+		for _, order := range s.orders() {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	report, err := settleAdbOrders(iter, s.namer(), groupBy, time.Time{}, time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report.GroupBy, check.Equals, groupBy)
+	c.Assert(report.Total.Orders, check.Equals, 4)
+	c.Assert(report.Total.PaidFee, check.Equals, 800)
+	c.Assert(report.Total.SuccessRate, check.Equals, 0.75)
+	return report
+}
+
+func (s *reportSuite) rows(report *types.AdbOrderReport) [][]interface{} {
+	ret := make([][]interface{}, len(report.Rows))
+	for idx, row := range report.Rows {
+		ret[idx] = []interface{}{row.Key, row.Name, row.Orders, row.PaidFee}
+	}
+	return ret
+}
+
+func (s *reportSuite) TestSettleByMerchant(c *check.C) {
+	// the legacy orders are settled under the default merchant
+	c.Assert(s.rows(s.settle(c, types.AdbOrderReportByMerchant)), check.DeepEquals, [][]interface{}{
+		{types.DefaultMerchantID, "default", 2, 400},
+		{"shop01", "Shop 01", 1, 0},
+		{"shop02", "", 1, 400}, // the merchant removed
+	})
+}
+
+func (s *reportSuite) TestSettleByAlipay(c *check.C) {
+	// by the payee account stored on the order, not the one currently bound on the device
+	c.Assert(s.rows(s.settle(c, types.AdbOrderReportByAlipay)), check.DeepEquals, [][]interface{}{
+		{"", "", 1, 400},
+		{"2088000000000001", "payee1", 2, 400},
+		{"2088000000000002", "payee2", 1, 0},
+	})
+}
+
+func (s *reportSuite) TestSettleByDayAndDevice(c *check.C) {
+	c.Assert(s.rows(s.settle(c, types.AdbOrderReportByDay)), check.DeepEquals, [][]interface{}{
+		{"2019-06-17", "2019-06-17", 2, 100},
+		{"2019-06-18", "2019-06-18", 2, 700},
+	})
+	c.Assert(s.rows(s.settle(c, types.AdbOrderReportByDevice)), check.DeepEquals, [][]interface{}{
+		{"dvc01", "shelf 1", 3, 400},
+		{"dvc02", "", 1, 400},
+	})
+}
+
+func (s *reportSuite) TestSettleIterError(c *check.C) {
+	iter := func(fn func(*types.AdbOrder) error) error { return errors.New("cursor killed") }
+	_, err := settleAdbOrders(iter, s.namer(), types.AdbOrderReportByDay, time.Time{}, time.Time{})
+	c.Assert(err, check.ErrorMatches, "cursor killed")
+}
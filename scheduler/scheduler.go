@@ -14,6 +14,7 @@ import (
 	"github.com/bbklab/adbot/pkg/mole"
 	"github.com/bbklab/adbot/pkg/pubsub"
 	"github.com/bbklab/adbot/pkg/routine"
+	"github.com/bbklab/adbot/types"
 )
 
 var (
@@ -31,6 +32,7 @@ type Scheduler struct {
 	cron         *cron.Cron        // cron
 	adbcbpub     *pubsub.Publisher // adbpay order callback event publisher
 	adbevpub     *pubsub.Publisher // adb device event publisher
+	adbstpub     *pubsub.Publisher // adb order status event publisher
 	limitMgr     *rateLimiterMgr   // event rate limiter
 	licMgr       *licMgr           // license manager
 	tgbot        *tgbot            // telegram bot
@@ -67,6 +69,7 @@ func Init(m *mole.Master) {
 		cron:        cron.New(),
 		adbcbpub:    pubsub.NewPublisher(time.Second*5, 1024),
 		adbevpub:    pubsub.NewPublisher(time.Second*5, 1024),
+		adbstpub:    pubsub.NewPublisher(time.Second*5, 16),
 		limitMgr:    newRateLimiter(),
 		licMgr:      newLicMgr(),
 		tgbot:       newRuntimeTGBot(),
@@ -81,6 +84,12 @@ func Init(m *mole.Master) {
 	// start cron daemon
 	// mark all of adb devices .OverQuota == false
 	sched.cron.AddFunc("0 0 0 * * *", func() { ResetAllAdbDevicesOverQuotaFlag() })
+	// reconcile the device bills of yesterday against the adb orders
+	sched.cron.AddFunc("0 30 0 * * *", func() { reconcileYesterday() })
+	// sweep the orphan expired pending adb orders
+	sched.cron.AddFunc("*/10 * * * * *", func() { sweepExpiredAdbOrders() })
+	// re-aggregate the recent adb order stats rollups
+	sched.cron.AddFunc("0 * * * * *", func() { rollupRecentAdbOrderStats() })
 	sched.cron.Start()
 
 	// register node join/die call back
@@ -107,16 +116,31 @@ func isLeader() bool {
 // Pubsub Adb Order Events
 //
 
+var (
+	errAdbOrderClosed = errors.New("adb order closed while waitting for backend adb callback")
+)
+
+// the adb order closed event, distinguished from the paid callback event
+type adbOrderClosedEvent string
+
 // PublishAdbOrderCallbackEvent is exported
 func PublishAdbOrderCallbackEvent(orderID string) {
 	sched.adbcbpub.Publish(orderID)
 }
 
+// PublishAdbOrderClosedEvent stop the pending adb order's callback event waitting
+func PublishAdbOrderClosedEvent(orderID string) {
+	sched.adbcbpub.Publish(adbOrderClosedEvent(orderID))
+}
+
 // SubscribeAdbOrderCallbackEvent is exported
 func SubscribeAdbOrderCallbackEvent(orderID string, timeout time.Duration) error {
 	sub := sched.adbcbpub.Subcribe(func(v interface{}) bool {
-		if vv, ok := v.(string); ok {
+		switch vv := v.(type) {
+		case string:
 			return vv == orderID
+		case adbOrderClosedEvent:
+			return string(vv) == orderID
 		}
 		return false
 	})
@@ -124,7 +148,10 @@ func SubscribeAdbOrderCallbackEvent(orderID string, timeout time.Duration) error
 
 	// hanging wait until timeout
 	select {
-	case <-sub:
+	case v := <-sub:
+		if _, ok := v.(adbOrderClosedEvent); ok {
+			return errAdbOrderClosed
+		}
 		return nil
 
 	case <-time.After(timeout):
@@ -132,6 +159,23 @@ func SubscribeAdbOrderCallbackEvent(orderID string, timeout time.Duration) error
 	}
 }
 
+// PublishAdbOrderStatusEvent notify the adb order status changed
+func PublishAdbOrderStatusEvent(orderID, status string) {
+	sched.adbstpub.Publish(&types.AdbOrderStatusEvent{OrderID: orderID, Status: status, Time: time.Now()})
+}
+
+// SubscribeAdbOrderStatusEvents subscribe the status changed events of the given adb order
+func SubscribeAdbOrderStatusEvents(orderID string) pubsub.Subcriber {
+	return sched.adbstpub.Subcribe(func(v interface{}) bool {
+		return v.(*types.AdbOrderStatusEvent).OrderID == orderID
+	})
+}
+
+// EvictAdbOrderStatusEvents is exported
+func EvictAdbOrderStatusEvents(sub pubsub.Subcriber) {
+	sched.adbstpub.Evict(sub)
+}
+
 // PublishAdbDeviceEvent is exported
 func PublishAdbDeviceEvent(ev *adbot.AdbEvent) {
 	sched.adbevpub.Publish(ev)
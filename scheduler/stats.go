@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/store"
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Order Time-Series Rollups
+//
+//  the orders are pre-aggregated into the rollups by minute, hour & day buckets of the created time,
+//  for each dimension: all, device, node, merchant. every minute the leader aggregates the orders
+//  into the minute rollups incrementally from the last completed bucket, and once more for the
+//  buckets just crossed each of the lags, as the orders keep changing after created: timeout,
+//  paid after timeout, callbacks. the hour & day rollups of the touched buckets are summed up
+//  from the finer rollups, instead of aggregating the orders again.
+//
+
+var (
+	statsRollupMux      sync.Mutex                                    // protect the rollup startup
+	statsRollupLast     time.Time                                     // the last incremental rollup time, zero means catch up the lookback
+	statsRollupLookback = types.AdbOrderLatePaymentWindow + time.Hour // catch up window of the minute rollups after the leader started
+	statsRollupLags     = []time.Duration{                            // re-aggregate the minute buckets once more after the orders changed
+		types.MaxAdbOrderTTL + types.AdbOrderSweepGrace, // the pending orders timeout
+		statsRollupLookback,                             // the late payments & the callback retries settled
+	}
+)
+
+// statsWindow is a time range [start, end) to be rolled up
+type statsWindow struct {
+	start, end time.Time
+}
+
+// RollupAdbOrderStats aggregate the orders created within [start, end) into the rollups of
+// the granularity on all dimensions, the start is aligned to the bucket start.
+// return the number of the upserted rollups
+func RollupAdbOrderStats(granularity string, start, end time.Time) (int, error) {
+	if err := types.ValidStatsGranularity(granularity); err != nil {
+		return 0, err
+	}
+
+	var (
+		now = time.Now()
+		num int
+	)
+
+	start = types.StatsBucketOf(granularity, start)
+	for _, dimension := range types.StatsDimensions {
+		stats, err := store.DB().AggregateAdbOrderStats(granularity, dimension, start, end)
+		if err != nil {
+			return num, fmt.Errorf("aggregate %s adb order stats by %s error: %v", granularity, dimension, err)
+		}
+		for _, stat := range stats {
+			stat.UpdatedAt = now
+			stat.Settle()
+			if err := store.DB().UpsertAdbOrderStats(stat); err != nil {
+				return num, err
+			}
+			num++
+		}
+	}
+
+	return num, nil
+}
+
+// sum the finer source rollups within the buckets [start, end) up into the rollups of the granularity
+func sumUpAdbOrderStats(granularity, source string, start, end time.Time) (int, error) {
+	query := bson.M{
+		"granularity": source,
+		"time":        bson.M{"$gte": start, "$lt": end},
+	}
+	stats, err := store.DB().ListAdbOrderStats(nil, query)
+	if err != nil {
+		return 0, fmt.Errorf("list %s adb order stats error: %v", source, err)
+	}
+
+	var (
+		now = time.Now()
+		num int
+	)
+	for _, stat := range types.SumAdbOrderStats(granularity, stats) {
+		stat.UpdatedAt = now
+		if err := store.DB().UpsertAdbOrderStats(stat); err != nil {
+			return num, err
+		}
+		num++
+	}
+	return num, nil
+}
+
+// AdbDeviceTodayStats return the today rollup of the adb device, nil if no orders today yet
+func AdbDeviceTodayStats(dvcid string) *types.AdbOrderStats {
+	query := bson.M{
+		"granularity": types.StatsGranularityDay,
+		"dimension":   types.StatsDimensionDevice,
+		"key":         dvcid,
+		"time":        types.StatsBucketOf(types.StatsGranularityDay, time.Now()),
+	}
+	stats, err := store.DB().ListAdbOrderStats(nil, query)
+	if err != nil || len(stats) == 0 {
+		return nil
+	}
+	return stats[0]
+}
+
+// incrementally rollup the recent orders, triggered by the cron daemon on the leader
+func rollupRecentAdbOrderStats() {
+	statsRollupMux.Lock()
+	if !isLeader() {
+		statsRollupLast = time.Time{} // catch up again once regain the leadership
+		statsRollupMux.Unlock()
+		return
+	}
+	if IsRegisteredGoRoutine("adb_order_stats_rollup", "system") { // the previous one is still running
+		statsRollupMux.Unlock()
+		return
+	}
+	RegisterGoroutine("adb_order_stats_rollup", "system")
+	var (
+		now     = time.Now()
+		windows = statsRollupWindows(statsRollupLast, now)
+	)
+	statsRollupMux.Unlock()
+	defer DeRegisterGoroutine("adb_order_stats_rollup", "system")
+
+	for _, w := range windows {
+		if _, err := RollupAdbOrderStats(types.StatsGranularityMinute, w.start, w.end); err != nil {
+			log.Errorf("rollup recent adb order stats error: %v", err)
+			return // retry the same windows on the next round
+		}
+	}
+
+	for _, granularity := range []string{types.StatsGranularityHour, types.StatsGranularityDay} {
+		for _, w := range statsCoarseWindows(granularity, windows) {
+			if _, err := sumUpAdbOrderStats(granularity, statsRollupSource(granularity, w.start), w.start, w.end); err != nil {
+				log.Errorf("sum up recent %s adb order stats error: %v", granularity, err)
+				return
+			}
+		}
+	}
+
+	statsRollupMux.Lock()
+	statsRollupLast = now
+	statsRollupMux.Unlock()
+}
+
+// statsRollupWindows return the merged windows of the minute rollups since the last rollup time:
+// the buckets since the last completed one, and the completed buckets just crossed each of the lags.
+// catch up the whole lookback on the first time, or the last rollup is too old
+func statsRollupWindows(last, now time.Time) []statsWindow {
+	bucketOf := func(t time.Time) time.Time {
+		return types.StatsBucketOf(types.StatsGranularityMinute, t)
+	}
+
+	if last.IsZero() || now.Sub(last) > statsRollupLookback {
+		return []statsWindow{{bucketOf(now.Add(-statsRollupLookback)), now}}
+	}
+
+	windows := []statsWindow{{bucketOf(last), now}} // including the last incomplete bucket
+	for _, lag := range statsRollupLags {
+		// note: only the whole buckets, a partial window would overwrite the bucket with the partial counters
+		w := statsWindow{bucketOf(last.Add(-lag)), bucketOf(now.Add(-lag))}
+		if w.start.Before(w.end) {
+			windows = append(windows, w)
+		}
+	}
+	return mergeStatsWindows(windows)
+}
+
+// statsCoarseWindows return the merged bucket windows of the granularity touched by the windows
+func statsCoarseWindows(granularity string, windows []statsWindow) []statsWindow {
+	ret := make([]statsWindow, len(windows))
+	for idx, w := range windows {
+		ret[idx] = statsWindow{types.StatsBucketOf(granularity, w.start), types.StatsBucketEnd(granularity, w.end.Add(-time.Nanosecond))}
+	}
+	return mergeStatsWindows(ret)
+}
+
+// merge the overlapped or adjacent windows, sorted by the start time
+func mergeStatsWindows(windows []statsWindow) []statsWindow {
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].start.Before(windows[j].start)
+	})
+
+	ret := make([]statsWindow, 0, len(windows))
+	for _, w := range windows {
+		if n := len(ret); n > 0 && !w.start.After(ret[n-1].end) {
+			if w.end.After(ret[n-1].end) {
+				ret[n-1].end = w.end
+			}
+			continue
+		}
+		ret = append(ret, w)
+	}
+	return ret
+}
+
+// the finer granularity the coarser rollups are summed up from
+func statsRollupSource(granularity string, t time.Time) string {
+	if granularity == types.StatsGranularityDay {
+		if _, offset := t.In(time.Local).Zone(); offset%3600 == 0 {
+			return types.StatsGranularityHour
+		}
+		// the local midnight is not on the hour, eg: +05:30
+	}
+	return types.StatsGranularityMinute
+}
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/types"
+)
+
+var _ = check.Suite(new(statsSuite))
+
+type statsSuite struct{}
+
+func (s *statsSuite) window(start, end time.Time) statsWindow {
+	return statsWindow{start, end}
+}
+
+func (s *statsSuite) TestRollupWindows(c *check.C) {
+	var (
+		minute = time.Date(2019, 6, 17, 11, 42, 0, 0, time.Local)
+		last   = minute.Add(time.Second * 10)
+		now    = last.Add(time.Minute)
+		lag1   = statsRollupLags[0]
+		lag2   = statsRollupLags[1]
+	)
+
+	// catch up the lookback at first, or the last rollup is too old
+	for _, last := range []time.Time{{}, now.Add(-statsRollupLookback - time.Second)} {
+		c.Assert(statsRollupWindows(last, now), check.DeepEquals, []statsWindow{
+			s.window(minute.Add(time.Minute-statsRollupLookback), now),
+		})
+	}
+
+	// from the last incomplete bucket, and the whole buckets crossed the lags
+	c.Assert(statsRollupWindows(last, now), check.DeepEquals, []statsWindow{
+		s.window(minute.Add(-lag2), minute.Add(time.Minute-lag2)),
+		s.window(minute.Add(-lag1), minute.Add(time.Minute-lag1)),
+		s.window(minute, now),
+	})
+
+	// no bucket crossed the lags within the same minute
+	c.Assert(statsRollupWindows(last, last.Add(time.Second*20)), check.DeepEquals, []statsWindow{
+		s.window(minute, last.Add(time.Second*20)),
+	})
+
+	// the overlapped windows merged, after a long round
+	now = last.Add(lag1 + time.Minute)
+	c.Assert(statsRollupWindows(last, now), check.DeepEquals, []statsWindow{
+		s.window(minute.Add(-lag2), minute.Add(time.Minute+lag1-lag2)),
+		s.window(minute.Add(-lag1), now),
+	})
+}
+
+func (s *statsSuite) TestCoarseWindows(c *check.C) {
+	var (
+		hour    = time.Date(2019, 6, 17, 11, 0, 0, 0, time.Local)
+		day     = time.Date(2019, 6, 17, 0, 0, 0, 0, time.Local)
+		windows = []statsWindow{
+			s.window(hour.Add(-time.Minute*2), hour.Add(-time.Minute)),
+			s.window(hour.Add(time.Minute*40), hour.Add(time.Minute*41)),
+			s.window(hour.Add(time.Hour*2), hour.Add(time.Hour*2+time.Second)),
+		}
+	)
+
+	c.Assert(statsCoarseWindows(types.StatsGranularityHour, windows), check.DeepEquals, []statsWindow{
+		s.window(hour.Add(-time.Hour), hour.Add(time.Hour)), // the adjacent hours merged
+		s.window(hour.Add(time.Hour*2), hour.Add(time.Hour*3)),
+	})
+	c.Assert(statsCoarseWindows(types.StatsGranularityDay, windows), check.DeepEquals, []statsWindow{
+		s.window(day, day.AddDate(0, 0, 1)),
+	})
+
+	// the window ends at the bucket boundary doesn't touch the next bucket
+	c.Assert(statsCoarseWindows(types.StatsGranularityHour, []statsWindow{s.window(hour, hour.Add(time.Hour))}), check.DeepEquals, []statsWindow{
+		s.window(hour, hour.Add(time.Hour)),
+	})
+}
+
+func (s *statsSuite) TestRollupSource(c *check.C) {
+	c.Assert(statsRollupSource(types.StatsGranularityHour, time.Now()), check.Equals, types.StatsGranularityMinute)
+
+	local := time.Local
+	defer func() { time.Local = local }()
+
+	time.Local = time.FixedZone("CST", 8*3600)
+	c.Assert(statsRollupSource(types.StatsGranularityDay, time.Now()), check.Equals, types.StatsGranularityHour)
+	time.Local = time.FixedZone("IST", 5*3600+1800)
+	c.Assert(statsRollupSource(types.StatsGranularityDay, time.Now()), check.Equals, types.StatsGranularityMinute)
+}
@@ -67,5 +67,10 @@ func CountAdbOrdersByStatus(query bson.M) types.AdbOrderStatistics {
 	ret.Timeout = num
 	ret.TimeoutBill = float64(numFee) / float64(100)
 
+	query["status"] = types.AdbOrderStatusPaidAfterTimeout
+	num, numFee = store.DB().CountAdbOrders(query)
+	ret.PaidAfterTimeout = num
+	ret.PaidAfterTimeoutBill = float64(numFee) / float64(100)
+
 	return ret
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -20,6 +21,7 @@ var commandKeyboard = tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButton("version"),
 		tgbotapi.NewKeyboardButton("license"),
 		tgbotapi.NewKeyboardButton("summary"),
+		tgbotapi.NewKeyboardButton("chatid"),
 	),
 	tgbotapi.NewKeyboardButtonRow(
 		tgbotapi.NewKeyboardButton("setting"),
@@ -158,6 +160,10 @@ func (b *tgbot) run() {
 				reply.Text = string(bs)
 				b.api.Send(reply)
 
+			case "chatid":
+				reply.Text = strconv.FormatInt(msg.Chat.ID, 10)
+				b.api.Send(reply)
+
 			case "close":
 				reply.Text = "reopen the keyboard by /help"
 				reply.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
@@ -191,6 +197,26 @@ func (b *tgbot) stop() {
 	}
 }
 
+// PushTGMessage push the text message to the telegram chat of the settings
+func PushTGMessage(text string) error {
+	settings, err := store.DB().GetSettings()
+	if err != nil {
+		return err
+	}
+	if settings.TGChatID == 0 {
+		return errors.New("telegram chat id not set")
+	}
+
+	sched.tgbot.RLock()
+	defer sched.tgbot.RUnlock()
+	if sched.tgbot.api == nil {
+		return errors.New("telegram bot not initialized, pls verify the bot token")
+	}
+
+	_, err = sched.tgbot.api.Send(tgbotapi.NewMessage(settings.TGChatID, text))
+	return err
+}
+
 // VerifyTGBotToken is exported
 func VerifyTGBotToken(token string) error {
 	_, err := tgbotapi.NewBotAPIWithClient(token, utils.InsecureHTTPClient())
@@ -0,0 +1,49 @@
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Flow
+//
+
+// AddAdbFlow is exported
+func (s *MgoStore) AddAdbFlow(flow *types.AdbFlow) error {
+	return s.insert(cAdbFlow, flow)
+}
+
+// UpdateAdbFlow is exported
+func (s *MgoStore) UpdateAdbFlow(id string, update interface{}) error {
+	query := bson.M{"id": id}
+	return s.update(cAdbFlow, query, update)
+}
+
+// RemoveAdbFlow is exported
+func (s *MgoStore) RemoveAdbFlow(id string) error {
+	query := bson.M{"id": id}
+	_, err := s.removeAll(cAdbFlow, query)
+	return err
+}
+
+// GetAdbFlow is exported
+func (s *MgoStore) GetAdbFlow(id string) (*types.AdbFlow, error) {
+	var ret *types.AdbFlow
+	query := bson.M{"$or": []bson.M{{"id": id}, {"name": id}}}
+	err := s.one(cAdbFlow, query, &ret)
+	return ret, err
+}
+
+// ListAdbFlows is exported
+func (s *MgoStore) ListAdbFlows(pager types.Pager, filter interface{}) ([]*types.AdbFlow, error) {
+	ret := []*types.AdbFlow{}
+	err := s.all(cAdbFlow, filter, pager, &ret, "name")
+	return ret, err
+}
+
+// CountAdbFlows is exported
+func (s *MgoStore) CountAdbFlows(filter interface{}) int {
+	return s.count(cAdbFlow, filter)
+}
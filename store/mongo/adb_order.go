@@ -1,6 +1,9 @@
 package mongo
 
 import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bbklab/adbot/types"
@@ -43,6 +46,25 @@ func (s *MgoStore) ListAdbOrders(pager types.Pager, filter interface{}) ([]*type
 	return ret, err
 }
 
+// IterAdbOrders is exported
+// note: the orders are decoded one by one from the db cursor, stop iterating if the handler returns error
+func (s *MgoStore) IterAdbOrders(filter interface{}, handler func(*types.AdbOrder) error) error {
+	return s.exec(func(db *mgo.Database) error {
+		var (
+			iter  = db.C(cAdbOrder).Find(filter).Sort("created_at").Batch(500).Iter()
+			order *types.AdbOrder
+		)
+		for iter.Next(&order) {
+			if err := handler(order); err != nil {
+				iter.Close()
+				return err
+			}
+			order = nil // decode into a new one
+		}
+		return iter.Close()
+	})
+}
+
 // CountAdbOrders is exported
 func (s *MgoStore) CountAdbOrders(filter interface{}) (int, int) {
 	ret := []struct {
@@ -60,3 +82,41 @@ func (s *MgoStore) CountAdbOrders(filter interface{}) (int, int) {
 	}
 	return sum, feesum
 }
+
+// TransitAdbOrder is exported
+// note: the conditional update makes sure only one of the concurrent transitions
+// from the same state could succeed, the others got the not found error
+func (s *MgoStore) TransitAdbOrder(id, field string, from []string, update interface{}) error {
+	query := bson.M{"id": id, field: bson.M{"$in": from}}
+	return s.update(cAdbOrder, query, update)
+}
+
+// ClaimAdbOrderCallback is exported
+// note: the findAndModify makes sure one due callback could only be claimed once
+// by one of masters until the lease expired
+func (s *MgoStore) ClaimAdbOrderCallback(lease string, ttl time.Duration) (*types.AdbOrder, error) {
+	var (
+		ret   *types.AdbOrder
+		now   = time.Now()
+		query = bson.M{
+			"callback_status":   types.AdbOrderCallbackStatusOngoing,
+			"callback_next_at":  bson.M{"$lte": now},
+			"callback_lease_at": bson.M{"$lt": now},
+		}
+		change = mgo.Change{
+			Update:    bson.M{"$set": bson.M{"callback_lease": lease, "callback_lease_at": now.Add(ttl)}},
+			ReturnNew: true,
+		}
+	)
+	err := s.exec(func(db *mgo.Database) error {
+		_, err := db.C(cAdbOrder).Find(query).Sort("callback_next_at").Apply(change, &ret)
+		return err
+	})
+	return ret, err
+}
+
+// UpdateLeasedAdbOrder is exported
+func (s *MgoStore) UpdateLeasedAdbOrder(id, lease string, update interface{}) error {
+	query := bson.M{"id": id, "callback_lease": lease}
+	return s.update(cAdbOrder, query, update)
+}
@@ -0,0 +1,49 @@
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Merchant
+//
+
+// AddMerchant is exported
+func (s *MgoStore) AddMerchant(merchant *types.Merchant) error {
+	return s.insert(cMerchant, merchant)
+}
+
+// UpdateMerchant is exported
+func (s *MgoStore) UpdateMerchant(id string, update interface{}) error {
+	query := bson.M{"id": id}
+	return s.update(cMerchant, query, update)
+}
+
+// RemoveMerchant is exported
+func (s *MgoStore) RemoveMerchant(id string) error {
+	query := bson.M{"id": id}
+	_, err := s.removeAll(cMerchant, query)
+	return err
+}
+
+// GetMerchant is exported
+func (s *MgoStore) GetMerchant(id string) (*types.Merchant, error) {
+	var ret *types.Merchant
+	query := bson.M{"$or": []bson.M{{"id": id}, {"name": id}}}
+	err := s.one(cMerchant, query, &ret)
+	return ret, err
+}
+
+// ListMerchants is exported
+func (s *MgoStore) ListMerchants(pager types.Pager, filter interface{}) ([]*types.Merchant, error) {
+	ret := []*types.Merchant{}
+	err := s.all(cMerchant, filter, pager, &ret, "created_at")
+	return ret, err
+}
+
+// CountMerchants is exported
+func (s *MgoStore) CountMerchants(filter interface{}) int {
+	return s.count(cMerchant, filter)
+}
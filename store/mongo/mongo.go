@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"strings"
 	"time"
 
 	"github.com/bbklab/adbot/types"
@@ -9,15 +10,20 @@ import (
 )
 
 var (
-	cUser        = "user"
-	cUserSession = "user_session"
-	cNode        = "node" // node
-	cBlockedNode = "blocked_node"
-	cAdbDevice   = "adb_device" // adb device
-	cAdbOrder    = "adb_order"  // adb order
-	cLicense     = "license"    // license
-	cSettings    = "settings"
-	cPing        = "ping"
+	cUser          = "user"
+	cUserSession   = "user_session"
+	cNode          = "node" // node
+	cBlockedNode   = "blocked_node"
+	cAdbDevice     = "adb_device"      // adb device
+	cAdbOrder      = "adb_order"       // adb order
+	cAdbFlow       = "adb_flow"        // adb automation flow
+	cLicense       = "license"         // license
+	cNonce         = "nonce"           // paygate signature nonce
+	cMerchant      = "merchant"        // paygate merchant
+	cReconcile     = "adb_reconcile"   // daily reconciliation report
+	cAdbOrderStats = "adb_order_stats" // adb order time-series rollups
+	cSettings      = "settings"
+	cPing          = "ping"
 )
 
 // Setup is exported
@@ -50,10 +56,16 @@ func Setup(typ string, cfg *types.MongodbConfig) (*MgoStore, error) {
 		return nil, err
 	}
 
-	// ensure indexes for all base collections
+	// drop the obsolete indexes & ensure indexes for all base collections
+	if err = s.dropObsoleteIndexes(); err != nil {
+		return nil, err
+	}
 	if err = s.ensureIndexes(); err != nil {
 		return nil, err
 	}
+	if err = s.ensurePartialIndexes(); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
@@ -84,6 +96,16 @@ func (s *MgoStore) ErrNotFound(err error) bool {
 	return err == mgo.ErrNotFound
 }
 
+// ErrDuplicated is exported
+func (s *MgoStore) ErrDuplicated(err error) bool {
+	return mgo.IsDup(err)
+}
+
+// ErrPayFeeTaken is exported
+func (s *MgoStore) ErrPayFeeTaken(err error) bool {
+	return mgo.IsDup(err) && strings.Contains(err.Error(), idxPendingPayFee)
+}
+
 //
 // shorthands on various frequently used mgo ops
 //
@@ -207,6 +229,65 @@ func (s *MgoStore) ensureIndexes() error {
 	return nil
 }
 
+// ensure the partial indexes by the raw createIndexes command, as mgo.Index can't tell the partial filter
+func (s *MgoStore) ensurePartialIndexes() error {
+	for col, idxes := range partialIndexes {
+		cmd := bson.D{{Name: "createIndexes", Value: col}, {Name: "indexes", Value: idxes}}
+		if err := s.sess.DB(s.dbname()).Run(cmd, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop the obsolete indexes if exists
+func (s *MgoStore) dropObsoleteIndexes() error {
+	for col, keys := range obsoleteIndexes {
+		c := s.sess.DB(s.dbname()).C(col)
+
+		idxes, err := c.Indexes()
+		if err != nil {
+			continue // maybe the collection not exists yet
+		}
+
+		for _, key := range keys {
+			for _, idx := range idxes {
+				if strings.Join(idx.Key, ",") != strings.Join(key, ",") {
+					continue
+				}
+				if err := c.DropIndex(key...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var obsoleteIndexes = map[string][][]string{
+	cAdbOrder: {
+		{"out_order_id"}, // global uniq out order id, replaced by the uniq one within the merchant
+	},
+}
+
+const idxPendingPayFee = "uniq_pending_pay_fee"
+
+var partialIndexes = map[string][]bson.M{
+	cAdbOrder: {
+		{
+			// the payable amount is uniq among the pending orders of the same qrcode type on each device,
+			// guard the concurrent pickups on multiple masters, see scheduler.SaveAdbOrder
+			"name":   idxPendingPayFee,
+			"key":    bson.D{{Name: "device_id", Value: 1}, {Name: "qrtype", Value: 1}, {Name: "pay_fee", Value: 1}},
+			"unique": true,
+			"partialFilterExpression": bson.M{
+				"status":  types.AdbOrderStatusPending,
+				"pay_fee": bson.M{"$gt": 0}, // skip the legacy orders without the pay fee
+			},
+		},
+	},
+}
+
 var indexes = map[string][]mgo.Index{
 	cUser: {
 		{
@@ -290,7 +371,7 @@ var indexes = map[string][]mgo.Index{
 			Key: []string{"device_id"},
 		},
 		{
-			Key:    []string{"out_order_id"}, // out side order id
+			Key:    []string{"merchant_id", "out_order_id"}, // out side order id, uniq within the merchant
 			Unique: true,
 		},
 		{
@@ -308,5 +389,63 @@ var indexes = map[string][]mgo.Index{
 		{
 			Key: []string{"paid_at"},
 		},
+		{
+			Key: []string{"callback_status", "callback_next_at"}, // callback delivery queue
+		},
+		{
+			Key: []string{"merchant_id"},
+		},
+		{
+			Key: []string{"merchant_id", "payer_id"}, // sticky payer pickup
+		},
+	},
+	cMerchant: {
+		{
+			Key:    []string{"id"},
+			Unique: true,
+		},
+		{
+			Key:    []string{"name"},
+			Unique: true,
+		},
+	},
+	cNonce: {
+		{
+			Key:    []string{"nonce"},
+			Unique: true,
+		},
+		{
+			Key:         []string{"created_at"},
+			ExpireAfter: types.SignExpire * 2, // mongo ttl index
+		},
+	},
+	cReconcile: {
+		{
+			Key:    []string{"id"},
+			Unique: true,
+		},
+	},
+	cAdbOrderStats: {
+		{
+			Key:    []string{"granularity", "dimension", "key", "time"},
+			Unique: true,
+		},
+		{
+			Key: []string{"granularity", "dimension", "time"},
+		},
+		{
+			Key:         []string{"expire_at"},
+			ExpireAfter: time.Second, // mongo ttl index, the day rollups without expire_at are kept forever
+		},
+	},
+	cAdbFlow: {
+		{
+			Key:    []string{"id"},
+			Unique: true,
+		},
+		{
+			Key:    []string{"name"},
+			Unique: true,
+		},
 	},
 }
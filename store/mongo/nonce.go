@@ -0,0 +1,16 @@
+package mongo
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+//
+// Paygate Signature Nonce
+//
+
+// AddPaygateNonce is exported
+func (s *MgoStore) AddPaygateNonce(nonce string) error {
+	return s.insert(cNonce, bson.M{"nonce": nonce, "created_at": time.Now()})
+}
@@ -0,0 +1,37 @@
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Reconcile
+//
+
+// UpsertAdbReconcile is exported
+func (s *MgoStore) UpsertAdbReconcile(reconcile *types.AdbReconcile) error {
+	query := bson.M{"id": reconcile.ID}
+	return s.upsert(cReconcile, query, reconcile)
+}
+
+// GetAdbReconcile is exported
+func (s *MgoStore) GetAdbReconcile(id string) (*types.AdbReconcile, error) {
+	var ret *types.AdbReconcile
+	query := bson.M{"id": id}
+	err := s.one(cReconcile, query, &ret)
+	return ret, err
+}
+
+// ListAdbReconciles is exported
+func (s *MgoStore) ListAdbReconciles(pager types.Pager, filter interface{}) ([]*types.AdbReconcile, error) {
+	ret := []*types.AdbReconcile{}
+	err := s.all(cReconcile, filter, pager, &ret, "-id")
+	return ret, err
+}
+
+// CountAdbReconciles is exported
+func (s *MgoStore) CountAdbReconciles(filter interface{}) int {
+	return s.count(cReconcile, filter)
+}
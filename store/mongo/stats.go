@@ -0,0 +1,125 @@
+package mongo
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bbklab/adbot/types"
+)
+
+//
+// Adb Order Stats
+//
+
+// AggregateAdbOrderStats is exported
+// note: the time buckets are calculated by the date arithmetic instead of the
+// date operators, to keep compatible with the elder mongo servers
+func (s *MgoStore) AggregateAdbOrderStats(granularity, dimension string, start, end time.Time) ([]*types.AdbOrderStats, error) {
+	var (
+		epoch    = time.Unix(0, 0)
+		bucketMs = int64(types.StatsGranularities[granularity].Bucket / time.Millisecond)
+		offsetMs = int64(0)
+	)
+	if granularity == types.StatsGranularityDay { // by the local midnight
+		_, offset := start.In(time.Local).Zone()
+		offsetMs = int64(offset) * 1000
+	}
+
+	var (
+		sinceEpoch = bson.M{"$add": []interface{}{bson.M{"$subtract": []interface{}{"$created_at", epoch}}, offsetMs}}
+		bucket     = bson.M{"$subtract": []interface{}{"$created_at", bson.M{"$mod": []interface{}{sinceEpoch, bucketMs}}}}
+		countOf    = func(status string) bson.M {
+			return bson.M{"$sum": bson.M{"$cond": []interface{}{bson.M{"$eq": []interface{}{"$status", status}}, 1, 0}}}
+		}
+		callbackOf = func(statuses ...string) bson.M {
+			conds := []interface{}{}
+			for _, status := range statuses {
+				conds = append(conds, bson.M{"$eq": []interface{}{"$callback_status", status}})
+			}
+			return bson.M{"$sum": bson.M{"$cond": []interface{}{bson.M{"$or": conds}, 1, 0}}}
+		}
+		isPaid = bson.M{"$or": []interface{}{
+			bson.M{"$eq": []interface{}{"$status", types.AdbOrderStatusPaid}},
+			bson.M{"$eq": []interface{}{"$status", types.AdbOrderStatusPaidAfterTimeout}},
+		}}
+		payable = bson.M{"$cond": []interface{}{bson.M{"$gt": []interface{}{"$pay_fee", 0}}, "$pay_fee", "$fee"}} // legacy orders without pay fee
+	)
+
+	var key interface{}
+	switch dimension {
+	case types.StatsDimensionDevice:
+		key = "$device_id"
+	case types.StatsDimensionNode:
+		key = "$node_id"
+	case types.StatsDimensionMerchant: // the legacy orders belong to the default merchant
+		key = bson.M{"$cond": []interface{}{
+			bson.M{"$eq": []interface{}{bson.M{"$ifNull": []interface{}{"$merchant_id", ""}}, ""}},
+			types.DefaultMerchantID,
+			"$merchant_id",
+		}}
+	default:
+		key = bson.M{"$literal": ""}
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"created_at": bson.M{"$gte": start, "$lt": end}}},
+		{"$group": bson.M{
+			"_id":                bson.M{"key": key, "time": bucket},
+			"orders":             bson.M{"$sum": 1},
+			"paid":               countOf(types.AdbOrderStatusPaid),
+			"paid_after_timeout": countOf(types.AdbOrderStatusPaidAfterTimeout),
+			"pending":            countOf(types.AdbOrderStatusPending),
+			"timeout":            countOf(types.AdbOrderStatusTimeout),
+			"closed":             countOf(types.AdbOrderStatusClosed),
+			"fee":                bson.M{"$sum": "$fee"},
+			"paid_fee":           bson.M{"$sum": bson.M{"$cond": []interface{}{isPaid, payable, 0}}},
+			"callback_succeed":   callbackOf(types.AdbOrderCallbackStatusSucceed),
+			"callback_dead":      callbackOf(types.AdbOrderCallbackStatusDead, types.AdbOrderCallbackStatusError), // the legacy error is same as dead
+		}},
+	}
+
+	var rets []struct {
+		ID struct {
+			Key  string    `bson:"key"`
+			Time time.Time `bson:"time"`
+		} `bson:"_id"`
+		types.AdbOrderStats `bson:",inline"`
+	}
+	err := s.exec(func(db *mgo.Database) error {
+		return db.C(cAdbOrder).Pipe(pipeline).AllowDiskUse().All(&rets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]*types.AdbOrderStats, len(rets))
+	for idx, ret := range rets {
+		stat := ret.AdbOrderStats
+		stat.Granularity = granularity
+		stat.Dimension = dimension
+		stat.Key = ret.ID.Key
+		stat.Time = ret.ID.Time
+		stats[idx] = &stat
+	}
+	return stats, nil
+}
+
+// UpsertAdbOrderStats is exported
+func (s *MgoStore) UpsertAdbOrderStats(stats *types.AdbOrderStats) error {
+	query := bson.M{
+		"granularity": stats.Granularity,
+		"dimension":   stats.Dimension,
+		"key":         stats.Key,
+		"time":        stats.Time,
+	}
+	return s.upsert(cAdbOrderStats, query, stats)
+}
+
+// ListAdbOrderStats is exported
+func (s *MgoStore) ListAdbOrderStats(pager types.Pager, filter interface{}) ([]*types.AdbOrderStats, error) {
+	ret := []*types.AdbOrderStats{}
+	err := s.all(cAdbOrderStats, filter, pager, &ret, "time", "key")
+	return ret, err
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"errors"
+	"time"
 
 	"github.com/bbklab/adbot/store/mongo"
 	"github.com/bbklab/adbot/types"
@@ -59,7 +60,45 @@ type Store interface {
 	RemoveAdbOrder(id string) error
 	GetAdbOrder(id string) (*types.AdbOrder, error)
 	ListAdbOrders(pager types.Pager, filter interface{}) ([]*types.AdbOrder, error)
-	CountAdbOrders(filter interface{}) (int, int) // count orders, fees
+	CountAdbOrders(filter interface{}) (int, int)                                // count orders, fees
+	IterAdbOrders(filter interface{}, handler func(*types.AdbOrder) error) error // iterate orders by the created time, without loading all of them
+
+	// adb order state transition
+	TransitAdbOrder(id, field string, from []string, update interface{}) error // compare-and-set: update only if the field still one of from
+
+	// adb order callback delivery queue
+	ClaimAdbOrderCallback(lease string, ttl time.Duration) (*types.AdbOrder, error) // claim one due ongoing callback with the lease
+	UpdateLeasedAdbOrder(id, lease string, update interface{}) error                // update only if the callback lease still held
+
+	// adb flow
+	AddAdbFlow(flow *types.AdbFlow) error
+	UpdateAdbFlow(id string, update interface{}) error
+	RemoveAdbFlow(id string) error
+	GetAdbFlow(id string) (*types.AdbFlow, error)
+	ListAdbFlows(pager types.Pager, filter interface{}) ([]*types.AdbFlow, error)
+	CountAdbFlows(filter interface{}) int
+
+	// paygate merchant
+	AddMerchant(merchant *types.Merchant) error
+	UpdateMerchant(id string, update interface{}) error
+	RemoveMerchant(id string) error
+	GetMerchant(id string) (*types.Merchant, error) // by id or name
+	ListMerchants(pager types.Pager, filter interface{}) ([]*types.Merchant, error)
+	CountMerchants(filter interface{}) int
+
+	// adb order time-series rollups
+	AggregateAdbOrderStats(granularity, dimension string, start, end time.Time) ([]*types.AdbOrderStats, error) // aggregate the orders created within [start, end)
+	UpsertAdbOrderStats(stats *types.AdbOrderStats) error
+	ListAdbOrderStats(pager types.Pager, filter interface{}) ([]*types.AdbOrderStats, error)
+
+	// adb daily reconciliation report
+	UpsertAdbReconcile(reconcile *types.AdbReconcile) error
+	GetAdbReconcile(id string) (*types.AdbReconcile, error)
+	ListAdbReconciles(pager types.Pager, filter interface{}) ([]*types.AdbReconcile, error)
+	CountAdbReconciles(filter interface{}) int
+
+	// paygate signature nonce, for the replay protection
+	AddPaygateNonce(nonce string) error // return duplicated error if the nonce seen within types.SignExpire*2
 
 	// license
 	UpsertLicense(text string) error
@@ -70,6 +109,8 @@ type Store interface {
 	GetSettings() (*types.Settings, error)
 
 	ErrNotFound(error) bool
+	ErrDuplicated(error) bool
+	ErrPayFeeTaken(error) bool // the payable amount taken by another pending order on the same device
 	Type() string
 	Ping() error
 }
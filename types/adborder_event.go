@@ -0,0 +1,77 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// nolint
+var (
+	AdbOrderEventCreated        = "created"         // the order saved by the paygate request
+	AdbOrderEventRetried        = "retried"         // the retried paygate request got the existing order
+	AdbOrderEventDeviceSelected = "device_selected" // the adb device picked up, with the pickup reason
+	AdbOrderEventQRIssued       = "qr_issued"       // the payment qrcode generated and responded
+	AdbOrderEventNoticeMatched  = "notice_matched"  // the payment notice on the device matched the order
+	AdbOrderEventDeviceCheck    = "device_check"    // one UI searching attempt of the order on the device
+	AdbOrderEventBillMatched    = "bill_matched"    // the payment bill entry found by the UI searching
+	AdbOrderEventStatusChanged  = "status_changed"  // the order status transition, by the state machine or the operator
+	AdbOrderEventCallback       = "callback"        // one merchant callback delivery attempt
+
+	AdbOrderEventBodyMax = 256 // max bytes of the callback response body kept in the event
+)
+
+// AdbOrderEvent is an append-only lifecycle event of the adb order
+type AdbOrderEvent struct {
+	Type    string            `json:"type" bson:"type"`
+	Message string            `json:"message" bson:"message"`                 // readable detail, eg: the pickup reason, the check error
+	Attrs   map[string]string `json:"attrs,omitempty" bson:"attrs,omitempty"` // structured context, eg: device_id, http_status, latency_ms
+	Time    time.Time         `json:"time" bson:"time"`
+}
+
+// NewAdbOrderEvent new an adb order event happened now, the attrs are given by key-value pairs
+func NewAdbOrderEvent(typ, message string, kvs ...string) *AdbOrderEvent {
+	ev := &AdbOrderEvent{
+		Type:    typ,
+		Message: message,
+		Time:    time.Now(),
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if kvs[i+1] == "" {
+			continue
+		}
+		if ev.Attrs == nil {
+			ev.Attrs = make(map[string]string)
+		}
+		ev.Attrs[kvs[i]] = kvs[i+1]
+	}
+	return ev
+}
+
+// NewAdbOrderCreatedEvents return the initial lifecycle events of the newly adb order
+func NewAdbOrderCreatedEvents(order *AdbOrder) []*AdbOrderEvent {
+	created := NewAdbOrderEvent(AdbOrderEventCreated, "order created",
+		"merchant_id", order.MerchantID,
+		"out_order_id", order.OutOrderID,
+		"qrtype", order.QRType,
+		"fee", strconv.Itoa(order.Fee),
+		"ttl", strconv.Itoa(order.TTL),
+		"sign_type", order.SignType,
+	)
+	created.Time = order.CreatedAt
+
+	// note: the device is picked up just before the order saved
+	var evs []*AdbOrderEvent
+	if pickup := order.Pickup; pickup != nil {
+		selected := NewAdbOrderEvent(AdbOrderEventDeviceSelected, pickup.Reason,
+			"node_id", order.NodeID,
+			"device_id", order.DeviceID,
+			"strategy", pickup.Strategy,
+			"source", pickup.Source,
+			"pay_fee", strconv.Itoa(order.PayFee),
+			"candidates", strconv.Itoa(len(pickup.Candidates)),
+		)
+		selected.Time = pickup.Time
+		evs = append(evs, selected)
+	}
+	return append(evs, created)
+}
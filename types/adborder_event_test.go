@@ -0,0 +1,64 @@
+package types
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(adbOrderEventSuite))
+
+type adbOrderEventSuite struct{}
+
+func (s *adbOrderEventSuite) TestNewEvent(c *check.C) {
+	ev := NewAdbOrderEvent(AdbOrderEventCallback, "succeed", "http_status", "200", "body", "", "latency_ms")
+	c.Assert(ev.Type, check.Equals, AdbOrderEventCallback)
+	c.Assert(ev.Message, check.Equals, "succeed")
+	c.Assert(ev.Attrs, check.DeepEquals, map[string]string{"http_status": "200"}) // empty & odd values skipped
+	c.Assert(ev.Time.IsZero(), check.Equals, false)
+
+	ev = NewAdbOrderEvent(AdbOrderEventDeviceCheck, "not found", "device_id", "")
+	c.Assert(ev.Attrs, check.IsNil)
+}
+
+func (s *adbOrderEventSuite) TestNewCreatedEvents(c *check.C) {
+	var (
+		pickedAt  = time.Date(2019, 6, 20, 18, 32, 57, 0, time.Local)
+		createdAt = pickedAt.Add(time.Millisecond * 20)
+	)
+
+	order := &AdbOrder{
+		ID:         "2019620183258-BA01",
+		MerchantID: "shop01",
+		NodeID:     "node01",
+		DeviceID:   "dvc01",
+		PayFee:     1999,
+		Pickup: &AdbDevicePickup{
+			Strategy:   "round_robin",
+			Reason:     "least recently used",
+			Candidates: []*PickupCandidate{{DeviceID: "dvc01"}, {DeviceID: "dvc02"}},
+			Time:       pickedAt,
+		},
+		NewAdbOrderReq: NewAdbOrderReq{OutOrderID: "000082", QRType: QRCodeTypeAlipay, Fee: 2000, TTL: 300},
+		CreatedAt:      createdAt,
+	}
+
+	evs := NewAdbOrderCreatedEvents(order)
+	c.Assert(evs, check.HasLen, 2)
+	c.Assert(evs[0].Type, check.Equals, AdbOrderEventDeviceSelected)
+	c.Assert(evs[0].Message, check.Equals, "least recently used")
+	c.Assert(evs[0].Time, check.Equals, pickedAt)
+	c.Assert(evs[0].Attrs["device_id"], check.Equals, "dvc01")
+	c.Assert(evs[0].Attrs["pay_fee"], check.Equals, "1999")
+	c.Assert(evs[0].Attrs["candidates"], check.Equals, "2")
+	c.Assert(evs[1].Type, check.Equals, AdbOrderEventCreated)
+	c.Assert(evs[1].Time, check.Equals, createdAt)
+	c.Assert(evs[1].Attrs["out_order_id"], check.Equals, "000082")
+	c.Assert(evs[1].Attrs["fee"], check.Equals, "2000")
+
+	// the orders without the pickup details
+	order.Pickup = nil
+	evs = NewAdbOrderCreatedEvents(order)
+	c.Assert(evs, check.HasLen, 1)
+	c.Assert(evs[0].Type, check.Equals, AdbOrderEventCreated)
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/validator"
+)
+
+// nolint
+var (
+	AdbOrderOverridePaid    = "paid"    // the payment confirmed by the operator, eg: found in the alipay app after the order timeout
+	AdbOrderOverrideTimeout = "timeout" // the order failed as timeout
+	AdbOrderOverrideVoid    = "void"    // the order voided, eg: the wrong matched payment
+	AdbOrderOverrideRefund  = "refund"  // a refund note of the received payment, the order status is kept
+)
+
+// AdbOrderOverrideReq is the operator's manual adjudication request of an adb order
+type AdbOrderOverrideReq struct {
+	Action   string `json:"action"`   // must: paid, timeout, void, refund
+	Reason   string `json:"reason"`   // must: [4-256]
+	Callback bool   `json:"callback"` // optional: queue the merchant callback after marked as paid
+}
+
+// Valid is exported
+func (r *AdbOrderOverrideReq) Valid() error {
+	switch r.Action {
+	case AdbOrderOverridePaid, AdbOrderOverrideTimeout, AdbOrderOverrideVoid, AdbOrderOverrideRefund:
+	default:
+		return fmt.Errorf("adb order override action %q unrecoginized", r.Action)
+	}
+	if err := validator.String(strings.TrimSpace(r.Reason), 4, 256, nil); err != nil {
+		return fmt.Errorf("adb order override reason %v", err)
+	}
+	if r.Callback && r.Action != AdbOrderOverridePaid {
+		return errors.New("merchant callback can only be sent for the order marked as paid")
+	}
+	return nil
+}
+
+// AdbOrderOverride is the record of an operator's manual adjudication, appended to the adb order history
+type AdbOrderOverride struct {
+	Action     string    `json:"action" bson:"action"`           // paid, timeout, void, refund
+	From       string    `json:"from" bson:"from"`               // the previous order status
+	To         string    `json:"to" bson:"to"`                   // the order status after, same as the previous one for the refund note
+	Reason     string    `json:"reason" bson:"reason"`           // why the order was overridden
+	Callback   bool      `json:"callback" bson:"callback"`       // the merchant callback queued or not
+	OperatorID string    `json:"operator_id" bson:"operator_id"` // ref: user id
+	Operator   string    `json:"operator" bson:"operator"`       // the operator user name
+	Time       time.Time `json:"time" bson:"time"`
+}
+
+// AdbOrderOverrideRecord is a listed override of an adb order for the review
+type AdbOrderOverrideRecord struct {
+	OrderID           string `json:"order_id"`
+	MerchantID        string `json:"merchant_id"`
+	OutOrderID        string `json:"out_order_id"`
+	DeviceID          string `json:"device_id"`
+	Fee               int    `json:"fee"`
+	PayFee            int    `json:"pay_fee"`
+	Status            string `json:"status"` // the current order status
+	*AdbOrderOverride `json:",inline"`
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(adbOrderOverrideSuite))
+
+type adbOrderOverrideSuite struct{}
+
+func (s *adbOrderOverrideSuite) TestValidOverrideReq(c *check.C) {
+	req := &AdbOrderOverrideReq{Action: AdbOrderOverridePaid, Reason: "confirmed in the alipay app", Callback: true}
+	c.Assert(req.Valid(), check.IsNil)
+
+	req.Reason = "  ok  " // reason is mandatory
+	c.Assert(req.Valid(), check.NotNil)
+	req.Reason = ""
+	c.Assert(req.Valid(), check.NotNil)
+
+	req.Reason = "wrong matched payment"
+	req.Action = AdbOrderOverrideVoid // callback is only for the paid ones
+	c.Assert(req.Valid(), check.NotNil)
+	req.Callback = false
+	c.Assert(req.Valid(), check.IsNil)
+
+	req.Action = "closed"
+	c.Assert(req.Valid(), check.NotNil)
+}
+
+func (s *adbOrderOverrideSuite) TestValidOverride(c *check.C) {
+	for _, t := range []struct {
+		from, action, to string
+	}{
+		{AdbOrderStatusPending, AdbOrderOverridePaid, AdbOrderStatusPaid},
+		{AdbOrderStatusPending, AdbOrderOverrideTimeout, AdbOrderStatusTimeout},
+		{AdbOrderStatusPending, AdbOrderOverrideVoid, AdbOrderStatusVoid},
+		{AdbOrderStatusTimeout, AdbOrderOverridePaid, AdbOrderStatusPaid},
+		{AdbOrderStatusTimeout, AdbOrderOverrideVoid, AdbOrderStatusVoid},
+		{AdbOrderStatusPaidAfterTimeout, AdbOrderOverridePaid, AdbOrderStatusPaid},
+		{AdbOrderStatusClosed, AdbOrderOverridePaid, AdbOrderStatusPaid},
+		{AdbOrderStatusPaid, AdbOrderOverrideVoid, AdbOrderStatusVoid},
+		{AdbOrderStatusPaid, AdbOrderOverrideRefund, AdbOrderStatusPaid}, // refund note keeps the status
+		{AdbOrderStatusPaidAfterTimeout, AdbOrderOverrideRefund, AdbOrderStatusPaidAfterTimeout},
+		{AdbOrderStatusVoid, AdbOrderOverrideRefund, AdbOrderStatusVoid},
+	} {
+		to, err := ValidAdbOrderOverride(t.from, t.action)
+		c.Assert(err, check.IsNil, check.Commentf("%s by %s", t.from, t.action))
+		c.Assert(to, check.Equals, t.to)
+	}
+
+	for _, t := range []struct {
+		from, action string
+	}{
+		{AdbOrderStatusPaid, AdbOrderOverridePaid},
+		{AdbOrderStatusPaid, AdbOrderOverrideTimeout},
+		{AdbOrderStatusTimeout, AdbOrderOverrideTimeout},
+		{AdbOrderStatusClosed, AdbOrderOverrideVoid},
+		{AdbOrderStatusVoid, AdbOrderOverridePaid}, // void is final
+		{AdbOrderStatusPending, AdbOrderOverrideRefund},
+		{AdbOrderStatusTimeout, AdbOrderOverrideRefund},
+		{AdbOrderStatusClosed, AdbOrderOverrideRefund},
+	} {
+		to, err := ValidAdbOrderOverride(t.from, t.action)
+		c.Assert(err, check.NotNil, check.Commentf("%s by %s", t.from, t.action))
+		c.Assert(to, check.Equals, "")
+	}
+
+	// the overrides never loosen the automatic transitions
+	c.Assert(ValidAdbOrderTransition(AdbOrderStatusTimeout, AdbOrderStatusPaid), check.NotNil)
+	c.Assert(ValidAdbOrderTransition(AdbOrderStatusPending, AdbOrderStatusVoid), check.NotNil)
+}
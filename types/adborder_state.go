@@ -0,0 +1,73 @@
+package types
+
+import (
+	"fmt"
+)
+
+//
+// adb order state machine
+//
+
+// the legal adb order status transitions
+var adbOrderTransitions = map[string][]string{
+	AdbOrderStatusPending: {AdbOrderStatusPaid, AdbOrderStatusTimeout, AdbOrderStatusClosed},
+	AdbOrderStatusTimeout: {AdbOrderStatusPaidAfterTimeout},
+}
+
+// the legal adb order callback status transitions
+var adbOrderCallbackTransitions = map[string][]string{
+	AdbOrderCallbackStatusNone:    {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual},
+	AdbOrderCallbackStatusOngoing: {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusSucceed, AdbOrderCallbackStatusDead},
+	AdbOrderCallbackStatusAborted: {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual},
+	AdbOrderCallbackStatusError:   {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual},
+	AdbOrderCallbackStatusDead:    {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual},
+	AdbOrderCallbackStatusManual:  {AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusSucceed, AdbOrderCallbackStatusDead},
+}
+
+// the legal manual adb order status overrides by the operator
+var adbOrderOverrideTransitions = map[string][]string{
+	AdbOrderStatusPending:          {AdbOrderStatusPaid, AdbOrderStatusTimeout, AdbOrderStatusVoid},
+	AdbOrderStatusTimeout:          {AdbOrderStatusPaid, AdbOrderStatusVoid},
+	AdbOrderStatusPaidAfterTimeout: {AdbOrderStatusPaid, AdbOrderStatusVoid},
+	AdbOrderStatusClosed:           {AdbOrderStatusPaid},
+	AdbOrderStatusPaid:             {AdbOrderStatusVoid},
+}
+
+// the adb order statuses with the payment received, accept the refund notes
+var adbOrderRefundStatuses = []string{AdbOrderStatusPaid, AdbOrderStatusPaidAfterTimeout, AdbOrderStatusVoid}
+
+// ValidAdbOrderTransition verify the adb order status transition
+func ValidAdbOrderTransition(from, to string) error {
+	return validTransition("status", adbOrderTransitions, from, to)
+}
+
+// ValidAdbOrderCallbackTransition verify the adb order callback status transition
+func ValidAdbOrderCallbackTransition(from, to string) error {
+	return validTransition("callback status", adbOrderCallbackTransitions, from, to)
+}
+
+// ValidAdbOrderOverride verify the operator's manual override action on the adb order status,
+// return the order status after the override
+func ValidAdbOrderOverride(from, action string) (string, error) {
+	if action == AdbOrderOverrideRefund {
+		for _, status := range adbOrderRefundStatuses {
+			if status == from {
+				return from, nil
+			}
+		}
+		return "", fmt.Errorf("illegal adb order refund note on the un-paid status: %s", from)
+	}
+	if err := validTransition("status override", adbOrderOverrideTransitions, from, action); err != nil {
+		return "", err
+	}
+	return action, nil // the override actions are named as the target status
+}
+
+func validTransition(name string, transitions map[string][]string, from, to string) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("illegal adb order %s transition: %s -> %s", name, from, to)
+}
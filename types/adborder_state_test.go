@@ -0,0 +1,61 @@
+package types
+
+import (
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(adbOrderStateSuite))
+
+type adbOrderStateSuite struct{}
+
+func (s *adbOrderStateSuite) TestValidTransition(c *check.C) {
+	var (
+		statuses = []string{
+			AdbOrderStatusPending, AdbOrderStatusPaid, AdbOrderStatusTimeout, AdbOrderStatusClosed,
+			AdbOrderStatusVoid, AdbOrderStatusPaidAfterTimeout,
+		}
+		legal = map[[2]string]bool{
+			{AdbOrderStatusPending, AdbOrderStatusPaid}:             true,
+			{AdbOrderStatusPending, AdbOrderStatusTimeout}:          true,
+			{AdbOrderStatusPending, AdbOrderStatusClosed}:           true,
+			{AdbOrderStatusTimeout, AdbOrderStatusPaidAfterTimeout}: true, // the late payment, never back to paid automatically
+		}
+	)
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			err := ValidAdbOrderTransition(from, to)
+			if legal[[2]string{from, to}] {
+				c.Assert(err, check.IsNil, check.Commentf("%s -> %s", from, to))
+				continue
+			}
+			c.Assert(err, check.ErrorMatches, "illegal adb order status transition: "+from+" -> "+to)
+		}
+	}
+
+	c.Assert(ValidAdbOrderTransition("", AdbOrderStatusPaid), check.NotNil)
+}
+
+func (s *adbOrderStateSuite) TestValidCallbackTransition(c *check.C) {
+	// the fresh, aborted & dead callbacks could be queued or sent manually
+	for _, from := range []string{
+		AdbOrderCallbackStatusNone, AdbOrderCallbackStatusAborted, AdbOrderCallbackStatusError, AdbOrderCallbackStatusDead,
+	} {
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusOngoing), check.IsNil, check.Commentf(from))
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusManual), check.IsNil, check.Commentf(from))
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusSucceed), check.NotNil, check.Commentf(from))
+	}
+
+	// the in-flight ones are finished by the delivery, or re-queued while restart
+	for _, from := range []string{AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual} {
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusSucceed), check.IsNil, check.Commentf(from))
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusDead), check.IsNil, check.Commentf(from))
+		c.Assert(ValidAdbOrderCallbackTransition(from, AdbOrderCallbackStatusOngoing), check.IsNil, check.Commentf(from))
+	}
+
+	// the concurrent manual re-callbacks are rejected, the delivered one is final
+	c.Assert(ValidAdbOrderCallbackTransition(AdbOrderCallbackStatusManual, AdbOrderCallbackStatusManual), check.NotNil)
+	c.Assert(ValidAdbOrderCallbackTransition(AdbOrderCallbackStatusOngoing, AdbOrderCallbackStatusManual), check.NotNil)
+	c.Assert(ValidAdbOrderCallbackTransition(AdbOrderCallbackStatusSucceed, AdbOrderCallbackStatusOngoing), check.ErrorMatches,
+		"illegal adb order callback status transition: succeed -> ongoing")
+}
@@ -1,19 +1,23 @@
 package types
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/pkg/orderparam"
 	"github.com/bbklab/adbot/pkg/validator"
 )
 
 // nolint
 var (
-	QRCodeTypeAlipay = "alipay"
-	QRCodeTypeWxpay  = "wxpay"
+	QRCodeTypeAlipay = adbot.PaymentAppAlipay // same as the payment app driver name
+	QRCodeTypeWxpay  = adbot.PaymentAppWxpay
 )
 
 // nolint
@@ -35,7 +39,7 @@ type AdbDeviceWrapper struct {
 	*AdbDevice
 	RecentAdbOrders RecentAdbOrders `json:"recent_adb_orders"`
 	MaxAmountYuan   float64         `json:"max_amount_yuan"`
-	TodayPaidRate   float64         `json:"today_paid_rate"` // today paid order rate
+	TodayPaidRate   float64         `json:"today_paid_rate"` // today paid order rate %, by the daily device rollup
 }
 
 // AdbDevice is a db adb device
@@ -87,11 +91,48 @@ func (a *AlipayAccount) Valid() error {
 
 // WxpayAccount is exported
 type WxpayAccount struct {
+	WxID     string `json:"wxid" bson:"wxid"`         // must, wechat id: 我 -> 微信号
+	Username string `json:"username" bson:"username"` // must, real name shown to payer
+	Nickname string `json:"nickname" bson:"nickname"` // optional
+}
+
+// Valid is exported
+func (a *WxpayAccount) Valid() error {
+	if err := validator.String(a.WxID, 6, 20, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("wxpay wxid %v", err)
+	}
+	if a.Username == "" {
+		return errors.New("wxpay username required")
+	}
+	return nil
 }
 
 // nolint
 var (
-	AdbOrderTimeout = time.Minute * 5
+	AdbOrderTimeout    = time.Minute * 5  // default ttl of the pending orders, if neither the order request nor the merchant provided
+	MinAdbOrderTTL     = time.Minute * 2  // min ttl of the order request & merchant settings
+	MaxAdbOrderTTL     = time.Minute * 15 // max ttl of the order request & merchant settings
+	MaxAdbDeviceHold   = time.Minute * 30 // max device hold of the merchant settings
+	AdbOrderSweepGrace = time.Minute      // sweep the orphan expired pending orders, whose waiting was lost, eg: by restart
+	AdbOrderNoticeWait = time.Minute      // wait for the payment notice before UI searching the pending order
+	MaxPayFeeOffset    = 99               // max cents of the payable amount offset settings
+
+	AdbOrderCallbackWorkers = 10               // max concurrent callback deliveries
+	AdbOrderCallbackLease   = time.Minute * 5  // claimed callback delivery lease, must be longer than the callback http timeout
+	AdbOrderCallbackBackoff = []time.Duration{ // default failure retry backoff of the callback delivery
+		time.Second * 10,  // 10s
+		time.Second * 30,  // 30s
+		time.Second * 120, // 2m
+		time.Second * 300, // 5m
+		time.Second * 900, // 15m
+	}
+)
+
+// nolint
+var (
+	SignTypeMD5        = "MD5"           // legacy, only covers the out_order_id & fee, selectable per merchant during the migration
+	SignTypeHMACSHA256 = "HMAC-SHA256"   // covers all of the canonicalised parameters, with the timestamp & nonce replay protection
+	SignExpire         = time.Minute * 5 // max clock skew of the signed timestamp, the nonces are kept twice as long
 )
 
 // nolint
@@ -99,17 +140,50 @@ var (
 	AdbOrderStatusPending = "pending" // init status
 	AdbOrderStatusPaid    = "paid"    // paid
 	AdbOrderStatusTimeout = "timeout" // timeout
+	AdbOrderStatusClosed  = "closed"  // closed by the merchant before paid
+	AdbOrderStatusVoid    = "void"    // voided by the operator, eg: the wrong matched payment
+
+	AdbOrderStatusPaidAfterTimeout = "paid_after_timeout" // late payment of the timeout order, no callback, waiting for the operator
+
+	AdbOrderLatePaymentWindow = time.Hour // match the late payment notices against the timeout orders within
 )
 
 // nolint
 var (
 	AdbOrderCallbackStatusNone    = "none"    // init status, not triggered yet
-	AdbOrderCallbackStatusOngoing = "ongoing" // ongoing, triggered by adb device callback, sending callback to outerside
+	AdbOrderCallbackStatusOngoing = "ongoing" // ongoing, triggered by adb device callback, queued in the delivery queue to outerside
 	AdbOrderCallbackStatusSucceed = "succeed" // succeed, final state
-	AdbOrderCallbackStatusError   = "error"   // error, final state
-	AdbOrderCallbackStatusAborted = "aborted" // reset `ongoing` callback on startup initilization
+	AdbOrderCallbackStatusError   = "error"   // error, final state of the legacy callback, same as dead
+	AdbOrderCallbackStatusAborted = "aborted" // legacy, `ongoing` callback aborted by restart, re-queued on startup initilization
+	AdbOrderCallbackStatusDead    = "dead"    // dead letter, all of delivery attempts failed, waiting for the operator replay
+	AdbOrderCallbackStatusManual  = "manual"  // manual re-callback in-flight, re-queued on startup initilization if aborted by restart
+
+	AdbOrderCallbackDeadStatuses = []string{AdbOrderCallbackStatusDead, AdbOrderCallbackStatusError} // listed & replayed as dead letters
 )
 
+// ParseCallbackBackoff parse the comma separated callback failure retry backoff, eg: 10s,30s,2m,5m,15m
+func ParseCallbackBackoff(s string) ([]time.Duration, error) {
+	var ret []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, fmt.Errorf("callback backoff %v", err)
+		}
+		if d < time.Second || d > time.Hour*24 {
+			return nil, fmt.Errorf("callback backoff %s must between [1s-24h]", field)
+		}
+		ret = append(ret, d)
+	}
+	if len(ret) > 20 {
+		return nil, errors.New("callback backoff at most 20 retries")
+	}
+	return ret, nil
+}
+
 // AdbOrderWrapper is exported
 type AdbOrderWrapper struct {
 	*AdbOrder
@@ -119,34 +193,158 @@ type AdbOrderWrapper struct {
 
 // AdbOrder is a db adb order
 type AdbOrder struct {
-	ID              string                          `json:"id" bson:"id"`               // order id, uniq
-	Status          string                          `json:"status" bson:"status"`       // pending, paid, timeout
-	NodeID          string                          `json:"node_id" bson:"node_id"`     // ref: adb device node id
-	DeviceID        string                          `json:"device_id" bson:"device_id"` // ref: adb device id
+	ID              string                          `json:"id" bson:"id"`                             // order id, uniq
+	Status          string                          `json:"status" bson:"status"`                     // pending, paid, timeout, closed, paid_after_timeout, void
+	MerchantID      string                          `json:"merchant_id" bson:"merchant_id"`           // ref: merchant id
+	NodeID          string                          `json:"node_id" bson:"node_id"`                   // ref: adb device node id
+	DeviceID        string                          `json:"device_id" bson:"device_id"`               // ref: adb device id
+	PayFee          int                             `json:"pay_fee" bson:"pay_fee"`                   // the actual payable amount, uniq among the device pending orders
+	Alipay          *AlipayAccount                  `json:"alipay,omitempty" bson:"alipay,omitempty"` // the payee alipay account of the qrcode, alipay orders only
+	Pickup          *AdbDevicePickup                `json:"pickup" bson:"pickup"`                     // the adb device pickup decision trace
 	NewAdbOrderReq  `json:",inline" bson:",inline"` // step1: order request <- from merchant
 	Response        *NewAdbOrderResp                `json:"response" bson:"response"`                 // step2: order response -> to out side
 	Callback        *NewAdbOrderCallback            `json:"callback" bson:"callback"`                 // step4: order callback -> to out side
-	CallbackStatus  string                          `json:"callback_status" bson:"callback_status"`   // callback status: none, ongoing, succeed, error
+	CallbackStatus  string                          `json:"callback_status" bson:"callback_status"`   // callback status: none, ongoing, succeed, dead
 	CallbackHistory []string                        `json:"callback_history" bson:"callback_history"` // callback history with all failure retries
+	CallbackTries   int                             `json:"callback_tries" bson:"callback_tries"`     // nb of callback delivery attempts
+	CallbackNextAt  time.Time                       `json:"callback_next_at" bson:"callback_next_at"` // next callback delivery attempt time while ongoing
+	CallbackLease   string                          `json:"-" bson:"callback_lease"`                  // the delivery lease token of the claimed callback
+	CallbackLeaseAt time.Time                       `json:"-" bson:"callback_lease_at"`               // the delivery lease expire time
+	ExpireAt        time.Time                       `json:"expire_at" bson:"expire_at"`               // created at + ttl, the pending order turns timeout after
+	DeviceHold      int                             `json:"device_hold" bson:"device_hold"`           // seconds the timeout order keeps holding its payable amount on the device, by the merchant
+	HoldUntil       time.Time                       `json:"hold_until" bson:"hold_until"`             // expire at + device hold, the payable amount is not reused on the device before
+	QRCode          []byte                          `json:"-" bson:"qrcode"`                          // the qrcode png, shown on the hosted cashier page
+	CashierToken    string                          `json:"-" bson:"cashier_token"`                   // access token of the hosted cashier page & status stream
+	Overrides       []*AdbOrderOverride             `json:"overrides" bson:"overrides"`               // the operator's manual adjudications history
+	Events          []*AdbOrderEvent                `json:"events,omitempty" bson:"events"`           // the append-only lifecycle events, only shown on the order detail
 	CreatedAt       time.Time                       `json:"created_at" bson:"created_at"`
 	PaidAt          time.Time                       `json:"paid_at" bson:"paid_at"`
+	ClosedAt        time.Time                       `json:"closed_at" bson:"closed_at"`
+}
+
+// Payable return the actual payable amount of the order,
+// the legacy orders without the pay fee are payable by the fee
+func (o *AdbOrder) Payable() int {
+	if o.PayFee > 0 {
+		return o.PayFee
+	}
+	return o.Fee
+}
+
+// MerchantOrDefault return the merchant id of the order, the orders
+// created before the multi-merchant belong to the default merchant
+func (o *AdbOrder) MerchantOrDefault() string {
+	if o.MerchantID == "" {
+		return DefaultMerchantID
+	}
+	return o.MerchantID
+}
+
+// Deadline return the time the pending order turns timeout,
+// the legacy orders without the expire time are timeout by the default ttl
+func (o *AdbOrder) Deadline() time.Time {
+	if !o.ExpireAt.IsZero() {
+		return o.ExpireAt
+	}
+	return o.CreatedAt.Add(AdbOrderTimeout)
+}
+
+// Conflict verify the retried order request of the same out order id carries the identical
+// order parameters as the existing order, the signature fields are not compared as they
+// are always renewed by the retries
+//
+// note: the request should be already filled with the merchant defaults (notify url & ttl)
+func (o *AdbOrder) Conflict(req *NewAdbOrderReq) error {
+	var field string
+	switch {
+	case req.QRType != o.QRType:
+		field = "qrtype"
+	case req.Fee != o.Fee:
+		field = "fee"
+	case req.Attach != o.Attach:
+		field = "attach"
+	case req.PayerID != o.PayerID:
+		field = "payer_id"
+	case req.NotifyURL != o.NotifyURL:
+		field = "notify_url"
+	case req.ReturnURL != o.ReturnURL:
+		field = "return_url"
+	case req.TTL != o.TTL && o.TTL > 0: // the legacy orders without ttl
+		field = "ttl"
+	default:
+		return nil
+	}
+	return &AdbOrderConflictError{OrderID: o.ID, Field: field}
+}
+
+// AdbOrderConflictError is returned if the out order id already exists with the different order parameters
+type AdbOrderConflictError struct {
+	OrderID string
+	Field   string
+}
+
+func (e *AdbOrderConflictError) Error() string {
+	return fmt.Sprintf("out order id conflicts with the existing adb order %s on %s", e.OrderID, e.Field)
+}
+
+// AdbOrderStatusEvent is the adb order status changed event, streamed to the hosted cashier page
+type AdbOrderStatusEvent struct {
+	OrderID   string    `json:"order_id"`
+	Status    string    `json:"status"`
+	ExpireAt  time.Time `json:"expire_at"`
+	ReturnURL string    `json:"return_url,omitempty"` // the merchant return url after the order done
+	Time      time.Time `json:"time"`
+}
+
+// Format format the event as the server-sent event
+func (ev *AdbOrderStatusEvent) Format() []byte {
+	bs, _ := json.Marshal(ev)
+	return []byte(fmt.Sprintf("event: status\ndata: %s\n\n", string(bs)))
 }
 
 // NewAdbOrderReq is a new adb order request
 type NewAdbOrderReq struct {
+	AppID      string `json:"app_id" bson:"app_id"`             // optional: merchant id, [0-64], default the `default` merchant
 	OutOrderID string `json:"out_order_id" bson:"out_order_id"` // must: out side order id, [1-64], [a-zA-Z0-9.-_]
 	QRType     string `json:"qrtype" bson:"qrtype"`             // must: qrcode type [alipay,wxpay]
 	Fee        int    `json:"fee" bson:"fee"`                   // must: order fee [1,10000000000]
 	Attach     string `json:"attach" bson:"attach"`             // optional: out side custom data, [0-128]
+	PayerID    string `json:"payer_id" bson:"payer_id"`         // optional: out side payer id, [0-64], used by the sticky-payer pickup
 	NotifyURL  string `json:"notify_url" bson:"notify_url"`     // optional: call back url, [0-128]
+	TTL        int    `json:"ttl" bson:"ttl"`                   // optional: order ttl in seconds, [120-900], default the merchant ttl
+	ReturnURL  string `json:"return_url" bson:"return_url"`     // optional: redirect url of the hosted cashier page after the order done, [0-256]
+	SignType   string `json:"sign_type" bson:"sign_type"`       // optional: signature type [MD5,HMAC-SHA256], default MD5
+	Timestamp  int64  `json:"timestamp" bson:"timestamp"`       // must by HMAC-SHA256: unix timestamp in seconds
+	Nonce      string `json:"nonce" bson:"nonce"`               // must by HMAC-SHA256: random string, [8-32], [a-zA-Z0-9.-_]
 	Sign       string `json:"sign" bson:"sign"`                 // must: signature, [1-64]
 }
 
-// StringToSign return **uniq** string to be signed
+// StringToSign return **uniq** string to be signed by the legacy MD5
 func (r *NewAdbOrderReq) StringToSign() string {
 	return fmt.Sprintf("out_order_id=%s&fee=%d", r.OutOrderID, r.Fee)
 }
 
+// SignParams return the canonicalised parameters to be signed by HMAC-SHA256,
+// all of the non-empty fields except the sign
+func (r *NewAdbOrderReq) SignParams() *orderparam.Params {
+	params := orderparam.New()
+	params.SetIgnoreNull("app_id", r.AppID)
+	params.SetIgnoreNull("out_order_id", r.OutOrderID)
+	params.SetIgnoreNull("qrtype", r.QRType)
+	params.SetIgnoreNull("fee", strconv.Itoa(r.Fee))
+	params.SetIgnoreNull("attach", r.Attach)
+	params.SetIgnoreNull("payer_id", r.PayerID)
+	params.SetIgnoreNull("notify_url", r.NotifyURL)
+	if r.TTL > 0 {
+		params.Set("ttl", strconv.Itoa(r.TTL))
+	}
+	params.SetIgnoreNull("return_url", r.ReturnURL)
+	params.SetIgnoreNull("sign_type", r.SignType)
+	params.SetIgnoreNull("timestamp", strconv.FormatInt(r.Timestamp, 10))
+	params.SetIgnoreNull("nonce", r.Nonce)
+	return params
+}
+
 // Valid is exported
 func (r *NewAdbOrderReq) Valid() error {
 	if err := validator.String(r.OutOrderID, 1, 64, validator.NormalCharacters); err != nil {
@@ -167,18 +365,127 @@ func (r *NewAdbOrderReq) Valid() error {
 		return fmt.Errorf("attach %v", err)
 	}
 
-	if err := validator.String(r.NotifyURL, -1, 128, nil); err != nil {
-		return fmt.Errorf("notify url %v", err)
+	if err := validator.String(r.PayerID, -1, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("payer id %v", err)
+	}
+
+	if err := validNotifyURL(r.NotifyURL); err != nil {
+		return err
 	}
-	if r.NotifyURL != "" {
-		u, err := url.Parse(r.NotifyURL)
+
+	if err := validHTTPURL("return url", r.ReturnURL, 256); err != nil {
+		return err
+	}
+
+	if r.TTL != 0 {
+		if err := ValidAdbOrderTTL(r.TTL); err != nil {
+			return err
+		}
+	}
+
+	if err := validator.String(r.AppID, -1, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("app id %v", err)
+	}
+
+	switch r.SignType {
+	case "", SignTypeMD5:
+	case SignTypeHMACSHA256:
+		if r.Timestamp <= 0 {
+			return errors.New("timestamp required")
+		}
+		if err := validator.String(r.Nonce, 8, 32, validator.NormalCharacters); err != nil {
+			return fmt.Errorf("nonce %v", err)
+		}
+	default:
+		return errors.New("signature type unrecoginized")
+	}
+
+	if err := validator.String(r.Sign, 1, 64, nil); err != nil {
+		return fmt.Errorf("signature %v", err)
+	}
+
+	return nil
+}
+
+// ValidAdbOrderTTL verify the order ttl in seconds within the bounds
+func ValidAdbOrderTTL(ttl int) error {
+	if err := validator.Int(ttl, int(MinAdbOrderTTL.Seconds()), int(MaxAdbOrderTTL.Seconds())); err != nil {
+		return fmt.Errorf("order ttl %v", err)
+	}
+	return nil
+}
+
+func validNotifyURL(notifyURL string) error {
+	return validHTTPURL("notify url", notifyURL, 128)
+}
+
+// verify the optional http(s) url within the max length
+func validHTTPURL(name, rawurl string, max int) error {
+	if err := validator.String(rawurl, -1, max, nil); err != nil {
+		return fmt.Errorf("%s %v", name, err)
+	}
+	if rawurl != "" {
+		u, err := url.Parse(rawurl)
 		if err != nil {
-			return fmt.Errorf("notify url %v", err)
+			return fmt.Errorf("%s %v", name, err)
 		}
 		if u.Scheme != "http" && u.Scheme != "https" {
-			return errors.New("notify url only support scheme: http|https")
+			return fmt.Errorf("%s only support scheme: http|https", name)
 		}
 	}
+	return nil
+}
+
+// PaygateOrderReq is a signed paygate request to query or close an existing adb order,
+// only the HMAC-SHA256 signature is accepted
+type PaygateOrderReq struct {
+	AppID      string `json:"app_id"`       // optional: merchant id, [0-64], default the `default` merchant
+	OrderID    string `json:"order_id"`     // optional: adbot order id, one of order_id & out_order_id required
+	OutOrderID string `json:"out_order_id"` // optional: out side order id
+	SignType   string `json:"sign_type"`    // must: signature type [HMAC-SHA256]
+	Timestamp  int64  `json:"timestamp"`    // must: unix timestamp in seconds
+	Nonce      string `json:"nonce"`        // must: random string, [8-32], [a-zA-Z0-9.-_]
+	Sign       string `json:"sign"`         // must: signature, [1-64]
+}
+
+// SignParams return the canonicalised parameters to be signed by HMAC-SHA256,
+// all of the non-empty fields except the sign
+func (r *PaygateOrderReq) SignParams() *orderparam.Params {
+	params := orderparam.New()
+	params.SetIgnoreNull("app_id", r.AppID)
+	params.SetIgnoreNull("order_id", r.OrderID)
+	params.SetIgnoreNull("out_order_id", r.OutOrderID)
+	params.SetIgnoreNull("sign_type", r.SignType)
+	params.SetIgnoreNull("timestamp", strconv.FormatInt(r.Timestamp, 10))
+	params.SetIgnoreNull("nonce", r.Nonce)
+	return params
+}
+
+// Valid is exported
+func (r *PaygateOrderReq) Valid() error {
+	if err := validator.String(r.AppID, -1, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("app id %v", err)
+	}
+
+	if r.OrderID == "" && r.OutOrderID == "" {
+		return errors.New("one of order id or out order id required")
+	}
+	if err := validator.String(r.OrderID, -1, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("order id %v", err)
+	}
+	if err := validator.String(r.OutOrderID, -1, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("out order id %v", err)
+	}
+
+	if r.SignType != SignTypeHMACSHA256 {
+		return fmt.Errorf("signature type must be %s", SignTypeHMACSHA256)
+	}
+	if r.Timestamp <= 0 {
+		return errors.New("timestamp required")
+	}
+	if err := validator.String(r.Nonce, 8, 32, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("nonce %v", err)
+	}
 
 	if err := validator.String(r.Sign, 1, 64, nil); err != nil {
 		return fmt.Errorf("signature %v", err)
@@ -187,6 +494,53 @@ func (r *NewAdbOrderReq) Valid() error {
 	return nil
 }
 
+// PaygateOrderResp is the response of the paygate order query & close requests,
+// signed by HMAC-SHA256 with the merchant secret while succeed
+type PaygateOrderResp struct {
+	Code       int     `json:"code"`         // 1:success  0:error
+	Message    string  `json:"message"`      // error message while Code==0
+	AppID      string  `json:"app_id"`       // merchant id, same as the order request app id
+	OrderID    string  `json:"order_id"`     // adbot order id
+	OutOrderID string  `json:"out_order_id"` // out side order id
+	QRType     string  `json:"qrtype"`       // qrcode type
+	Fee        int     `json:"fee"`          // order fee
+	FeeYuan    float64 `json:"fee_yuan"`     // order fee / 100
+	PayFee     int     `json:"pay_fee"`      // the actual payable amount
+	Attach     string  `json:"attach"`       // out side custom data, return unchanged
+	Status     string  `json:"status"`       // order status: pending, paid, timeout, closed
+	CreatedAt  int64   `json:"created_at"`   // order created unix timestamp in seconds
+	ExpireAt   int64   `json:"expire_at"`    // the pending order turns timeout after, unix timestamp in seconds
+	PaidAt     int64   `json:"paid_at"`      // order paid unix timestamp in seconds, 0 if not paid
+	ClosedAt   int64   `json:"closed_at"`    // order closed unix timestamp in seconds, 0 if not closed
+	SignType   string  `json:"sign_type"`    // HMAC-SHA256
+	Timestamp  int64   `json:"timestamp"`    // unix timestamp in seconds
+	Nonce      string  `json:"nonce"`        // random string
+	Sign       string  `json:"sign"`         // signature, used for receiver verify this response
+}
+
+// SignParams return the canonicalised parameters to be signed by HMAC-SHA256,
+// all of the non-empty fields except the sign & message
+func (r *PaygateOrderResp) SignParams() *orderparam.Params {
+	params := orderparam.New()
+	params.SetIgnoreNull("code", strconv.Itoa(r.Code))
+	params.SetIgnoreNull("app_id", r.AppID)
+	params.SetIgnoreNull("order_id", r.OrderID)
+	params.SetIgnoreNull("out_order_id", r.OutOrderID)
+	params.SetIgnoreNull("qrtype", r.QRType)
+	params.SetIgnoreNull("fee", strconv.Itoa(r.Fee))
+	params.SetIgnoreNull("pay_fee", strconv.Itoa(r.PayFee))
+	params.SetIgnoreNull("attach", r.Attach)
+	params.SetIgnoreNull("status", r.Status)
+	params.SetIgnoreNull("created_at", strconv.FormatInt(r.CreatedAt, 10))
+	params.SetIgnoreNull("expire_at", strconv.FormatInt(r.ExpireAt, 10))
+	params.SetIgnoreNull("paid_at", strconv.FormatInt(r.PaidAt, 10))
+	params.SetIgnoreNull("closed_at", strconv.FormatInt(r.ClosedAt, 10))
+	params.SetIgnoreNull("sign_type", r.SignType)
+	params.SetIgnoreNull("timestamp", strconv.FormatInt(r.Timestamp, 10))
+	params.SetIgnoreNull("nonce", r.Nonce)
+	return params
+}
+
 // NewAdbOrderResp is a new adb order response
 type NewAdbOrderResp struct {
 	Code       int       `json:"code" bson:"code"`                 // 1:success  0:error
@@ -196,19 +550,64 @@ type NewAdbOrderResp struct {
 	OutOrderID string    `json:"out_order_id" bson:"out_order_id"` // copy from Req.OutOrderID
 	Fee        int       `json:"fee" bson:"fee"`                   // copy from Req.Fee
 	FeeYuan    float64   `json:"fee_yuan" bson:"fee_yuan"`         // copy from Req, Req.Fee/100
+	PayFee     int       `json:"pay_fee" bson:"pay_fee"`           // the actual payable amount, maybe a few cents less than the fee
+	PayFeeYuan float64   `json:"pay_fee_yuan" bson:"pay_fee_yuan"` // PayFee/100
+	CashierURL string    `json:"cashier_url" bson:"cashier_url"`   // the hosted cashier page of the order
+	TTL        int       `json:"ttl" bson:"ttl"`                   // the order ttl in seconds
+	ExpireAt   time.Time `json:"expire_at" bson:"expire_at"`       // the pending order turns timeout after
 	Time       time.Time `json:"time" bson:"time"`                 // set by us, only used for tracking order steps time line
 }
 
 // NewAdbOrderCallback is exported
 type NewAdbOrderCallback struct {
 	Code       int       `json:"code" bson:"code"`                 // always = 1:success
+	AppID      string    `json:"app_id" bson:"app_id"`             // merchant id, same as the order request app id
+	OrderID    string    `json:"order_id" bson:"order_id"`         // adbot order id
 	OutOrderID string    `json:"out_order_id" bson:"out_order_id"` // out side order id
 	Fee        int       `json:"fee" bson:"fee"`                   // order fee
+	PayFee     int       `json:"pay_fee" bson:"pay_fee"`           // the actual paid amount, maybe a few cents less than the fee
 	Attach     string    `json:"attach" bson:"attach"`             // out side custom data, return unchanged
+	Status     string    `json:"status" bson:"status"`             // order status
+	PaidAt     int64     `json:"paid_at" bson:"paid_at"`           // order paid unix timestamp in seconds
+	SignType   string    `json:"sign_type" bson:"sign_type"`       // same as the order request signature type
+	Timestamp  int64     `json:"timestamp" bson:"timestamp"`       // set by HMAC-SHA256: unix timestamp in seconds
+	Nonce      string    `json:"nonce" bson:"nonce"`               // set by HMAC-SHA256: random string
 	Sign       string    `json:"sign" bson:"sign"`                 // set by us, used for receiver verify this callback to prevent any fake callbacks
 	Time       time.Time `json:"time" bson:"time"`                 // set by us, only used for tracking order steps time line
 }
 
+// StringToSign return **uniq** string to be signed by the legacy MD5,
+// note: it's the same as the order request's, kept unchanged for the existing legacy merchants
+func (cb *NewAdbOrderCallback) StringToSign() string {
+	return fmt.Sprintf("out_order_id=%s&fee=%d", cb.OutOrderID, cb.Fee)
+}
+
+// StringToSignV2 return **uniq** string to be signed by the legacy MD5 for the merchants
+// opted in the v2 callback signature, it covers the order status and differs from the
+// order request's, so the request signature can't be replayed as a forged callback
+func (cb *NewAdbOrderCallback) StringToSignV2() string {
+	return fmt.Sprintf("out_order_id=%s&fee=%d&status=%s", cb.OutOrderID, cb.Fee, cb.Status)
+}
+
+// SignParams return the canonicalised parameters to be signed by HMAC-SHA256,
+// all of the non-empty fields except the sign & time
+func (cb *NewAdbOrderCallback) SignParams() *orderparam.Params {
+	params := orderparam.New()
+	params.SetIgnoreNull("code", strconv.Itoa(cb.Code))
+	params.SetIgnoreNull("app_id", cb.AppID)
+	params.SetIgnoreNull("order_id", cb.OrderID)
+	params.SetIgnoreNull("out_order_id", cb.OutOrderID)
+	params.SetIgnoreNull("fee", strconv.Itoa(cb.Fee))
+	params.SetIgnoreNull("pay_fee", strconv.Itoa(cb.PayFee))
+	params.SetIgnoreNull("attach", cb.Attach)
+	params.SetIgnoreNull("status", cb.Status)
+	params.SetIgnoreNull("paid_at", strconv.FormatInt(cb.PaidAt, 10))
+	params.SetIgnoreNull("sign_type", cb.SignType)
+	params.SetIgnoreNull("timestamp", strconv.FormatInt(cb.Timestamp, 10))
+	params.SetIgnoreNull("nonce", cb.Nonce)
+	return params
+}
+
 // AdbDeviceCmd is exported
 type AdbDeviceCmd struct {
 	Command string `json:"command"`
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+	"github.com/bbklab/adbot/pkg/validator"
+)
+
+// AdbFlow is a db stored adb device automation flow
+type AdbFlow struct {
+	ID        string    `json:"id" bson:"id"`
+	Name      string    `json:"name" bson:"name"`       // uniq, copy from the flow document
+	Desc      string    `json:"desc" bson:"desc"`       // copy from the flow document
+	Content   string    `json:"content" bson:"content"` // the original yaml or json flow document
+	NumSteps  int       `json:"num_steps" bson:"num_steps"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Flow parse the flow document
+func (f *AdbFlow) Flow() (*adbot.Flow, error) {
+	return adbot.ParseFlow([]byte(f.Content))
+}
+
+// NewAdbFlow parse the given flow document and construct a new db flow
+func NewAdbFlow(content []byte) (*AdbFlow, error) {
+	if err := validator.String(string(content), 1, 1024*1024, nil); err != nil {
+		return nil, fmt.Errorf("flow document %v", err)
+	}
+
+	flow, err := adbot.ParseFlow(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.String(flow.Name, 1, 64, validator.NormalCharacters); err != nil {
+		return nil, fmt.Errorf("flow name %v", err)
+	}
+	if err := validator.String(flow.Desc, -1, 1024, nil); err != nil {
+		return nil, fmt.Errorf("flow desc %v", err)
+	}
+
+	return &AdbFlow{
+		Name:     flow.Name,
+		Desc:     flow.Desc,
+		Content:  string(content),
+		NumSteps: len(flow.Steps),
+	}, nil
+}
+
+// AdbFlowRunReq is a request to run db flow on one adb device or a set of
+// online adb devices which belongs to the label-selected nodes
+type AdbFlowRunReq struct {
+	DeviceID string            `json:"device_id"`
+	Labels   map[string]string `json:"labels"` // node labels
+	Vars     map[string]string `json:"vars"`   // override the flow default variables
+}
+
+// Valid is exported
+func (r *AdbFlowRunReq) Valid() error {
+	if r.DeviceID == "" && len(r.Labels) == 0 {
+		return errors.New("one of device id or node labels required")
+	}
+	if r.DeviceID != "" && len(r.Labels) > 0 {
+		return errors.New("device id and node labels are mutually exclusive")
+	}
+	return nil
+}
+
+// AdbFlowRunResult is the flow run result on one adb device
+type AdbFlowRunResult struct {
+	DeviceID string            `json:"device_id"`
+	NodeID   string            `json:"node_id"`
+	Errmsg   string            `json:"error"`  // error before the flow running, eg: device busy
+	Result   *adbot.FlowResult `json:"result"` // step by step trace
+}
+
+// AdbDeviceFlowReq is a request to run flow on the agent adb device
+type AdbDeviceFlowReq struct {
+	Flow *adbot.Flow       `json:"flow"`
+	Vars map[string]string `json:"vars"`
+}
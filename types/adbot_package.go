@@ -0,0 +1,55 @@
+package types
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+)
+
+// nolint
+var (
+	AdbPackageRolloutInstalling = "installing"
+	AdbPackageRolloutSucceed    = "succeed"
+	AdbPackageRolloutFailed     = "failed"
+	AdbPackageRolloutSkipped    = "skipped" // device busy
+)
+
+// AdbPackageRolloutReq is a request to install the apk onto all of online
+// adb devices which belongs to the label-selected nodes
+type AdbPackageRolloutReq struct {
+	Labels      map[string]string `json:"labels"`      // node labels
+	Package     string            `json:"package"`     // optional: query the installed version after each installation
+	Concurrency int               `json:"concurrency"` // max concurrent installations, default 5
+}
+
+// Valid is exported
+func (r *AdbPackageRolloutReq) Valid() error {
+	if len(r.Labels) == 0 {
+		return errors.New("node labels required")
+	}
+	if r.Package != "" {
+		if err := adbot.ValidPackageName(r.Package); err != nil {
+			return err
+		}
+	}
+	if r.Concurrency < 0 || r.Concurrency > 50 {
+		return errors.New("concurrency must between [1-50]")
+	}
+	if r.Concurrency == 0 {
+		r.Concurrency = 5
+	}
+	return nil
+}
+
+// AdbPackageRolloutProgress is the apk rollout progress of one adb device
+type AdbPackageRolloutProgress struct {
+	DeviceID string                `json:"device_id"`
+	NodeID   string                `json:"node_id"`
+	Status   string                `json:"status"` // installing, succeed, failed, skipped
+	Errmsg   string                `json:"error"`
+	Package  *adbot.AndroidPackage `json:"package"` // the installed version if the package name given
+	Done     int                   `json:"done"`    // number of finished devices
+	Total    int                   `json:"total"`   // number of target devices
+	Time     time.Time             `json:"time"`
+}
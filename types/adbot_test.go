@@ -0,0 +1,62 @@
+package types
+
+import (
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(adbOrderSuite))
+
+type adbOrderSuite struct{}
+
+func (s *adbOrderSuite) req() *NewAdbOrderReq {
+	return &NewAdbOrderReq{
+		AppID:      "shop01",
+		OutOrderID: "000082",
+		QRType:     QRCodeTypeAlipay,
+		Fee:        2000,
+		Attach:     "anything",
+		PayerID:    "payer01",
+		NotifyURL:  "http://requestbin.net/ve1",
+		ReturnURL:  "https://shop01.example.com/return",
+		TTL:        300,
+		SignType:   SignTypeHMACSHA256,
+		Timestamp:  1561025578,
+		Nonce:      "k2Jd8xPqR0aZ",
+		Sign:       "8B0F3C1E",
+	}
+}
+
+func (s *adbOrderSuite) TestConflict(c *check.C) {
+	order := &AdbOrder{ID: "2019620183258-BA01", NewAdbOrderReq: *s.req()}
+
+	// the retry renews the signature fields only
+	retry := s.req()
+	retry.Timestamp, retry.Nonce, retry.Sign = 1561025600, "Qm8zLp3Xw0Ka", "5A1C3E7B"
+	c.Assert(order.Conflict(retry), check.IsNil)
+
+	for field, modify := range map[string]func(*NewAdbOrderReq){
+		"qrtype":     func(r *NewAdbOrderReq) { r.QRType = QRCodeTypeWxpay },
+		"fee":        func(r *NewAdbOrderReq) { r.Fee = 2001 },
+		"attach":     func(r *NewAdbOrderReq) { r.Attach = "" },
+		"payer_id":   func(r *NewAdbOrderReq) { r.PayerID = "payer02" },
+		"notify_url": func(r *NewAdbOrderReq) { r.NotifyURL = "http://requestbin.net/ve2" },
+		"return_url": func(r *NewAdbOrderReq) { r.ReturnURL = "" },
+		"ttl":        func(r *NewAdbOrderReq) { r.TTL = 600 },
+	} {
+		req := s.req()
+		modify(req)
+		err := order.Conflict(req)
+		c.Assert(err, check.FitsTypeOf, &AdbOrderConflictError{}, check.Commentf("field %s", field))
+		c.Assert(err.(*AdbOrderConflictError).Field, check.Equals, field)
+		c.Assert(err.(*AdbOrderConflictError).OrderID, check.Equals, order.ID)
+	}
+
+	// the legacy orders were created without ttl
+	order.TTL = 0
+	c.Assert(order.Conflict(s.req()), check.IsNil)
+}
+
+func (s *adbOrderSuite) TestConflictError(c *check.C) {
+	err := &AdbOrderConflictError{OrderID: "2019620183258-BA01", Field: "fee"}
+	c.Assert(err.Error(), check.Equals, "out order id conflicts with the existing adb order 2019620183258-BA01 on fee")
+}
@@ -78,7 +78,8 @@ func (c *StoreConfig) Valid() error {
 
 // AgentConfig is exported
 type AgentConfig struct {
-	JoinAddrs []string `json:"join_addrs"`
+	JoinAddrs    []string `json:"join_addrs"`
+	AdbSimulator int      `json:"adb_simulator"` // nb of virtual devices on in-memory adb simulator, 0 means using the real adb host
 }
 
 // Valid is exported
@@ -94,5 +95,9 @@ func (c *AgentConfig) Valid() error {
 		}
 	}
 
+	if c.AdbSimulator < 0 {
+		return errors.New("adb simulator devices number can't be negative")
+	}
+
 	return nil
 }
@@ -71,4 +71,7 @@ type AdbOrderStatistics struct {
 	PendingBill float64 `json:"pending_bill"`
 	Timeout     int     `json:"timeout"`
 	TimeoutBill float64 `json:"timeout_bill"`
+
+	PaidAfterTimeout     int     `json:"paid_after_timeout"`
+	PaidAfterTimeoutBill float64 `json:"paid_after_timeout_bill"`
 }
@@ -0,0 +1,209 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bbklab/adbot/pkg/validator"
+)
+
+// nolint
+var (
+	DefaultMerchantID = "default" // migrated from the single paygate secret, serves the paygate requests without app id
+)
+
+// Merchant is a db paygate merchant
+type Merchant struct {
+	ID              string    `json:"id" bson:"id"`                             // merchant id, as the app id of the paygate requests, uniq
+	Name            string    `json:"name" bson:"name"`                         // uniq
+	Secret          string    `json:"secret" bson:"secret"`                     // paygate signature secret key
+	NotifyURL       string    `json:"notify_url" bson:"notify_url"`             // default notify url if the order request not provided
+	QRTypes         []string  `json:"qrtypes" bson:"qrtypes"`                   // allowed qrcode types, empty means all
+	MinFee          int       `json:"min_fee" bson:"min_fee"`                   // min order fee by CNY cent, 0 means unlimit
+	MaxFee          int       `json:"max_fee" bson:"max_fee"`                   // max order fee by CNY cent, 0 means unlimit
+	Devices         []string  `json:"devices" bson:"devices"`                   // dedicated adb device pool, empty means the shared pool
+	PickupStrategy  string    `json:"pickup_strategy" bson:"pickup_strategy"`   // adb device pickup strategy, empty means the global settings
+	SignLegacy      bool      `json:"sign_legacy" bson:"sign_legacy"`           // accept the legacy MD5 signature during the migration
+	SignLegacyV2    bool      `json:"sign_legacy_v2" bson:"sign_legacy_v2"`     // the legacy MD5 callback signature covers the order status, opt-in
+	CallbackBackoff string    `json:"callback_backoff" bson:"callback_backoff"` // callback failure retry backoff, eg: 10s,30s,2m, empty means default
+	OrderTTL        int       `json:"order_ttl" bson:"order_ttl"`               // default order ttl in seconds if the order request not provided, 0 means default
+	DeviceHold      int       `json:"device_hold" bson:"device_hold"`           // seconds the timeout order keeps holding its payable amount on the device, 0 means never
+	Disabled        bool      `json:"disabled" bson:"disabled"`                 // disabled merchant can't create new orders
+	Desc            string    `json:"desc" bson:"desc"`                         // description text
+	CreatedAt       time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Valid is exported
+func (m *Merchant) Valid() error {
+	if err := validator.String(m.ID, 2, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("merchant id %v", err)
+	}
+	if err := validator.String(m.Name, 2, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("merchant name %v", err)
+	}
+	if err := validator.String(m.Secret, 16, 64, validator.NormalCharacters); err != nil {
+		return fmt.Errorf("merchant secret %v", err)
+	}
+	if err := validNotifyURL(m.NotifyURL); err != nil {
+		return err
+	}
+	for _, typ := range m.QRTypes {
+		switch typ {
+		case QRCodeTypeAlipay, QRCodeTypeWxpay:
+		default:
+			return fmt.Errorf("qrcode type %s unrecoginized", typ)
+		}
+	}
+	if m.MinFee < 0 || m.MaxFee < 0 {
+		return errors.New("merchant fee limit can't be negative")
+	}
+	if m.MaxFee > 0 && m.MinFee > m.MaxFee {
+		return errors.New("merchant min fee can't be greater than max fee")
+	}
+	if err := ValidPickupStrategy(m.PickupStrategy); err != nil {
+		return err
+	}
+	if _, err := ParseCallbackBackoff(m.CallbackBackoff); err != nil {
+		return err
+	}
+	if m.OrderTTL != 0 {
+		if err := ValidAdbOrderTTL(m.OrderTTL); err != nil {
+			return err
+		}
+	}
+	if err := validator.Int(m.DeviceHold, 0, int(MaxAdbDeviceHold.Seconds())); err != nil {
+		return fmt.Errorf("device hold %v", err)
+	}
+	if err := validator.String(m.Desc, -1, 1024, nil); err != nil {
+		return fmt.Errorf("merchant desc %v", err)
+	}
+	return nil
+}
+
+// Allow verify the order request against the merchant qrcode types & fee limits
+func (m *Merchant) Allow(req *NewAdbOrderReq) error {
+	if m.Disabled {
+		return errors.New("merchant disabled")
+	}
+	if len(m.QRTypes) > 0 {
+		var allowed bool
+		for _, typ := range m.QRTypes {
+			if typ == req.QRType {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("qrcode type %s not allowed", req.QRType)
+		}
+	}
+	if m.MinFee > 0 && req.Fee < m.MinFee {
+		return fmt.Errorf("fee less than the merchant min fee %d", m.MinFee)
+	}
+	if m.MaxFee > 0 && req.Fee > m.MaxFee {
+		return fmt.Errorf("fee greater than the merchant max fee %d", m.MaxFee)
+	}
+	return nil
+}
+
+// Backoff return the callback failure retry backoff of the merchant
+func (m *Merchant) Backoff() []time.Duration {
+	if m.CallbackBackoff == "" {
+		return AdbOrderCallbackBackoff
+	}
+	backoff, err := ParseCallbackBackoff(m.CallbackBackoff)
+	if err != nil {
+		return AdbOrderCallbackBackoff
+	}
+	return backoff
+}
+
+// TTL return the order ttl of the order request, fall back to the merchant ttl, then the default
+func (m *Merchant) TTL(req *NewAdbOrderReq) time.Duration {
+	if req.TTL > 0 {
+		return time.Duration(req.TTL) * time.Second
+	}
+	if m.OrderTTL > 0 {
+		return time.Duration(m.OrderTTL) * time.Second
+	}
+	return AdbOrderTimeout
+}
+
+// Hidden set the merchant secret as invisible
+func (m *Merchant) Hidden() {
+	if m.Secret != "" {
+		m.Secret = SensitiveHolder
+	}
+}
+
+// MerchantWrapper is a wrapper of db merchant with related adb orders statistics
+type MerchantWrapper struct {
+	*Merchant
+	RecentAdbOrders RecentAdbOrders `json:"recent_adb_orders"`
+}
+
+// UpdateMerchantReq is similar to types.Merchant, but all changable fields are pointer type
+type UpdateMerchantReq struct {
+	Name            *string   `json:"name"`
+	NotifyURL       *string   `json:"notify_url"`
+	QRTypes         *[]string `json:"qrtypes"`
+	MinFee          *int      `json:"min_fee"`
+	MaxFee          *int      `json:"max_fee"`
+	Devices         *[]string `json:"devices"`
+	PickupStrategy  *string   `json:"pickup_strategy"`
+	SignLegacy      *bool     `json:"sign_legacy"`
+	SignLegacyV2    *bool     `json:"sign_legacy_v2"`
+	CallbackBackoff *string   `json:"callback_backoff"`
+	OrderTTL        *int      `json:"order_ttl"`
+	DeviceHold      *int      `json:"device_hold"`
+	Disabled        *bool     `json:"disabled"`
+	Desc            *string   `json:"desc"`
+}
+
+// Apply apply the non-nil fields on the merchant
+func (req *UpdateMerchantReq) Apply(m *Merchant) {
+	if req.Name != nil {
+		m.Name = *req.Name
+	}
+	if req.NotifyURL != nil {
+		m.NotifyURL = *req.NotifyURL
+	}
+	if req.QRTypes != nil {
+		m.QRTypes = *req.QRTypes
+	}
+	if req.MinFee != nil {
+		m.MinFee = *req.MinFee
+	}
+	if req.MaxFee != nil {
+		m.MaxFee = *req.MaxFee
+	}
+	if req.Devices != nil {
+		m.Devices = *req.Devices
+	}
+	if req.PickupStrategy != nil {
+		m.PickupStrategy = *req.PickupStrategy
+	}
+	if req.SignLegacy != nil {
+		m.SignLegacy = *req.SignLegacy
+	}
+	if req.SignLegacyV2 != nil {
+		m.SignLegacyV2 = *req.SignLegacyV2
+	}
+	if req.CallbackBackoff != nil {
+		m.CallbackBackoff = *req.CallbackBackoff
+	}
+	if req.OrderTTL != nil {
+		m.OrderTTL = *req.OrderTTL
+	}
+	if req.DeviceHold != nil {
+		m.DeviceHold = *req.DeviceHold
+	}
+	if req.Disabled != nil {
+		m.Disabled = *req.Disabled
+	}
+	if req.Desc != nil {
+		m.Desc = *req.Desc
+	}
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	check "gopkg.in/check.v1"
+
+	"github.com/bbklab/adbot/pkg/label"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(new(merchantSuite))
+
+type merchantSuite struct{}
+
+func (s *merchantSuite) merchant() *Merchant {
+	return &Merchant{
+		ID:     "shop01",
+		Name:   "shop01",
+		Secret: "4f6168398ae711eb24f72fb86638796f",
+	}
+}
+
+func (s *merchantSuite) TestOrderTTL(c *check.C) {
+	var (
+		merchant = s.merchant()
+		req      = &NewAdbOrderReq{}
+	)
+
+	c.Assert(merchant.TTL(req), check.Equals, AdbOrderTimeout)
+
+	merchant.OrderTTL = 600
+	c.Assert(merchant.TTL(req), check.Equals, time.Minute*10)
+
+	req.TTL = 120
+	c.Assert(merchant.TTL(req), check.Equals, time.Minute*2)
+
+	for ttl, valid := range map[int]bool{
+		119: false,
+		120: true,
+		300: true,
+		900: true,
+		901: false,
+		-1:  false,
+	} {
+		c.Assert(ValidAdbOrderTTL(ttl) == nil, check.Equals, valid, check.Commentf("ttl %d", ttl))
+	}
+}
+
+func (s *merchantSuite) TestValidOrderTTLAndDeviceHold(c *check.C) {
+	merchant := s.merchant()
+	c.Assert(merchant.Valid(), check.IsNil) // 0 means default ttl & never hold
+
+	merchant.OrderTTL = 60
+	c.Assert(merchant.Valid(), check.NotNil)
+	merchant.OrderTTL = 900
+	c.Assert(merchant.Valid(), check.IsNil)
+
+	merchant.DeviceHold = -1
+	c.Assert(merchant.Valid(), check.NotNil)
+	merchant.DeviceHold = int(MaxAdbDeviceHold.Seconds()) + 1
+	c.Assert(merchant.Valid(), check.NotNil)
+	merchant.DeviceHold = 600
+	c.Assert(merchant.Valid(), check.IsNil)
+}
+
+func (s *merchantSuite) TestOrderDeadline(c *check.C) {
+	createdAt := time.Date(2019, 6, 20, 18, 32, 58, 0, time.Local)
+
+	legacy := &AdbOrder{CreatedAt: createdAt}
+	c.Assert(legacy.Deadline().Equal(createdAt.Add(AdbOrderTimeout)), check.Equals, true)
+
+	order := &AdbOrder{CreatedAt: createdAt, ExpireAt: createdAt.Add(time.Minute * 2)}
+	c.Assert(order.Deadline().Equal(createdAt.Add(time.Minute*2)), check.Equals, true)
+}
+
+func (s *merchantSuite) TestSignOrderTTL(c *check.C) {
+	req := &NewAdbOrderReq{OutOrderID: "000082", QRType: QRCodeTypeAlipay, Fee: 19, Sign: "x"}
+	c.Assert(req.SignParams().Get("ttl"), check.Equals, "") // not provided, not signed
+	c.Assert(req.Valid(), check.IsNil)
+
+	req.TTL = 600
+	c.Assert(req.SignParams().Get("ttl"), check.Equals, "600")
+	c.Assert(req.Valid(), check.IsNil)
+
+	req.TTL = 30
+	c.Assert(req.Valid(), check.NotNil)
+}
+
+func (s *merchantSuite) TestPaygateSignLegacy(c *check.C) {
+	settings := &Settings{GlobalAttrs: label.New(nil)}
+	c.Assert(settings.PaygateSignLegacy(), check.Equals, false) // fresh install
+
+	settings.GlobalAttrs.Set(GlobalAttrPaygateSecretKey, "secret01") // upgrading
+	c.Assert(settings.PaygateSignLegacy(), check.Equals, true)
+
+	settings.GlobalAttrs.Set(GlobalAttrPaygateSignLegacy, "false")
+	c.Assert(settings.PaygateSignLegacy(), check.Equals, false)
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// nolint
+var (
+	PickupStrategyWeight        = "weight"         // weighted random, default
+	PickupStrategyRoundRobin    = "round-robin"    // smooth weighted round-robin
+	PickupStrategyLeastPending  = "least-pending"  // the least pending orders
+	PickupStrategyQuotaHeadroom = "quota-headroom" // the most today quota headroom
+	PickupStrategySuccessRate   = "success-rate"   // weighted random by the weight * recent success rate
+	PickupStrategyStickyPayer   = "sticky-payer"   // the same device as the payer's last order, fall back to weighted random
+
+	PickupStrategies = []string{
+		PickupStrategyWeight,
+		PickupStrategyRoundRobin,
+		PickupStrategyLeastPending,
+		PickupStrategyQuotaHeadroom,
+		PickupStrategySuccessRate,
+		PickupStrategyStickyPayer,
+	}
+
+	PickupSuccessRateWindow = time.Hour * 24 // the recent orders window of the success rate
+)
+
+// ValidPickupStrategy verify the pickup strategy name, the empty name means the default
+func ValidPickupStrategy(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, strategy := range PickupStrategies {
+		if name == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("pickup strategy %s unrecoginized, must be one of %v", name, PickupStrategies)
+}
+
+// AdbDevicePickup is the decision trace of picking up the adb device for an adb order
+type AdbDevicePickup struct {
+	Strategy   string             `json:"strategy" bson:"strategy"`     // the pickup strategy name
+	Source     string             `json:"source" bson:"source"`         // where the strategy comes from: merchant, settings, default
+	DeviceID   string             `json:"device_id" bson:"device_id"`   // the chosen adb device
+	PayFee     int                `json:"pay_fee" bson:"pay_fee"`       // the uniq payable amount on the chosen adb device
+	Reason     string             `json:"reason" bson:"reason"`         // why the device was chosen
+	Candidates []*PickupCandidate `json:"candidates" bson:"candidates"` // all of the candidate devices with the metrics
+	Time       time.Time          `json:"time" bson:"time"`
+}
+
+// PickupCandidate is a candidate adb device with the metrics while picking up
+type PickupCandidate struct {
+	DeviceID    string  `json:"device_id" bson:"device_id"`
+	Weight      int     `json:"weight" bson:"weight"`             // device weight
+	Pending     int     `json:"pending" bson:"pending"`           // nb of pending orders
+	Holding     int     `json:"holding" bson:"holding"`           // nb of timeout orders still holding the payable amounts within the device hold
+	SamePending int     `json:"same_pending" bson:"same_pending"` // nb of pending orders with the same qrcode type & payable amount
+	PayFee      int     `json:"pay_fee" bson:"pay_fee"`           // the uniq payable amount on the device, 0 if none within the offset
+	Headroom    float64 `json:"headroom" bson:"headroom"`         // today quota headroom [0-1], 1 means unlimit
+	SuccessRate float64 `json:"success_rate" bson:"success_rate"` // recent paid rate [0-1]
+	Score       float64 `json:"score" bson:"score"`               // the strategy score if any
+	Excluded    string  `json:"excluded" bson:"excluded"`         // the excluded reason if any
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"time"
+
+	"github.com/bbklab/adbot/pkg/adbot"
+)
+
+// nolint
+var (
+	AdbReconcileStatusRunning = "running"
+	AdbReconcileStatusDone    = "done"
+	AdbReconcileStatusFailed  = "failed"
+)
+
+// nolint
+var (
+	AdbReconcileIssueUnmatchedBill  = "unmatched_bill"   // incoming payment bill without any matched order
+	AdbReconcileIssueMissingBill    = "missing_bill"     // order marked as paid but no bill found
+	AdbReconcileIssueAmountMismatch = "amount_mismatch"  // bill amount differs from the order payable amount
+	AdbReconcileIssueUnpaidWithBill = "unpaid_with_bill" // bill found but the order is not marked as paid
+)
+
+// AdbReconcile is a db daily reconciliation report of the device bills against the adb orders
+type AdbReconcile struct {
+	ID         string                `json:"id" bson:"id"`         // the reconciled day, eg: 2019-06-10, uniq
+	Status     string                `json:"status" bson:"status"` // running, done, failed
+	ErrMsg     string                `json:"errmsg" bson:"errmsg"` // failure reason if failed
+	Devices    []*AdbReconcileDevice `json:"devices" bson:"devices"`
+	NumBills   int                   `json:"num_bills" bson:"num_bills"`   // total bills of all devices
+	NumOrders  int                   `json:"num_orders" bson:"num_orders"` // total reconciled orders of all devices
+	NumIssues  int                   `json:"num_issues" bson:"num_issues"` // total issues of all devices
+	NumErrors  int                   `json:"num_errors" bson:"num_errors"` // total devices failed to list the bills
+	CreatedAt  time.Time             `json:"created_at" bson:"created_at"`
+	FinishedAt time.Time             `json:"finished_at" bson:"finished_at"`
+}
+
+// AdbReconcileDevice is the reconciliation of one payment app on one adb device
+type AdbReconcileDevice struct {
+	DeviceID  string               `json:"device_id" bson:"device_id"`
+	NodeID    string               `json:"node_id" bson:"node_id"`
+	App       string               `json:"app" bson:"app"`             // payment app, same as the qrcode type
+	NumBills  int                  `json:"num_bills" bson:"num_bills"` // bills listed on the device
+	BillFee   int                  `json:"bill_fee" bson:"bill_fee"`   // total bill amount by CNY cent
+	NumOrders int                  `json:"num_orders" bson:"num_orders"`
+	NumPaid   int                  `json:"num_paid" bson:"num_paid"` // orders marked as paid
+	PaidFee   int                  `json:"paid_fee" bson:"paid_fee"` // total payable amount of the paid orders by CNY cent
+	Issues    []*AdbReconcileIssue `json:"issues" bson:"issues"`
+	Error     string               `json:"error" bson:"error"` // failure reason if the bills couldn't be listed
+}
+
+// AdbReconcileIssue is one mismatch between the device bills and the adb orders
+type AdbReconcileIssue struct {
+	Type        string          `json:"type" bson:"type"`
+	OrderID     string          `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	OrderStatus string          `json:"order_status,omitempty" bson:"order_status,omitempty"`
+	OrderFee    int             `json:"order_fee,omitempty" bson:"order_fee,omitempty"` // order payable amount by CNY cent
+	Bill        *adbot.PayOrder `json:"bill,omitempty" bson:"bill,omitempty"`
+	Message     string          `json:"message" bson:"message"`
+}
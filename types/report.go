@@ -0,0 +1,113 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// nolint
+var (
+	AdbOrderReportByDay      = "day"      // by the local created day of the orders
+	AdbOrderReportByDevice   = "device"   // by the adb device
+	AdbOrderReportByAlipay   = "alipay"   // by the payee alipay account stored on the order, alipay orders only
+	AdbOrderReportByMerchant = "merchant" // by the paygate merchant
+)
+
+// ValidAdbOrderReportGroupBy verify the settlement report group by
+func ValidAdbOrderReportGroupBy(groupBy string) error {
+	switch groupBy {
+	case AdbOrderReportByDay, AdbOrderReportByDevice, AdbOrderReportByAlipay, AdbOrderReportByMerchant:
+		return nil
+	}
+	return fmt.Errorf("report group by %s unrecoginized", groupBy)
+}
+
+// AdbOrderReport is the settlement report of the adb orders within a time range
+type AdbOrderReport struct {
+	GroupBy string               `json:"group_by"`
+	StartAt time.Time            `json:"start_at"` // zero means unlimit
+	EndAt   time.Time            `json:"end_at"`   // zero means unlimit
+	Rows    []*AdbOrderReportRow `json:"rows"`     // sorted by the group key
+	Total   *AdbOrderReportRow   `json:"total"`    // the totals of all rows
+}
+
+// AdbOrderReportRow is the settlement of one group of the adb orders
+type AdbOrderReportRow struct {
+	Key              string  `json:"key"`                // group key: day, device id, alipay user id, merchant id
+	Name             string  `json:"name"`               // readable group name: device desc, alipay username, merchant name
+	Orders           int     `json:"orders"`             // total orders
+	Paid             int     `json:"paid"`               // paid orders
+	PaidAfterTimeout int     `json:"paid_after_timeout"` // late paid orders
+	Pending          int     `json:"pending"`
+	Timeout          int     `json:"timeout"`
+	Closed           int     `json:"closed"`
+	Fee              int     `json:"fee"`             // total order fee by CNY cent
+	PaidFee          int     `json:"paid_fee"`        // total payable amount of the paid & late paid orders by CNY cent
+	SuccessRate      float64 `json:"success_rate"`    // (paid + paid_after_timeout) / (orders - pending)
+	AvgPaySeconds    float64 `json:"avg_pay_seconds"` // average time to pay of the paid & late paid orders
+
+	paidTime time.Duration // total time to pay, to calculate the average
+}
+
+// NewAdbOrderReportRow is exported
+func NewAdbOrderReportRow(key, name string) *AdbOrderReportRow {
+	return &AdbOrderReportRow{Key: key, Name: name}
+}
+
+// Add count the order into the row
+func (r *AdbOrderReportRow) Add(order *AdbOrder) {
+	r.Orders++
+	r.Fee += order.Fee
+
+	switch order.Status {
+	case AdbOrderStatusPaid, AdbOrderStatusPaidAfterTimeout:
+		if order.Status == AdbOrderStatusPaid {
+			r.Paid++
+		} else {
+			r.PaidAfterTimeout++
+		}
+		r.PaidFee += order.Payable()
+		if !order.PaidAt.IsZero() && order.PaidAt.After(order.CreatedAt) {
+			r.paidTime += order.PaidAt.Sub(order.CreatedAt)
+		}
+	case AdbOrderStatusPending:
+		r.Pending++
+	case AdbOrderStatusTimeout:
+		r.Timeout++
+	case AdbOrderStatusClosed:
+		r.Closed++
+	}
+}
+
+// Merge count the other row into the row
+func (r *AdbOrderReportRow) Merge(o *AdbOrderReportRow) {
+	r.Orders += o.Orders
+	r.Paid += o.Paid
+	r.PaidAfterTimeout += o.PaidAfterTimeout
+	r.Pending += o.Pending
+	r.Timeout += o.Timeout
+	r.Closed += o.Closed
+	r.Fee += o.Fee
+	r.PaidFee += o.PaidFee
+	r.paidTime += o.paidTime
+}
+
+// Settle calculate the success rate & average time to pay
+func (r *AdbOrderReportRow) Settle() {
+	r.SuccessRate, r.AvgPaySeconds = 0, 0
+	if n := r.Orders - r.Pending; n > 0 {
+		r.SuccessRate = float64(r.Paid+r.PaidAfterTimeout) / float64(n)
+	}
+	if n := r.Paid + r.PaidAfterTimeout; n > 0 {
+		r.AvgPaySeconds = r.paidTime.Seconds() / float64(n)
+	}
+}
+
+// AdbOrderReportFilter is the orders filter of the reports, empty fields mean unlimit
+type AdbOrderReportFilter struct {
+	StartAt    time.Time // created time range
+	EndAt      time.Time
+	MerchantID string
+	DeviceID   string
+	Status     string
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(reportSuite))
+
+type reportSuite struct{}
+
+func (s *reportSuite) TestReportRow(c *check.C) {
+	var (
+		created = time.Date(2019, 6, 17, 11, 9, 14, 0, time.Local)
+		row     = NewAdbOrderReportRow("2019-06-17", "2019-06-17")
+	)
+
+	for _, order := range []*AdbOrder{
+		{Status: AdbOrderStatusPaid, PayFee: 9999, NewAdbOrderReq: NewAdbOrderReq{Fee: 10000}, CreatedAt: created, PaidAt: created.Add(time.Second * 40)},
+		{Status: AdbOrderStatusPaidAfterTimeout, NewAdbOrderReq: NewAdbOrderReq{Fee: 500}, CreatedAt: created, PaidAt: created.Add(time.Second * 80)}, // legacy without pay fee
+		{Status: AdbOrderStatusPaid, NewAdbOrderReq: NewAdbOrderReq{Fee: 100}, CreatedAt: created},                                                    // paid time unknown
+		{Status: AdbOrderStatusPending, NewAdbOrderReq: NewAdbOrderReq{Fee: 100}, CreatedAt: created},
+		{Status: AdbOrderStatusTimeout, NewAdbOrderReq: NewAdbOrderReq{Fee: 100}, CreatedAt: created},
+		{Status: AdbOrderStatusClosed, NewAdbOrderReq: NewAdbOrderReq{Fee: 100}, CreatedAt: created},
+		{Status: AdbOrderStatusVoid, NewAdbOrderReq: NewAdbOrderReq{Fee: 100}, CreatedAt: created},
+	} {
+		row.Add(order)
+	}
+	row.Settle()
+
+	c.Assert([]int{row.Orders, row.Paid, row.PaidAfterTimeout, row.Pending, row.Timeout, row.Closed}, check.DeepEquals, []int{7, 2, 1, 1, 1, 1})
+	c.Assert(row.Fee, check.Equals, 11000)
+	c.Assert(row.PaidFee, check.Equals, 10599)
+	c.Assert(row.SuccessRate, check.Equals, 0.5)
+	c.Assert(row.AvgPaySeconds, check.Equals, float64(40))
+
+	total := NewAdbOrderReportRow("total", "")
+	total.Merge(row)
+	total.Merge(row)
+	total.Settle()
+	c.Assert(total.Orders, check.Equals, 14)
+	c.Assert(total.PaidFee, check.Equals, 21198)
+	c.Assert(total.SuccessRate, check.Equals, 0.5)
+	c.Assert(total.AvgPaySeconds, check.Equals, float64(40))
+
+	empty := NewAdbOrderReportRow("empty", "")
+	empty.Add(&AdbOrder{Status: AdbOrderStatusPending})
+	empty.Settle()
+	c.Assert(empty.SuccessRate, check.Equals, float64(0))
+	c.Assert(empty.AvgPaySeconds, check.Equals, float64(0))
+}
+
+func (s *reportSuite) TestMerchantOrDefault(c *check.C) {
+	c.Assert((&AdbOrder{MerchantID: "shop01"}).MerchantOrDefault(), check.Equals, "shop01")
+	c.Assert((&AdbOrder{}).MerchantOrDefault(), check.Equals, DefaultMerchantID)
+}
@@ -2,11 +2,13 @@ package types
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/bbklab/adbot/pkg/label"
+	"github.com/bbklab/adbot/pkg/validator"
 )
 
 var (
@@ -17,7 +19,9 @@ var (
 
 // nolint
 var (
-	GlobalAttrPaygateSecretKey = "com_adbbot_paygate_secret"
+	GlobalAttrPaygateSecretKey       = "com_adbbot_paygate_secret"
+	GlobalAttrPaygateCallbackBackoff = "com_adbbot_paygate_callback_backoff" // eg: 10s,30s,2m,5m,15m
+	GlobalAttrPaygateSignLegacy      = "com_adbbot_paygate_sign_legacy"      // accept the legacy MD5 signature or not, default true while upgrading
 )
 
 var (
@@ -40,6 +44,10 @@ type Settings struct {
 	EnableHTTPMuxDebug bool         `json:"enable_httpmux_debug" bson:"enable_httpmux_debug"` // enable httpmux debug or not
 	UnmarkSensitive    bool         `json:"unmask_sensitive" bson:"unmask_sensitive"`         // uncover the sensitive fields, eg: ssh password, access key, etc
 	TGBotToken         string       `json:"tg_bot_token" bson:"tg_bot_token"`                 // telegram bot token
+	TGChatID           int64        `json:"tg_chat_id" bson:"tg_chat_id"`                     // telegram chat to push the reports, eg: the daily reconciliation, 0 means never
+	PickupStrategy     string       `json:"pickup_strategy" bson:"pickup_strategy"`           // paygate adb device pickup strategy, empty means weight
+	PayFeeOffset       int          `json:"pay_fee_offset" bson:"pay_fee_offset"`             // max cents to reduce the payable amount to keep it uniq on the device, 0 means never
+	CashierBaseURL     string       `json:"cashier_base_url" bson:"cashier_base_url"`         // external base url of the hosted cashier pages, eg: https://pay.example.com, empty means by the paygate request host
 	GlobalAttrs        label.Labels `json:"global_attrs" bson:"global_attrs"`                 // user customized kv, we just treat it as general label kv
 	UpdatedAt          time.Time    `json:"updated_at" bson:"updated_at"`
 	Initial            bool         `json:"initial" bson:"initial"`
@@ -52,12 +60,27 @@ func (s *Settings) Hidden() {
 	}
 }
 
+// PaygateSignLegacy return whether the migrated default merchant accepts the legacy MD5 signature,
+// default true only while upgrading the paygate served by the legacy secret, false for the fresh installs
+func (s *Settings) PaygateSignLegacy() bool {
+	val := s.GlobalAttrs.Get(GlobalAttrPaygateSignLegacy)
+	if val == "" {
+		return s.GlobalAttrs.Get(GlobalAttrPaygateSecretKey) != ""
+	}
+	legacy, _ := strconv.ParseBool(val)
+	return legacy
+}
+
 // UpdateSettingsReq is similar to types.Settings, but all changable fields are pointer type
 type UpdateSettingsReq struct {
 	LogLevel           *string `json:"log_level"`
 	EnableHTTPMuxDebug *bool   `json:"enable_httpmux_debug"`
 	UnmarkSensitive    *bool   `json:"unmask_sensitive"`
 	TGBotToken         *string `json:"tg_bot_token"`
+	TGChatID           *int64  `json:"tg_chat_id"`
+	PickupStrategy     *string `json:"pickup_strategy"`
+	PayFeeOffset       *int    `json:"pay_fee_offset"`
+	CashierBaseURL     *string `json:"cashier_base_url"`
 }
 
 // Valid verify the UpdateSettingsReq
@@ -72,5 +95,20 @@ func (req *UpdateSettingsReq) Valid() error {
 			return fmt.Errorf("tg bot token required")
 		}
 	}
+	if req.PickupStrategy != nil {
+		if err := ValidPickupStrategy(*req.PickupStrategy); err != nil {
+			return err
+		}
+	}
+	if req.PayFeeOffset != nil {
+		if err := validator.Int(*req.PayFeeOffset, 0, MaxPayFeeOffset); err != nil {
+			return fmt.Errorf("pay fee offset: %v", err)
+		}
+	}
+	if req.CashierBaseURL != nil {
+		if err := validHTTPURL("cashier base url", *req.CashierBaseURL, 256); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,140 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// nolint
+var (
+	StatsGranularityMinute = "minute"
+	StatsGranularityHour   = "hour"
+	StatsGranularityDay    = "day" // by the local day
+
+	StatsDimensionAll      = "all"      // all of the orders, the key is empty
+	StatsDimensionDevice   = "device"   // by the adb device id
+	StatsDimensionNode     = "node"     // by the adb node id
+	StatsDimensionMerchant = "merchant" // by the merchant id, the legacy orders belong to the default merchant
+
+	StatsDimensions = []string{StatsDimensionAll, StatsDimensionDevice, StatsDimensionNode, StatsDimensionMerchant}
+
+	// the bucket size & the rollups retention of each granularity, 0 means forever
+	StatsGranularities = map[string]struct{ Bucket, Retention time.Duration }{
+		StatsGranularityMinute: {time.Minute, time.Hour * 24 * 7},
+		StatsGranularityHour:   {time.Hour, time.Hour * 24 * 90},
+		StatsGranularityDay:    {time.Hour * 24, 0},
+	}
+
+	MaxStatsBuckets = 2000 // max buckets of one stats query
+)
+
+// ValidStatsGranularity is exported
+func ValidStatsGranularity(granularity string) error {
+	if _, ok := StatsGranularities[granularity]; !ok {
+		return fmt.Errorf("stats granularity %s unrecoginized", granularity)
+	}
+	return nil
+}
+
+// StatsBucketOf return the bucket start time of the given time by the granularity,
+// the day bucket starts at the local midnight
+func StatsBucketOf(granularity string, t time.Time) time.Time {
+	if granularity == StatsGranularityDay {
+		t = t.In(time.Local)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	}
+	return t.Truncate(StatsGranularities[granularity].Bucket)
+}
+
+// StatsBucketEnd return the end time of the bucket which the given time belongs to,
+// the day bucket ends at the next local midnight
+func StatsBucketEnd(granularity string, t time.Time) time.Time {
+	start := StatsBucketOf(granularity, t)
+	if granularity == StatsGranularityDay {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(StatsGranularities[granularity].Bucket)
+}
+
+// AdbOrderStats is a db rollup of the adb orders created within one time bucket
+type AdbOrderStats struct {
+	Granularity         string     `json:"granularity" bson:"granularity"` // minute, hour, day
+	Dimension           string     `json:"dimension" bson:"dimension"`     // all, device, node, merchant
+	Key                 string     `json:"key" bson:"key"`                 // the device, node or merchant id, empty for all
+	Time                time.Time  `json:"time" bson:"time"`               // the bucket start time
+	Orders              int        `json:"orders" bson:"orders"`
+	Paid                int        `json:"paid" bson:"paid"`
+	PaidAfterTimeout    int        `json:"paid_after_timeout" bson:"paid_after_timeout"`
+	Pending             int        `json:"pending" bson:"pending"`
+	Timeout             int        `json:"timeout" bson:"timeout"`
+	Closed              int        `json:"closed" bson:"closed"`
+	Fee                 int        `json:"fee" bson:"fee"`                                     // total order fee by CNY cent
+	PaidFee             int        `json:"paid_fee" bson:"paid_fee"`                           // total payable amount of the paid & late paid orders by CNY cent
+	CallbackSucceed     int        `json:"callback_succeed" bson:"callback_succeed"`           // orders with the callback delivered
+	CallbackDead        int        `json:"callback_dead" bson:"callback_dead"`                 // orders with the callback dead
+	PaidRate            float64    `json:"paid_rate" bson:"paid_rate"`                         // (paid + paid_after_timeout) / (orders - pending)
+	CallbackSuccessRate float64    `json:"callback_success_rate" bson:"callback_success_rate"` // callback_succeed / (callback_succeed + callback_dead)
+	UpdatedAt           time.Time  `json:"updated_at" bson:"updated_at"`
+	ExpireAt            *time.Time `json:"-" bson:"expire_at,omitempty"` // mongo ttl, nil means forever
+}
+
+// Add accumulate the counters of another rollup, the rates are left to Settle
+func (s *AdbOrderStats) Add(o *AdbOrderStats) {
+	s.Orders += o.Orders
+	s.Paid += o.Paid
+	s.PaidAfterTimeout += o.PaidAfterTimeout
+	s.Pending += o.Pending
+	s.Timeout += o.Timeout
+	s.Closed += o.Closed
+	s.Fee += o.Fee
+	s.PaidFee += o.PaidFee
+	s.CallbackSucceed += o.CallbackSucceed
+	s.CallbackDead += o.CallbackDead
+}
+
+// SumAdbOrderStats sum the finer rollups up into the settled rollups of the coarser
+// granularity, by the dimension, the key & the bucket, in the order of first seen
+func SumAdbOrderStats(granularity string, stats []*AdbOrderStats) []*AdbOrderStats {
+	type bucketKey struct {
+		dimension, key string
+		time           int64 // note: not by time.Time, whose location is compared as well
+	}
+
+	var (
+		ret  = make([]*AdbOrderStats, 0)
+		sums = make(map[bucketKey]*AdbOrderStats)
+	)
+	for _, stat := range stats {
+		bucket := StatsBucketOf(granularity, stat.Time)
+		bk := bucketKey{stat.Dimension, stat.Key, bucket.UnixNano()}
+		sum, ok := sums[bk]
+		if !ok {
+			sum = &AdbOrderStats{Granularity: granularity, Dimension: stat.Dimension, Key: stat.Key, Time: bucket}
+			sums[bk] = sum
+			ret = append(ret, sum)
+		}
+		sum.Add(stat)
+	}
+
+	for _, sum := range ret {
+		sum.Settle()
+	}
+	return ret
+}
+
+// Settle calculate the rates & the expire time
+func (s *AdbOrderStats) Settle() {
+	s.PaidRate, s.CallbackSuccessRate = 0, 0
+	if n := s.Orders - s.Pending; n > 0 {
+		s.PaidRate = float64(s.Paid+s.PaidAfterTimeout) / float64(n)
+	}
+	if n := s.CallbackSucceed + s.CallbackDead; n > 0 {
+		s.CallbackSuccessRate = float64(s.CallbackSucceed) / float64(n)
+	}
+
+	s.ExpireAt = nil
+	if retention := StatsGranularities[s.Granularity].Retention; retention > 0 {
+		expireAt := s.Time.Add(retention)
+		s.ExpireAt = &expireAt
+	}
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(statsSuite))
+
+type statsSuite struct{}
+
+func (s *statsSuite) TestStatsBucket(c *check.C) {
+	t := time.Date(2019, 6, 17, 11, 42, 37, 5, time.Local)
+
+	c.Assert(StatsBucketOf(StatsGranularityMinute, t).Equal(time.Date(2019, 6, 17, 11, 42, 0, 0, time.Local)), check.Equals, true)
+	c.Assert(StatsBucketEnd(StatsGranularityMinute, t).Equal(time.Date(2019, 6, 17, 11, 43, 0, 0, time.Local)), check.Equals, true)
+	c.Assert(StatsBucketOf(StatsGranularityDay, t).Equal(time.Date(2019, 6, 17, 0, 0, 0, 0, time.Local)), check.Equals, true)
+	c.Assert(StatsBucketEnd(StatsGranularityDay, t).Equal(time.Date(2019, 6, 18, 0, 0, 0, 0, time.Local)), check.Equals, true)
+
+	// the day bucket is by the local midnight whatever the location of the given time
+	midnight := time.Date(2019, 6, 17, 0, 0, 0, 0, time.Local)
+	c.Assert(StatsBucketOf(StatsGranularityDay, midnight.UTC()).Equal(midnight), check.Equals, true)
+	c.Assert(StatsBucketOf(StatsGranularityDay, midnight.Add(-time.Nanosecond)).Equal(midnight.AddDate(0, 0, -1)), check.Equals, true)
+
+	// the bucket start is the end of the previous one
+	c.Assert(StatsBucketEnd(StatsGranularityHour, t.Add(-time.Hour)).Equal(StatsBucketOf(StatsGranularityHour, t)), check.Equals, true)
+}
+
+func (s *statsSuite) TestSettle(c *check.C) {
+	stat := &AdbOrderStats{Granularity: StatsGranularityMinute, Time: time.Unix(1560740520, 0), Orders: 10, Paid: 6, PaidAfterTimeout: 1, Pending: 3, CallbackSucceed: 3, CallbackDead: 1}
+	stat.Settle()
+	c.Assert(stat.PaidRate, check.Equals, float64(1))
+	c.Assert(stat.CallbackSuccessRate, check.Equals, 0.75)
+	c.Assert(stat.ExpireAt, check.NotNil)
+	c.Assert(stat.ExpireAt.Equal(stat.Time.Add(time.Hour*24*7)), check.Equals, true)
+
+	stat = &AdbOrderStats{Granularity: StatsGranularityDay, Orders: 2, Pending: 2}
+	stat.Settle()
+	c.Assert(stat.PaidRate, check.Equals, float64(0))
+	c.Assert(stat.CallbackSuccessRate, check.Equals, float64(0))
+	c.Assert(stat.ExpireAt, check.IsNil) // kept forever
+}
+
+func (s *statsSuite) TestSumAdbOrderStats(c *check.C) {
+	var (
+		hour  = time.Date(2019, 6, 17, 11, 0, 0, 0, time.Local)
+		stats = []*AdbOrderStats{
+			{Granularity: StatsGranularityMinute, Dimension: StatsDimensionAll, Time: hour.Add(time.Minute), Orders: 2, Paid: 1, Timeout: 1, Fee: 200, PaidFee: 99, CallbackSucceed: 1},
+			{Granularity: StatsGranularityMinute, Dimension: StatsDimensionDevice, Key: "dvc1", Time: hour.Add(time.Minute), Orders: 2, Paid: 1, Timeout: 1, Fee: 200, PaidFee: 99, CallbackSucceed: 1},
+			{Granularity: StatsGranularityMinute, Dimension: StatsDimensionAll, Time: hour.Add(time.Minute * 59).UTC(), Orders: 1, PaidAfterTimeout: 1, Fee: 100, PaidFee: 100, CallbackDead: 1},
+			{Granularity: StatsGranularityMinute, Dimension: StatsDimensionDevice, Key: "dvc2", Time: hour.Add(time.Minute * 59), Orders: 1, PaidAfterTimeout: 1, Fee: 100, PaidFee: 100, CallbackDead: 1},
+			{Granularity: StatsGranularityMinute, Dimension: StatsDimensionAll, Time: hour.Add(time.Hour), Orders: 1, Pending: 1, Fee: 100},
+		}
+	)
+
+	sums := SumAdbOrderStats(StatsGranularityHour, stats)
+	c.Assert(sums, check.HasLen, 4)
+
+	all := sums[0]
+	c.Assert(all.Granularity, check.Equals, StatsGranularityHour)
+	c.Assert(all.Dimension, check.Equals, StatsDimensionAll)
+	c.Assert(all.Time.Equal(hour), check.Equals, true)
+	c.Assert([]int{all.Orders, all.Paid, all.PaidAfterTimeout, all.Timeout, all.Fee, all.PaidFee, all.CallbackSucceed, all.CallbackDead}, check.DeepEquals, []int{3, 1, 1, 1, 300, 199, 1, 1})
+	c.Assert(all.PaidRate, check.Equals, float64(2)/float64(3))
+	c.Assert(all.CallbackSuccessRate, check.Equals, 0.5)
+	c.Assert(all.ExpireAt, check.NotNil)
+
+	c.Assert(sums[1].Key, check.Equals, "dvc1")
+	c.Assert(sums[1].Orders, check.Equals, 2)
+	c.Assert(sums[2].Key, check.Equals, "dvc2")
+	c.Assert(sums[2].PaidRate, check.Equals, float64(1))
+	c.Assert(sums[3].Time.Equal(hour.Add(time.Hour)), check.Equals, true)
+	c.Assert(sums[3].Pending, check.Equals, 1)
+
+	// the day rollups
+	sums = SumAdbOrderStats(StatsGranularityDay, sums)
+	c.Assert(sums, check.HasLen, 3)
+	c.Assert(sums[0].Orders, check.Equals, 4)
+	c.Assert(sums[0].ExpireAt, check.IsNil)
+}